@@ -0,0 +1,43 @@
+package sniffer
+
+// Aggregator groups the traffic of the connections into a view of its own, e.g. by
+// team, by SLO or by customer, along the processes, the remote addresses and the rest
+// of the snapshots. The connections it is given are the ones the builtin views count,
+// of the known processes within the loopback and scope settings.
+type Aggregator interface {
+	// Name names the view among the Views of the snapshots.
+	Name() string
+	// Group returns the group the traffic of the connection counts toward, false to
+	// leave the connection out of the view.
+	Group(conn Connection, info *ConnectionInfo) (string, bool)
+}
+
+// funcAggregator is an Aggregator grouping by a function.
+type funcAggregator struct {
+	name  string
+	group func(conn Connection, info *ConnectionInfo) (string, bool)
+}
+
+func (a funcAggregator) Name() string { return a.name }
+
+func (a funcAggregator) Group(conn Connection, info *ConnectionInfo) (string, bool) {
+	return a.group(conn, info)
+}
+
+// NewAggregator returns the Aggregator of the view grouping the connections by the
+// function.
+func NewAggregator(name string, group func(conn Connection, info *ConnectionInfo) (string, bool)) Aggregator {
+	return funcAggregator{name: name, group: group}
+}
+
+// AddAggregator counts the view of the aggregator in the snapshots from now on, the
+// aggregators added later replacing the ones of the same name.
+func (s *StatsManager) AddAggregator(a Aggregator) {
+	for i, existing := range s.aggregators {
+		if existing.Name() == a.Name() {
+			s.aggregators[i] = a
+			return
+		}
+	}
+	s.aggregators = append(s.aggregators, a)
+}
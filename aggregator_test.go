@@ -0,0 +1,51 @@
+package sniffer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator(t *testing.T) {
+	teams := map[string]string{"nginx": "web", "haproxy": "web", "postgres": "db"}
+	byTeam := NewAggregator("team", func(conn Connection, info *ConnectionInfo) (string, bool) {
+		team, ok := teams[info.Process.Name]
+		return team, ok
+	})
+	byPort := NewAggregator("port", func(conn Connection, info *ConnectionInfo) (string, bool) {
+		return "any", true
+	})
+
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: &ProcessInfo{Pid: 1, Name: "nginx"}, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2}}: {Process: &ProcessInfo{Pid: 2, Name: "haproxy"}, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3}}: {Process: &ProcessInfo{Pid: 3, Name: "postgres"}, UploadBytes: 200},
+		{Local: LocalSocket{Port: 4}}: {Process: &ProcessInfo{Pid: 4, Name: "sshd"}, UploadBytes: 100},
+		{Local: LocalSocket{Port: 5}}: {DownloadBytes: 50},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.AddAggregator(byTeam)
+	s.AddAggregator(byPort)
+	// the aggregators of the same name replace the earlier ones
+	s.AddAggregator(NewAggregator("port", func(conn Connection, info *ConnectionInfo) (string, bool) {
+		return strings.Repeat("p", int(conn.Local.Port)), true
+	}))
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.Views, 2)
+	web := snapshot.Views["team"]["web"]
+	assert.Equal(t, 2, web.ConnCount)
+	assert.Equal(t, 2000, web.UploadBytes)
+	assert.Equal(t, 1000, web.DownloadBytes)
+	assert.Len(t, snapshot.Views["team"], 2)
+	// the traffic of unknown processes is left out, as the builtin views do
+	assert.Len(t, snapshot.Views["port"], 4)
+
+	top := snapshot.TopNView("team", 1, ModeTableBytes)
+	assert.Equal(t, "web", top[0].Group)
+	assert.Nil(t, snapshot.TopNView("customer", 1, ModeTableBytes))
+}
@@ -0,0 +1,188 @@
+package sniffer
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// bandwidthLinger is how long the peak and the average rates of a connection or a
+// process are kept once it carries no traffic.
+const bandwidthLinger = 10 * time.Minute
+
+// Bandwidth is the peak and the average rates of a connection or a process since it
+// was first seen, the peak going by the busiest interval, along with the percentiles
+// of the rates of the intervals within the window of Options.PercentileWindow and the
+// rates of the latest intervals.
+type Bandwidth struct {
+	PeakUploadRate   float64 // Bytes per second uploaded over the busiest interval
+	PeakDownloadRate float64 // Bytes per second downloaded over the busiest interval
+	AvgUploadRate    float64 // Bytes per second uploaded since first seen
+	AvgDownloadRate  float64 // Bytes per second downloaded since first seen
+
+	UploadPercentiles   Percentiles
+	DownloadPercentiles Percentiles
+
+	// UploadHistory and DownloadHistory are the rates of the latest intervals since
+	// first seen, the oldest first and as many as Options.RateHistorySize, e.g. to draw
+	// sparklines. The idle intervals count as 0. They are never changed once in a
+	// snapshot.
+	UploadHistory   []float64
+	DownloadHistory []float64
+}
+
+// pushRate returns the rates with the rate appended, the oldest ones dropped beyond
+// the size, in a new slice not to change the ones of the snapshots taken.
+func pushRate(rates []float64, rate float64, size int) []float64 {
+	if size <= 0 {
+		return nil
+	}
+	if len(rates) >= size {
+		rates = rates[len(rates)-size+1:]
+	}
+	pushed := make([]float64, len(rates), len(rates)+1)
+	copy(pushed, rates)
+	return append(pushed, rate)
+}
+
+// Percentiles are the percentiles of the rates of the intervals a connection or a
+// process carried traffic in, in bytes per second.
+type Percentiles struct {
+	P50 float64
+	P95 float64
+	P99 float64
+}
+
+// percentiles returns the percentiles of the rates by the nearest rank, sorting them.
+func percentiles(rates []float64) Percentiles {
+	if len(rates) == 0 {
+		return Percentiles{}
+	}
+	sort.Float64s(rates)
+	rank := func(p float64) float64 {
+		return rates[int(math.Ceil(p*float64(len(rates))))-1]
+	}
+	return Percentiles{P50: rank(0.5), P95: rank(0.95), P99: rank(0.99)}
+}
+
+// rateSample is the rates of an interval.
+type rateSample struct {
+	time     time.Time // When the interval ended
+	upload   float64
+	download float64
+}
+
+// bandwidth tracks the bandwidth of a connection or a process across the stats put.
+type bandwidth struct {
+	Bandwidth
+	firstSeen     time.Time // Start of the first interval it carried traffic in
+	lastSeen      time.Time
+	uploadBytes   int
+	downloadBytes int
+	samples       []rateSample // Rates of the intervals within the window, the oldest first
+}
+
+// put counts the bytes of the interval elapsed until now in, the percentiles going by
+// the intervals ended within the window and the history keeping as many rates as its
+// size.
+func (b *bandwidth) put(uploadBytes, downloadBytes int, elapsed, window time.Duration, size int, now time.Time) {
+	if b.firstSeen.IsZero() {
+		b.firstSeen = now.Add(-elapsed)
+	}
+	b.lastSeen = now
+	b.uploadBytes += uploadBytes
+	b.downloadBytes += downloadBytes
+
+	sample := rateSample{time: now, upload: bytesRate(uploadBytes, elapsed), download: bytesRate(downloadBytes, elapsed)}
+	if sample.upload > b.PeakUploadRate {
+		b.PeakUploadRate = sample.upload
+	}
+	if sample.download > b.PeakDownloadRate {
+		b.PeakDownloadRate = sample.download
+	}
+	b.AvgUploadRate = bytesRate(b.uploadBytes, now.Sub(b.firstSeen))
+	b.AvgDownloadRate = bytesRate(b.downloadBytes, now.Sub(b.firstSeen))
+	b.UploadHistory = pushRate(b.UploadHistory, sample.upload, size)
+	b.DownloadHistory = pushRate(b.DownloadHistory, sample.download, size)
+
+	b.samples = append(b.samples, sample)
+	expired := 0
+	for expired < len(b.samples)-1 && now.Sub(b.samples[expired].time) > window {
+		expired++
+	}
+	b.samples = append(b.samples[:0], b.samples[expired:]...)
+
+	uploads, downloads := make([]float64, len(b.samples)), make([]float64, len(b.samples))
+	for i, sample := range b.samples {
+		uploads[i], downloads[i] = sample.upload, sample.download
+	}
+	b.UploadPercentiles, b.DownloadPercentiles = percentiles(uploads), percentiles(downloads)
+}
+
+// idle counts an interval the connection or the process carried no traffic in, in its
+// history alone.
+func (b *bandwidth) idle(size int) {
+	if len(b.UploadHistory) == 0 {
+		return
+	}
+	b.UploadHistory = pushRate(b.UploadHistory, 0, size)
+	b.DownloadHistory = pushRate(b.DownloadHistory, 0, size)
+}
+
+// bandwidthTracker tracks the bandwidth of the connections and the processes.
+type bandwidthTracker struct {
+	window      time.Duration // Window of the intervals the percentiles go by
+	size        int           // Rates kept in the history of each
+	connections map[Connection]*bandwidth
+	processes   map[string]*bandwidth
+}
+
+func newBandwidthTracker(window time.Duration, size int) *bandwidthTracker {
+	return &bandwidthTracker{
+		window:      window,
+		size:        size,
+		connections: make(map[Connection]*bandwidth),
+		processes:   make(map[string]*bandwidth),
+	}
+}
+
+// trackBandwidth counts the traffic of the connections and the processes of the point
+// of the history in, leaving out the same connections, and forgets the ones having
+// carried no traffic for a while.
+func (s *StatsManager) trackBandwidth(stat Stat, point HistoryPoint) {
+	t := s.rates
+	for conn, info := range stat.Utilization {
+		if _, ok := s.processName(conn, info); !ok {
+			continue
+		}
+		b, ok := t.connections[conn]
+		if !ok {
+			b = &bandwidth{}
+			t.connections[conn] = b
+		}
+		b.put(info.UploadBytes, info.DownloadBytes, point.Elapsed, t.window, t.size, point.Time)
+	}
+	for name, data := range point.Processes {
+		b, ok := t.processes[name]
+		if !ok {
+			b = &bandwidth{}
+			t.processes[name] = b
+		}
+		b.put(data.UploadBytes, data.DownloadBytes, point.Elapsed, t.window, t.size, point.Time)
+	}
+
+	for conn, b := range t.connections {
+		if point.Time.Sub(b.lastSeen) > bandwidthLinger {
+			delete(t.connections, conn)
+		} else if !b.lastSeen.Equal(point.Time) {
+			b.idle(t.size)
+		}
+	}
+	for name, b := range t.processes {
+		if point.Time.Sub(b.lastSeen) > bandwidthLinger {
+			delete(t.processes, name)
+		} else if !b.lastSeen.Equal(point.Time) {
+			b.idle(t.size)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBandwidth(t *testing.T) {
+	now := time.Now()
+	b := &bandwidth{}
+	b.put(2000, 0, 2*time.Second, time.Minute, 0, now)
+	b.put(8000, 1000, 2*time.Second, time.Minute, 0, now.Add(2*time.Second))
+	b.put(0, 0, 4*time.Second, time.Minute, 0, now.Add(6*time.Second))
+
+	assert.Equal(t, 4000.0, b.PeakUploadRate)
+	assert.Equal(t, 500.0, b.PeakDownloadRate)
+	// 10000 bytes uploaded over the 8 seconds since the start of the first interval
+	assert.Equal(t, 1250.0, b.AvgUploadRate)
+	assert.Equal(t, 125.0, b.AvgDownloadRate)
+}
+
+func TestPercentiles(t *testing.T) {
+	assert.Equal(t, Percentiles{}, percentiles(nil))
+	assert.Equal(t, Percentiles{P50: 7, P95: 7, P99: 7}, percentiles([]float64{7}))
+
+	rates := make([]float64, 100)
+	for i := range rates {
+		rates[i] = float64(100 - i)
+	}
+	assert.Equal(t, Percentiles{P50: 50, P95: 95, P99: 99}, percentiles(rates))
+}
+
+func TestBandwidthPercentileWindow(t *testing.T) {
+	now := time.Now()
+	b := &bandwidth{}
+	for i, upload := range []int{10000, 1000, 2000, 3000} {
+		b.put(upload, 0, time.Second, 2*time.Second, 0, now.Add(time.Duration(i)*time.Second))
+	}
+
+	// the rates of the intervals ended over 2 seconds ago are left out
+	assert.Len(t, b.samples, 3)
+	assert.Equal(t, Percentiles{P50: 2000, P95: 3000, P99: 3000}, b.UploadPercentiles)
+	assert.Equal(t, 10000.0, b.PeakUploadRate)
+}
+
+func TestSnapshotBandwidth(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	stat := func(upload int) Stat {
+		return Stat{Utilization: Utilization{conn: {
+			Process:     &ProcessInfo{Pid: 1, Name: "curl"},
+			UploadBytes: upload,
+		}}}
+	}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	now := time.Now()
+	s.put(stat(8000), now)
+	s.put(stat(2000), now.Add(2*time.Second))
+
+	snapshot := s.getSnapshot()
+	assert.Equal(t, 1000.0, snapshot.Connections[conn].UploadRate)
+	assert.Equal(t, 4000.0, snapshot.Connections[conn].PeakUploadRate)
+	assert.Equal(t, 2500.0, snapshot.Connections[conn].AvgUploadRate)
+	assert.Equal(t, 4000.0, snapshot.Processes["<1>:curl"].PeakUploadRate)
+	assert.Equal(t, 2500.0, snapshot.Processes["<1>:curl"].AvgUploadRate)
+
+	// the connections carrying no traffic for long are forgotten
+	s.put(Stat{}, now.Add(2*time.Second+bandwidthLinger+time.Second))
+	assert.Empty(t, s.rates.connections)
+	assert.Empty(t, s.rates.processes)
+}
+
+func TestSnapshotRateHistory(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	stat := func(upload int) Stat {
+		return Stat{Utilization: Utilization{conn: {
+			Process:     &ProcessInfo{Pid: 1, Name: "curl"},
+			UploadBytes: upload,
+		}}}
+	}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes, RateHistorySize: 3})
+	now := time.Now()
+	s.put(stat(2000), now)
+	s.put(stat(4000), now.Add(2*time.Second))
+	earlier := s.getSnapshot()
+	s.put(Stat{}, now.Add(4*time.Second))
+	s.put(stat(8000), now.Add(6*time.Second))
+
+	// the idle intervals count as 0, the oldest rates dropped beyond the size
+	snapshot := s.getSnapshot()
+	assert.Equal(t, []float64{2000, 0, 4000}, snapshot.Connections[conn].UploadHistory)
+	assert.Equal(t, []float64{0, 0, 0}, snapshot.Connections[conn].DownloadHistory)
+	assert.Equal(t, []float64{2000, 0, 4000}, snapshot.Processes["<1>:curl"].UploadHistory)
+	assert.Equal(t, []float64{1000, 2000}, earlier.Connections[conn].UploadHistory)
+
+	s = NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.put(stat(2000), now)
+	assert.Nil(t, s.getSnapshot().Connections[conn].UploadHistory)
+}
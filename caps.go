@@ -0,0 +1,39 @@
+package sniffer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMissingCapability is the error of the sniffer lacking the privileges to
+	// capture, to be run with sudo or granted the capabilities with setcap.
+	ErrMissingCapability = errors.New("missing capability")
+
+	// ErrNoDevices is the error of no device matching the devices to capture.
+	ErrNoDevices = errors.New("no available devices found")
+)
+
+// CapabilityError is the error of the capture denied for lack of privileges, telling
+// the capabilities missing on Linux. It is an ErrMissingCapability.
+type CapabilityError struct {
+	Missing []string // Capabilities missing, e.g. CAP_NET_RAW, empty off Linux
+	Err     error    // Error the capture failed with
+}
+
+func (e *CapabilityError) Error() string {
+	if len(e.Missing) == 0 {
+		return fmt.Sprintf("missing the privileges to capture (%v), run sniffer with sudo", e.Err)
+	}
+	return fmt.Sprintf("missing capability %s (%v), run sniffer with sudo or grant it with `sudo setcap cap_net_raw,cap_net_admin=eip $(which sniffer)`",
+		strings.Join(e.Missing, ","), e.Err)
+}
+
+func (e *CapabilityError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CapabilityError) Is(target error) bool {
+	return target == ErrMissingCapability
+}
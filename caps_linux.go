@@ -0,0 +1,74 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// The capabilities the sniffer takes, CAP_NET_RAW to capture and CAP_NET_ADMIN to
+// receive the process events.
+var snifferCapabilities = []struct {
+	bit  uint
+	name string
+}{
+	{unix.CAP_NET_RAW, "CAP_NET_RAW"},
+	{unix.CAP_NET_ADMIN, "CAP_NET_ADMIN"},
+}
+
+// parseCapEff parses the effective capabilities out of a /proc/<pid>/status file.
+func parseCapEff(r io.Reader) (uint64, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		return caps, err == nil
+	}
+	return 0, false
+}
+
+// missingCapabilities returns the names of the capabilities of the sniffer the
+// effective ones lack.
+func missingCapabilities(caps uint64) []string {
+	var missing []string
+	for _, c := range snifferCapabilities {
+		if caps&(1<<c.bit) == 0 {
+			missing = append(missing, c.name)
+		}
+	}
+	return missing
+}
+
+// capabilityError returns the error of the capture denied with err, telling the
+// capabilities the process lacks, CAP_NET_RAW if unknown.
+func capabilityError(err error) *CapabilityError {
+	missing := []string{"CAP_NET_RAW"}
+	if f, ferr := os.Open("/proc/self/status"); ferr == nil {
+		if caps, ok := parseCapEff(f); ok {
+			missing = missingCapabilities(caps)
+		}
+		f.Close()
+	}
+	return &CapabilityError{Missing: missing, Err: err}
+}
+
+// sockDiagAvailable returns whether the sockets can be dumped through sock_diag, which
+// takes no privileges but may be filtered out, as by seccomp.
+func sockDiagAvailable() bool {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_SOCK_DIAG)
+	if err != nil {
+		return false
+	}
+	unix.Close(fd)
+	return true
+}
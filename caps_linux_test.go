@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCapEff(t *testing.T) {
+	status := "Name:\tsniffer\nCapInh:\t0000000000000000\nCapPrm:\t0000000000003000\nCapEff:\t0000000000002000\n"
+	caps, ok := parseCapEff(strings.NewReader(status))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0x2000), caps)
+	assert.Equal(t, []string{"CAP_NET_ADMIN"}, missingCapabilities(caps))
+	assert.Empty(t, missingCapabilities(0x3000))
+	assert.Equal(t, []string{"CAP_NET_RAW", "CAP_NET_ADMIN"}, missingCapabilities(0))
+
+	_, ok = parseCapEff(strings.NewReader("Name:\tsniffer\n"))
+	assert.False(t, ok)
+}
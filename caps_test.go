@@ -0,0 +1,22 @@
+package sniffer
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilityError(t *testing.T) {
+	err := error(&CapabilityError{Missing: []string{"CAP_NET_RAW"}, Err: syscall.EPERM})
+	assert.True(t, errors.Is(err, ErrMissingCapability))
+	assert.True(t, errors.Is(err, syscall.EPERM))
+	assert.False(t, errors.Is(err, ErrNoDevices))
+	assert.Contains(t, err.Error(), "missing capability CAP_NET_RAW")
+	assert.Contains(t, err.Error(), "setcap")
+
+	err = &CapabilityError{Err: errors.New("/dev/bpf0: Permission denied")}
+	assert.Contains(t, err.Error(), "run sniffer with sudo")
+	assert.NotContains(t, err.Error(), "setcap")
+}
@@ -0,0 +1,157 @@
+package sniffer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// uncategorizedName is the category of the processes no rule matches.
+const uncategorizedName = "<UNCATEGORIZED>"
+
+// categoryCacheSize bounds the processes whose categories are cached, the cache
+// starting over once full.
+const categoryCacheSize = 4096
+
+// The fields of the processes the category rules match.
+const (
+	categoryFieldName    = "name"
+	categoryFieldPath    = "path"
+	categoryFieldCmdline = "cmdline"
+)
+
+// categoryRule puts the processes whose field matches the pattern in the category.
+type categoryRule struct {
+	category string
+	field    string
+	pattern  *regexp.Regexp
+}
+
+// CategoryRules puts the processes in the categories of the user, e.g. browser, backup
+// or telemetry, so the many helpers of an application count as one. The first rule
+// matching a process wins.
+type CategoryRules struct {
+	rules    []categoryRule
+	commands bool // Whether a rule matches the paths or the command lines of the processes
+
+	mu    sync.Mutex
+	cache map[ProcessInfo]string
+}
+
+// LoadCategoryRules reads the rules file at the path.
+func LoadCategoryRules(path string) (*CategoryRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules, err := parseCategoryRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// parseCategoryRules parses a rules file, of lines like "browser name ^(chrome|firefox)$"
+// giving the category, the field matched, either name, path or cmdline, and the
+// regular expression matching it.
+func parseCategoryRules(r io.Reader) (*CategoryRules, error) {
+	c := &CategoryRules{cache: make(map[ProcessInfo]string)}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: want category field regexp", n)
+		}
+		category, field := fields[0], fields[1]
+		switch field {
+		case categoryFieldName:
+		case categoryFieldPath, categoryFieldCmdline:
+			c.commands = true
+		default:
+			return nil, fmt.Errorf("line %d: unknown field %q, want name, path or cmdline", n, field)
+		}
+
+		// the pattern is the rest of the line, spaces included
+		expr := strings.TrimSpace(line[len(category):])
+		expr = strings.TrimSpace(expr[len(field):])
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		c.rules = append(c.rules, categoryRule{category: category, field: field, pattern: pattern})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Categorize returns the category of the process, uncategorizedName if no rule
+// matches.
+func (c *CategoryRules) Categorize(p *ProcessInfo) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if category, ok := c.cache[*p]; ok {
+		return category
+	}
+	var path, cmdline string
+	if c.commands {
+		path, cmdline = lookupCommand(p.Pid)
+	}
+	category := c.match(p.Name, path, cmdline)
+	if len(c.cache) >= categoryCacheSize {
+		c.cache = make(map[ProcessInfo]string)
+	}
+	c.cache[*p] = category
+	return category
+}
+
+// match returns the category of the first rule matching the fields of a process.
+func (c *CategoryRules) match(name, path, cmdline string) string {
+	for _, rule := range c.rules {
+		value := name
+		switch rule.field {
+		case categoryFieldPath:
+			value = path
+		case categoryFieldCmdline:
+			value = cmdline
+		}
+		if value != "" && rule.pattern.MatchString(value) {
+			return rule.category
+		}
+	}
+	return uncategorizedName
+}
+
+// lookupCommand returns the executable path and the command line of the pid, empty if
+// unknown.
+func lookupCommand(pid int) (string, string) {
+	if pid <= 0 {
+		return "", ""
+	}
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return "", ""
+	}
+	path, _ := p.Exe()
+	cmdline, _ := p.Cmdline()
+	return path, cmdline
+}
+
+// SetCategories categorizes the processes of the snapshots by the rules from now on.
+func (s *StatsManager) SetCategories(rules *CategoryRules) {
+	s.categories = rules
+}
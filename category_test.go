@@ -0,0 +1,40 @@
+package sniffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCategoryRules(t *testing.T) {
+	rules, err := parseCategoryRules(strings.NewReader(`# the browsers first
+browser   name    ^(chrome|firefox)
+backup    path    ^/usr/bin/(restic|borg)$
+telemetry cmdline --crash-reporter| telemetry
+`))
+	assert.NoError(t, err)
+	assert.Len(t, rules.rules, 3)
+	assert.True(t, rules.commands)
+
+	assert.Equal(t, "browser", rules.match("chrome", "/opt/google/chrome/chrome", "chrome --type=renderer"))
+	assert.Equal(t, "backup", rules.match("restic", "/usr/bin/restic", "restic backup /home"))
+	// the patterns keep their spaces
+	assert.Equal(t, "telemetry", rules.match("helper", "/usr/lib/helper", "helper --mode telemetry"))
+	assert.Equal(t, uncategorizedName, rules.match("sshd", "/usr/sbin/sshd", "sshd -D"))
+
+	for _, bad := range []string{"browser name", "browser exe ^chrome", "browser name (chrome"} {
+		_, err := parseCategoryRules(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCategorizeByName(t *testing.T) {
+	rules, err := parseCategoryRules(strings.NewReader("browser name ^chrom"))
+	assert.NoError(t, err)
+	assert.False(t, rules.commands)
+
+	assert.Equal(t, "browser", rules.Categorize(&ProcessInfo{Pid: 1, Name: "chromium"}))
+	assert.Equal(t, uncategorizedName, rules.Categorize(&ProcessInfo{Pid: 2, Name: "curl"}))
+	assert.Len(t, rules.cache, 2)
+}
@@ -0,0 +1,137 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// sysClassNet is the directory Linux lists the network devices in.
+const sysClassNet = "/sys/class/net"
+
+// virtualDevice reports whether the device listed in the directory of the network
+// devices is backed by no hardware, like veth and bridges, or driven by virtio_net.
+// The packets received on them may carry the checksums the kernel left unfinished
+// (CHECKSUM_PARTIAL), as on the loopback devices.
+func virtualDevice(dir, device string) bool {
+	if _, err := os.Stat(filepath.Join(dir, device)); err != nil {
+		return false
+	}
+	driver, err := os.Readlink(filepath.Join(dir, device, "device", "driver"))
+	if err != nil {
+		return true
+	}
+	return filepath.Base(driver) == "virtio_net"
+}
+
+// corrupt reports whether the checksums of the segment fail the verification, the sent
+// packets being captured ahead of the checksum offloading of the NIC and the devices
+// leaving the checksums unfinished being skipped.
+func (c *PcapClient) corrupt(ph *pcapHandler, seg *Segment, decoded []gopacket.Layer) bool {
+	if !c.verifyChecksums || seg.Direction != DirectionDownload || ph.partialChecksums {
+		return false
+	}
+	return !checksumsValid(decoded, ph.mtu)
+}
+
+// onesSum adds data up as big endian 16-bit words to the one's complement sum.
+func onesSum(sum uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	return sum
+}
+
+// onesFold folds the carries of the sum back into 16 bits.
+func onesFold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return uint16(sum)
+}
+
+// pseudoHeaderSum returns the sum of the pseudo header the TCP or UDP checksum covers
+// for the IP layer, false if the transport checksum can't be verified: the packet is
+// a fragment or its capture is truncated.
+func pseudoHeaderSum(network gopacket.Layer, proto layers.IPProtocol, length int) (uint32, bool) {
+	sum := uint32(proto) + uint32(length)
+	switch ip := network.(type) {
+	case *layers.IPv4:
+		fragment := ip.Flags&layers.IPv4MoreFragments != 0 || ip.FragOffset > 0
+		if fragment || len(ip.Payload) < int(ip.Length)-len(ip.Contents) {
+			return 0, false
+		}
+		sum = onesSum(sum, ip.SrcIP.To4())
+		sum = onesSum(sum, ip.DstIP.To4())
+
+	case *layers.IPv6:
+		// jumbograms leave the length to an extension header
+		if ip.Length == 0 || len(ip.Payload) < int(ip.Length) {
+			return 0, false
+		}
+		sum = onesSum(sum, ip.SrcIP.To16())
+		sum = onesSum(sum, ip.DstIP.To16())
+
+	default:
+		return 0, false
+	}
+	return sum, true
+}
+
+// checksumsValid verifies the IPv4 header checksums and the TCP and UDP checksums of
+// the decoded layers. What can't be verified is taken for valid, that's truncated
+// captures, fragments and GRO super-packets exceeding the MTU, whose transport
+// checksums are left stale by the kernel.
+func checksumsValid(decoded []gopacket.Layer, mtu int) bool {
+	var network gopacket.Layer
+	for _, lyr := range decoded {
+		var proto layers.IPProtocol
+		var header, payload []byte
+
+		switch l := lyr.(type) {
+		case *layers.IPv4:
+			if onesFold(onesSum(0, l.Contents)) != 0xffff {
+				return false
+			}
+			network = l
+			continue
+
+		case *layers.IPv6:
+			network = l
+			continue
+
+		case *layers.TCP:
+			proto, header, payload = layers.IPProtocolTCP, l.Contents, l.Payload
+
+		case *layers.UDP:
+			// a zero checksum means the sender computed none
+			if l.Checksum == 0 {
+				continue
+			}
+			proto, header, payload = layers.IPProtocolUDP, l.Contents, l.Payload
+
+		default:
+			continue
+		}
+
+		length := len(header) + len(payload)
+		if mtu > 0 && length > mtu {
+			continue
+		}
+		sum, ok := pseudoHeaderSum(network, proto, length)
+		if !ok {
+			continue
+		}
+		sum = onesSum(onesSum(sum, header), payload)
+		if onesFold(sum) != 0xffff {
+			return false
+		}
+	}
+	return true
+}
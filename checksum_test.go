@@ -0,0 +1,91 @@
+package sniffer
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// serialize returns the packet of the layers with their checksums computed.
+func serialize(t *testing.T, network gopacket.NetworkLayer, transport gopacket.SerializableLayer) []byte {
+	switch l := transport.(type) {
+	case *layers.TCP:
+		assert.NoError(t, l.SetNetworkLayerForChecksum(network))
+	case *layers.UDP:
+		assert.NoError(t, l.SetNetworkLayerForChecksum(network))
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	err := gopacket.SerializeLayers(buf, opts, network.(gopacket.SerializableLayer), transport, gopacket.Payload("hello"))
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestChecksumsValid(t *testing.T) {
+	decode := func(data []byte, first gopacket.Decoder) []gopacket.Layer {
+		return gopacket.NewPacket(data, first, gopacket.Default).Layers()
+	}
+
+	ipv4 := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP("10.0.0.1"), DstIP: net.ParseIP("10.0.0.2")}
+	data := serialize(t, ipv4, &layers.TCP{SrcPort: 443, DstPort: 50000, Seq: 1, ACK: true, Window: 512})
+	assert.True(t, checksumsValid(decode(data, layers.LayerTypeIPv4), 1500))
+
+	// a flipped payload bit
+	data[len(data)-1] ^= 0x01
+	assert.False(t, checksumsValid(decode(data, layers.LayerTypeIPv4), 1500))
+	data[len(data)-1] ^= 0x01
+
+	// a broken IPv4 header
+	data[8]--
+	assert.False(t, checksumsValid(decode(data, layers.LayerTypeIPv4), 1500))
+
+	ipv6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP("fe80::1"), DstIP: net.ParseIP("fe80::2")}
+	data = serialize(t, ipv6, &layers.UDP{SrcPort: 53, DstPort: 50000})
+	assert.True(t, checksumsValid(decode(data, layers.LayerTypeIPv6), 1500))
+
+	data[len(data)-1] ^= 0x01
+	assert.False(t, checksumsValid(decode(data, layers.LayerTypeIPv6), 1500))
+
+	// truncated captures can't be verified
+	assert.True(t, checksumsValid(decode(data[:len(data)-2], layers.LayerTypeIPv6), 1500))
+}
+
+func TestPartialChecksums(t *testing.T) {
+	// a packet of the loopback device carrying the checksum the kernel left unfinished,
+	// the sum of the pseudo header only
+	ipv4 := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP("127.0.0.1"), DstIP: net.ParseIP("127.0.0.1")}
+	data := serialize(t, ipv4, &layers.TCP{SrcPort: 8080, DstPort: 50000, Seq: 1, ACK: true, Window: 512})
+	decoded := gopacket.NewPacket(data, layers.LayerTypeIPv4, gopacket.Default).Layers()
+	tcp := decoded[1].(*layers.TCP)
+	sum, ok := pseudoHeaderSum(decoded[0], layers.IPProtocolTCP, len(tcp.Contents)+len(tcp.Payload))
+	assert.True(t, ok)
+	tcp.Checksum = onesFold(sum)
+	tcp.Contents[16], tcp.Contents[17] = byte(tcp.Checksum>>8), byte(tcp.Checksum)
+	assert.False(t, checksumsValid(decoded, 65536))
+
+	c := &PcapClient{verifyChecksums: true}
+	seg := &Segment{Direction: DirectionDownload}
+	assert.False(t, c.corrupt(&pcapHandler{loopback: true, partialChecksums: true, mtu: 65536}, seg, decoded))
+	assert.True(t, c.corrupt(&pcapHandler{mtu: 65536}, seg, decoded))
+
+	// the virtual devices are backed by no hardware or driven by virtio_net
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "veth0"), 0755))
+	for device, driver := range map[string]string{"eth0": "e1000e", "ens3": "virtio_net"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, device, "device"), 0755))
+		assert.NoError(t, os.Symlink(filepath.Join("..", "drivers", driver), filepath.Join(dir, device, "device", "driver")))
+	}
+	assert.True(t, virtualDevice(dir, "veth0"))
+	assert.True(t, virtualDevice(dir, "ens3"))
+	assert.False(t, virtualDevice(dir, "eth0"))
+	assert.False(t, virtualDevice(dir, "missing0"))
+}
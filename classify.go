@@ -0,0 +1,101 @@
+package sniffer
+
+import (
+	"bytes"
+)
+
+// classifyProbes bounds the payload-carrying packets a connection is classified from.
+const classifyProbes = 4
+
+var tcpApplicationPorts = map[uint16]ApplicationProtocol{
+	22:   AppProtoSSH,
+	25:   AppProtoSMTP,
+	53:   AppProtoDNS,
+	80:   AppProtoHTTP,
+	443:  AppProtoTLS,
+	587:  AppProtoSMTP,
+	853:  AppProtoTLS,
+	3389: AppProtoRDP,
+	6881: AppProtoBitTorrent,
+	8080: AppProtoHTTP,
+	8443: AppProtoTLS,
+}
+
+var udpApplicationPorts = map[uint16]ApplicationProtocol{
+	dnsPort:          AppProtoDNS,
+	dhcpServerPort:   AppProtoDHCP,
+	dhcpClientPort:   AppProtoDHCP,
+	123:              AppProtoNTP,
+	quicPort:         AppProtoQUIC,
+	dhcpv6ClientPort: AppProtoDHCP,
+	dhcpv6ServerPort: AppProtoDHCP,
+	ssdpPort:         AppProtoSSDP,
+	3389:             AppProtoRDP,
+	mdnsPort:         AppProtoMDNS,
+	llmnrPort:        AppProtoLLMNR,
+	6881:             AppProtoBitTorrent,
+}
+
+// classify labels the connection with the application protocol recognized from the
+// first bytes of its payload, the well-known ports are only a guess the payload may
+// overrule later.
+func classify(flow *flowState, conn Connection, payload []byte) {
+	if len(payload) == 0 || flow.classifyProbes >= classifyProbes {
+		return
+	}
+	if flow.ApplicationProtocol != "" && !flow.portGuess {
+		return
+	}
+	flow.classifyProbes++
+
+	if app := classifyPayload(flow, conn.Local.Protocol, payload); app != "" {
+		flow.ApplicationProtocol, flow.portGuess = app, false
+		return
+	}
+	if flow.ApplicationProtocol == "" {
+		flow.ApplicationProtocol, flow.portGuess = classifyPort(conn), true
+	}
+}
+
+// classifyPayload returns the application protocol whose signature the payload starts
+// with, empty if none matches.
+func classifyPayload(flow *flowState, protocol Protocol, data []byte) ApplicationProtocol {
+	switch protocol {
+	case ProtoTCP:
+		switch {
+		case flow.HTTPMethod != "" || bytes.HasPrefix(data, []byte("HTTP/1.")):
+			return AppProtoHTTP
+		case flow.JA3 != "" || (len(data) >= 3 && data[0] == tlsRecordHandshake && data[1] == 0x03 && data[2] <= 0x04):
+			return AppProtoTLS
+		case bytes.HasPrefix(data, []byte("SSH-")):
+			return AppProtoSSH
+		case bytes.HasPrefix(data, []byte("\x13BitTorrent protocol")):
+			return AppProtoBitTorrent
+		case bytes.HasPrefix(data, []byte("EHLO ")) || bytes.HasPrefix(data, []byte("HELO ")):
+			return AppProtoSMTP
+		// TPKT header followed by an X.224 connection request
+		case len(data) >= 6 && data[0] == 0x03 && data[1] == 0x00 && data[5] == 0xe0:
+			return AppProtoRDP
+		}
+
+	case ProtoUDP:
+		// bencoded DHT queries and responses
+		if bytes.HasPrefix(data, []byte("d1:ad2:id20:")) || bytes.HasPrefix(data, []byte("d1:rd2:id20:")) {
+			return AppProtoBitTorrent
+		}
+	}
+	return ""
+}
+
+// classifyPort guesses the application protocol from the well-known port of either end.
+func classifyPort(conn Connection) ApplicationProtocol {
+	ports := tcpApplicationPorts
+	if conn.Local.Protocol == ProtoUDP {
+		ports = udpApplicationPorts
+	}
+
+	if app, ok := ports[conn.Remote.Port]; ok {
+		return app
+	}
+	return ports[conn.Local.Port]
+}
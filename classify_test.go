@@ -0,0 +1,38 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.2", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "10.0.0.1", Port: 2222},
+	}
+
+	tests := []struct {
+		payload []byte
+		want    ApplicationProtocol
+	}{
+		{[]byte("SSH-2.0-OpenSSH_9.6\r\n"), AppProtoSSH},
+		{[]byte("HTTP/1.1 200 OK\r\n"), AppProtoHTTP},
+		{[]byte{0x16, 0x03, 0x01, 0x02, 0x00}, AppProtoTLS},
+		{[]byte("\x13BitTorrent protocol"), AppProtoBitTorrent},
+		{[]byte{0x03, 0x00, 0x00, 0x13, 0x0e, 0xe0}, AppProtoRDP},
+	}
+	for _, tt := range tests {
+		flow := &flowState{}
+		classify(flow, conn, tt.payload)
+		assert.Equal(t, tt.want, flow.ApplicationProtocol)
+	}
+
+	// the well-known port is a guess the payload overrules
+	conn.Remote.Port = 443
+	flow := &flowState{}
+	classify(flow, conn, []byte{0, 1, 2})
+	assert.Equal(t, AppProtoTLS, flow.ApplicationProtocol)
+	classify(flow, conn, []byte("SSH-2.0-dropbear\r\n"))
+	assert.Equal(t, AppProtoSSH, flow.ApplicationProtocol)
+}
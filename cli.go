@@ -1,8 +1,13 @@
 package sniffer
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 )
 
@@ -13,8 +18,14 @@ func NewApp() *cobra.Command {
 
 	opt := Options{}
 	var mode int
+	var interval string
 	var unit string
+	var sortKey string
 	var list bool
+	var unixSockets bool
+	var topTalkers bool
+	var compare bool
+	var since, until string
 
 	app := &cobra.Command{
 		Use:     "sniffer",
@@ -31,8 +42,38 @@ func NewApp() *cobra.Command {
 				}
 				return
 			}
+			if unixSockets {
+				groups, err := ListUnixSockets()
+				if err != nil {
+					exit(err.Error())
+				}
+				for _, group := range groups {
+					fmt.Println(group.Process)
+					for _, sock := range group.Sockets {
+						fmt.Println("  " + sock.String())
+					}
+				}
+				return
+			}
+			if topTalkers {
+				if err := printTopTalkers(opt.StoreDir, since, until, opt.Rows); err != nil {
+					exit(err.Error())
+				}
+				return
+			}
+			if compare {
+				if err := printComparison(opt.StoreDir, since, until, opt.Rows); err != nil {
+					exit(err.Error())
+				}
+				return
+			}
+			var err error
+			if opt.RefreshInterval, err = ParseInterval(interval); err != nil {
+				exit(err.Error())
+			}
 			opt.ViewMode = ViewMode(mode)
 			opt.Unit = Unit(unit)
+			opt.SortKey = SortKey(sortKey)
 			if err := opt.Validate(); err != nil {
 				exit(err.Error())
 			}
@@ -47,23 +88,186 @@ func NewApp() *cobra.Command {
 		Example: `  # bytes mode in MB unit
   $ sniffer -u MB
 
+  # bytes mode in the unit fitting each value, in bits per second
+  $ sniffer -u auto --bits
+
+  # top talkers of last night as recorded to the store
+  $ sniffer --store-dir /var/lib/sniffer --top-talkers --since 2022-01-01T22:00:00Z --until 2022-01-02T06:00:00Z
+
+  # what changed over the last 5 minutes against the previous 5 minutes
+  $ sniffer --store-dir /var/lib/sniffer --compare --since 5m
+
+  # replay the session recorded with --record incident.session 4 times as fast
+  $ sniffer --replay incident.session --replay-speed 4
+
+  # every connection of a process and its children along with their rates
+  $ sniffer --watch-pid 1234
+
   # only capture the TCP protocol packets with lo,eth prefixed devices
   $ sniffer -b tcp -d lo -d eth`,
 	}
 
 	app.Flags().BoolVarP(&list, "list", "l", false, "list all devices name")
+	app.Flags().BoolVar(&unixSockets, "unix-sockets", false, "list the unix domain socket endpoints of the processes (Linux only)")
 	app.Flags().BoolVarP(&opt.AllDevices, "all-devices", "a", false, "listen all devices if present")
+	app.Flags().StringVar(&opt.CategoryRules, "category-rules", defaultOpts.CategoryRules, "file of the rules categorizing the processes, lines like \"browser name ^(chrome|firefox)$\"")
+	app.Flags().StringVar(&opt.ASNDB, "asn-db", defaultOpts.ASNDB, "MaxMind GeoLite2 ASN database the autonomous systems of the remote IPs are looked up in")
 	app.Flags().StringVarP(&opt.BPFFilter, "bpf", "b", defaultOpts.BPFFilter, "specify string pcap filter with the BPF syntax")
-	app.Flags().IntVarP(&opt.Interval, "interval", "i", defaultOpts.Interval, "interval for refresh rate in seconds")
+	app.Flags().StringVarP(&interval, "interval", "i", defaultOpts.interval().String(), "interval for refresh rate, e.g. 500ms, in seconds if a bare number")
+	app.Flags().BoolVar(&opt.Bits, "bits", defaultOpts.Bits, "show the traffic stats in bits per second under the auto unit")
+	app.Flags().BoolVar(&opt.Cumulative, "cumulative", defaultOpts.Cumulative, "rank the processes and remote addresses by their totals since started")
+	app.Flags().BoolVar(&opt.Dedup, "dedup", defaultOpts.Dedup, "drop the copies of packets captured on several devices, e.g. a bond and its members")
 	app.Flags().StringArrayVarP(&opt.DevicesPrefix, "devices-prefix", "d", defaultOpts.DevicesPrefix, "prefixed devices to monitor")
+	app.Flags().StringSliceVar(&opt.LocalSubnets, "local-subnets", defaultOpts.LocalSubnets, "subnets of the local network, the rest is internet traffic")
 	app.Flags().BoolVarP(&opt.DisableDNSResolve, "no-dns-resolve", "n", defaultOpts.DisableDNSResolve, "disable the DNS resolution")
-	app.Flags().IntVarP(&mode, "mode", "m", int(defaultOpts.ViewMode), "view mode of sniffer (0: bytes 1: packets 2: plot)")
-	app.Flags().StringVarP(&unit, "unit", "u", defaultOpts.Unit.String(), "unit of traffic stats, optional: B, Kb, KB, Mb, MB, Gb, GB")
+	app.Flags().BoolVar(&opt.PassiveDNSOnly, "passive-dns-only", defaultOpts.PassiveDNSOnly, "resolve remote IPs only from the DNS responses seen on the wire")
+	app.Flags().BoolVar(&opt.TunnelOuter, "tunnel-outer", defaultOpts.TunnelOuter, "attribute tunnelled traffic to the outer tunnel endpoints")
+	app.Flags().StringVar(&opt.ExportDir, "export-dir", defaultOpts.ExportDir, "directory the e hotkey exports the tables to as CSV")
+	app.Flags().BoolVar(&opt.ExcludeSelf, "exclude-self", defaultOpts.ExcludeSelf, "leave the traffic of the sniffer itself out of the stats")
+	app.Flags().StringVar(&opt.GeoIPDB, "geoip-db", defaultOpts.GeoIPDB, "MaxMind GeoLite2 City or Country database the remote IPs are located with")
+	app.Flags().StringVar(&opt.TagsFile, "tags-file", defaultOpts.TagsFile, "file the tags of the remote hosts and the connections are saved to, the g hotkey tagging them")
+	app.Flags().StringVar(&opt.HostLabels, "host-labels", defaultOpts.HostLabels, "file of the labels of the remote networks, lines like \"10.2.0.0/16 = staging-k8s\"")
+	app.Flags().BoolVar(&opt.Goodput, "goodput", defaultOpts.Goodput, "rank and show the bytes tables by payload bytes")
+	app.Flags().IntVar(&opt.HistorySize, "history-size", defaultOpts.HistorySize, "intervals of throughput kept in the history")
+	app.Flags().IntVar(&opt.RateHistorySize, "rate-history-size", defaultOpts.RateHistorySize, "interval rates kept for each connection and process in the snapshots, none if 0")
+	app.Flags().DurationVar(&opt.IdleTimeout, "idle-timeout", defaultOpts.IdleTimeout, "leave the connections idle longer than it within the window out of the tables, 0 to keep them")
+	app.Flags().BoolVar(&opt.IncludeLoopback, "include-loopback", defaultOpts.IncludeLoopback, "count the traffic of the loopback devices")
+	app.Flags().BoolVar(&opt.VerifyChecksums, "verify-checksums", defaultOpts.VerifyChecksums, "verify the checksums of received packets and count the corrupt ones apart")
+	app.Flags().BoolVar(&opt.WirePackets, "wire-packets", defaultOpts.WirePackets, "count GRO/GSO super-packets as wire-equivalent packets")
+	app.Flags().IntVar(&opt.MaxConnections, "max-connections", defaultOpts.MaxConnections, "connections tracked at most, the rest folded into <other>, unlimited if 0")
+	app.Flags().BoolVar(&opt.Mirror, "mirror", defaultOpts.Mirror, "account the traffic between other hosts seen on a switch mirror port")
+	app.Flags().DurationVar(&opt.PercentileWindow, "percentile-window", defaultOpts.PercentileWindow, "window of the interval rates the throughput percentiles go by")
+	app.Flags().StringVar(&opt.ParquetDir, "parquet-dir", defaultOpts.ParquetDir, "directory the rows of each interval are written to as Parquet, a file an hour")
+	app.Flags().BoolVar(&opt.Pktap, "pktap", defaultOpts.Pktap, "capture through the pktap device telling the process of each packet (macOS only)")
+	app.Flags().IntSliceVar(&opt.Pids, "pid", defaultOpts.Pids, "only attribute the sockets of these processes (Linux only)")
+	app.Flags().IntVar(&opt.WatchPID, "watch-pid", defaultOpts.WatchPID, "only show the traffic of this process and its children")
+	app.Flags().StringVar(&opt.WatchProcessName, "watch-process", defaultOpts.WatchProcessName, "only show the traffic of the processes whose name matches this pattern and their children")
+	app.Flags().StringSliceVar(&opt.ProcessNames, "process", defaultOpts.ProcessNames, "only attribute the sockets of the processes whose name matches these patterns (Linux only)")
+	app.Flags().DurationVar(&opt.ProcessRefreshMin, "process-refresh-min", defaultOpts.ProcessRefreshMin, "shortest interval of the process sockets refresh (Linux only)")
+	app.Flags().DurationVar(&opt.ProcessRefreshMax, "process-refresh-max", defaultOpts.ProcessRefreshMax, "longest interval of the process sockets refresh (Linux only)")
+	app.Flags().StringVar(&opt.RecordFile, "record", defaultOpts.RecordFile, "session file the stats of each interval are recorded to, to replay later on")
+	app.Flags().StringVar(&opt.ReplayFile, "replay", defaultOpts.ReplayFile, "session file replayed in place of capturing")
+	app.Flags().Float64Var(&opt.ReplaySpeed, "replay-speed", defaultOpts.ReplaySpeed, "how much faster than recorded the session is replayed")
+	app.Flags().BoolVar(&opt.Seccomp, "seccomp", defaultOpts.Seccomp, "restrict the sniffer to the syscalls it takes once started (Linux only)")
+	app.Flags().DurationVar(&opt.SockDiagTimeout, "sock-diag-timeout", defaultOpts.SockDiagTimeout, "timeout of each reply of the socket dumps (Linux only)")
+	app.Flags().StringVar(&opt.User, "user", defaultOpts.User, "user to switch to once the capture is open (Linux only)")
+	app.Flags().StringVar(&opt.StateFile, "state-file", defaultOpts.StateFile, "file the totals are saved to and restored from across restarts")
+	app.Flags().DurationVar(&opt.StateSaveInterval, "state-save-interval", defaultOpts.StateSaveInterval, "interval the totals are saved to the state file at")
+	app.Flags().StringVar(&opt.StoreDir, "store-dir", defaultOpts.StoreDir, "directory the rows of each interval are recorded to")
+	app.Flags().DurationVar(&opt.StoreRetention, "store-retention", defaultOpts.StoreRetention, "how long the intervals recorded to the store are kept, forever if 0")
+	app.Flags().BoolVar(&topTalkers, "top-talkers", false, "print the top processes and remote addresses recorded to the store and exit")
+	app.Flags().BoolVar(&compare, "compare", false, "print the processes and remote addresses recorded to the store whose traffic changed the most against the range as long before and exit")
+	app.Flags().StringVar(&since, "since", "24h", "start of the top talkers or the compared range, a RFC 3339 time or a duration ago")
+	app.Flags().StringVar(&until, "until", "", "end of the top talkers or the compared range, a RFC 3339 time or a duration ago, now if empty")
+	app.Flags().StringSliceVar(&opt.SocketStates, "socket-states", defaultOpts.SocketStates, "states of the TCP sockets looked up, e.g. ESTABLISHED,LISTEN (Linux only)")
+	app.Flags().DurationVar(&opt.Window, "window", defaultOpts.Window, "window the stats are summed up over, the latest interval only if 0")
+	app.Flags().IntVar(&opt.Rows, "rows", defaultOpts.Rows, "rows of each table")
+	app.Flags().IntVarP(&mode, "mode", "m", int(defaultOpts.ViewMode), "view mode of sniffer (0: bytes 1: packets 2: plot 3: users 4: containers 5: categories 6: applications)")
+	app.Flags().StringVar(&sortKey, "sort", defaultOpts.SortKey.String(), "sort order of the tables, optional: total, upload, download, packets, connections")
+	app.Flags().StringVarP(&unit, "unit", "u", defaultOpts.Unit.String(), "unit of traffic stats, optional: B, b, Kb, KB, Mb, MB, Gb, GB, auto")
 
 	app.Flags().PrintDefaults()
 	return app
 }
 
+// printComparison prints the processes and remote addresses recorded to the store of
+// the directory whose bytes changed the most from the range as long right before since
+// to the range between since and until.
+func printComparison(dir, since, until string, n int) error {
+	if dir == "" {
+		return errors.New("no store directory given, with --store-dir")
+	}
+	now := time.Now()
+	from, err := parseQueryTime(since, now)
+	if err != nil {
+		return err
+	}
+	to, err := parseQueryTime(until, now)
+	if err != nil {
+		return err
+	}
+	if !from.Before(to) {
+		return errors.New("empty range to compare, --since not before --until")
+	}
+
+	store, err := OpenHistoryStore(dir, 0)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	processes, remoteAddrs, err := store.Compare(from.Add(-to.Sub(from)), from, from, to, n)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, section := range []struct {
+		title string
+		rows  []RowChange
+	}{
+		{"Process Name", processes},
+		{"Remote Address", remoteAddrs},
+	} {
+		fmt.Fprintf(w, "%s\tBefore\tAfter\tChange\n", section.title)
+		for _, row := range section.rows {
+			before := row.Before.UploadBytes + row.Before.DownloadBytes
+			after := row.After.UploadBytes + row.After.DownloadBytes
+			change := "+" + humanize.IBytes(uint64(row.Change()))
+			if row.Change() < 0 {
+				change = "-" + humanize.IBytes(uint64(-row.Change()))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.Name,
+				humanize.IBytes(uint64(before)), humanize.IBytes(uint64(after)), change)
+		}
+		fmt.Fprintln(w, "\t\t\t")
+	}
+	return w.Flush()
+}
+
+// printTopTalkers prints the top processes and remote addresses recorded to the store
+// of the directory between since and until.
+func printTopTalkers(dir, since, until string, n int) error {
+	if dir == "" {
+		return errors.New("no store directory given, with --store-dir")
+	}
+	now := time.Now()
+	from, err := parseQueryTime(since, now)
+	if err != nil {
+		return err
+	}
+	to, err := parseQueryTime(until, now)
+	if err != nil {
+		return err
+	}
+
+	store, err := OpenHistoryStore(dir, 0)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	processes, remoteAddrs, err := store.TopTalkers(from, to, n)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, section := range []struct {
+		title string
+		rows  []StoredRow
+	}{
+		{"Process Name", processes},
+		{"Remote Address", remoteAddrs},
+	} {
+		fmt.Fprintf(w, "%s\tConnections\tUpload\tDownload\n", section.title)
+		for _, row := range section.rows {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", row.Name, row.Connections,
+				humanize.IBytes(uint64(row.UploadBytes)), humanize.IBytes(uint64(row.DownloadBytes)))
+		}
+		fmt.Fprintln(w, "\t\t\t")
+	}
+	return w.Flush()
+}
+
 func main() {
 	app := NewApp()
 	if err := app.Execute(); err != nil {
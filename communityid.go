@@ -0,0 +1,68 @@
+package sniffer
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+)
+
+// communityIDSeed is the seed of the community IDs, the default one the other tools
+// use too.
+const communityIDSeed = 0
+
+// ianaProtocols are the IANA protocol numbers of the protocols.
+var ianaProtocols = map[Protocol]uint8{
+	ProtoTCP: 6,
+	ProtoUDP: 17,
+	ProtoGRE: 47,
+}
+
+// CommunityID returns the version 1 community ID of the connection, the hash of its
+// 5-tuple that Zeek, Suricata and the NetFlow collectors compute for the same flow
+// whichever end sent the packet. It returns an empty string if the IPs are invalid or
+// the protocol lacks a 5-tuple, like the ICMP echoes hashed by their types.
+func (c Connection) CommunityID() string {
+	proto, ok := ianaProtocols[c.Local.Protocol]
+	srcIP, dstIP := communityIP(c.Local.IP), communityIP(c.Remote.IP)
+	if !ok || srcIP == nil || dstIP == nil || len(srcIP) != len(dstIP) {
+		return ""
+	}
+	srcPort, dstPort := c.Local.Port, c.Remote.Port
+
+	// the lower end goes first, the same for both directions
+	if cmp := bytes.Compare(srcIP, dstIP); cmp > 0 || (cmp == 0 && srcPort > dstPort) {
+		srcIP, dstIP = dstIP, srcIP
+		srcPort, dstPort = dstPort, srcPort
+	}
+
+	buf := make([]byte, 0, 2+2*net.IPv6len+6)
+	buf = append(buf, byte(communityIDSeed>>8), byte(communityIDSeed&0xff))
+	buf = append(buf, srcIP...)
+	buf = append(buf, dstIP...)
+	buf = append(buf, proto, 0)
+
+	// only the protocols with ports have them hashed
+	if c.Local.Protocol == ProtoTCP || c.Local.Protocol == ProtoUDP {
+		var ports [4]byte
+		binary.BigEndian.PutUint16(ports[:2], srcPort)
+		binary.BigEndian.PutUint16(ports[2:], dstPort)
+		buf = append(buf, ports[:]...)
+	}
+
+	sum := sha1.Sum(buf)
+	return "1:" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// communityIP returns the 4 or 16 bytes of the IP, nil if invalid.
+func communityIP(ip string) net.IP {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4
+	}
+	return parsed
+}
@@ -0,0 +1,29 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommunityID(t *testing.T) {
+	// the reference flow of the community ID specification
+	conn := Connection{
+		Local:  LocalSocket{IP: "128.232.110.120", Port: 34855, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "66.35.250.204", Port: 80},
+	}
+	assert.Equal(t, "1:LQU9qZlK+B5F3KDmev6m5PMibrg=", conn.CommunityID())
+
+	// the same from the other end
+	reversed := Connection{
+		Local:  LocalSocket{IP: "66.35.250.204", Port: 80, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "128.232.110.120", Port: 34855},
+	}
+	assert.Equal(t, conn.CommunityID(), reversed.CommunityID())
+
+	conn.Local.Protocol = ProtoUDP
+	assert.NotEqual(t, reversed.CommunityID(), conn.CommunityID())
+
+	assert.Equal(t, "", Connection{Local: LocalSocket{IP: "10.0.0.1"}, Remote: RemoteSocket{IP: "::1"}}.CommunityID())
+	assert.Equal(t, "", Connection{Local: LocalSocket{IP: "10.0.0.1", Protocol: ProtoICMP}, Remote: RemoteSocket{IP: "10.0.0.2"}}.CommunityID())
+}
@@ -17,14 +17,14 @@ type lsofConn struct {
 }
 
 type Invoker interface {
-	Exec() ([]byte, error)
+	Exec(ctx context.Context) ([]byte, error)
 }
 
 type lsofInvoker struct{}
 
 // Exec executes the command and return the output bytes of it.
-func (i lsofInvoker) Exec() ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (i lsofInvoker) Exec(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "lsof", "-n", "-R", "-P", "-iTCP", "-iUDP", "-s", "TCP:ESTABLISHED", "+c", "0")
@@ -44,9 +44,9 @@ func (i lsofInvoker) Exec() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (lc *lsofConn) GetOpenSockets() (OpenSockets, error) {
+func (lc *lsofConn) GetOpenSockets(ctx context.Context) (OpenSockets, error) {
 	sockets := make(OpenSockets)
-	output, err := lc.invoker.Exec()
+	output, err := lc.invoker.Exec(ctx)
 	if err != nil {
 		return sockets, err
 	}
@@ -60,7 +60,7 @@ func (lc *lsofConn) GetOpenSockets() (OpenSockets, error) {
 
 		procName := strings.ReplaceAll(fields[0], "\\x20", " ")
 		pid, _ := strconv.Atoi(fields[1])
-		procInfo := ProcessInfo{Pid: pid, Name: procName}
+		procInfo := SocketInfo{ProcessInfo: ProcessInfo{Pid: pid, Name: procName}, UID: -1}
 
 		switch fields[8] {
 		case "TCP":
@@ -68,6 +68,9 @@ func (lc *lsofConn) GetOpenSockets() (OpenSockets, error) {
 			if len(addr) != 2 {
 				continue
 			}
+			if len(fields) > 10 {
+				procInfo.State, _ = ParseSocketState(strings.Trim(fields[10], "()"))
+			}
 			ipport := strings.Split(addr[0], ":")
 			if len(ipport) != 2 {
 				continue
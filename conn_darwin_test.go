@@ -1,6 +1,7 @@
 package sniffer
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,7 +9,7 @@ import (
 
 type noopInvoker struct{}
 
-func (noopInvoker) Exec() ([]byte, error) {
+func (noopInvoker) Exec(context.Context) ([]byte, error) {
 	output := `
 goland                          44546     1 chenjiandongx   14u  IPv4 0x22b93638598dd98d      0t0  UDP *:60203
 goland                          44546     1 chenjiandongx   17u  IPv4 0x22b93638598dfb3d      0t0  UDP *:8976
@@ -19,13 +20,13 @@ wget                            44817 44815 chenjiandongx   19u  IPv4 0x22b93638
 
 func TestDarwinGetSockets(t *testing.T) {
 	conn := lsofConn{invoker: noopInvoker{}}
-	sockets, err := conn.GetOpenSockets()
+	sockets, err := conn.GetOpenSockets(context.Background())
 	assert.NoError(t, err)
 
-	expected := map[LocalSocket]ProcessInfo{
-		{IP: "*", Port: 8976, Protocol: ProtoUDP}:          {Pid: 44546, Name: "goland"},
-		{IP: "*", Port: 60203, Protocol: ProtoUDP}:         {Pid: 44546, Name: "goland"},
-		{IP: "127.0.0.1", Port: 53747, Protocol: ProtoTCP}: {Pid: 44817, Name: "wget"},
+	expected := map[LocalSocket]SocketInfo{
+		{IP: "*", Port: 8976, Protocol: ProtoUDP}:          {ProcessInfo: ProcessInfo{Pid: 44546, Name: "goland"}, UID: -1},
+		{IP: "*", Port: 60203, Protocol: ProtoUDP}:         {ProcessInfo: ProcessInfo{Pid: 44546, Name: "goland"}, UID: -1},
+		{IP: "127.0.0.1", Port: 53747, Protocol: ProtoTCP}: {ProcessInfo: ProcessInfo{Pid: 44817, Name: "wget"}, State: StateEstablished, UID: -1},
 	}
 
 	assert.Equal(t, OpenSockets(expected), sockets)
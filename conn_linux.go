@@ -4,6 +4,7 @@
 package sniffer
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -13,6 +14,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -25,9 +27,65 @@ const (
 	udpConnection  = uint8(0x07)
 
 	sizeOfInetDiagRequest = 72
+	sizeOfInetDiagMsg     = 72
 	sockDiagByFamily      = 20
+
+	// inetDiagInfo is the INET_DIAG_INFO extension carrying the tcp_info
+	inetDiagInfo = 2
+
+	// sockdiagRetries bounds the retries of the interrupted and timed out receives of
+	// a dump, backing off from sockdiagBackoff
+	sockdiagRetries = 3
+	sockdiagBackoff = 10 * time.Millisecond
+
+	// sockdiagTimeout bounds the wait for each reply of a dump unless configured
+	// otherwise
+	sockdiagTimeout = 200 * time.Millisecond
 )
 
+// ErrSockDiagUnsupported is matched by the errors of the sock_diag requests the kernel
+// lacks, being too old or missing the diag module of the family.
+var ErrSockDiagUnsupported = errors.New("sock_diag request unsupported by the kernel")
+
+// SockDiagError is an error of a sock_diag request. It matches os.ErrPermission when
+// the request is denied and ErrSockDiagUnsupported when the kernel lacks it.
+type SockDiagError struct {
+	Op    string
+	Errno syscall.Errno
+}
+
+func (e *SockDiagError) Error() string {
+	return fmt.Sprintf("sock_diag %s: %v", e.Op, e.Errno)
+}
+
+func (e *SockDiagError) Unwrap() error {
+	return e.Errno
+}
+
+func (e *SockDiagError) Is(target error) bool {
+	if target != ErrSockDiagUnsupported {
+		return false
+	}
+	switch e.Errno {
+	case unix.ENOENT, unix.EINVAL, unix.EOPNOTSUPP, unix.EPROTONOSUPPORT, unix.EAFNOSUPPORT:
+		return true
+	}
+	return false
+}
+
+// sockdiagErr returns the error carried by the data of an NLMSG_ERROR message, nil
+// if it acknowledges the request.
+func sockdiagErr(data []byte) error {
+	if len(data) < 4 {
+		return &SockDiagError{Op: "dump", Errno: unix.EBADMSG}
+	}
+	errno := int32(getNativeEndian().Uint32(data))
+	if errno == 0 {
+		return nil
+	}
+	return &SockDiagError{Op: "dump", Errno: syscall.Errno(-errno)}
+}
+
 var nativeEndian binary.ByteOrder
 
 // getNativeEndian gets native endianness for the system
@@ -153,7 +211,52 @@ type inetDiagRequest struct {
 	ReqDiag inetDiagReqV2
 }
 
-type netlinkConn struct{}
+type netlinkConn struct {
+	timeout   int64        // the wait for each reply of a dump in nanoseconds, accessed atomically
+	tcpStates uint32       // mask of the states of the TCP sockets dumped, accessed atomically
+	filter    atomic.Value // *procFilter of the processes whose sockets are looked up
+}
+
+// setTCPStates sets the mask of the states of the TCP sockets dumped, zero for the
+// established ones
+func (nl *netlinkConn) setTCPStates(mask uint32) {
+	atomic.StoreUint32(&nl.tcpStates, mask)
+}
+
+// tcpStateMask returns the mask of the states of the TCP sockets dumped
+func (nl *netlinkConn) tcpStateMask() uint32 {
+	if mask := atomic.LoadUint32(&nl.tcpStates); mask != 0 {
+		return mask
+	}
+	return 1 << tcpEstablished
+}
+
+// errProcFiltered fails the lookup of the sockets of the processes filtered out
+var errProcFiltered = errors.New("process filtered out")
+
+// setFilter restricts the processes whose sockets are looked up, nil for every one
+func (nl *netlinkConn) setFilter(filter *procFilter) {
+	nl.filter.Store(filter)
+}
+
+// procFilter returns the filter of the processes, nil if none
+func (nl *netlinkConn) procFilter() *procFilter {
+	filter, _ := nl.filter.Load().(*procFilter)
+	return filter
+}
+
+// setTimeout bounds the wait for each reply of the dumps, zero for the default one
+func (nl *netlinkConn) setTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&nl.timeout, int64(timeout))
+}
+
+// replyTimeout returns the wait for each reply of the dumps
+func (nl *netlinkConn) replyTimeout() time.Duration {
+	if timeout := time.Duration(atomic.LoadInt64(&nl.timeout)); timeout > 0 {
+		return timeout
+	}
+	return sockdiagTimeout
+}
 
 // ipv4 be32 to string
 func (nl *netlinkConn) ipv4(b be32) string {
@@ -183,13 +286,37 @@ func (nl *netlinkConn) ipHex2String(family uint8, ip [4]be32) (string, error) {
 	}
 }
 
-// sockdiagSend sends netlinkConn msgs
-// see https://github.com/sivasankariit/iproute2/blob/1179ab033c31d2c67f406be5bcd5e4c0685855fe/misc/ss.c#L1575-L1640
-func (nl *netlinkConn) sockdiagSend(proto, family uint8, states uint32) (skfd int, err error) {
+// sockdiagDial opens a sock_diag netlink socket and sends the dump request to it.
+func (nl *netlinkConn) sockdiagDial(req []byte) (skfd int, err error) {
 	if skfd, err = unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_SOCK_DIAG); err != nil {
-		return -1, err
+		return -1, sockdiagOpErr("socket", err)
 	}
 
+	sockAddrNl := unix.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	timeout := syscall.NsecToTimeval(nl.replyTimeout().Nanoseconds())
+	if err = syscall.SetsockoptTimeval(skfd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(skfd)
+		return -1, sockdiagOpErr("setsockopt", err)
+	}
+
+	if err = unix.Sendmsg(skfd, req, nil, &sockAddrNl, 0); err != nil {
+		syscall.Close(skfd)
+		return -1, sockdiagOpErr("sendmsg", err)
+	}
+	return skfd, nil
+}
+
+// sockdiagOpErr wraps the errno failing the operation into a SockDiagError.
+func sockdiagOpErr(op string, err error) error {
+	if errno, ok := err.(syscall.Errno); ok {
+		return &SockDiagError{Op: op, Errno: errno}
+	}
+	return err
+}
+
+// sockdiagSend sends netlinkConn msgs
+// see https://github.com/sivasankariit/iproute2/blob/1179ab033c31d2c67f406be5bcd5e4c0685855fe/misc/ss.c#L1575-L1640
+func (nl *netlinkConn) sockdiagSend(proto, family uint8, states uint32) (skfd int, err error) {
 	var diagReq inetDiagRequest
 	diagReq.Nlh.Type = sockDiagByFamily
 
@@ -198,67 +325,259 @@ func (nl *netlinkConn) sockdiagSend(proto, family uint8, states uint32) (skfd in
 	diagReq.ReqDiag.Family = family
 	diagReq.ReqDiag.Protocol = proto
 	diagReq.ReqDiag.States = states
+	if proto == syscall.IPPROTO_TCP {
+		diagReq.ReqDiag.Ext = 1 << (inetDiagInfo - 1)
+	}
 	diagReq.Nlh.Len = uint32(unsafe.Sizeof(diagReq))
 
 	buffer := make([]byte, sizeOfInetDiagRequest)
 	*(*inetDiagRequest)(unsafe.Pointer(&buffer[0])) = diagReq
-
-	sockAddrNl := unix.SockaddrNetlink{Family: syscall.AF_NETLINK}
-	timeout := syscall.NsecToTimeval((200 * time.Millisecond).Nanoseconds())
-	if err = syscall.SetsockoptTimeval(skfd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
-		return 0, err
-	}
-
-	if err = unix.Sendmsg(skfd, buffer, nil, &sockAddrNl, 0); err != nil {
-		return -1, err
-	}
-	return skfd, nil
+	return nl.sockdiagDial(buffer)
 }
 
-func (nl *netlinkConn) sockdiagRecv(skfd, proto int, inodeMap map[uint32]ProcessInfo) (OpenSockets, error) {
-	sockets := make(OpenSockets)
+// sockdiagDump receives the messages of a dump until its end, handing the data of
+// each one to handle. The interrupted and timed out receives are retried with backoff.
+func (nl *netlinkConn) sockdiagDump(skfd int, handle func(data []byte)) error {
 	buffer := make([]byte, os.Getpagesize())
-loop:
+	retries := 0
 	for {
-		n, _, _, _, err := unix.Recvmsg(skfd, buffer, nil, 0)
+		// the datagrams exceeding the buffer get truncated, peek at their size first
+		// to grow the buffer, the kernel fills up the dumps up to the size read
+		n, _, _, _, err := unix.Recvmsg(skfd, buffer, nil, unix.MSG_PEEK|unix.MSG_TRUNC)
+		if (err == unix.EINTR || err == unix.EAGAIN) && retries < sockdiagRetries {
+			time.Sleep(sockdiagBackoff << retries)
+			retries++
+			continue
+		}
 		if err != nil {
-			return sockets, err
+			return sockdiagOpErr("recvmsg", err)
+		}
+		retries = 0
+
+		if n > len(buffer) {
+			buffer = make([]byte, n)
+		}
+		n, _, recvflags, _, err := unix.Recvmsg(skfd, buffer, nil, unix.MSG_DONTWAIT)
+		if err != nil {
+			return sockdiagOpErr("recvmsg", err)
+		}
+		if recvflags&unix.MSG_TRUNC != 0 {
+			return &SockDiagError{Op: "recvmsg", Errno: unix.EMSGSIZE}
 		}
 
 		if n == 0 {
-			break loop
+			return nil
 		}
 
 		msgs, err := syscall.ParseNetlinkMessage(buffer[:n])
 		if err != nil {
-			return sockets, err
+			return err
 		}
 
 		for _, msg := range msgs {
-			if msg.Header.Type == syscall.NLMSG_DONE {
-				break loop
+			switch msg.Header.Type {
+			// the dumps failing halfway end with the error
+			case syscall.NLMSG_DONE:
+				if len(msg.Data) < 4 {
+					return nil
+				}
+				return sockdiagErr(msg.Data)
+			case syscall.NLMSG_ERROR:
+				if err := sockdiagErr(msg.Data); err != nil {
+					return err
+				}
+				continue
 			}
+			handle(msg.Data)
+		}
+	}
+}
+
+// diagAttr returns the payload of the attribute of the type among the attributes
+// following a sock_diag message, nil if absent.
+func (nl *netlinkConn) diagAttr(attrs []byte, attrType uint16) []byte {
+	for len(attrs) >= unix.SizeofRtAttr {
+		attrLen := int(getNativeEndian().Uint16(attrs[0:2]))
+		if attrLen < unix.SizeofRtAttr || attrLen > len(attrs) {
+			return nil
+		}
+		if getNativeEndian().Uint16(attrs[2:4]) == attrType {
+			return attrs[unix.SizeofRtAttr:attrLen]
+		}
+
+		// the attributes are aligned to 4 bytes
+		attrLen = (attrLen + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+		if attrLen > len(attrs) {
+			return nil
+		}
+		attrs = attrs[attrLen:]
+	}
+	return nil
+}
+
+// socketCookie identifies a socket across the dumps, unlike its ports.
+type socketCookie struct {
+	cookie uint64
+	inode  uint32
+}
+
+// socketDetails collects the details of the sockets dumped through sock_diag, keyed
+// by their connections.
+type socketDetails struct {
+	tcpInfos map[Connection]TCPInfo
+	cookies  map[Connection]socketCookie
+}
+
+func newSocketDetails() *socketDetails {
+	return &socketDetails{
+		tcpInfos: make(map[Connection]TCPInfo),
+		cookies:  make(map[Connection]socketCookie),
+	}
+}
+
+// sockdiagRecv receives the sockets dumped, their details go to details unless nil.
+func (nl *netlinkConn) sockdiagRecv(skfd, proto int, inodeMap map[uint32]ProcessInfo, details *socketDetails) (OpenSockets, error) {
+	sockets := make(OpenSockets)
+	err := nl.sockdiagDump(skfd, func(data []byte) {
+		if len(data) < sizeOfInetDiagMsg {
+			return
+		}
+		m := (*inetDiagMsg)(unsafe.Pointer(&data[0]))
+		srcIP, _ := nl.ipHex2String(m.IDiagFamily, m.ID.IdiagSrc)
+
+		procInfo := SocketInfo{ProcessInfo: inodeMap[m.IDiagInode], State: SocketState(m.IDiagState), UID: int(m.IDiagUid)}
+
+		var p Protocol
+		switch proto {
+		case syscall.IPPROTO_TCP:
+			p = ProtoTCP
+		case syscall.IPPROTO_UDP:
+			p = ProtoUDP
+		}
+		local := LocalSocket{IP: srcIP, Port: uint16(m.ID.IdiagSport.Int()), Protocol: p}
+		sockets[local] = procInfo
+
+		if details == nil {
+			return
+		}
+		dstIP, _ := nl.ipHex2String(m.IDiagFamily, m.ID.IdiagDst)
+		conn := Connection{Local: local, Remote: RemoteSocket{IP: dstIP, Port: uint16(m.ID.IdiagDport.Int())}}
+		details.cookies[conn] = socketCookie{
+			cookie: uint64(m.ID.IdiagCookie[1])<<32 | uint64(m.ID.IdiagCookie[0]),
+			inode:  m.IDiagInode,
+		}
+
+		if p != ProtoTCP {
+			return
+		}
+		// the queues are known even without the tcp_info
+		info, _ := parseTCPInfo(nl.diagAttr(data[sizeOfInetDiagMsg:], inetDiagInfo), getNativeEndian())
+		info.RecvQueue, info.SendQueue = m.IDiagRqueue, m.IDiagWqueue
+		details.tcpInfos[conn] = info
+	})
+	return sockets, err
+}
+
+// procNetRawTables are the tables of the raw and the ping sockets, which sock_diag
+// lists only with the raw_diag module loaded or not at all.
+var procNetRawTables = []string{"raw", "raw6", "icmp", "icmp6"}
+
+// getRawSockets adds the raw sockets of the GRE and ICMP protocols and the ping
+// sockets to the sockets. The raw sockets take port 0, being bound to a protocol, the
+// ping ones take the identifier of their echoes.
+func (nl *netlinkConn) getRawSockets(inodeMap map[uint32]ProcessInfo, sockets OpenSockets) {
+	for _, table := range procNetRawTables {
+		f, err := os.Open(filepath.Join("/proc/net", table))
+		if err != nil {
+			continue
+		}
+		entries, _ := parseProcNet(f, getNativeEndian())
+		f.Close()
+
+		for _, entry := range entries {
+			local := LocalSocket{IP: entry.LocalIP, Port: entry.LocalPort, Protocol: ProtoICMP}
+
+			// the port of a raw socket is the protocol it is bound to
+			if strings.HasPrefix(table, "raw") {
+				switch entry.LocalPort {
+				case syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+				case syscall.IPPROTO_GRE:
+					local.Protocol = ProtoGRE
+				default:
+					continue
+				}
+				local.Port = 0
+			}
+			sockets[local] = SocketInfo{ProcessInfo: inodeMap[entry.Inode], State: SocketState(entry.State), UID: int(entry.UID)}
+		}
+	}
+}
 
-			m := (*inetDiagMsg)(unsafe.Pointer(&msg.Data[0]))
-			srcIP, _ := nl.ipHex2String(m.IDiagFamily, m.ID.IdiagSrc)
+// procNetTables are the tables of the TCP and UDP sockets along with the states of
+// the sockets dumped through sock_diag, the TCP ones unless configured otherwise.
+var procNetTables = []struct {
+	name     string
+	protocol Protocol
+	state    uint8
+}{
+	{"tcp", ProtoTCP, tcpEstablished},
+	{"tcp6", ProtoTCP, tcpEstablished},
+	{"udp", ProtoUDP, udpConnection},
+	{"udp6", ProtoUDP, udpConnection},
+}
 
-			procInfo := inodeMap[m.IDiagInode]
+// getProcNetSockets lists the TCP and UDP sockets from the /proc/net tables, the same
+// ones sock_diag dumps, for the containers and hardened kernels blocking sock_diag.
+func (nl *netlinkConn) getProcNetSockets(inodeMap map[uint32]ProcessInfo) (OpenSockets, error) {
+	sockets := make(OpenSockets)
+	for _, table := range procNetTables {
+		f, err := os.Open(filepath.Join("/proc/net", table.name))
+		if err != nil {
+			// the IPv6 tables are missing with IPv6 disabled
+			if table.name == "tcp" {
+				return nil, err
+			}
+			continue
+		}
+		entries, err := parseProcNet(f, getNativeEndian())
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
 
-			var p Protocol
-			switch proto {
-			case syscall.IPPROTO_TCP:
-				p = ProtoTCP
-			case syscall.IPPROTO_UDP:
-				p = ProtoUDP
+		states := uint32(1) << table.state
+		if table.protocol == ProtoTCP {
+			states = nl.tcpStateMask()
+		}
+		for _, entry := range entries {
+			if states&(1<<entry.State) == 0 {
+				continue
 			}
-			sockets[LocalSocket{IP: srcIP, Port: uint16(m.ID.IdiagSport.Int()), Protocol: p}] = procInfo
+			local := LocalSocket{IP: entry.LocalIP, Port: entry.LocalPort, Protocol: table.protocol}
+			sockets[local] = SocketInfo{ProcessInfo: inodeMap[entry.Inode], State: SocketState(entry.State), UID: int(entry.UID)}
+		}
+	}
+	return sockets, nil
+}
+
+// getOpenSockets lists the sockets through sock_diag, falling back to the /proc/net
+// tables if it fails. The details of the sockets are only known to sock_diag. The
+// TCP/UDP sockets of the network namespaces of the given processes, e.g. those of
+// the containers, are dumped along.
+func (nl *netlinkConn) getOpenSockets(inodeMap map[uint32]ProcessInfo, netnsPids []int32, details *socketDetails) (OpenSockets, error) {
+	sockets, err := nl.getDiagSockets(inodeMap, details)
+	if err != nil {
+		if sockets, err = nl.getProcNetSockets(inodeMap); err != nil {
+			return nil, err
 		}
 	}
 
+	nl.getRawSockets(inodeMap, sockets)
+	nl.getNetnsSockets(netnsPids, inodeMap, details, sockets)
 	return sockets, nil
 }
 
-func (nl *netlinkConn) getOpenSockets(inodeMap map[uint32]ProcessInfo) (OpenSockets, error) {
+func (nl *netlinkConn) getDiagSockets(inodeMap map[uint32]ProcessInfo, details *socketDetails) (OpenSockets, error) {
 	sockets := make(OpenSockets)
 
 	type Req struct {
@@ -267,9 +586,10 @@ func (nl *netlinkConn) getOpenSockets(inodeMap map[uint32]ProcessInfo) (OpenSock
 		State    uint32
 	}
 
+	tcpStates := 1 | nl.tcpStateMask()
 	reqs := []Req{
-		{syscall.IPPROTO_TCP, syscall.AF_INET, uint32(1 | 1<<tcpEstablished)},
-		{syscall.IPPROTO_TCP, syscall.AF_INET6, uint32(1 | 1<<tcpEstablished)},
+		{syscall.IPPROTO_TCP, syscall.AF_INET, tcpStates},
+		{syscall.IPPROTO_TCP, syscall.AF_INET6, tcpStates},
 		{syscall.IPPROTO_UDP, syscall.AF_INET, uint32(1 << udpConnection)},
 		{syscall.IPPROTO_UDP, syscall.AF_INET6, uint32(1 << udpConnection)},
 	}
@@ -289,7 +609,7 @@ func (nl *netlinkConn) getOpenSockets(inodeMap map[uint32]ProcessInfo) (OpenSock
 	}
 
 	for _, fd := range fds {
-		m, err := nl.sockdiagRecv(fd.fd, fd.proto, inodeMap)
+		m, err := nl.sockdiagRecv(fd.fd, fd.proto, inodeMap, details)
 		if err != nil {
 			return sockets, err
 		}
@@ -302,9 +622,15 @@ func (nl *netlinkConn) getOpenSockets(inodeMap map[uint32]ProcessInfo) (OpenSock
 	return sockets, nil
 }
 
-func (nl *netlinkConn) getAllProcsInodes(pids ...int32) map[uint32]ProcessInfo {
+// getAllProcsInodes returns the inode to process map of the sockets of the processes,
+// stopping with the error of the context once done.
+func (nl *netlinkConn) getAllProcsInodes(ctx context.Context, pids ...int32) (map[uint32]ProcessInfo, error) {
 	inode2Procs := make(map[uint32]ProcessInfo)
 	for _, pid := range pids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		procName, inodes, err := nl.getProcInodes(pid)
 		if err != nil {
 			continue
@@ -317,7 +643,7 @@ func (nl *netlinkConn) getAllProcsInodes(pids ...int32) map[uint32]ProcessInfo {
 			}
 		}
 	}
-	return inode2Procs
+	return inode2Procs, nil
 }
 
 func (nl *netlinkConn) getProcInodes(pid int32) (string, []uint32, error) {
@@ -326,6 +652,9 @@ func (nl *netlinkConn) getProcInodes(pid int32) (string, []uint32, error) {
 	if err != nil {
 		return procName, inodeFds, err
 	}
+	if !nl.procFilter().allow(pid, filepath.Base(procName)) {
+		return procName, inodeFds, errProcFiltered
+	}
 
 	f, err := os.Open(fmt.Sprintf("/proc/%d/fd", pid))
 	if err != nil {
@@ -370,9 +699,10 @@ func (nl *netlinkConn) listPids() ([]int32, error) {
 		return pids, err
 	}
 
+	filter := nl.procFilter()
 	for _, fname := range fnames {
 		pid, err := strconv.ParseInt(fname, 10, 32)
-		if err != nil {
+		if err != nil || filter.skipPid(int32(pid)) {
 			continue
 		}
 		pids = append(pids, int32(pid))
@@ -381,14 +711,28 @@ func (nl *netlinkConn) listPids() ([]int32, error) {
 	return pids, nil
 }
 
-func (nl *netlinkConn) GetOpenSockets() (OpenSockets, error) {
+// GetOpenSockets walks the processes and dumps their sockets, giving up with the error
+// of the context once done. A dump under way ends within the reply timeout.
+func (nl *netlinkConn) GetOpenSockets(ctx context.Context) (OpenSockets, error) {
 	pids, err := nl.listPids()
 	if err != nil {
 		return nil, err
 	}
 
-	inodeMap := nl.getAllProcsInodes(pids...)
-	return nl.getOpenSockets(inodeMap)
+	own, _ := procNetns(int32(os.Getpid()))
+	netns := make(map[int32]uint64, len(pids))
+	for _, pid := range pids {
+		netns[pid], _ = procNetns(pid)
+	}
+
+	inodeMap, err := nl.getAllProcsInodes(ctx, pids...)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nl.getOpenSockets(inodeMap, foreignNetns(netns, own), nil)
 }
 
 func GetSocketFetcher() SocketFetcher {
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestSockdiagErr(t *testing.T) {
+	nlmsgerr := func(errno int32) []byte {
+		data := make([]byte, 20)
+		getNativeEndian().PutUint32(data, uint32(errno))
+		return data
+	}
+
+	assert.NoError(t, sockdiagErr(nlmsgerr(0)))
+
+	err := sockdiagErr(nlmsgerr(-int32(unix.EPERM)))
+	assert.True(t, errors.Is(err, os.ErrPermission))
+	assert.False(t, errors.Is(err, ErrSockDiagUnsupported))
+
+	err = sockdiagErr(nlmsgerr(-int32(unix.ENOENT)))
+	assert.True(t, errors.Is(err, ErrSockDiagUnsupported))
+	assert.False(t, errors.Is(err, os.ErrPermission))
+	assert.EqualError(t, err, "sock_diag dump: no such file or directory")
+
+	var diagErr *SockDiagError
+	assert.True(t, errors.As(sockdiagOpErr("socket", unix.EPROTONOSUPPORT), &diagErr))
+	assert.Equal(t, "socket", diagErr.Op)
+	assert.True(t, errors.Is(diagErr, ErrSockDiagUnsupported))
+
+	assert.Error(t, sockdiagErr(nil))
+}
@@ -4,6 +4,7 @@
 package sniffer
 
 import (
+	"context"
 	"path/filepath"
 
 	"github.com/shirou/gopsutil/net"
@@ -12,26 +13,26 @@ import (
 
 type psutilConn struct{}
 
-func (ps *psutilConn) GetOpenSockets() (OpenSockets, error) {
+func (ps *psutilConn) GetOpenSockets(ctx context.Context) (OpenSockets, error) {
 	openSockets := make(OpenSockets)
-	if err := ps.getConnections(ProtoTCP, openSockets); err != nil {
+	if err := ps.getConnections(ctx, ProtoTCP, openSockets); err != nil {
 		return nil, err
 	}
-	if err := ps.getConnections(ProtoUDP, openSockets); err != nil {
+	if err := ps.getConnections(ctx, ProtoUDP, openSockets); err != nil {
 		return nil, err
 	}
 
 	return openSockets, nil
 }
 
-func (ps *psutilConn) getProcName(pid int32) ProcessInfo {
+func (ps *psutilConn) getProcName(ctx context.Context, pid int32) ProcessInfo {
 	procInfo := ProcessInfo{Name: unknownProcessName}
 
-	proc, err := process.NewProcess(pid)
+	proc, err := process.NewProcessWithContext(ctx, pid)
 	if err != nil {
 		return procInfo
 	}
-	exe, err := proc.Exe()
+	exe, err := proc.ExeWithContext(ctx)
 	if err != nil {
 		return procInfo
 	}
@@ -41,13 +42,16 @@ func (ps *psutilConn) getProcName(pid int32) ProcessInfo {
 	return procInfo
 }
 
-func (ps *psutilConn) getConnections(proto Protocol, openSockets OpenSockets) error {
-	connections, err := net.Connections(string(proto))
+func (ps *psutilConn) getConnections(ctx context.Context, proto Protocol, openSockets OpenSockets) error {
+	connections, err := net.ConnectionsWithContext(ctx, string(proto))
 	if err != nil {
 		return err
 	}
 
 	for _, conn := range connections {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if proto == ProtoTCP && conn.Status != "ESTABLISHED" {
 			continue
 		}
@@ -57,7 +61,12 @@ func (ps *psutilConn) getConnections(proto Protocol, openSockets OpenSockets) er
 			Port:     uint16(conn.Laddr.Port),
 			Protocol: proto,
 		}
-		openSockets[localSocket] = ps.getProcName(conn.Pid)
+		state, _ := ParseSocketState(conn.Status)
+		info := SocketInfo{ProcessInfo: ps.getProcName(ctx, conn.Pid), State: state, UID: -1}
+		if len(conn.Uids) > 0 {
+			info.UID = int(conn.Uids[0])
+		}
+		openSockets[localSocket] = info
 	}
 	return nil
 }
@@ -0,0 +1,78 @@
+package sniffer
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// containerLinger is how long the container of a pid is taken as looked up, the pids
+// being recycled.
+const containerLinger = time.Minute
+
+// containerIDLen is the length of the short container IDs, as docker shows them.
+const containerIDLen = 12
+
+// containerEntry is the container of a pid along with when it was looked up.
+type containerEntry struct {
+	id string
+	at time.Time
+}
+
+// containers caches the containers of the pids.
+var containers sync.Map
+
+// containerOf returns the short ID of the container running the pid, empty if the pid
+// runs on the host or is unknown.
+func containerOf(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	now := time.Now()
+	if e, ok := containers.Load(pid); ok && now.Sub(e.(containerEntry).at) < containerLinger {
+		return e.(containerEntry).id
+	}
+	id := lookupContainer(pid)
+	containers.Store(pid, containerEntry{id: id, at: now})
+	return id
+}
+
+// parseContainerID parses the container ID out of a /proc/<pid>/cgroup file, as the
+// cgroups of docker, containerd, CRI-O and podman name it, e.g.
+// 0::/system.slice/docker-<id>.scope or 12:pids:/kubepods/burstable/<pod>/<id>.
+func parseContainerID(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		segments := strings.Split(parts[2], "/")
+		for i := len(segments) - 1; i >= 0; i-- {
+			if id := cgroupContainerID(segments[i]); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// cgroupContainerID returns the short container ID a cgroup is named after, empty if
+// none.
+func cgroupContainerID(name string) string {
+	name = strings.TrimSuffix(name, ".scope")
+	for _, prefix := range []string{"docker-", "cri-containerd-", "crio-", "libpod-"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	if len(name) != 64 {
+		return ""
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return ""
+		}
+	}
+	return name[:containerIDLen]
+}
@@ -0,0 +1,19 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"fmt"
+	"os"
+)
+
+// lookupContainer reads the container of the pid out of its cgroups.
+func lookupContainer(pid int) string {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return parseContainerID(f)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package sniffer
+
+// lookupContainer knows no container off Linux.
+func lookupContainer(pid int) string {
+	return ""
+}
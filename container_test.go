@@ -0,0 +1,25 @@
+package sniffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContainerID(t *testing.T) {
+	id := strings.Repeat("0123456789abcdef", 4)
+	for _, cgroup := range []string{
+		"0::/system.slice/docker-" + id + ".scope",
+		"12:pids:/docker/" + id,
+		"0::/kubepods.slice/kubepods-burstable.slice/cri-containerd-" + id + ".scope",
+		"11:memory:/kubepods/burstable/pod1234/" + id + "\n0::/",
+		"0::/user.slice/user-1000.slice/user@1000.service/libpod-" + id + ".scope/container",
+	} {
+		assert.Equal(t, "0123456789ab", parseContainerID(strings.NewReader(cgroup)), cgroup)
+	}
+
+	assert.Equal(t, "", parseContainerID(strings.NewReader("0::/user.slice/user-1000.slice/session-2.scope")))
+	assert.Equal(t, "", parseContainerID(strings.NewReader("0::/docker/"+strings.ToUpper(id))))
+	assert.Equal(t, "", containerOf(0))
+}
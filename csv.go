@@ -0,0 +1,136 @@
+package sniffer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// CSVSection is a table of the snapshot written as CSV.
+type CSVSection string
+
+const (
+	CSVProcesses   CSVSection = "processes"
+	CSVRemoteAddrs CSVSection = "remote-addrs"
+	CSVConnections CSVSection = "connections"
+)
+
+// CSVSections are the tables of the snapshot ExportCSV writes.
+var CSVSections = []CSVSection{CSVProcesses, CSVRemoteAddrs, CSVConnections}
+
+// csvExportTimeFormat is the timestamp of the exported files, sorting by time.
+const csvExportTimeFormat = "20060102-150405"
+
+var (
+	networkDataCSVHeader = []string{
+		"connections", "upload_bytes", "download_bytes", "upload_payload_bytes", "download_payload_bytes",
+		"upload_packets", "download_packets", "upload_rate", "download_rate",
+	}
+	connectionCSVHeader = []string{
+		"protocol", "local_ip", "local_port", "remote_ip", "remote_port", "remote_service", "process", "interface", "server_name",
+		"upload_bytes", "download_bytes", "upload_payload_bytes", "download_payload_bytes",
+		"upload_packets", "download_packets", "upload_rate", "download_rate", "first_seen", "last_seen",
+	}
+)
+
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', 2, 64)
+}
+
+func networkDataCSVRecord(d *NetworkData) []string {
+	return []string{
+		strconv.Itoa(d.ConnCount),
+		strconv.Itoa(d.UploadBytes),
+		strconv.Itoa(d.DownloadBytes),
+		strconv.Itoa(d.UploadPayloadBytes),
+		strconv.Itoa(d.DownloadPayloadBytes),
+		strconv.Itoa(d.UploadPackets),
+		strconv.Itoa(d.DownloadPackets),
+		formatRate(d.UploadRate),
+		formatRate(d.DownloadRate),
+	}
+}
+
+func connectionCSVRecord(conn Connection, d *ConnectionData) []string {
+	return []string{
+		string(conn.Local.Protocol),
+		conn.Local.IP,
+		strconv.Itoa(int(conn.Local.Port)),
+		conn.Remote.IP,
+		strconv.Itoa(int(conn.Remote.Port)),
+		conn.RemoteService(),
+		d.ProcessName,
+		d.InterfaceName,
+		d.ServerName,
+		strconv.Itoa(d.UploadBytes),
+		strconv.Itoa(d.DownloadBytes),
+		strconv.Itoa(d.UploadPayloadBytes),
+		strconv.Itoa(d.DownloadPayloadBytes),
+		strconv.Itoa(d.UploadPackets),
+		strconv.Itoa(d.DownloadPackets),
+		formatRate(d.UploadRate),
+		formatRate(d.DownloadRate),
+		d.FirstSeen.Format(time.RFC3339),
+		d.LastSeen.Format(time.RFC3339),
+	}
+}
+
+// WriteCSV writes the section of the snapshot as CSV with a header, the rows ranking
+// by their bytes as in the tables, the processes and the remote addresses by their
+// totals since started if cumulative.
+func (s *Snapshot) WriteCSV(w io.Writer, section CSVSection) error {
+	cw := csv.NewWriter(w)
+	var records [][]string
+	switch section {
+	case CSVProcesses:
+		records = append(records, append([]string{"process"}, networkDataCSVHeader...))
+		for _, r := range s.TopNProcesses(math.MaxInt32, ModeTableBytes) {
+			records = append(records, append([]string{r.ProcessName}, networkDataCSVRecord(r.Data)...))
+		}
+	case CSVRemoteAddrs:
+		records = append(records, append([]string{"remote_addr"}, networkDataCSVHeader...))
+		for _, r := range s.TopNRemoteAddrs(math.MaxInt32, ModeTableBytes) {
+			records = append(records, append([]string{r.Addr}, networkDataCSVRecord(r.Data)...))
+		}
+	case CSVConnections:
+		records = append(records, connectionCSVHeader)
+		for _, r := range s.TopNConnections(math.MaxInt32, ModeTableBytes) {
+			records = append(records, connectionCSVRecord(r.Conn, r.Data))
+		}
+	default:
+		return fmt.Errorf("invalid CSV section %q", section)
+	}
+	return cw.WriteAll(records)
+}
+
+// ExportCSV writes each of the CSVSections to its own file in the directory, named
+// after the section and the time, e.g. sniffer-processes-20220102-150405.csv, and
+// returns the paths written.
+func (s *Snapshot) ExportCSV(dir string, now time.Time) ([]string, error) {
+	var paths []string
+	for _, section := range CSVSections {
+		path := filepath.Join(dir, fmt.Sprintf("sniffer-%s-%s.csv", section, now.Format(csvExportTimeFormat)))
+		if err := s.writeCSVFile(path, section); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func (s *Snapshot) writeCSVFile(path string, section CSVSection) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.WriteCSV(f, section); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
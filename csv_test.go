@@ -0,0 +1,70 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func csvSnapshot() *Snapshot {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	wget := &ProcessInfo{Pid: 2, Name: "wget"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{IP: "10.0.0.1", Port: 1, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}: {Process: curl, UploadBytes: 4000, UploadPackets: 4},
+		{Local: LocalSocket{IP: "10.0.0.1", Port: 2, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "8.8.8.8", Port: 443}}: {Process: wget, DownloadBytes: 200},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.put(stat, time.Now())
+	return s.getSnapshot()
+}
+
+func TestSnapshotWriteCSV(t *testing.T) {
+	snapshot := csvSnapshot()
+
+	var buf bytes.Buffer
+	assert.NoError(t, snapshot.WriteCSV(&buf, CSVProcesses))
+	records, err := csv.NewReader(&buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, append([]string{"process"}, networkDataCSVHeader...), records[0])
+	assert.Equal(t, []string{"<1>:curl", "1", "2000", "0", "0", "0", "2", "0", "2000.00", "0.00"}, records[1])
+	assert.Equal(t, "<2>:wget", records[2][0])
+
+	buf.Reset()
+	assert.NoError(t, snapshot.WriteCSV(&buf, CSVConnections))
+	records, err = csv.NewReader(&buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, connectionCSVHeader, records[0])
+	assert.Equal(t, []string{"tcp", "10.0.0.1", "1", "1.1.1.1", "443", "https", "<1>:curl"}, records[1][:7])
+
+	assert.Error(t, snapshot.WriteCSV(&buf, CSVSection("neighbors")))
+}
+
+func TestSnapshotExportCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2022, 1, 2, 15, 4, 5, 0, time.Local)
+	paths, err := csvSnapshot().ExportCSV(dir, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "sniffer-processes-20220102-150405.csv"),
+		filepath.Join(dir, "sniffer-remote-addrs-20220102-150405.csv"),
+		filepath.Join(dir, "sniffer-connections-20220102-150405.csv"),
+	}, paths)
+	for _, path := range paths {
+		assert.FileExists(t, path)
+	}
+
+	_, err = csvSnapshot().ExportCSV(filepath.Join(dir, "missing"), now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package sniffer
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// packetLayers are preallocated layers along with the parsers decoding packets into
+// them, down to the TCP/UDP layer, without allocating.
+type packetLayers struct {
+	ether layers.Ethernet
+	arp   layers.ARP
+	ipv4  layers.IPv4
+	ipv6  layers.IPv6
+	tcp   layers.TCP
+	udp   layers.UDP
+
+	icmp4 layers.ICMPv4
+	icmp6 layers.ICMPv6
+
+	// network and transport are the IP and TCP/UDP layers of the latest packet
+	// decoded, nil if absent
+	network   gopacket.Layer
+	transport gopacket.Layer
+
+	parsers map[layers.EthernetType]*gopacket.DecodingLayerParser
+	types   []gopacket.LayerType
+}
+
+func newPacketLayers() *packetLayers {
+	l := &packetLayers{types: make([]gopacket.LayerType, 0, 4)}
+	newParser := func(first gopacket.LayerType) *gopacket.DecodingLayerParser {
+		parser := gopacket.NewDecodingLayerParser(first, &l.ether, &l.arp, &l.ipv4, &l.ipv6, &l.tcp, &l.udp)
+		parser.IgnoreUnsupported = true
+		return parser
+	}
+
+	// transparent ethernet bridging stands for the packets starting with an ethernet
+	// frame, the rest being bare IP packets
+	l.parsers = map[layers.EthernetType]*gopacket.DecodingLayerParser{
+		layers.EthernetTypeTransparentEthernetBridging: newParser(layers.LayerTypeEthernet),
+		layers.EthernetTypeIPv4:                        newParser(layers.LayerTypeIPv4),
+		layers.EthernetTypeIPv6:                        newParser(layers.LayerTypeIPv6),
+	}
+	return l
+}
+
+// decode decodes the data starting with a layer of the ethernet type as deep as the
+// parsers go, which stops at the layers without a decoder like MPLS, GRE and the
+// IP fragments. It returns false if the data fails decoding.
+func (l *packetLayers) decode(etype layers.EthernetType, data []byte) bool {
+	l.network, l.transport = nil, nil
+	parser, ok := l.parsers[etype]
+	if !ok || parser.DecodeLayers(data, &l.types) != nil || len(l.types) == 0 {
+		return false
+	}
+
+	for _, typ := range l.types {
+		switch typ {
+		case layers.LayerTypeIPv4:
+			l.network = &l.ipv4
+		case layers.LayerTypeIPv6:
+			l.network = &l.ipv6
+		case layers.LayerTypeTCP:
+			l.transport = &l.tcp
+		case layers.LayerTypeUDP:
+			l.transport = &l.udp
+		}
+	}
+	return true
+}
+
+// last returns the type of the deepest layer decoded.
+func (l *packetLayers) last() gopacket.LayerType {
+	return l.types[len(l.types)-1]
+}
+
+// decodeEcho decodes the ICMP or ICMPv6 echo carried by an IP layer of the given
+// protocol, nil if it isn't one.
+func (l *packetLayers) decodeEcho(proto layers.IPProtocol, data []byte) gopacket.Layer {
+	switch proto {
+	case layers.IPProtocolICMPv4:
+		if l.icmp4.DecodeFromBytes(data, gopacket.NilDecodeFeedback) != nil {
+			return nil
+		}
+		if t := l.icmp4.TypeCode.Type(); t == layers.ICMPv4TypeEchoRequest || t == layers.ICMPv4TypeEchoReply {
+			return &l.icmp4
+		}
+
+	case layers.IPProtocolICMPv6:
+		if l.icmp6.DecodeFromBytes(data, gopacket.NilDecodeFeedback) != nil {
+			return nil
+		}
+		if icmpv6Echo(&l.icmp6) {
+			return &l.icmp6
+		}
+	}
+	return nil
+}
+
+// icmpv6Echo reports whether the ICMPv6 layer is an echo, which gopacket decodes into
+// an ICMPv6Echo layer lacking its contents and payload.
+func icmpv6Echo(icmp *layers.ICMPv6) bool {
+	t := icmp.TypeCode.Type()
+	return (t == layers.ICMPv6TypeEchoRequest || t == layers.ICMPv6TypeEchoReply) && len(icmp.Payload) >= 4
+}
+
+// decodeTransport decodes the TCP/UDP layer carried by an IP layer of the given protocol.
+func decodeTransport(proto layers.IPProtocol, data []byte, tcp *layers.TCP, udp *layers.UDP) gopacket.Layer {
+	switch proto {
+	case layers.IPProtocolTCP:
+		if err := tcp.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			return tcp
+		}
+	case layers.IPProtocolUDP:
+		if err := udp.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err == nil {
+			return udp
+		}
+	}
+	return nil
+}
+
+// wirePackets estimates the number of wire packets a GRO/GSO super-packet exceeding
+// the MTU of the capturing device stands for, along with the bytes of them.
+func wirePackets(mtu, ipHeaderLen, headerLen, payloadLen int) (int, int) {
+	mss := mtu - ipHeaderLen - headerLen
+	if mss <= 0 || ipHeaderLen+headerLen+payloadLen <= mtu {
+		return 1, headerLen + payloadLen
+	}
+
+	n := (payloadLen + mss - 1) / mss
+	return n, n*headerLen + payloadLen
+}
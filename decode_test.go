@@ -0,0 +1,76 @@
+package sniffer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacketLayersDecode(t *testing.T) {
+	ether := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP("10.0.0.1"), DstIP: net.ParseIP("10.0.0.2")}
+	tcp := &layers.TCP{SrcPort: 50000, DstPort: 443, Seq: 1, SYN: true}
+	assert.NoError(t, tcp.SetNetworkLayerForChecksum(ip))
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	assert.NoError(t, gopacket.SerializeLayers(buf, opts, ether, ip, tcp, gopacket.Payload("hello")))
+	frame := buf.Bytes()
+
+	l := newPacketLayers()
+	assert.True(t, l.decode(layers.EthernetTypeTransparentEthernetBridging, frame))
+	assert.Equal(t, &l.ipv4, l.network)
+	assert.Equal(t, &l.tcp, l.transport)
+	assert.Equal(t, layers.TCPPort(443), l.tcp.DstPort)
+	assert.Equal(t, []byte("hello"), l.tcp.Payload)
+
+	// bare IP packets
+	assert.True(t, l.decode(layers.EthernetTypeIPv4, frame[14:]))
+	assert.Equal(t, &l.tcp, l.transport)
+	assert.False(t, l.decode(0, frame[14:]))
+
+	// the parser stops ahead of fragments
+	frame[14+6] |= 0x20
+	assert.True(t, l.decode(layers.EthernetTypeTransparentEthernetBridging, frame))
+	assert.Equal(t, &l.ipv4, l.network)
+	assert.Nil(t, l.transport)
+	assert.Equal(t, layers.LayerTypeIPv4, l.last())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		l.decode(layers.EthernetTypeTransparentEthernetBridging, frame)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestPacketLayersDecodeEcho(t *testing.T) {
+	serialize := func(ls ...gopacket.SerializableLayer) []byte {
+		buf := gopacket.NewSerializeBuffer()
+		assert.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, ls...))
+		return buf.Bytes()
+	}
+	l := newPacketLayers()
+
+	ping := serialize(&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 4242, Seq: 1}, gopacket.Payload("ping"))
+	assert.Equal(t, &l.icmp4, l.decodeEcho(layers.IPProtocolICMPv4, ping))
+	assert.Equal(t, uint16(4242), l.icmp4.Id)
+
+	unreachable := serialize(&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, 3)})
+	assert.Nil(t, l.decodeEcho(layers.IPProtocolICMPv4, unreachable))
+
+	pong := serialize(
+		&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoReply, 0)},
+		&layers.ICMPv6Echo{Identifier: 4242, SeqNumber: 1},
+		gopacket.Payload("pong"),
+	)
+	assert.Equal(t, &l.icmp6, l.decodeEcho(layers.IPProtocolICMPv6, pong))
+	assert.Equal(t, []byte{0x10, 0x92, 0, 1, 'p', 'o', 'n', 'g'}, l.icmp6.Payload)
+
+	assert.Nil(t, l.decodeEcho(layers.IPProtocolTCP, ping))
+}
@@ -0,0 +1,78 @@
+package sniffer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+const (
+	// dedupWindow bounds how far apart the copies of a packet captured on several
+	// devices, like a bond and its members, are seen.
+	dedupWindow = 50 * time.Millisecond
+
+	// dedupPrefix bounds the bytes of the IP payload fingerprinted, which covers the
+	// transport header and enough data to tell the IPv6 packets apart.
+	dedupPrefix = 64
+)
+
+type dedupEntry struct {
+	device string
+	ts     time.Time
+}
+
+// dedupTable spots the packets seen on a device already, shared by the handlers of
+// all the devices.
+type dedupTable struct {
+	mut       sync.Mutex
+	seen      map[uint64]dedupEntry
+	lastSweep time.Time
+}
+
+func newDedupTable() *dedupTable {
+	return &dedupTable{seen: make(map[uint64]dedupEntry)}
+}
+
+// fnv1a folds the data into the 64-bit FNV-1a hash.
+func fnv1a(h uint64, data []byte) uint64 {
+	for _, b := range data {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	return h
+}
+
+// packetFingerprint hashes the IP header along with the start of its payload, the
+// copies of a packet forwarded unchanged are the same in that.
+func packetFingerprint(network gopacket.Layer) uint64 {
+	payload := network.LayerPayload()
+	if len(payload) > dedupPrefix {
+		payload = payload[:dedupPrefix]
+	}
+	return fnv1a(fnv1a(14695981039346656037, network.LayerContents()), payload)
+}
+
+// Duplicate reports whether the packet was seen on another device within the window,
+// the repeats on the same device are genuine ones.
+func (t *dedupTable) Duplicate(network gopacket.Layer, device string, ts time.Time) bool {
+	fp := packetFingerprint(network)
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if ts.Sub(t.lastSweep) > time.Second {
+		for k, e := range t.seen {
+			if ts.Sub(e.ts) > dedupWindow {
+				delete(t.seen, k)
+			}
+		}
+		t.lastSweep = ts
+	}
+
+	if e, ok := t.seen[fp]; ok && e.device != device && ts.Sub(e.ts) <= dedupWindow && e.ts.Sub(ts) <= dedupWindow {
+		return true
+	}
+	t.seen[fp] = dedupEntry{device: device, ts: ts}
+	return false
+}
@@ -0,0 +1,30 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupTable(t *testing.T) {
+	table := newDedupTable()
+	packet := func(id uint16) *layers.IPv4 {
+		ip := &layers.IPv4{}
+		ip.Contents = []byte{0x45, 0, 0, 40, byte(id >> 8), byte(id), 0, 0, 64, 6}
+		ip.Payload = []byte("tcp segment")
+		return ip
+	}
+	now := time.Now()
+
+	assert.False(t, table.Duplicate(packet(1), "bond0", now))
+	assert.True(t, table.Duplicate(packet(1), "eth0", now.Add(time.Millisecond)))
+	assert.False(t, table.Duplicate(packet(2), "eth0", now.Add(time.Millisecond)))
+
+	// repeats on the same device are genuine
+	assert.False(t, table.Duplicate(packet(2), "eth0", now.Add(2*time.Millisecond)))
+
+	// so are the ones out of the window
+	assert.False(t, table.Duplicate(packet(1), "eth1", now.Add(time.Second)))
+}
@@ -0,0 +1,213 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	dhcpServerPort   = 67
+	dhcpClientPort   = 68
+	dhcpv6ClientPort = 546
+	dhcpv6ServerPort = 547
+)
+
+// dhcpMaxEvents bounds the DHCP events kept by the sinker.
+const dhcpMaxEvents = 100
+
+// DHCPEventType is the kind of change a DHCP exchange made to a lease.
+type DHCPEventType string
+
+const (
+	DHCPLease   DHCPEventType = "lease"   // the server granted or renewed a lease
+	DHCPNak     DHCPEventType = "nak"     // the server refused the requested address
+	DHCPRelease DHCPEventType = "release" // the client gave the lease up
+	DHCPDecline DHCPEventType = "decline" // the client found the address already in use
+)
+
+// DHCPEvent is a lease event of DHCP/DHCPv6.
+type DHCPEvent struct {
+	Time      time.Time
+	Interface string
+	Type      DHCPEventType
+	Client    string        // Hardware address of the client, its DUID if unknown
+	IP        string        // Address the event is about, empty for a NAK
+	Server    string        // Address of the DHCP server, its DUID for DHCPv6
+	Hostname  string        // Host name of the client if sent along
+	LeaseTime time.Duration // Valid lifetime of a granted lease
+}
+
+// dhcpEvent returns the lease event carried by the UDP segment, if any.
+func dhcpEvent(seg *Segment, payload []byte) (DHCPEvent, bool) {
+	conn := seg.Connection
+	if conn.Local.Protocol != ProtoUDP {
+		return DHCPEvent{}, false
+	}
+
+	srcIP, srcPort := conn.Remote.IP, conn.Remote.Port
+	if seg.Direction == DirectionUpload {
+		srcIP, srcPort = conn.Local.IP, conn.Local.Port
+	}
+
+	var ev DHCPEvent
+	var ok bool
+	switch srcPort {
+	case dhcpServerPort, dhcpClientPort:
+		ev, ok = parseDHCPv4Event(payload, srcIP)
+	case dhcpv6ServerPort, dhcpv6ClientPort:
+		ev, ok = parseDHCPv6Event(payload)
+	}
+	ev.Time = time.Now()
+	ev.Interface = seg.Interface
+	return ev, ok
+}
+
+func parseDHCPv4Event(data []byte, srcIP string) (DHCPEvent, bool) {
+	var dhcp layers.DHCPv4
+	if err := dhcp.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		return DHCPEvent{}, false
+	}
+
+	ev := DHCPEvent{Client: dhcp.ClientHWAddr.String()}
+	var msgType layers.DHCPMsgType
+	var serverID, requestIP net.IP
+	for _, opt := range dhcp.Options {
+		switch opt.Type {
+		case layers.DHCPOptMessageType:
+			if len(opt.Data) == 1 {
+				msgType = layers.DHCPMsgType(opt.Data[0])
+			}
+		case layers.DHCPOptServerID:
+			if len(opt.Data) == net.IPv4len {
+				serverID = opt.Data
+			}
+		case layers.DHCPOptRequestIP:
+			if len(opt.Data) == net.IPv4len {
+				requestIP = opt.Data
+			}
+		case layers.DHCPOptLeaseTime:
+			if len(opt.Data) == 4 {
+				ev.LeaseTime = time.Duration(binary.BigEndian.Uint32(opt.Data)) * time.Second
+			}
+		case layers.DHCPOptHostname:
+			ev.Hostname = string(opt.Data)
+		}
+	}
+
+	// replies are sent by the server itself unless relayed
+	ev.Server = srcIP
+	if serverID != nil {
+		ev.Server = serverID.String()
+	}
+
+	switch msgType {
+	case layers.DHCPMsgTypeAck:
+		ev.Type = DHCPLease
+		ev.IP = dhcp.YourClientIP.String()
+	case layers.DHCPMsgTypeNak:
+		ev.Type = DHCPNak
+	case layers.DHCPMsgTypeRelease:
+		ev.Type = DHCPRelease
+		ev.IP = dhcp.ClientIP.String()
+	case layers.DHCPMsgTypeDecline:
+		ev.Type = DHCPDecline
+		// the declined address is sent in option 50, some clients set ciaddr instead
+		switch {
+		case requestIP != nil:
+			ev.IP = requestIP.String()
+		case dhcp.ClientIP != nil && !dhcp.ClientIP.IsUnspecified():
+			ev.IP = dhcp.ClientIP.String()
+		}
+	default:
+		return DHCPEvent{}, false
+	}
+	return ev, true
+}
+
+func parseDHCPv6Event(data []byte) (DHCPEvent, bool) {
+	var dhcp layers.DHCPv6
+	if err := dhcp.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		return DHCPEvent{}, false
+	}
+
+	var ev DHCPEvent
+	switch dhcp.MsgType {
+	case layers.DHCPv6MsgTypeReply:
+		ev.Type = DHCPLease
+	case layers.DHCPv6MsgTypeRelease:
+		ev.Type = DHCPRelease
+	case layers.DHCPv6MsgTypeDecline:
+		ev.Type = DHCPDecline
+	default:
+		return DHCPEvent{}, false
+	}
+
+	for _, opt := range dhcp.Options {
+		switch opt.Code {
+		case layers.DHCPv6OptClientID:
+			ev.Client = duidString(opt.Data)
+		case layers.DHCPv6OptServerID:
+			ev.Server = duidString(opt.Data)
+		case layers.DHCPv6OptIANA:
+			if ip, valid := parseIANA(opt.Data); ip != nil && ev.IP == "" {
+				ev.IP, ev.LeaseTime = ip.String(), valid
+			}
+		}
+	}
+
+	// replies to information requests carry no address
+	if ev.IP == "" {
+		return DHCPEvent{}, false
+	}
+	return ev, true
+}
+
+// parseIANA returns the first address of an IA_NA option and its valid lifetime.
+func parseIANA(data []byte) (net.IP, time.Duration) {
+	// IAID(4) T1(4) T2(4) options
+	if len(data) < 12 {
+		return nil, 0
+	}
+	data = data[12:]
+
+	// option: code(2) length(2) data, IAADDR: address(16) preferred(4) valid(4) options
+	for len(data) >= 4 {
+		code := layers.DHCPv6Opt(binary.BigEndian.Uint16(data))
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+length {
+			return nil, 0
+		}
+		if code == layers.DHCPv6OptIAAddr && length >= 24 {
+			valid := binary.BigEndian.Uint32(data[4+20:])
+			return net.IP(data[4 : 4+16]), time.Duration(valid) * time.Second
+		}
+		data = data[4+length:]
+	}
+	return nil, 0
+}
+
+// duidString returns the hardware address of a link-layer DUID, the hex DUID otherwise.
+func duidString(duid []byte) string {
+	if len(duid) < 4 || binary.BigEndian.Uint16(duid[2:]) != uint16(layers.LinkTypeEthernet) {
+		return hex.EncodeToString(duid)
+	}
+
+	switch layers.DHCPv6DUIDType(binary.BigEndian.Uint16(duid)) {
+	case layers.DHCPv6DUIDTypeLLT:
+		// type(2) hardware type(2) time(4) address
+		if len(duid) == 8+6 {
+			return net.HardwareAddr(duid[8:]).String()
+		}
+	case layers.DHCPv6DUIDTypeLL:
+		// type(2) hardware type(2) address
+		if len(duid) == 4+6 {
+			return net.HardwareAddr(duid[4:]).String()
+		}
+	}
+	return hex.EncodeToString(duid)
+}
@@ -0,0 +1,89 @@
+package sniffer
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDHCPEvent(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	dhcp := &layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		YourClientIP: net.IPv4(192, 168, 1, 50),
+		ClientHWAddr: mac,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeAck)}),
+			layers.NewDHCPOption(layers.DHCPOptServerID, []byte{192, 168, 1, 1}),
+			layers.NewDHCPOption(layers.DHCPOptLeaseTime, []byte{0, 0, 0x0e, 0x10}),
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	assert.NoError(t, dhcp.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}))
+
+	seg := &Segment{
+		Interface: "eth0",
+		Direction: DirectionDownload,
+		Connection: Connection{
+			Local:  LocalSocket{IP: "255.255.255.255", Port: dhcpClientPort, Protocol: ProtoUDP},
+			Remote: RemoteSocket{IP: "192.168.1.254", Port: dhcpServerPort},
+		},
+	}
+	ev, ok := dhcpEvent(seg, buf.Bytes())
+	assert.True(t, ok)
+	assert.Equal(t, DHCPLease, ev.Type)
+	assert.Equal(t, "00:11:22:33:44:55", ev.Client)
+	assert.Equal(t, "192.168.1.50", ev.IP)
+	assert.Equal(t, "192.168.1.1", ev.Server)
+	assert.Equal(t, time.Hour, ev.LeaseTime)
+}
+
+func TestDHCPDeclineEvent(t *testing.T) {
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	seg := &Segment{
+		Interface: "eth0",
+		Direction: DirectionUpload,
+		Connection: Connection{
+			Local:  LocalSocket{IP: "0.0.0.0", Port: dhcpClientPort, Protocol: ProtoUDP},
+			Remote: RemoteSocket{IP: "255.255.255.255", Port: dhcpServerPort},
+		},
+	}
+	decline := func(clientIP net.IP, opts ...layers.DHCPOption) DHCPEvent {
+		dhcp := &layers.DHCPv4{
+			Operation:    layers.DHCPOpRequest,
+			HardwareType: layers.LinkTypeEthernet,
+			ClientIP:     clientIP,
+			ClientHWAddr: mac,
+			Options: append(layers.DHCPOptions{
+				layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDecline)}),
+			}, opts...),
+		}
+		buf := gopacket.NewSerializeBuffer()
+		assert.NoError(t, dhcp.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}))
+		ev, ok := dhcpEvent(seg, buf.Bytes())
+		assert.True(t, ok)
+		assert.Equal(t, DHCPDecline, ev.Type)
+		return ev
+	}
+
+	ev := decline(net.IPv4zero, layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{192, 168, 1, 50}))
+	assert.Equal(t, "192.168.1.50", ev.IP)
+	ev = decline(net.IPv4(192, 168, 1, 51))
+	assert.Equal(t, "192.168.1.51", ev.IP)
+	ev = decline(net.IPv4zero)
+	assert.Equal(t, "", ev.IP)
+}
+
+func TestDUIDString(t *testing.T) {
+	llt, _ := hex.DecodeString("000100012a5b3c4d001122334455")
+	assert.Equal(t, "00:11:22:33:44:55", duidString(llt))
+
+	en, _ := hex.DecodeString("0002000000090102")
+	assert.Equal(t, "0002000000090102", duidString(en))
+}
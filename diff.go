@@ -0,0 +1,132 @@
+package sniffer
+
+import "sort"
+
+// TrafficDelta is the change of the traffic of a connection, a process or a remote
+// address from a snapshot to a later one.
+type TrafficDelta struct {
+	UploadBytes     int
+	DownloadBytes   int
+	UploadPackets   int
+	DownloadPackets int
+}
+
+// SnapshotDiff is what changed from a snapshot to a later one. The traffic of the
+// snapshots being per second, the deltas of the connections, the processes and the
+// remote addresses are the changes of their rates, while the transfers are the
+// traffic between the snapshots by the totals since started.
+type SnapshotDiff struct {
+	NewConnections    []Connection
+	ClosedConnections []Connection
+	NewProcesses      []string
+	GoneProcesses     []string
+	NewRemoteAddrs    []string
+	GoneRemoteAddrs   []string
+
+	Connections map[Connection]TrafficDelta
+	Processes   map[string]TrafficDelta
+	RemoteAddrs map[string]TrafficDelta
+
+	ProcessTransfers    map[string]TrafficDelta
+	RemoteAddrTransfers map[string]TrafficDelta
+}
+
+// Diff returns what changed from the earlier snapshot to this one, the entities in
+// either of them being compared as of no traffic in the other. A nil earlier snapshot
+// is an empty one, everything being new.
+func (s *Snapshot) Diff(earlier *Snapshot) *SnapshotDiff {
+	if earlier == nil {
+		earlier = &Snapshot{}
+	}
+	diff := &SnapshotDiff{Connections: make(map[Connection]TrafficDelta)}
+
+	for conn, data := range s.Connections {
+		var before ConnectionData
+		if prev, ok := earlier.Connections[conn]; ok {
+			before = *prev
+		} else {
+			diff.NewConnections = append(diff.NewConnections, conn)
+		}
+		diff.Connections[conn] = TrafficDelta{
+			UploadBytes:     data.UploadBytes - before.UploadBytes,
+			DownloadBytes:   data.DownloadBytes - before.DownloadBytes,
+			UploadPackets:   data.UploadPackets - before.UploadPackets,
+			DownloadPackets: data.DownloadPackets - before.DownloadPackets,
+		}
+	}
+	for conn, prev := range earlier.Connections {
+		if _, ok := s.Connections[conn]; !ok {
+			diff.ClosedConnections = append(diff.ClosedConnections, conn)
+			diff.Connections[conn] = TrafficDelta{
+				UploadBytes:     -prev.UploadBytes,
+				DownloadBytes:   -prev.DownloadBytes,
+				UploadPackets:   -prev.UploadPackets,
+				DownloadPackets: -prev.DownloadPackets,
+			}
+		}
+	}
+	sortConnections(diff.NewConnections)
+	sortConnections(diff.ClosedConnections)
+
+	diff.Processes, diff.NewProcesses, diff.GoneProcesses = diffNetworkData(s.Processes, earlier.Processes)
+	diff.RemoteAddrs, diff.NewRemoteAddrs, diff.GoneRemoteAddrs = diffNetworkData(s.RemoteAddrs, earlier.RemoteAddrs)
+	diff.ProcessTransfers, _, _ = diffNetworkData(s.ProcessTotals, earlier.ProcessTotals)
+	diff.RemoteAddrTransfers, _, _ = diffNetworkData(s.RemoteAddrTotals, earlier.RemoteAddrTotals)
+	return diff
+}
+
+// diffNetworkData returns the deltas of the entities from the earlier data to the later
+// one, along with the sorted names of the ones new to the later data and of the ones
+// gone from it.
+func diffNetworkData(later, earlier map[string]*NetworkData) (map[string]TrafficDelta, []string, []string) {
+	deltas := make(map[string]TrafficDelta)
+	var added, gone []string
+	for name, data := range later {
+		var before NetworkData
+		if prev, ok := earlier[name]; ok {
+			before = *prev
+		} else {
+			added = append(added, name)
+		}
+		deltas[name] = TrafficDelta{
+			UploadBytes:     data.UploadBytes - before.UploadBytes,
+			DownloadBytes:   data.DownloadBytes - before.DownloadBytes,
+			UploadPackets:   data.UploadPackets - before.UploadPackets,
+			DownloadPackets: data.DownloadPackets - before.DownloadPackets,
+		}
+	}
+	for name, prev := range earlier {
+		if _, ok := later[name]; !ok {
+			gone = append(gone, name)
+			deltas[name] = TrafficDelta{
+				UploadBytes:     -prev.UploadBytes,
+				DownloadBytes:   -prev.DownloadBytes,
+				UploadPackets:   -prev.UploadPackets,
+				DownloadPackets: -prev.DownloadPackets,
+			}
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(gone)
+	return deltas, added, gone
+}
+
+// sortConnections sorts the connections by their local and then their remote sockets.
+func sortConnections(conns []Connection) {
+	sort.Slice(conns, func(i, j int) bool {
+		a, b := conns[i], conns[j]
+		switch {
+		case a.Local.IP != b.Local.IP:
+			return a.Local.IP < b.Local.IP
+		case a.Local.Port != b.Local.Port:
+			return a.Local.Port < b.Local.Port
+		case a.Local.Protocol != b.Local.Protocol:
+			return a.Local.Protocol < b.Local.Protocol
+		case a.Remote.IP != b.Remote.IP:
+			return a.Remote.IP < b.Remote.IP
+		case a.Remote.Port != b.Remote.Port:
+			return a.Remote.Port < b.Remote.Port
+		}
+		return a.VNI < b.VNI
+	})
+}
@@ -0,0 +1,93 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	kept := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	closed := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50001, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "8.8.8.8", Port: 443},
+	}
+	opened := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50002, Protocol: ProtoUDP},
+		Remote: RemoteSocket{IP: "9.9.9.9", Port: 53},
+	}
+
+	earlier := &Snapshot{
+		Connections: map[Connection]*ConnectionData{
+			kept:   {UploadBytes: 1000, DownloadBytes: 4000},
+			closed: {UploadBytes: 300},
+		},
+		Processes: map[string]*NetworkData{
+			"<1>:curl": {UploadBytes: 1300, DownloadBytes: 4000},
+		},
+		RemoteAddrs: map[string]*NetworkData{
+			"1.1.1.1": {UploadBytes: 1000, DownloadBytes: 4000},
+			"8.8.8.8": {UploadBytes: 300},
+		},
+		ProcessTotals: map[string]*NetworkData{
+			"<1>:curl": {UploadBytes: 10000, DownloadBytes: 40000},
+		},
+	}
+	later := &Snapshot{
+		Connections: map[Connection]*ConnectionData{
+			kept:   {UploadBytes: 1500, DownloadBytes: 1000},
+			opened: {UploadBytes: 80, UploadPackets: 1},
+		},
+		Processes: map[string]*NetworkData{
+			"<1>:curl": {UploadBytes: 1500, DownloadBytes: 1000},
+			"<2>:dig":  {UploadBytes: 80, UploadPackets: 1},
+		},
+		RemoteAddrs: map[string]*NetworkData{
+			"1.1.1.1": {UploadBytes: 1500, DownloadBytes: 1000},
+			"9.9.9.9": {UploadBytes: 80, UploadPackets: 1},
+		},
+		ProcessTotals: map[string]*NetworkData{
+			"<1>:curl": {UploadBytes: 13000, DownloadBytes: 45000},
+			"<2>:dig":  {UploadBytes: 80, UploadPackets: 1},
+		},
+	}
+
+	diff := later.Diff(earlier)
+	assert.Equal(t, []Connection{opened}, diff.NewConnections)
+	assert.Equal(t, []Connection{closed}, diff.ClosedConnections)
+	assert.Equal(t, TrafficDelta{UploadBytes: 500, DownloadBytes: -3000}, diff.Connections[kept])
+	assert.Equal(t, TrafficDelta{UploadBytes: -300}, diff.Connections[closed])
+	assert.Equal(t, TrafficDelta{UploadBytes: 80, UploadPackets: 1}, diff.Connections[opened])
+
+	assert.Equal(t, []string{"<2>:dig"}, diff.NewProcesses)
+	assert.Empty(t, diff.GoneProcesses)
+	assert.Equal(t, []string{"9.9.9.9"}, diff.NewRemoteAddrs)
+	assert.Equal(t, []string{"8.8.8.8"}, diff.GoneRemoteAddrs)
+	assert.Equal(t, TrafficDelta{UploadBytes: 200, DownloadBytes: -3000}, diff.Processes["<1>:curl"])
+
+	// the transfers go by the totals since started
+	assert.Equal(t, TrafficDelta{UploadBytes: 3000, DownloadBytes: 5000}, diff.ProcessTransfers["<1>:curl"])
+	assert.Equal(t, TrafficDelta{UploadBytes: 80, UploadPackets: 1}, diff.ProcessTransfers["<2>:dig"])
+	assert.Empty(t, diff.RemoteAddrTransfers)
+}
+
+func TestSnapshotDiffNil(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	later := &Snapshot{
+		Connections: map[Connection]*ConnectionData{conn: {UploadBytes: 1000}},
+		Processes:   map[string]*NetworkData{"<1>:curl": {UploadBytes: 1000}},
+	}
+
+	// everything is new to no earlier snapshot
+	diff := later.Diff(nil)
+	assert.Equal(t, []Connection{conn}, diff.NewConnections)
+	assert.Equal(t, []string{"<1>:curl"}, diff.NewProcesses)
+	assert.Equal(t, 1000, diff.Connections[conn].UploadBytes)
+	assert.Empty(t, diff.ClosedConnections)
+}
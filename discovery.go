@@ -0,0 +1,163 @@
+package sniffer
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	ssdpPort  = 1900
+	mdnsPort  = 5353
+	llmnrPort = 5355
+)
+
+// DiscoveryProtocol is a multicast protocol devices announce themselves with on the LAN.
+type DiscoveryProtocol string
+
+const (
+	DiscoveryMDNS  DiscoveryProtocol = "mdns"
+	DiscoverySSDP  DiscoveryProtocol = "ssdp"
+	DiscoveryLLMNR DiscoveryProtocol = "llmnr"
+)
+
+// DiscoveryInfo is what a device announced about itself.
+type DiscoveryInfo struct {
+	Interface string
+	Protocols []DiscoveryProtocol
+	Names     []string // Host names the device answers to
+	Services  []string // Announced services, e.g. DNS-SD instances or UPnP device types
+	Server    string   // Software of the device, e.g. the SSDP SERVER header
+	Packets   int
+	LastSeen  time.Time
+}
+
+// Discoveries is the inventory of the devices announcing themselves, keyed by IP.
+type Discoveries map[string]*DiscoveryInfo
+
+// DiscoveryPacket is an announcement observed on a device.
+type DiscoveryPacket struct {
+	Interface string
+	IP        string
+	Protocol  DiscoveryProtocol
+	Names     []string
+	Services  []string
+	Server    string
+}
+
+func (d *DiscoveryInfo) add(pkt DiscoveryPacket) {
+	d.Protocols = appendUniqueProtocol(d.Protocols, pkt.Protocol)
+	for _, name := range pkt.Names {
+		d.Names = appendUniqueString(d.Names, name)
+	}
+	for _, service := range pkt.Services {
+		d.Services = appendUniqueString(d.Services, service)
+	}
+	if pkt.Server != "" {
+		d.Server = pkt.Server
+	}
+	d.Packets++
+	d.LastSeen = time.Now()
+}
+
+func appendUniqueProtocol(protocols []DiscoveryProtocol, p DiscoveryProtocol) []DiscoveryProtocol {
+	for _, v := range protocols {
+		if v == p {
+			return protocols
+		}
+	}
+	return append(protocols, p)
+}
+
+func appendUniqueString(values []string, s string) []string {
+	for _, v := range values {
+		if v == s {
+			return values
+		}
+	}
+	return append(values, s)
+}
+
+// discoveryPacket returns the announcement carried by the UDP segment, if any.
+func discoveryPacket(seg *Segment, payload []byte) (DiscoveryPacket, bool) {
+	conn := seg.Connection
+	if conn.Local.Protocol != ProtoUDP || len(payload) == 0 {
+		return DiscoveryPacket{}, false
+	}
+
+	pkt := DiscoveryPacket{Interface: seg.Interface, IP: conn.Remote.IP}
+	srcPort, dstPort := conn.Remote.Port, conn.Local.Port
+	if seg.Direction == DirectionUpload {
+		pkt.IP = conn.Local.IP
+		srcPort, dstPort = conn.Local.Port, conn.Remote.Port
+	}
+
+	var ok bool
+	switch {
+	case srcPort == mdnsPort:
+		pkt.Protocol = DiscoveryMDNS
+		pkt.Names, pkt.Services, ok = parseDNSAnnouncement(payload)
+	case srcPort == llmnrPort:
+		pkt.Protocol = DiscoveryLLMNR
+		pkt.Names, pkt.Services, ok = parseDNSAnnouncement(payload)
+	case srcPort == ssdpPort || dstPort == ssdpPort:
+		pkt.Protocol = DiscoverySSDP
+		pkt.Services, pkt.Server, ok = parseSSDPAnnouncement(payload)
+	}
+	return pkt, ok
+}
+
+// parseDNSAnnouncement returns the host names and services in the records of an
+// mDNS/LLMNR response, queries announce nothing.
+func parseDNSAnnouncement(data []byte) (names, services []string, ok bool) {
+	var dns layers.DNS
+	if err := dns.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil || !dns.QR {
+		return nil, nil, false
+	}
+
+	records := append(dns.Answers, dns.Additionals...)
+	for _, rr := range records {
+		switch rr.Type {
+		case layers.DNSTypeA, layers.DNSTypeAAAA:
+			names = appendUniqueString(names, string(rr.Name))
+		case layers.DNSTypePTR:
+			// reverse mappings name the device rather than a service
+			if name := string(rr.Name); !strings.HasSuffix(name, ".arpa") {
+				services = appendUniqueString(services, string(rr.PTR))
+			}
+		}
+	}
+	return names, services, len(names) > 0 || len(services) > 0
+}
+
+// parseSSDPAnnouncement returns the service type and server of an SSDP NOTIFY or
+// M-SEARCH response, searches and byebye notifications announce nothing.
+func parseSSDPAnnouncement(data []byte) (services []string, server string, ok bool) {
+	lines := bytes.Split(data, []byte("\r\n"))
+	start := string(lines[0])
+	if !strings.HasPrefix(start, "NOTIFY ") && !strings.HasPrefix(start, "HTTP/1.1 200") {
+		return nil, "", false
+	}
+
+	for _, line := range lines[1:] {
+		colon := bytes.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		value := strings.TrimSpace(string(line[colon+1:]))
+		switch strings.ToUpper(string(line[:colon])) {
+		case "NT", "ST":
+			services = appendUniqueString(services, value)
+		case "NTS":
+			if value == "ssdp:byebye" {
+				return nil, "", false
+			}
+		case "SERVER":
+			server = value
+		}
+	}
+	return services, server, len(services) > 0
+}
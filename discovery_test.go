@@ -0,0 +1,54 @@
+package sniffer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoveryPacket(t *testing.T) {
+	dns := &layers.DNS{
+		QR: true,
+		AA: true,
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("_googlecast._tcp.local"), Type: layers.DNSTypePTR, Class: layers.DNSClassIN, PTR: []byte("Living Room._googlecast._tcp.local")},
+			{Name: []byte("chromecast.local"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, IP: net.IPv4(192, 168, 1, 20)},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	assert.NoError(t, dns.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}))
+
+	seg := &Segment{
+		Interface: "eth0",
+		Direction: DirectionDownload,
+		Connection: Connection{
+			Local:  LocalSocket{IP: "224.0.0.251", Port: mdnsPort, Protocol: ProtoUDP},
+			Remote: RemoteSocket{IP: "192.168.1.20", Port: mdnsPort},
+		},
+	}
+	pkt, ok := discoveryPacket(seg, buf.Bytes())
+	assert.True(t, ok)
+	assert.Equal(t, DiscoveryPacket{
+		Interface: "eth0",
+		IP:        "192.168.1.20",
+		Protocol:  DiscoveryMDNS,
+		Names:     []string{"chromecast.local"},
+		Services:  []string{"Living Room._googlecast._tcp.local"},
+	}, pkt)
+
+	seg.Connection.Local = LocalSocket{IP: "239.255.255.250", Port: ssdpPort, Protocol: ProtoUDP}
+	seg.Connection.Remote = RemoteSocket{IP: "192.168.1.30", Port: 41234}
+	notify := "NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nNT: urn:schemas-upnp-org:device:MediaRenderer:1\r\n" +
+		"NTS: ssdp:alive\r\nServer: Linux/4.9 UPnP/1.0 Sonos/70.3\r\n\r\n"
+	pkt, ok = discoveryPacket(seg, []byte(notify))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"urn:schemas-upnp-org:device:MediaRenderer:1"}, pkt.Services)
+	assert.Equal(t, "Linux/4.9 UPnP/1.0 Sonos/70.3", pkt.Server)
+
+	search := "M-SEARCH * HTTP/1.1\r\nST: ssdp:all\r\n\r\n"
+	_, ok = discoveryPacket(seg, []byte(search))
+	assert.False(t, ok)
+}
@@ -2,25 +2,49 @@ package sniffer
 
 import (
 	"context"
+	"encoding/binary"
+	"net"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/rs/dnscache"
 )
 
-type Lookup func(string) string
+const dnsPort = 53
+
+const (
+	// passiveDNSTimeout is how long a name seen in DNS responses is kept, long-lived
+	// connections outlast the record TTLs by far.
+	passiveDNSTimeout = time.Hour
+
+	// passiveDNSMaxEntries bounds the names kept from DNS responses.
+	passiveDNSMaxEntries = 1 << 16
+)
+
+// Lookup names the remote ip of a connection of the process, nil if unknown.
+type Lookup func(ip string, process *ProcessInfo) string
+
+// Observe records the name queried by a client for an address in a DNS response, the
+// process of the client being nil if unknown.
+type Observe func(ip, name string, process *ProcessInfo)
 
 type DNSResolver struct {
-	done     chan struct{}
-	resolver *dnscache.Resolver
-	wg       sync.WaitGroup
+	done        chan struct{}
+	resolver    *dnscache.Resolver
+	passive     *passiveDNS
+	passiveOnly bool
+	wg          sync.WaitGroup
 }
 
-func NewDnsResolver() *DNSResolver {
+func NewDnsResolver(opt Options) *DNSResolver {
 	r := &DNSResolver{
-		done:     make(chan struct{}, 1),
-		resolver: &dnscache.Resolver{},
+		done:        make(chan struct{}, 1),
+		resolver:    &dnscache.Resolver{Resolver: &net.Resolver{PreferGo: true, Dial: self.Dial}},
+		passive:     newPassiveDNS(),
+		passiveOnly: opt.PassiveDNSOnly,
 	}
 	r.start()
 	return r
@@ -50,8 +74,21 @@ func (c *DNSResolver) Close() {
 	c.wg.Wait()
 }
 
-// Lookup resolve remote ip to the domains.
-func (c *DNSResolver) Lookup(ip string) string {
+// Observe records the name a client queried for the ip.
+func (c *DNSResolver) Observe(ip, name string, process *ProcessInfo) {
+	c.passive.Put(ip, name, pidOf(process))
+}
+
+// Lookup resolve remote ip to the domains, the names seen in DNS responses are
+// preferred to the reverse lookups, the ones the process queried first.
+func (c *DNSResolver) Lookup(ip string, process *ProcessInfo) string {
+	if name, ok := c.passive.Get(ip, pidOf(process)); ok {
+		return name
+	}
+	if c.passiveOnly {
+		return ip
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 	addrs, err := c.resolver.LookupAddr(ctx, ip)
@@ -70,3 +107,123 @@ func (c *DNSResolver) Lookup(ip string) string {
 	sort.Strings(addrs)
 	return addrs[0]
 }
+
+// passiveDNS maps the addresses seen in DNS responses to the names queried, by any
+// client and by each process, the processes of a host resolving different names to
+// the same addresses of a CDN.
+type passiveDNS struct {
+	mut       sync.RWMutex
+	entries   map[passiveDNSKey]passiveDNSEntry
+	lastSweep time.Time
+}
+
+// passiveDNSKey is an address resolved by the process of the pid, 0 for any process.
+type passiveDNSKey struct {
+	pid int
+	ip  string
+}
+
+type passiveDNSEntry struct {
+	name     string
+	lastSeen time.Time
+}
+
+func newPassiveDNS() *passiveDNS {
+	return &passiveDNS{entries: make(map[passiveDNSKey]passiveDNSEntry)}
+}
+
+func (p *passiveDNS) Put(ip, name string, pid int) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	now := time.Now()
+	if len(p.entries) >= passiveDNSMaxEntries && now.Sub(p.lastSweep) > time.Minute {
+		for k, e := range p.entries {
+			if now.Sub(e.lastSeen) > passiveDNSTimeout {
+				delete(p.entries, k)
+			}
+		}
+		p.lastSweep = now
+	}
+
+	keys := []passiveDNSKey{{ip: ip}}
+	if pid != 0 {
+		keys = append(keys, passiveDNSKey{pid: pid, ip: ip})
+	}
+	for _, key := range keys {
+		if _, ok := p.entries[key]; !ok && len(p.entries) >= passiveDNSMaxEntries {
+			return
+		}
+		p.entries[key] = passiveDNSEntry{name: name, lastSeen: now}
+	}
+}
+
+// Get returns the name the process of the pid queried for the ip, or else the name
+// any client queried lately.
+func (p *passiveDNS) Get(ip string, pid int) (string, bool) {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+
+	for _, key := range []passiveDNSKey{{pid: pid, ip: ip}, {ip: ip}} {
+		if e, ok := p.entries[key]; ok && time.Since(e.lastSeen) <= passiveDNSTimeout {
+			return e.name, true
+		}
+	}
+	return "", false
+}
+
+// pidOf returns the pid of the process, 0 if unknown.
+func pidOf(process *ProcessInfo) int {
+	if process == nil {
+		return 0
+	}
+	return process.Pid
+}
+
+// dnsClient returns the process of the client of the DNS response carried by the
+// segment, nil if unknown or if the response is sent to a remote client.
+func dnsClient(seg *Segment) *ProcessInfo {
+	if seg.Direction == DirectionUpload {
+		return nil
+	}
+	return seg.Process
+}
+
+// parseDNSResponse returns the name queried in the DNS response carried by the
+// segment along with the addresses it resolved to.
+func parseDNSResponse(seg *Segment, payload []byte) (string, []string) {
+	srcPort := seg.Connection.Remote.Port
+	if seg.Direction == DirectionUpload {
+		srcPort = seg.Connection.Local.Port
+	}
+	if srcPort != dnsPort {
+		return "", nil
+	}
+
+	// DNS over TCP prefixes the messages with their length, only the responses fitting
+	// in a segment are parsed
+	if seg.Connection.Local.Protocol == ProtoTCP {
+		if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != len(payload)-2 {
+			return "", nil
+		}
+		payload = payload[2:]
+	}
+
+	var dns layers.DNS
+	if err := dns.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return "", nil
+	}
+	if !dns.QR || dns.ResponseCode != layers.DNSResponseCodeNoErr || len(dns.Questions) == 0 {
+		return "", nil
+	}
+
+	// the answers of a CNAME chain are named after the question rather than the
+	// canonical name
+	var ips []string
+	for _, rr := range dns.Answers {
+		if rr.Type == layers.DNSTypeA || rr.Type == layers.DNSTypeAAAA {
+			ips = append(ips, rr.IP.String())
+		}
+	}
+	return string(dns.Questions[0].Name), ips
+}
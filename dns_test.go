@@ -0,0 +1,54 @@
+package sniffer
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDNSResponse(t *testing.T) {
+	dns := &layers.DNS{
+		QR:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte("www.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("www.example.com"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, CNAME: []byte("edge.cdn.net")},
+			{Name: []byte("edge.cdn.net"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, IP: net.IPv4(93, 184, 216, 34)},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	assert.NoError(t, dns.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}))
+
+	seg := &Segment{
+		Direction: DirectionDownload,
+		Connection: Connection{
+			Local:  LocalSocket{IP: "192.168.1.2", Port: 51000, Protocol: ProtoUDP},
+			Remote: RemoteSocket{IP: "192.168.1.1", Port: dnsPort},
+		},
+	}
+	name, ips := parseDNSResponse(seg, buf.Bytes())
+	assert.Equal(t, "www.example.com", name)
+	assert.Equal(t, []string{"93.184.216.34"}, ips)
+
+	// the query itself names nothing
+	seg.Direction = DirectionUpload
+	seg.Connection.Local.Port = 51000
+	_, ips = parseDNSResponse(seg, buf.Bytes())
+	assert.Empty(t, ips)
+
+	r := &DNSResolver{passive: newPassiveDNS(), passiveOnly: true}
+	r.Observe("93.184.216.34", "www.example.com", nil)
+	assert.Equal(t, "www.example.com", r.Lookup("93.184.216.34", nil))
+	assert.Equal(t, "10.0.0.1", r.Lookup("10.0.0.1", nil))
+
+	// the processes go by the names they queried for the addresses of a CDN
+	curl, wget := &ProcessInfo{Pid: 100, Name: "curl"}, &ProcessInfo{Pid: 200, Name: "wget"}
+	r.Observe("151.101.1.1", "a.example.com", curl)
+	r.Observe("151.101.1.1", "b.example.com", wget)
+	assert.Equal(t, "a.example.com", r.Lookup("151.101.1.1", curl))
+	assert.Equal(t, "b.example.com", r.Lookup("151.101.1.1", wget))
+	assert.Equal(t, "b.example.com", r.Lookup("151.101.1.1", &ProcessInfo{Pid: 300}))
+	assert.Equal(t, "b.example.com", r.Lookup("151.101.1.1", nil))
+}
@@ -0,0 +1,61 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// kernelNetworkEvent is the layout of an event of the Microsoft-Windows-Kernel-Network
+// ETW provider, all starting with the pid, the size and the remote then the local
+// address and port, the ports in network byte order.
+type kernelNetworkEvent struct {
+	protocol Protocol
+	ipv6     bool
+}
+
+// kernelNetworkEvents are the events of the TCP connections attempted and accepted
+// and of the data sent and received over TCP and UDP, by their ids.
+var kernelNetworkEvents = map[uint16]kernelNetworkEvent{
+	10: {ProtoTCP, false}, // data sent
+	11: {ProtoTCP, false}, // data received
+	12: {ProtoTCP, false}, // connection attempted
+	15: {ProtoTCP, false}, // connection accepted
+	26: {ProtoTCP, true},
+	27: {ProtoTCP, true},
+	28: {ProtoTCP, true},
+	31: {ProtoTCP, true},
+	42: {ProtoUDP, false}, // data sent
+	43: {ProtoUDP, false}, // data received
+	58: {ProtoUDP, true},
+	59: {ProtoUDP, true},
+}
+
+// parseKernelNetworkEvent parses the local socket and the pid of the process owning
+// it out of the data of a Microsoft-Windows-Kernel-Network event, false if the event
+// isn't about a socket of a process.
+func parseKernelNetworkEvent(id uint16, data []byte) (LocalSocket, uint32, bool) {
+	event, ok := kernelNetworkEvents[id]
+	if !ok {
+		return LocalSocket{}, 0, false
+	}
+
+	addrLen := net.IPv4len
+	if event.ipv6 {
+		addrLen = net.IPv6len
+	}
+	local := 8 + addrLen
+	ports := 8 + 2*addrLen
+	if len(data) < ports+4 {
+		return LocalSocket{}, 0, false
+	}
+
+	pid := binary.LittleEndian.Uint32(data)
+	if pid == 0 {
+		return LocalSocket{}, 0, false
+	}
+	return LocalSocket{
+		IP:       net.IP(data[local : local+addrLen]).String(),
+		Port:     binary.BigEndian.Uint16(data[ports+2:]),
+		Protocol: event.protocol,
+	}, pid, true
+}
@@ -0,0 +1,37 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKernelNetworkEvent(t *testing.T) {
+	event := func(pid uint32, remote, local net.IP, remotePort, localPort uint16) []byte {
+		b := make([]byte, 8, 64)
+		binary.LittleEndian.PutUint32(b, pid)
+		binary.LittleEndian.PutUint32(b[4:], 1500)
+		b = append(append(b, remote...), local...)
+		b = append(b, byte(remotePort>>8), byte(remotePort), byte(localPort>>8), byte(localPort))
+		return append(b, 0, 0, 0, 0) // sequence number
+	}
+
+	socket, pid, ok := parseKernelNetworkEvent(12, event(4242, net.IPv4(1, 1, 1, 1).To4(), net.IPv4(10, 0, 0, 1).To4(), 443, 50000))
+	assert.True(t, ok)
+	assert.Equal(t, uint32(4242), pid)
+	assert.Equal(t, LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP}, socket)
+
+	socket, _, ok = parseKernelNetworkEvent(59, event(4242, net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 53, 40000))
+	assert.True(t, ok)
+	assert.Equal(t, LocalSocket{IP: "2001:db8::2", Port: 40000, Protocol: ProtoUDP}, socket)
+
+	// disconnects, truncated events and the system process
+	_, _, ok = parseKernelNetworkEvent(13, event(4242, net.IPv4(1, 1, 1, 1).To4(), net.IPv4(10, 0, 0, 1).To4(), 443, 50000))
+	assert.False(t, ok)
+	_, _, ok = parseKernelNetworkEvent(28, event(4242, net.IPv4(1, 1, 1, 1).To4(), net.IPv4(10, 0, 0, 1).To4(), 443, 50000))
+	assert.False(t, ok)
+	_, _, ok = parseKernelNetworkEvent(12, event(0, net.IPv4(1, 1, 1, 1).To4(), net.IPv4(10, 0, 0, 1).To4(), 443, 50000))
+	assert.False(t, ok)
+}
@@ -0,0 +1,302 @@
+//go:build windows && (amd64 || arm64)
+// +build windows
+// +build amd64 arm64
+
+package sniffer
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32           = windows.NewLazySystemDLL("advapi32.dll")
+	procStartTraceW    = advapi32.NewProc("StartTraceW")
+	procControlTraceW  = advapi32.NewProc("ControlTraceW")
+	procEnableTraceEx2 = advapi32.NewProc("EnableTraceEx2")
+	procOpenTraceW     = advapi32.NewProc("OpenTraceW")
+	procProcessTrace   = advapi32.NewProc("ProcessTrace")
+	procCloseTrace     = advapi32.NewProc("CloseTrace")
+)
+
+// kernelNetworkProvider is the Microsoft-Windows-Kernel-Network provider.
+var kernelNetworkProvider = windows.GUID{
+	Data1: 0x7dd42a49,
+	Data2: 0x5329,
+	Data3: 0x4832,
+	Data4: [8]byte{0x8d, 0xfd, 0x43, 0xd9, 0x79, 0x15, 0x3a, 0x88},
+}
+
+const (
+	etwSessionName = "sniffer-kernel-network"
+
+	wnodeFlagTracedGUID            = 0x00020000
+	eventTraceRealTimeMode         = 0x00000100
+	eventTraceControlStop          = 1
+	eventControlCodeEnableProvider = 1
+	traceLevelInformation          = 4
+	processTraceModeRealTime       = 0x00000100
+	processTraceModeEventRecord    = 0x10000000
+
+	kernelNetworkKeywordIPv4 = 0x10
+	kernelNetworkKeywordIPv6 = 0x20
+)
+
+// The structs of evntrace.h and evntcons.h, laid out for the 64-bit platforms.
+type wnodeHeader struct {
+	BufferSize        uint32
+	ProviderID        uint32
+	HistoricalContext uint64
+	TimeStamp         int64
+	GUID              windows.GUID
+	ClientContext     uint32
+	Flags             uint32
+}
+
+type eventTraceProperties struct {
+	Wnode               wnodeHeader
+	BufferSize          uint32
+	MinimumBuffers      uint32
+	MaximumBuffers      uint32
+	MaximumFileSize     uint32
+	LogFileMode         uint32
+	FlushTimer          uint32
+	EnableFlags         uint32
+	AgeLimit            int32
+	NumberOfBuffers     uint32
+	FreeBuffers         uint32
+	EventsLost          uint32
+	BuffersWritten      uint32
+	LogBuffersLost      uint32
+	RealTimeBuffersLost uint32
+	LoggerThreadID      windows.Handle
+	LogFileNameOffset   uint32
+	LoggerNameOffset    uint32
+}
+
+// etwProperties are the properties of a session followed by the room for its name.
+type etwProperties struct {
+	eventTraceProperties
+	loggerName [256]uint16
+}
+
+type eventTraceHeader struct {
+	Size           uint16
+	FieldTypeFlags uint16
+	Version        uint32
+	ThreadID       uint32
+	ProcessID      uint32
+	TimeStamp      int64
+	GUID           windows.GUID
+	ProcessorTime  uint64
+}
+
+type eventTrace struct {
+	Header           eventTraceHeader
+	InstanceID       uint32
+	ParentInstanceID uint32
+	ParentGUID       windows.GUID
+	MofData          uintptr
+	MofLength        uint32
+	ClientContext    uint32
+}
+
+type traceLogfileHeader struct {
+	BufferSize         uint32
+	Version            uint32
+	ProviderVersion    uint32
+	NumberOfProcessors uint32
+	EndTime            int64
+	TimerResolution    uint32
+	MaximumFileSize    uint32
+	LogFileMode        uint32
+	BuffersWritten     uint32
+	LogInstanceGUID    windows.GUID
+	LoggerName         *uint16
+	LogFileName        *uint16
+	TimeZone           windows.Timezoneinformation
+	BootTime           int64
+	PerfFreq           int64
+	StartTime          int64
+	ReservedFlags      uint32
+	BuffersLost        uint32
+}
+
+type eventTraceLogfile struct {
+	LogFileName         *uint16
+	LoggerName          *uint16
+	CurrentTime         int64
+	BuffersRead         uint32
+	ProcessTraceMode    uint32
+	CurrentEvent        eventTrace
+	LogfileHeader       traceLogfileHeader
+	BufferCallback      uintptr
+	BufferSize          uint32
+	Filled              uint32
+	EventsLost          uint32
+	EventRecordCallback uintptr
+	IsKernelTrace       uint32
+	Context             uintptr
+}
+
+type eventHeader struct {
+	Size          uint16
+	HeaderType    uint16
+	Flags         uint16
+	EventProperty uint16
+	ThreadID      uint32
+	ProcessID     uint32
+	TimeStamp     int64
+	ProviderID    windows.GUID
+	ID            uint16
+	Version       uint8
+	Channel       uint8
+	Level         uint8
+	Opcode        uint8
+	Task          uint16
+	Keyword       uint64
+	ProcessorTime uint64
+	ActivityID    windows.GUID
+}
+
+type eventRecord struct {
+	Header            eventHeader
+	BufferContext     uint32
+	ExtendedDataCount uint16
+	UserDataLength    uint16
+	ExtendedData      uintptr
+	UserData          *byte
+	UserContext       uintptr
+}
+
+// The events go to the observer of the single session of the process, the callback
+// being created once for good.
+var (
+	etwMu       sync.Mutex
+	etwObserver func(socket LocalSocket, pid uint32)
+	etwCallback uintptr
+	etwOnce     sync.Once
+)
+
+func onKernelNetworkEvent(record *eventRecord) uintptr {
+	if record.Header.ProviderID != kernelNetworkProvider || record.UserData == nil {
+		return 0
+	}
+	n := int(record.UserDataLength)
+	data := (*[1 << 16]byte)(unsafe.Pointer(record.UserData))[:n:n]
+	socket, pid, ok := parseKernelNetworkEvent(record.Header.ID, data)
+	if !ok {
+		return 0
+	}
+
+	etwMu.Lock()
+	observe := etwObserver
+	etwMu.Unlock()
+	if observe != nil {
+		observe(socket, pid)
+	}
+	return 0
+}
+
+// etwSession is a real-time ETW session of the Microsoft-Windows-Kernel-Network
+// provider, telling the local sockets of the processes as they connect, accept, send
+// and receive.
+type etwSession struct {
+	props   *etwProperties
+	session uint64
+	trace   uint64
+	done    chan struct{}
+}
+
+func newETWProperties() *etwProperties {
+	props := &etwProperties{}
+	props.Wnode.BufferSize = uint32(unsafe.Sizeof(*props))
+	props.Wnode.ClientContext = 1 // the QueryPerformanceCounter timestamps
+	props.Wnode.Flags = wnodeFlagTracedGUID
+	props.LogFileMode = eventTraceRealTimeMode
+	props.LoggerNameOffset = uint32(unsafe.Offsetof(props.loggerName))
+	return props
+}
+
+func etwErr(op string, ret uintptr) error {
+	return &windows.DLLError{Err: syscall.Errno(ret), ObjName: "advapi32.dll", Msg: op + ": " + syscall.Errno(ret).Error()}
+}
+
+// startETW starts the session, the events going to observe until it is closed. It
+// takes the administrators, or the Performance Log Users group.
+func startETW(observe func(socket LocalSocket, pid uint32)) (*etwSession, error) {
+	if err := advapi32.Load(); err != nil {
+		return nil, err
+	}
+	name, err := windows.UTF16PtrFromString(etwSessionName)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &etwSession{props: newETWProperties(), done: make(chan struct{})}
+	ret, _, _ := procStartTraceW.Call(uintptr(unsafe.Pointer(&s.session)), uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(s.props)))
+	if syscall.Errno(ret) == windows.ERROR_ALREADY_EXISTS {
+		// the session of a sniffer which didn't stop it
+		procControlTraceW.Call(0, uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(newETWProperties())), eventTraceControlStop)
+		s.props = newETWProperties()
+		ret, _, _ = procStartTraceW.Call(uintptr(unsafe.Pointer(&s.session)), uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(s.props)))
+	}
+	if ret != 0 {
+		return nil, etwErr("StartTrace", ret)
+	}
+
+	ret, _, _ = procEnableTraceEx2.Call(
+		uintptr(s.session),
+		uintptr(unsafe.Pointer(&kernelNetworkProvider)),
+		eventControlCodeEnableProvider,
+		traceLevelInformation,
+		kernelNetworkKeywordIPv4|kernelNetworkKeywordIPv6,
+		0, 0, 0,
+	)
+	if ret != 0 {
+		s.stop()
+		return nil, etwErr("EnableTraceEx2", ret)
+	}
+
+	etwOnce.Do(func() { etwCallback = syscall.NewCallback(onKernelNetworkEvent) })
+	logfile := &eventTraceLogfile{
+		LoggerName:          name,
+		ProcessTraceMode:    processTraceModeRealTime | processTraceModeEventRecord,
+		EventRecordCallback: etwCallback,
+	}
+	ret, _, _ = procOpenTraceW.Call(uintptr(unsafe.Pointer(logfile)))
+	if s.trace = uint64(ret); s.trace == ^uint64(0) {
+		s.stop()
+		return nil, errors.New("OpenTrace failed")
+	}
+
+	etwMu.Lock()
+	etwObserver = observe
+	etwMu.Unlock()
+
+	go func() {
+		defer close(s.done)
+		procProcessTrace.Call(uintptr(unsafe.Pointer(&s.trace)), 1, 0, 0)
+	}()
+	return s, nil
+}
+
+// stop stops the session, ending the processing of its events.
+func (s *etwSession) stop() {
+	procControlTraceW.Call(uintptr(s.session), 0, uintptr(unsafe.Pointer(s.props)), eventTraceControlStop)
+}
+
+// Close stops the session and waits for the processing of its events to end.
+func (s *etwSession) Close() {
+	etwMu.Lock()
+	etwObserver = nil
+	etwMu.Unlock()
+
+	s.stop()
+	procCloseTrace.Call(uintptr(s.trace))
+	<-s.done
+}
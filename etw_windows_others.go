@@ -0,0 +1,15 @@
+//go:build windows && !amd64 && !arm64
+// +build windows,!amd64,!arm64
+
+package sniffer
+
+import "errors"
+
+type etwSession struct{}
+
+// startETW fails, the ETW structs being laid out for the 64-bit platforms only.
+func startETW(observe func(socket LocalSocket, pid uint32)) (*etwSession, error) {
+	return nil, errors.New("ETW is not supported on this platform")
+}
+
+func (s *etwSession) Close() {}
@@ -0,0 +1,112 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+// osSignatures are the TCP options layouts of the SYN and SYN-ACK segments sent by
+// the common TCP stacks along with their initial TTLs and the window sizes of their
+// SYN segments, the layouts match by prefix in the order listed. M stands for MSS, N
+// for NOP, W for window scale, S for SACK permitted, T for timestamps and E for the
+// end of the options list. The windows of the SYN-ACK segments go by the window of
+// the SYN, hence match any.
+var osSignatures = []struct {
+	ttl       uint8
+	window    uint16 // Window size of the SYN segments, any if 0
+	mssWindow bool   // Whether the window size of the SYN segments is a multiple of the MSS
+	layout    string
+	os        string
+}{
+	{64, 65535, false, "M,N,W,N,N,T,S,E", "macOS"},
+	{64, 65535, false, "M,N,W,S,T", "FreeBSD"},
+	{64, 0, true, "M,S,T,N,W", "Linux"},
+	{64, 0, true, "M,N,N,S,N,W", "Linux"},
+	{64, 0, true, "M,N,N,T,N,W", "Linux"},
+	{128, 64240, false, "M,N,W,N,N,S", "Windows"},
+	{128, 65535, false, "M,N,W,N,N,S", "Windows"},
+	{128, 8192, false, "M,N,W,N,N,S", "Windows"},
+	{128, 0, false, "M,N,W,S,T", "Windows"},
+	{128, 0, false, "M,N,N,S", "Windows"},
+	{255, 0, false, "M,N,W,N,N,T,N,N,S", "Solaris"},
+}
+
+// initialTTL returns the initial TTL the packet was most likely sent with, the TTLs
+// only ever go down on the way.
+func initialTTL(ttl uint8) uint8 {
+	switch {
+	case ttl <= 32:
+		return 32
+	case ttl <= 64:
+		return 64
+	case ttl <= 128:
+		return 128
+	}
+	return 255
+}
+
+// tcpOptionsLayout returns the kinds of the TCP options in order, encoded like the
+// layouts of the signatures.
+func tcpOptionsLayout(options []layers.TCPOption) string {
+	kinds := make([]string, 0, len(options))
+	for _, opt := range options {
+		switch opt.OptionType {
+		case layers.TCPOptionKindMSS:
+			kinds = append(kinds, "M")
+		case layers.TCPOptionKindNop:
+			kinds = append(kinds, "N")
+		case layers.TCPOptionKindWindowScale:
+			kinds = append(kinds, "W")
+		case layers.TCPOptionKindSACKPermitted:
+			kinds = append(kinds, "S")
+		case layers.TCPOptionKindTimestamps:
+			kinds = append(kinds, "T")
+		case layers.TCPOptionKindEndList:
+			kinds = append(kinds, "E")
+		default:
+			kinds = append(kinds, "?")
+		}
+	}
+	return strings.Join(kinds, ",")
+}
+
+// tcpMSS returns the MSS of the TCP options, 0 if none.
+func tcpMSS(options []layers.TCPOption) uint16 {
+	for _, opt := range options {
+		if opt.OptionType == layers.TCPOptionKindMSS && len(opt.OptionData) == 2 {
+			return binary.BigEndian.Uint16(opt.OptionData)
+		}
+	}
+	return 0
+}
+
+// guessOS guesses the operating system of the sender of a SYN or SYN-ACK segment the
+// p0f way, from its initial TTL, its TCP options layout and its window size. It
+// returns an empty string if nothing matches.
+func guessOS(ttl uint8, tcp *layers.TCP) string {
+	initial := initialTTL(ttl)
+	layout := tcpOptionsLayout(tcp.Options)
+	mss := tcpMSS(tcp.Options)
+	for _, sig := range osSignatures {
+		if sig.ttl != initial || !strings.HasPrefix(layout, sig.layout) {
+			continue
+		}
+		if !tcp.ACK {
+			if sig.window != 0 && tcp.Window != sig.window {
+				continue
+			}
+			if sig.mssWindow && (mss == 0 || tcp.Window%mss != 0) {
+				continue
+			}
+		}
+		return sig.os
+	}
+
+	// hardly any other stack starts at 128
+	if initial == 128 {
+		return "Windows"
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuessOS(t *testing.T) {
+	synWindow := func(window uint16, kinds ...layers.TCPOptionKind) *layers.TCP {
+		tcp := &layers.TCP{SYN: true, Window: window}
+		for _, kind := range kinds {
+			opt := layers.TCPOption{OptionType: kind}
+			if kind == layers.TCPOptionKindMSS {
+				opt.OptionData = []byte{0x05, 0xb4} // 1460
+			}
+			tcp.Options = append(tcp.Options, opt)
+		}
+		return tcp
+	}
+	syn := func(kinds ...layers.TCPOptionKind) *layers.TCP {
+		return synWindow(65535, kinds...)
+	}
+	const (
+		mss  = layers.TCPOptionKindMSS
+		nop  = layers.TCPOptionKindNop
+		ws   = layers.TCPOptionKindWindowScale
+		sack = layers.TCPOptionKindSACKPermitted
+		ts   = layers.TCPOptionKindTimestamps
+		eol  = layers.TCPOptionKindEndList
+	)
+
+	assert.Equal(t, "Linux", guessOS(52, synWindow(64240, mss, sack, ts, nop, ws)))
+	assert.Equal(t, "macOS", guessOS(60, syn(mss, nop, ws, nop, nop, ts, sack, eol, eol)))
+	assert.Equal(t, "FreeBSD", guessOS(64, syn(mss, nop, ws, sack, ts)))
+	assert.Equal(t, "Windows", guessOS(113, syn(mss, nop, ws, nop, nop, sack)))
+	assert.Equal(t, "Windows", guessOS(113, synWindow(8192, mss, nop, ws, nop, nop, sack)))
+
+	// the window sizes tell the stacks sharing the options layout apart
+	assert.Equal(t, "Linux", guessOS(64, synWindow(29200, mss, sack, ts, nop, ws)))
+	assert.Equal(t, "", guessOS(64, synWindow(65535, mss, sack, ts, nop, ws)))
+	assert.Equal(t, "", guessOS(64, synWindow(1024, mss, nop, ws, nop, nop, ts, sack, eol, eol)))
+
+	// the windows of the SYN-ACK segments go by the SYN
+	synACK := synWindow(65160, mss, sack, ts, nop, ws)
+	synACK.ACK = true
+	assert.Equal(t, "Linux", guessOS(64, synACK))
+	assert.Equal(t, "Windows", guessOS(120, syn(mss)))
+	assert.Equal(t, "", guessOS(64, syn(mss)))
+	assert.Equal(t, "", guessOS(250, syn(mss, sack, ts, nop, ws)))
+}
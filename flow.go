@@ -0,0 +1,190 @@
+package sniffer
+
+import (
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// flowTimeout is how long the state of an idle connection is kept.
+	flowTimeout = 5 * time.Minute
+
+	// flowCloseLinger is how long the state of a closed TCP connection is kept, so the
+	// last acknowledgements and retransmitted FINs aren't taken for a new connection.
+	flowCloseLinger = 30 * time.Second
+
+	flowSweepInterval = 30 * time.Second
+)
+
+// flowState is the state of a connection tracked across its packets.
+type flowState struct {
+	FlowInfo
+	lastSeen time.Time
+	tcp      tcpState
+	quic     *quicCrypto // CRYPTO stream of the client Initial packets, nil once parsed
+	tlsHello []byte      // ClientHello record spanning several segments so far, nil if none
+
+	// http2Probes is the number of segments left to search for the first HTTP/2 request
+	http2Probes int
+
+	classifyProbes int  // payload-carrying packets the connection was classified from
+	portGuess      bool // whether the application protocol was only guessed from the ports
+}
+
+// flowTable tracks the state of the connections seen on a device.
+type flowTable struct {
+	entries   map[Connection]*flowState
+	lastSweep time.Time
+	max       int // Connections tracked at most, unlimited if 0
+}
+
+func newFlowTable(max int) *flowTable {
+	return &flowTable{entries: make(map[Connection]*flowState), max: max}
+}
+
+// Get returns the state of the connection, creating it on the first packet.
+func (t *flowTable) Get(conn Connection) *flowState {
+	now := time.Now()
+	if now.Sub(t.lastSweep) > flowSweepInterval {
+		for k, e := range t.entries {
+			idle := now.Sub(e.lastSeen)
+			if idle > flowTimeout || e.tcp.state == TCPStateClosed && idle > flowCloseLinger {
+				delete(t.entries, k)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	flow, ok := t.entries[conn]
+	if !ok {
+		flow = &flowState{}
+		// past the limit the state of the new connections is dropped with each packet
+		if t.max <= 0 || len(t.entries) < t.max {
+			t.entries[conn] = flow
+		}
+	}
+	flow.lastSeen = now
+	return flow
+}
+
+// inspect updates the state of the segment's connection with the application payload
+// and labels the segment with what's been learned.
+func (t *flowTable) inspect(seg *Segment, tcp *layers.TCP, payload []byte) {
+	flow := t.Get(seg.Connection)
+
+	ts := seg.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	if flow.FirstSeen.IsZero() {
+		flow.FirstSeen = ts
+	}
+	flow.LastSeen = ts
+
+	if tcp != nil {
+		flow.tcp.inspect(seg, tcp)
+		flow.RTT = flow.tcp.srtt
+		flow.LocalWindow = int(flow.tcp.upload.window)
+		flow.RemoteWindow = int(flow.tcp.download.window)
+
+		if tcp.SYN && seg.Direction == DirectionDownload && flow.RemoteOS == "" {
+			flow.RemoteOS = guessOS(seg.TTL, tcp)
+		}
+	}
+
+	if seg.Direction == DirectionUpload && seg.Connection.Local.Protocol == ProtoTCP && len(payload) > 0 {
+		inspectTCPUpload(flow, payload)
+	}
+	if seg.Direction == DirectionUpload && seg.Connection.Local.Protocol == ProtoUDP &&
+		seg.Connection.Remote.Port == quicPort && flow.JA4 == "" {
+		inspectQUICUpload(flow, payload)
+	}
+	classify(flow, seg.Connection, payload)
+	seg.FlowInfo = flow.FlowInfo
+}
+
+func inspectTCPUpload(flow *flowState, payload []byte) {
+	if isHTTP2Preface(payload) {
+		flow.ApplicationProtocol, flow.portGuess = AppProtoHTTP2, false
+		flow.http2Probes = http2Probes
+		payload = payload[len(http2Preface):]
+	}
+	if flow.http2Probes > 0 {
+		flow.http2Probes--
+		if contentType, ok := parseHTTP2ContentType(payload); ok {
+			flow.ApplicationProtocol = http2Application(contentType)
+			flow.http2Probes = 0
+		}
+		return
+	}
+
+	if flow.JA3 == "" && inspectClientHello(flow, payload) {
+		return
+	}
+
+	// keep-alive connections carry several requests, the latest one is kept
+	if req := parseHTTPRequest(payload); req != nil {
+		flow.HTTPMethod = req.Method
+		flow.HTTPPath = req.Path
+		if req.Host != "" {
+			flow.ServerName = req.Host
+		}
+	}
+}
+
+// inspectClientHello fingerprints the ClientHello record starting the payload, or the
+// one buffered from the segments before, once the record is whole. It reports whether
+// the payload is of a ClientHello.
+func inspectClientHello(flow *flowState, payload []byte) bool {
+	record := payload
+	if flow.tlsHello != nil {
+		record = append(flow.tlsHello, payload...)
+	}
+	length := clientHelloRecordLength(record)
+	if length == 0 {
+		flow.tlsHello = nil
+		return false
+	}
+
+	hello := parseClientHello(record)
+	if len(record) < length {
+		// the server name is told ahead of the rest of the record
+		if hello != nil && hello.ServerName != "" {
+			flow.ServerName = hello.ServerName
+		}
+		if flow.tlsHello == nil {
+			record = append([]byte(nil), payload...)
+		}
+		flow.tlsHello = record
+		return true
+	}
+
+	flow.tlsHello = nil
+	if hello = parseClientHello(record[:length]); hello == nil {
+		return false
+	}
+	flow.ServerName = hello.ServerName
+	flow.JA3 = hello.JA3()
+	flow.JA4 = hello.JA4(false)
+	return true
+}
+
+func inspectQUICUpload(flow *flowState, payload []byte) {
+	plain := openQUICInitial(payload)
+	if plain == nil {
+		return
+	}
+
+	// only a client Initial packet authenticates with the keys derived from its header
+	flow.ApplicationProtocol, flow.portGuess = AppProtoQUIC, false
+	if flow.quic == nil {
+		flow.quic = &quicCrypto{}
+	}
+	if hello := flow.quic.Add(parseQUICCryptoFrames(plain)); hello != nil {
+		flow.ServerName = hello.ServerName
+		flow.JA3 = hello.JA3()
+		flow.JA4 = hello.JA4(true)
+		flow.quic = nil
+	}
+}
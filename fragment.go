@@ -0,0 +1,170 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// fragmentTimeout bounds how long fragments wait for the first fragment of their
+// datagram, same as the default of net.ipv4.ipfrag_time.
+const fragmentTimeout = 30 * time.Second
+
+type fragmentKey struct {
+	src, dst string
+	id       uint32
+	proto    layers.IPProtocol
+}
+
+// ipFragment describes the position of a packet in a fragmented IP datagram, offset
+// and length are in bytes.
+type ipFragment struct {
+	key    fragmentKey
+	offset int
+	length int
+	more   bool
+}
+
+// parseFragment returns the fragment info of the IP layer along with the protocol
+// and the data carried by it.
+func parseFragment(lyr gopacket.Layer) (ipFragment, layers.IPProtocol, []byte) {
+	switch ip := lyr.(type) {
+	case *layers.IPv4:
+		frag := ipFragment{
+			offset: int(ip.FragOffset) * 8,
+			length: len(ip.Payload),
+			more:   ip.Flags&layers.IPv4MoreFragments != 0,
+		}
+		if frag.offset > 0 || frag.more {
+			frag.key = fragmentKey{src: ip.SrcIP.String(), dst: ip.DstIP.String(), id: uint32(ip.Id), proto: ip.Protocol}
+		}
+		return frag, ip.Protocol, ip.Payload
+
+	case *layers.IPv6:
+		data := ip.Payload
+		if ip.NextHeader != layers.IPProtocolIPv6Fragment || len(data) < 8 {
+			return ipFragment{}, ip.NextHeader, data
+		}
+
+		proto := layers.IPProtocol(data[0])
+		frag := ipFragment{
+			key:    fragmentKey{src: ip.SrcIP.String(), dst: ip.DstIP.String(), id: binary.BigEndian.Uint32(data[4:8]), proto: proto},
+			offset: int(binary.BigEndian.Uint16(data[2:4])>>3) * 8,
+			length: len(data) - 8,
+			more:   data[3]&0x01 != 0,
+		}
+		return frag, proto, data[8:]
+	}
+	return ipFragment{}, 0, nil
+}
+
+type fragmentEntry struct {
+	seg      *Segment // segment of the first fragment, nil until it's seen
+	bytes    int      // bytes of the fragments seen ahead of the first fragment
+	packets  int
+	received [][2]int // sorted and merged byte ranges of the datagram received
+	length   int      // length of the datagram, 0 until the last fragment is seen
+	expire   time.Time
+}
+
+// receive merges the byte range of the fragment into the ones received, and reports
+// whether the whole datagram is received along with its first fragment.
+func (e *fragmentEntry) receive(frag ipFragment, dataLen int) bool {
+	start, end := frag.offset, frag.offset+dataLen
+	if !frag.more {
+		e.length = end
+	}
+
+	merged := make([][2]int, 0, len(e.received)+1)
+	for _, r := range e.received {
+		switch {
+		case r[1] < start:
+			merged = append(merged, r)
+		case end < r[0]:
+			merged = append(merged, [2]int{start, end})
+			start, end = r[0], r[1]
+		default:
+			if r[0] < start {
+				start = r[0]
+			}
+			if r[1] > end {
+				end = r[1]
+			}
+		}
+	}
+	e.received = append(merged, [2]int{start, end})
+
+	return e.seg != nil && e.length > 0 && len(e.received) == 1 &&
+		e.received[0][0] == 0 && e.received[0][1] >= e.length
+}
+
+// fragmentTable attributes non-first fragments, which carry no transport header, to
+// the connection of the first fragment of their datagram.
+type fragmentTable struct {
+	entries   map[fragmentKey]*fragmentEntry
+	lastSweep time.Time
+}
+
+func newFragmentTable() *fragmentTable {
+	return &fragmentTable{entries: make(map[fragmentKey]*fragmentEntry)}
+}
+
+func (t *fragmentTable) entry(key fragmentKey) *fragmentEntry {
+	now := time.Now()
+	if now.Sub(t.lastSweep) > fragmentTimeout {
+		for k, e := range t.entries {
+			if now.After(e.expire) {
+				delete(t.entries, k)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	e, ok := t.entries[key]
+	if !ok {
+		e = &fragmentEntry{}
+		t.entries[key] = e
+	}
+	e.expire = now.Add(fragmentTimeout)
+	return e
+}
+
+// First remembers the segment of the first fragment and folds the fragments seen
+// ahead of it into the segment.
+func (t *fragmentTable) First(frag ipFragment, seg *Segment) {
+	e := t.entry(frag.key)
+	cloned := *seg
+	e.seg = &cloned
+	if e.receive(frag, frag.length) {
+		delete(t.entries, frag.key)
+	}
+
+	if e.packets > 0 {
+		seg.DataLen += e.bytes
+		seg.PayloadLen += e.bytes
+		seg.Packets = e.packets + 1
+		e.bytes, e.packets = 0, 0
+	}
+}
+
+// Follow returns the segment of a non-first fragment, or nil if the first fragment
+// hasn't been seen yet. The datagram is forgotten once all its bytes are received,
+// whatever the order of its fragments, or else on the timeout.
+func (t *fragmentTable) Follow(frag ipFragment, dataLen int) *Segment {
+	e := t.entry(frag.key)
+	complete := e.receive(frag, dataLen)
+	if e.seg == nil {
+		e.bytes += dataLen
+		e.packets++
+		return nil
+	}
+
+	if complete {
+		delete(t.entries, frag.key)
+	}
+	seg := *e.seg
+	seg.DataLen, seg.PayloadLen = dataLen, dataLen
+	return &seg
+}
@@ -0,0 +1,58 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFragmentTable(t *testing.T) {
+	table := newFragmentTable()
+	key := fragmentKey{src: "10.0.0.1", dst: "10.0.0.2", id: 42, proto: 17}
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 5353, Protocol: ProtoUDP},
+		Remote: RemoteSocket{IP: "10.0.0.2", Port: 53},
+	}
+
+	// fragments arriving ahead of the first fragment are held back
+	assert.Nil(t, table.Follow(ipFragment{key: key, offset: 2960, more: false}, 100))
+
+	first := &Segment{DataLen: 1480, PayloadLen: 1472, Connection: conn}
+	table.First(ipFragment{key: key, offset: 0, length: 1480, more: true}, first)
+	assert.Equal(t, 1580, first.DataLen)
+	assert.Equal(t, 1572, first.PayloadLen)
+	assert.Equal(t, 2, first.Packets)
+
+	seg := table.Follow(ipFragment{key: key, offset: 1480, more: false}, 1480)
+	assert.NotNil(t, seg)
+	assert.Equal(t, conn, seg.Connection)
+	assert.Equal(t, 1480, seg.DataLen)
+	assert.Equal(t, 1480, seg.PayloadLen)
+	assert.Equal(t, 0, seg.Packets)
+	assert.Empty(t, table.entries)
+}
+
+func TestFragmentTableOutOfOrder(t *testing.T) {
+	table := newFragmentTable()
+	key := fragmentKey{src: "10.0.0.1", dst: "10.0.0.2", id: 43, proto: 17}
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 5353, Protocol: ProtoUDP},
+		Remote: RemoteSocket{IP: "10.0.0.2", Port: 53},
+	}
+
+	first := &Segment{DataLen: 1480, PayloadLen: 1472, Connection: conn}
+	table.First(ipFragment{key: key, offset: 0, length: 1480, more: true}, first)
+	assert.Equal(t, 1480, first.DataLen)
+
+	// the last fragment arriving ahead of the middle one keeps the datagram around
+	last := table.Follow(ipFragment{key: key, offset: 2960, more: false}, 100)
+	assert.NotNil(t, last)
+	assert.Equal(t, conn, last.Connection)
+	assert.Len(t, table.entries, 1)
+
+	middle := table.Follow(ipFragment{key: key, offset: 1480, more: true}, 1480)
+	assert.NotNil(t, middle)
+	assert.Equal(t, conn, middle.Connection)
+	assert.Equal(t, 1480, middle.DataLen)
+	assert.Empty(t, table.entries)
+}
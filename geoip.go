@@ -0,0 +1,137 @@
+package sniffer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// geoCacheSize bounds the IPs whose locations are cached, the cache starting over once
+// full.
+const geoCacheSize = 1 << 16
+
+// Location is where a remote IP is, as told by the GeoIP databases: its country and
+// city, and the autonomous system announcing it.
+type Location struct {
+	Country     string // ISO 3166-1 code of the country, e.g. US, empty if unknown
+	CountryName string // English name of the country
+	City        string // English name of the city, empty with the country databases
+	ASN         uint   // Number of the autonomous system, 0 if unknown
+	ASOrg       string // Organization of the autonomous system, e.g. Cloudflare, Inc.
+}
+
+func (l *Location) String() string {
+	if l == nil {
+		return ""
+	}
+	if l.City != "" {
+		return l.City + ", " + l.Country
+	}
+	return l.Country
+}
+
+// countryCode returns the ISO code of the country of the location, empty if unknown.
+func (l *Location) countryCode() string {
+	if l == nil {
+		return ""
+	}
+	return l.Country
+}
+
+// AS returns the autonomous system of the location along with its organization, e.g.
+// AS13335 Cloudflare, Inc., empty if unknown.
+func (l *Location) AS() string {
+	if l == nil || l.ASN == 0 {
+		return ""
+	}
+	if l.ASOrg == "" {
+		return fmt.Sprintf("AS%d", l.ASN)
+	}
+	return fmt.Sprintf("AS%d %s", l.ASN, l.ASOrg)
+}
+
+// GeoIP locates the remote IPs from a MaxMind GeoLite2 or GeoIP2 City or Country
+// database and an ASN one, either being optional, caching their locations.
+type GeoIP struct {
+	city *mmdbReader // nil without a City or Country database
+	asn  *mmdbReader // nil without an ASN database
+
+	mu    sync.Mutex
+	cache map[string]*Location
+}
+
+// OpenGeoIP reads the City or Country database at the path, e.g. GeoLite2-City.mmdb,
+// and the ASN one, e.g. GeoLite2-ASN.mmdb, none of the empty paths.
+func OpenGeoIP(cityPath, asnPath string) (*GeoIP, error) {
+	g := &GeoIP{cache: make(map[string]*Location)}
+	var err error
+	if cityPath != "" {
+		if g.city, err = openMMDB(cityPath); err != nil {
+			return nil, err
+		}
+	}
+	if asnPath != "" {
+		if g.asn, err = openMMDB(asnPath); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Lookup returns the location of the IP, nil if unknown.
+func (g *GeoIP) Lookup(ip string) *Location {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if loc, ok := g.cache[ip]; ok {
+		return loc
+	}
+	loc := g.locate(ip)
+	if len(g.cache) >= geoCacheSize {
+		g.cache = make(map[string]*Location)
+	}
+	g.cache[ip] = loc
+	return loc
+}
+
+func (g *GeoIP) locate(ip string) *Location {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil
+	}
+
+	loc := &Location{}
+	if g.city != nil {
+		if record, err := g.city.lookup(parsed); err == nil && record != nil {
+			// the anycast networks and the like are of no country but the registered one
+			country := "country"
+			if mmdbLookupString(record, country, "iso_code") == "" {
+				country = "registered_country"
+			}
+			loc.Country = mmdbLookupString(record, country, "iso_code")
+			loc.CountryName = mmdbLookupString(record, country, "names", "en")
+			loc.City = mmdbLookupString(record, "city", "names", "en")
+		}
+	}
+	if g.asn != nil {
+		if record, err := g.asn.lookup(parsed); err == nil && record != nil {
+			m, _ := record.(map[string]interface{})
+			asn, _ := m["autonomous_system_number"].(uint64)
+			loc.ASN = uint(asn)
+			loc.ASOrg = mmdbLookupString(record, "autonomous_system_organization")
+		}
+	}
+	if loc.Country == "" && loc.ASN == 0 {
+		return nil
+	}
+	return loc
+}
+
+// locate looks the location of the remote end of the segment up, the traffic of the
+// local network and to the groups being of no location.
+func (c *PcapClient) locate(seg *Segment) {
+	if c.geoip == nil || seg.Scope == ScopeLocal || seg.Cast != CastUnicast {
+		return
+	}
+	seg.Location = c.geoip.Lookup(seg.Connection.Remote.IP)
+}
@@ -0,0 +1,67 @@
+package sniffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoIPLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer-geoip")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "GeoLite2-City.mmdb")
+	db := buildMMDB(24, 6, []mmdbTestNetwork{
+		{"81.2.69.0/24", map[string]interface{}{
+			"city":    map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+			"country": map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom"}},
+		}},
+		{"1.1.1.0/24", map[string]interface{}{
+			"registered_country": map[string]interface{}{"iso_code": "AU", "names": map[string]interface{}{"en": "Australia"}},
+		}},
+	})
+	assert.NoError(t, ioutil.WriteFile(path, db, 0644))
+
+	g, err := OpenGeoIP(path, "")
+	assert.NoError(t, err)
+	london := g.Lookup("81.2.69.142")
+	assert.Equal(t, &Location{Country: "GB", CountryName: "United Kingdom", City: "London"}, london)
+	assert.Equal(t, "London, GB", london.String())
+	assert.Same(t, london, g.Lookup("81.2.69.142"))
+
+	// the anycast networks go by their registered country
+	assert.Equal(t, "AU", g.Lookup("1.1.1.1").String())
+	assert.Nil(t, g.Lookup("8.8.8.8"))
+	assert.Nil(t, g.Lookup("dns.google"))
+	assert.Equal(t, "", (*Location)(nil).String())
+
+	_, err = OpenGeoIP(filepath.Join(dir, "missing.mmdb"), "")
+	assert.Error(t, err)
+}
+
+func TestGeoIPLookupASN(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer-geoip")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	db := buildMMDB(28, 6, []mmdbTestNetwork{
+		{"1.1.1.0/24", map[string]interface{}{"autonomous_system_number": uint32(13335), "autonomous_system_organization": "CLOUDFLARENET"}},
+		{"2600:1f00::/24", map[string]interface{}{"autonomous_system_number": uint32(16509)}},
+	})
+	assert.NoError(t, ioutil.WriteFile(path, db, 0644))
+
+	g, err := OpenGeoIP("", path)
+	assert.NoError(t, err)
+	cloudflare := g.Lookup("1.1.1.1")
+	assert.Equal(t, &Location{ASN: 13335, ASOrg: "CLOUDFLARENET"}, cloudflare)
+	assert.Equal(t, "AS13335 CLOUDFLARENET", cloudflare.AS())
+	assert.Equal(t, "", cloudflare.String())
+	assert.Equal(t, "AS16509", g.Lookup("2600:1f00::1").AS())
+	assert.Nil(t, g.Lookup("8.8.8.8"))
+	assert.Equal(t, "", (*Location)(nil).AS())
+}
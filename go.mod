@@ -1,6 +1,6 @@
 module github.com/jeffreynn/sniffer
 
-go 1.15
+go 1.16
 
 require (
 	github.com/StackExchange/wmi v1.2.1 // indirect
@@ -19,6 +19,7 @@ require (
 	github.com/spf13/cobra v1.2.1
 	github.com/stretchr/testify v1.7.0
 	github.com/tklauser/go-sysconf v0.3.9 // indirect
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 	golang.org/x/sys v0.0.0-20211123173158-ef496fb156ab
 )
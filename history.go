@@ -0,0 +1,86 @@
+package sniffer
+
+import (
+	"sync"
+	"time"
+)
+
+// HistoryPoint is the throughput of an interval in total and of each process, the
+// bytes and the packets being those counted over the interval.
+type HistoryPoint struct {
+	Time      time.Time     // When the interval ended
+	Elapsed   time.Duration // Length of the interval
+	Total     NetworkData
+	Processes map[string]NetworkData
+}
+
+// throughputHistory is a ring buffer of the throughput of the latest intervals.
+type throughputHistory struct {
+	mu     sync.RWMutex
+	points []HistoryPoint
+	next   int
+	full   bool
+}
+
+func newThroughputHistory(size int) *throughputHistory {
+	return &throughputHistory{points: make([]HistoryPoint, size)}
+}
+
+// add adds the point, overwriting the oldest one once full.
+func (h *throughputHistory) add(point HistoryPoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.points) == 0 {
+		return
+	}
+	h.points[h.next] = point
+	h.next = (h.next + 1) % len(h.points)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the points from the oldest to the latest.
+func (h *throughputHistory) list() []HistoryPoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if !h.full {
+		return append([]HistoryPoint(nil), h.points[:h.next]...)
+	}
+	return append(append([]HistoryPoint(nil), h.points[h.next:]...), h.points[:h.next]...)
+}
+
+// historyPoint sums the throughput of the stats up as a point of the history, the
+// connections of unknown processes and, unless counted, of the loopback devices being
+// left out as in the snapshots.
+func (s *StatsManager) historyPoint(stat Stat, now time.Time) HistoryPoint {
+	point := HistoryPoint{Time: now, Elapsed: s.elapsed, Processes: make(map[string]NetworkData)}
+	for conn, info := range stat.Utilization {
+		procName, ok := s.processName(conn, info)
+		if !ok {
+			continue
+		}
+
+		data := point.Processes[procName]
+		data.add(info)
+		data.ConnCount++
+		point.Processes[procName] = data
+		point.Total.add(info)
+		point.Total.ConnCount++
+	}
+
+	for name, data := range point.Processes {
+		data.setRates(s.elapsed)
+		point.Processes[name] = data
+	}
+	point.Total.setRates(s.elapsed)
+	return point
+}
+
+// History returns the throughput of the latest intervals from the oldest to the
+// latest, as many as Options.HistorySize.
+func (s *StatsManager) History() []HistoryPoint {
+	return s.history.list()
+}
@@ -0,0 +1,61 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughputHistory(t *testing.T) {
+	h := newThroughputHistory(3)
+	assert.Empty(t, h.list())
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		h.add(HistoryPoint{Time: now.Add(time.Duration(i) * time.Second)})
+	}
+
+	// the oldest points are overwritten, the rest listed from the oldest
+	points := h.list()
+	assert.Len(t, points, 3)
+	for i, point := range points {
+		assert.Equal(t, now.Add(time.Duration(i+2)*time.Second), point.Time)
+	}
+
+	h = newThroughputHistory(0)
+	h.add(HistoryPoint{Time: now})
+	assert.Empty(t, h.list())
+}
+
+func TestStatsManagerHistory(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	unknown := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50001, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	stat := Stat{Utilization: Utilization{
+		conn:    {Process: &ProcessInfo{Pid: 1, Name: "curl"}, UploadBytes: 3000, DownloadBytes: 6000},
+		unknown: {UploadBytes: 100},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes, HistorySize: 2})
+	now := time.Now()
+	s.put(stat, now)
+	s.put(stat, now.Add(3*time.Second))
+
+	history := s.History()
+	assert.Len(t, history, 2)
+	assert.Equal(t, 2*time.Second, history[0].Elapsed)
+
+	latest := history[1]
+	assert.Equal(t, now.Add(3*time.Second), latest.Time)
+	assert.Equal(t, 3*time.Second, latest.Elapsed)
+	assert.Equal(t, 3000, latest.Total.UploadBytes)
+	assert.Equal(t, 1, latest.Total.ConnCount)
+	assert.Equal(t, 1000.0, latest.Total.UploadRate)
+	assert.Equal(t, 2000.0, latest.Processes["<1>:curl"].DownloadRate)
+}
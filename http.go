@@ -0,0 +1,63 @@
+package sniffer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("DELETE "), []byte("HEAD "),
+	[]byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "), []byte("TRACE "),
+}
+
+// httpRequest holds the request line and the Host header of a plaintext HTTP/1.x request.
+type httpRequest struct {
+	Method string
+	Path   string
+	Host   string
+}
+
+// parseHTTPRequest parses the HTTP/1.x request at the beginning of a TCP payload, the
+// headers are parsed as far as the payload goes.
+func parseHTTPRequest(data []byte) *httpRequest {
+	var matched bool
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(data, method) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil
+	}
+
+	end := bytes.Index(data, []byte("\r\n"))
+	if end < 0 {
+		return nil
+	}
+
+	// request line: method SP request-target SP HTTP-version
+	fields := strings.Split(string(data[:end]), " ")
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/1.") {
+		return nil
+	}
+	req := &httpRequest{Method: fields[0], Path: fields[1]}
+
+	for _, line := range bytes.Split(data[end+2:], []byte("\r\n")) {
+		if len(line) == 0 {
+			break
+		}
+
+		colon := bytes.IndexByte(line, ':')
+		if colon < 0 || !strings.EqualFold(string(line[:colon]), "host") {
+			continue
+		}
+		req.Host = strings.TrimSpace(string(line[colon+1:]))
+		if host, _, err := net.SplitHostPort(req.Host); err == nil {
+			req.Host = host
+		}
+		break
+	}
+	return req
+}
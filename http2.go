@@ -0,0 +1,77 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// http2Preface is the connection preface sent by HTTP/2 clients, either right away
+// (prior knowledge) or after an h2c upgrade.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// http2Probes bounds the segments searched for the first HEADERS frame after the preface.
+const http2Probes = 4
+
+const (
+	http2FrameHeaders = 0x01
+
+	http2FlagPadded   = 0x08
+	http2FlagPriority = 0x20
+)
+
+// parseHTTP2ContentType returns the content-type of the first request in the HTTP/2
+// frames at the beginning of a client's payload, ok is false if there's no HEADERS frame.
+func parseHTTP2ContentType(data []byte) (contentType string, ok bool) {
+	// frame header: length(3) type(1) flags(1) stream identifier(4)
+	for len(data) >= 9 {
+		length := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+		frameType, flags := data[3], data[4]
+		stream := binary.BigEndian.Uint32(data[5:9]) & 0x7fffffff
+		payload := data[9:]
+		if length < len(payload) {
+			payload = payload[:length]
+		}
+		data = data[9+len(payload):]
+		if frameType != http2FrameHeaders || stream == 0 {
+			continue
+		}
+
+		if flags&http2FlagPadded != 0 && len(payload) > 0 {
+			padding := int(payload[0])
+			payload = payload[1:]
+			if padding <= len(payload) {
+				payload = payload[:len(payload)-padding]
+			}
+		}
+		if flags&http2FlagPriority != 0 && len(payload) >= 5 {
+			payload = payload[5:]
+		}
+
+		// a header block cut off by the segment boundary is decoded as far as it goes
+		decoder := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+			if f.Name == "content-type" {
+				contentType = f.Value
+			}
+		})
+		_, _ = decoder.Write(payload)
+		return contentType, true
+	}
+	return "", false
+}
+
+// isHTTP2Preface reports whether a client's payload starts with the HTTP/2 preface.
+func isHTTP2Preface(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(http2Preface))
+}
+
+// http2Application returns the application protocol of an HTTP/2 connection given
+// the content-type of its first request.
+func http2Application(contentType string) ApplicationProtocol {
+	if strings.HasPrefix(contentType, "application/grpc") {
+		return AppProtoGRPC
+	}
+	return AppProtoHTTP2
+}
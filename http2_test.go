@@ -0,0 +1,40 @@
+package sniffer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2/hpack"
+)
+
+func http2Frame(frameType, flags byte, stream byte, payload []byte) []byte {
+	n := len(payload)
+	frame := []byte{byte(n >> 16), byte(n >> 8), byte(n), frameType, flags, 0, 0, 0, stream}
+	return append(frame, payload...)
+}
+
+func http2Request(contentType string) []byte {
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	_ = encoder.WriteField(hpack.HeaderField{Name: ":method", Value: "POST"})
+	_ = encoder.WriteField(hpack.HeaderField{Name: ":path", Value: "/helloworld.Greeter/SayHello"})
+	_ = encoder.WriteField(hpack.HeaderField{Name: "content-type", Value: contentType})
+
+	settings := http2Frame(0x04, 0, 0, nil)
+	return append(settings, http2Frame(http2FrameHeaders, 0x04, 1, block.Bytes())...)
+}
+
+func TestInspectHTTP2(t *testing.T) {
+	flow := &flowState{}
+	inspectTCPUpload(flow, append([]byte(http2Preface), http2Request("application/grpc+proto")...))
+	assert.Equal(t, AppProtoGRPC, flow.ApplicationProtocol)
+
+	// the first request follows the preface in a later segment
+	flow = &flowState{}
+	inspectTCPUpload(flow, []byte(http2Preface))
+	assert.Equal(t, AppProtoHTTP2, flow.ApplicationProtocol)
+	inspectTCPUpload(flow, http2Request("text/html"))
+	assert.Equal(t, AppProtoHTTP2, flow.ApplicationProtocol)
+	assert.Equal(t, 0, flow.http2Probes)
+}
@@ -0,0 +1,19 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHTTPRequest(t *testing.T) {
+	req := parseHTTPRequest([]byte("GET /index.html HTTP/1.1\r\nUser-Agent: curl\r\nHOST: example.com:8080\r\n\r\n"))
+	assert.Equal(t, &httpRequest{Method: "GET", Path: "/index.html", Host: "example.com"}, req)
+
+	// headers cut off by the segment boundary
+	req = parseHTTPRequest([]byte("POST /api HTTP/1.0\r\nAccept: */*\r\nHo"))
+	assert.Equal(t, &httpRequest{Method: "POST", Path: "/api"}, req)
+
+	assert.Nil(t, parseHTTPRequest([]byte("GET / HTTP/2\r\n")))
+	assert.Nil(t, parseHTTPRequest([]byte("SSH-2.0-OpenSSH_8.9\r\n")))
+}
@@ -0,0 +1,146 @@
+package sniffer
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isGREASE reports whether the value is one of the reserved GREASE values of RFC 8701.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	var filtered []uint16
+	for _, v := range values {
+		if !isGREASE(v) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+func joinUint16s(values []uint16, sep string, format func(uint16) string) string {
+	items := make([]string, 0, len(values))
+	for _, v := range values {
+		items = append(items, format(v))
+	}
+	return strings.Join(items, sep)
+}
+
+func decimal(v uint16) string {
+	return strconv.Itoa(int(v))
+}
+
+func hex4(v uint16) string {
+	return fmt.Sprintf("%04x", v)
+}
+
+// JA3 returns the JA3 fingerprint of the ClientHello.
+// see https://github.com/salesforce/ja3
+func (h *clientHello) JA3() string {
+	formats := make([]uint16, 0, len(h.ECPointFormats))
+	for _, f := range h.ECPointFormats {
+		formats = append(formats, uint16(f))
+	}
+
+	s := strings.Join([]string{
+		decimal(h.Version),
+		joinUint16s(withoutGREASE(h.CipherSuites), "-", decimal),
+		joinUint16s(withoutGREASE(h.Extensions), "-", decimal),
+		joinUint16s(withoutGREASE(h.SupportedGroups), "-", decimal),
+		joinUint16s(formats, "-", decimal),
+	}, ",")
+
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+var ja4Versions = map[uint16]string{0x0304: "13", 0x0303: "12", 0x0302: "11", 0x0301: "10", 0x0300: "s3"}
+
+// JA4 returns the JA4 fingerprint of the ClientHello, quic tells whether it's carried
+// by QUIC rather than TCP.
+// see https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+func (h *clientHello) JA4(quic bool) string {
+	proto := "t"
+	if quic {
+		proto = "q"
+	}
+
+	// the highest supported version takes precedence over the legacy version field
+	version := h.Version
+	if supported := withoutGREASE(h.SupportedVersions); len(supported) > 0 {
+		version = supported[0]
+		for _, v := range supported {
+			if v > version {
+				version = v
+			}
+		}
+	}
+	ver, ok := ja4Versions[version]
+	if !ok {
+		ver = "00"
+	}
+
+	sni := "i"
+	if h.ServerName != "" {
+		sni = "d"
+	}
+
+	ciphers := withoutGREASE(h.CipherSuites)
+	extensions := withoutGREASE(h.Extensions)
+
+	alpn := "00"
+	if len(h.ALPN) > 0 && h.ALPN[0] != "" {
+		first, last := h.ALPN[0][0], h.ALPN[0][len(h.ALPN[0])-1]
+		if isAlnum(first) && isAlnum(last) {
+			alpn = string([]byte{first, last})
+		} else {
+			alpn = hex.EncodeToString([]byte{first})[:1] + hex.EncodeToString([]byte{last})[1:]
+		}
+	}
+
+	a := fmt.Sprintf("%s%s%s%02d%02d%s", proto, ver, sni, min99(len(ciphers)), min99(len(extensions)), alpn)
+
+	sortedCiphers := append([]uint16(nil), ciphers...)
+	sort.Slice(sortedCiphers, func(i, j int) bool { return sortedCiphers[i] < sortedCiphers[j] })
+
+	var sortedExts []uint16
+	for _, e := range extensions {
+		if e != tlsExtServerName && e != tlsExtALPN {
+			sortedExts = append(sortedExts, e)
+		}
+	}
+	sort.Slice(sortedExts, func(i, j int) bool { return sortedExts[i] < sortedExts[j] })
+
+	c := joinUint16s(sortedExts, ",", hex4)
+	if algs := withoutGREASE(h.SignatureAlgorithms); len(algs) > 0 {
+		c += "_" + joinUint16s(algs, ",", hex4)
+	}
+
+	return strings.Join([]string{a, ja4Hash(joinUint16s(sortedCiphers, ",", hex4)), ja4Hash(c)}, "_")
+}
+
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func min99(n int) int {
+	if n > 99 {
+		return 99
+	}
+	return n
+}
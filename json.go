@@ -0,0 +1,397 @@
+package sniffer
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// SnapshotSchemaVersion is the version of the JSON schema of the snapshots, bumped on
+// every change breaking its consumers. Fields are only ever added within a version.
+const SnapshotSchemaVersion = 1
+
+// The JSON schema of the snapshots, the names being snake case, the durations in
+// seconds, the times in RFC 3339 and the rates in bytes per second. The internal
+// structs stay free to change under it.
+type (
+	jsonSnapshot struct {
+		Version        int                                  `json:"version"`
+		ElapsedSeconds float64                              `json:"elapsed_seconds"`
+		Goodput        bool                                 `json:"goodput"`
+		Cumulative     bool                                 `json:"cumulative"`
+		Degraded       bool                                 `json:"degraded"`
+		Scope          string                               `json:"scope,omitempty"`
+		Watch          string                               `json:"watch,omitempty"`
+		Watched        []int                                `json:"watched,omitempty"`
+		Totals         jsonTotals                           `json:"totals"`
+		Throughput     *NetworkData                         `json:"throughput"`
+		Processes      map[string]*NetworkData              `json:"processes"`
+		RemoteAddrs    map[string]*NetworkData              `json:"remote_addrs"`
+		Applications   map[ApplicationProtocol]*NetworkData `json:"applications"`
+		Families       map[string]*NetworkData              `json:"families"`
+		Interfaces     map[string]*NetworkData              `json:"interfaces"`
+		RemotePorts    []RemotePortsResult                  `json:"remote_ports"`
+		Users          map[string]*NetworkData              `json:"users"`
+		Containers     map[string]*NetworkData              `json:"containers"`
+		Categories     map[string]*NetworkData              `json:"categories"`
+		Countries      map[string]*NetworkData              `json:"countries"`
+		ASNs           map[string]*NetworkData              `json:"asns"`
+		Scopes         map[string]*NetworkData              `json:"scopes"`
+		Unattributed   map[UnattributedReason]*NetworkData  `json:"unattributed"`
+		Connections    []ConnectionsResult                  `json:"connections"`
+		Tags           map[string][]string                  `json:"tags,omitempty"`
+		Views          map[string]map[string]*NetworkData   `json:"views,omitempty"`
+
+		ProcessTotals    map[string]*NetworkData `json:"process_totals,omitempty"`
+		RemoteAddrTotals map[string]*NetworkData `json:"remote_addr_totals,omitempty"`
+	}
+
+	jsonTotals struct {
+		UploadBytes          int `json:"upload_bytes"`
+		DownloadBytes        int `json:"download_bytes"`
+		UploadPayloadBytes   int `json:"upload_payload_bytes"`
+		DownloadPayloadBytes int `json:"download_payload_bytes"`
+		UploadPackets        int `json:"upload_packets"`
+		DownloadPackets      int `json:"download_packets"`
+		Connections          int `json:"connections"`
+		ActiveConnections    int `json:"active_connections"`
+		EvictedConnections   int `json:"evicted_connections"`
+	}
+
+	jsonRates struct {
+		UploadRate       float64 `json:"upload_rate"`
+		DownloadRate     float64 `json:"download_rate"`
+		PeakUploadRate   float64 `json:"peak_upload_rate,omitempty"`
+		PeakDownloadRate float64 `json:"peak_download_rate,omitempty"`
+		AvgUploadRate    float64 `json:"avg_upload_rate,omitempty"`
+		AvgDownloadRate  float64 `json:"avg_download_rate,omitempty"`
+
+		UploadHistory   []float64 `json:"upload_history,omitempty"`
+		DownloadHistory []float64 `json:"download_history,omitempty"`
+	}
+
+	jsonNetworkData struct {
+		UploadBytes          int `json:"upload_bytes"`
+		DownloadBytes        int `json:"download_bytes"`
+		UploadPayloadBytes   int `json:"upload_payload_bytes"`
+		DownloadPayloadBytes int `json:"download_payload_bytes"`
+		UploadPackets        int `json:"upload_packets"`
+		DownloadPackets      int `json:"download_packets"`
+		Connections          int `json:"connections"`
+		jsonRates
+
+		TCP *NetworkData `json:"tcp,omitempty"`
+		UDP *NetworkData `json:"udp,omitempty"`
+	}
+
+	jsonConnection struct {
+		Protocol   Protocol `json:"protocol"`
+		LocalIP    string   `json:"local_ip"`
+		LocalPort  uint16   `json:"local_port"`
+		RemoteIP   string   `json:"remote_ip"`
+		RemotePort uint16   `json:"remote_port"`
+		Service    string   `json:"service,omitempty"` // Service registered for the remote port
+		VNI        uint32   `json:"vni,omitempty"`
+	}
+
+	jsonLocation struct {
+		Country     string `json:"country,omitempty"`
+		CountryName string `json:"country_name,omitempty"`
+		City        string `json:"city,omitempty"`
+		ASN         uint   `json:"asn,omitempty"`
+		ASOrg       string `json:"as_org,omitempty"`
+	}
+
+	jsonProcess struct {
+		Pid       int    `json:"pid"`
+		Name      string `json:"name"`
+		User      string `json:"user,omitempty"`
+		Container string `json:"container,omitempty"`
+	}
+
+	jsonConnectionData struct {
+		Process              string              `json:"process"`
+		Interface            string              `json:"interface,omitempty"`
+		ServerName           string              `json:"server_name,omitempty"`
+		RemoteOS             string              `json:"remote_os,omitempty"`
+		CommunityID          string              `json:"community_id,omitempty"`
+		Application          ApplicationProtocol `json:"application,omitempty"`
+		UploadBytes          int                 `json:"upload_bytes"`
+		DownloadBytes        int                 `json:"download_bytes"`
+		UploadPayloadBytes   int                 `json:"upload_payload_bytes"`
+		DownloadPayloadBytes int                 `json:"download_payload_bytes"`
+		UploadPackets        int                 `json:"upload_packets"`
+		DownloadPackets      int                 `json:"download_packets"`
+		RetransmittedPackets int                 `json:"retransmitted_packets"`
+		RetransmittedBytes   int                 `json:"retransmitted_bytes"`
+		RTTSeconds           float64             `json:"rtt_seconds,omitempty"`
+		FirstSeen            time.Time           `json:"first_seen"`
+		LastSeen             time.Time           `json:"last_seen"`
+		jsonRates
+	}
+
+	jsonConnectionInfo struct {
+		Interface            string       `json:"interface,omitempty"`
+		Process              *jsonProcess `json:"process,omitempty"`
+		Family               string       `json:"family"`
+		Scope                string       `json:"scope"`
+		Loopback             bool         `json:"loopback"`
+		ServerName           string       `json:"server_name,omitempty"`
+		UploadBytes          int          `json:"upload_bytes"`
+		DownloadBytes        int          `json:"download_bytes"`
+		UploadPayloadBytes   int          `json:"upload_payload_bytes"`
+		DownloadPayloadBytes int          `json:"download_payload_bytes"`
+		UploadPackets        int          `json:"upload_packets"`
+		DownloadPackets      int          `json:"download_packets"`
+		RetransmittedPackets int          `json:"retransmitted_packets"`
+		RetransmittedBytes   int          `json:"retransmitted_bytes"`
+		TCPState             string       `json:"tcp_state,omitempty"`
+		FirstSeen            time.Time    `json:"first_seen"`
+		LastSeen             time.Time    `json:"last_seen"`
+	}
+)
+
+func newJSONRates(upload, download float64, b Bandwidth) jsonRates {
+	return jsonRates{
+		UploadRate:       upload,
+		DownloadRate:     download,
+		PeakUploadRate:   b.PeakUploadRate,
+		PeakDownloadRate: b.PeakDownloadRate,
+		AvgUploadRate:    b.AvgUploadRate,
+		AvgDownloadRate:  b.AvgDownloadRate,
+		UploadHistory:    b.UploadHistory,
+		DownloadHistory:  b.DownloadHistory,
+	}
+}
+
+// MarshalJSON encodes the snapshot by the schema of SnapshotSchemaVersion, the
+// connections and the remote ports listed in a stable order. The neighbors, the
+// discoveries and the events are left out.
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	out := jsonSnapshot{
+		Version:        SnapshotSchemaVersion,
+		ElapsedSeconds: s.Elapsed.Seconds(),
+		Goodput:        s.Goodput,
+		Cumulative:     s.Cumulative,
+		Degraded:       s.Degraded,
+		Totals: jsonTotals{
+			UploadBytes:          s.TotalUploadBytes,
+			DownloadBytes:        s.TotalDownloadBytes,
+			UploadPayloadBytes:   s.TotalUploadPayloadBytes,
+			DownloadPayloadBytes: s.TotalDownloadPayloadBytes,
+			UploadPackets:        s.TotalUploadPackets,
+			DownloadPackets:      s.TotalDownloadPackets,
+			Connections:          s.TotalConnections,
+			ActiveConnections:    s.ActiveConnections,
+			EvictedConnections:   s.EvictedConnections,
+		},
+		Throughput:       s.Throughput,
+		Processes:        s.Processes,
+		RemoteAddrs:      s.RemoteAddrs,
+		Applications:     s.Applications,
+		Families:         make(map[string]*NetworkData),
+		Interfaces:       s.Interfaces,
+		Users:            s.Users,
+		Containers:       s.Containers,
+		Categories:       s.Categories,
+		Countries:        s.Countries,
+		ASNs:             s.ASNs,
+		Unattributed:     s.Unattributed,
+		Tags:             s.Tags,
+		Views:            s.Views,
+		Scopes:           make(map[string]*NetworkData),
+		ProcessTotals:    s.ProcessTotals,
+		RemoteAddrTotals: s.RemoteAddrTotals,
+	}
+	if s.Scope != nil {
+		out.Scope = s.Scope.String()
+	}
+	out.Watch, out.Watched = s.Watch, s.Watched
+	for family, data := range s.Families {
+		out.Families[family.String()] = data
+	}
+	for scope, data := range s.Scopes {
+		out.Scopes[scope.String()] = data
+	}
+
+	out.RemotePorts = make([]RemotePortsResult, 0, len(s.RemotePorts))
+	for port, data := range s.RemotePorts {
+		out.RemotePorts = append(out.RemotePorts, RemotePortsResult{Port: port, Data: data})
+	}
+	sort.Slice(out.RemotePorts, func(i, j int) bool {
+		a, b := out.RemotePorts[i].Port, out.RemotePorts[j].Port
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Protocol < b.Protocol
+	})
+
+	conns := make([]Connection, 0, len(s.Connections))
+	for conn := range s.Connections {
+		conns = append(conns, conn)
+	}
+	sortConnections(conns)
+	out.Connections = make([]ConnectionsResult, 0, len(conns))
+	for _, conn := range conns {
+		out.Connections = append(out.Connections, ConnectionsResult{Conn: conn, Data: s.Connections[conn]})
+	}
+	return json.Marshal(out)
+}
+
+func (d NetworkData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonNetworkData{
+		UploadBytes:          d.UploadBytes,
+		DownloadBytes:        d.DownloadBytes,
+		UploadPayloadBytes:   d.UploadPayloadBytes,
+		DownloadPayloadBytes: d.DownloadPayloadBytes,
+		UploadPackets:        d.UploadPackets,
+		DownloadPackets:      d.DownloadPackets,
+		Connections:          d.ConnCount,
+		jsonRates:            newJSONRates(d.UploadRate, d.DownloadRate, d.Bandwidth),
+		TCP:                  d.TCP,
+		UDP:                  d.UDP,
+	})
+}
+
+func (d ConnectionData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonConnectionData{
+		Process:              d.ProcessName,
+		Interface:            d.InterfaceName,
+		ServerName:           d.ServerName,
+		RemoteOS:             d.RemoteOS,
+		CommunityID:          d.CommunityID,
+		Application:          d.Application,
+		UploadBytes:          d.UploadBytes,
+		DownloadBytes:        d.DownloadBytes,
+		UploadPayloadBytes:   d.UploadPayloadBytes,
+		DownloadPayloadBytes: d.DownloadPayloadBytes,
+		UploadPackets:        d.UploadPackets,
+		DownloadPackets:      d.DownloadPackets,
+		RetransmittedPackets: d.RetransmittedPackets,
+		RetransmittedBytes:   d.RetransmittedBytes,
+		RTTSeconds:           d.RTT.Seconds(),
+		FirstSeen:            d.FirstSeen,
+		LastSeen:             d.LastSeen,
+		jsonRates:            newJSONRates(d.UploadRate, d.DownloadRate, d.Bandwidth),
+	})
+}
+
+func (c ConnectionInfo) MarshalJSON() ([]byte, error) {
+	out := jsonConnectionInfo{
+		Interface:            c.Interface,
+		Family:               c.Family.String(),
+		Scope:                c.Scope.String(),
+		Loopback:             c.Loopback,
+		ServerName:           c.ServerName,
+		UploadBytes:          c.UploadBytes,
+		DownloadBytes:        c.DownloadBytes,
+		UploadPayloadBytes:   c.UploadPayloadBytes,
+		DownloadPayloadBytes: c.DownloadPayloadBytes,
+		UploadPackets:        c.UploadPackets,
+		DownloadPackets:      c.DownloadPackets,
+		RetransmittedPackets: c.RetransmittedPackets,
+		RetransmittedBytes:   c.RetransmittedBytes,
+		FirstSeen:            c.FirstSeen,
+		LastSeen:             c.LastSeen,
+	}
+	if c.Process != nil {
+		p := c.Process
+		out.Process = &jsonProcess{Pid: p.Pid, Name: p.Name, User: p.User, Container: p.Container}
+	}
+	if c.TCPState != TCPStateNone {
+		out.TCPState = c.TCPState.String()
+	}
+	return json.Marshal(out)
+}
+
+func (c Connection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonConnection{
+		Protocol:   c.Local.Protocol,
+		LocalIP:    c.Local.IP,
+		LocalPort:  c.Local.Port,
+		RemoteIP:   c.Remote.IP,
+		RemotePort: c.Remote.Port,
+		Service:    c.RemoteService(),
+		VNI:        c.VNI,
+	})
+}
+
+func (r ProcessesResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Process string       `json:"process"`
+		Data    *NetworkData `json:"data"`
+	}{r.ProcessName, r.Data})
+}
+
+func (r RemoteAddrsResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Addr     string        `json:"addr"`
+		Location *jsonLocation `json:"location,omitempty"`
+		Data     *NetworkData  `json:"data"`
+	}{r.Addr, newJSONLocation(r.Location), r.Data})
+}
+
+func (r ConnectionsResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Conn Connection      `json:"connection"`
+		Data *ConnectionData `json:"data"`
+	}{r.Conn, r.Data})
+}
+
+func (r ApplicationsResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Application ApplicationProtocol `json:"application"`
+		Data        *NetworkData        `json:"data"`
+	}{r.Application, r.Data})
+}
+
+func (r InterfacesResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Interface string       `json:"interface"`
+		Data      *NetworkData `json:"data"`
+	}{r.Interface, r.Data})
+}
+
+func (r RemotePortsResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Port     uint16       `json:"port"`
+		Protocol Protocol     `json:"protocol"`
+		Service  string       `json:"service,omitempty"`
+		Data     *NetworkData `json:"data"`
+	}{r.Port.Port, r.Port.Protocol, r.Port.Service(), r.Data})
+}
+
+func (r UsersResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		User string       `json:"user"`
+		Data *NetworkData `json:"data"`
+	}{r.User, r.Data})
+}
+
+func (r ContainersResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Container string       `json:"container"`
+		Data      *NetworkData `json:"data"`
+	}{r.Container, r.Data})
+}
+
+func (r ViewResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Group string       `json:"group"`
+		Data  *NetworkData `json:"data"`
+	}{r.Group, r.Data})
+}
+
+func (r CategoriesResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Category string       `json:"category"`
+		Data     *NetworkData `json:"data"`
+	}{r.Category, r.Data})
+}
+
+func newJSONLocation(l *Location) *jsonLocation {
+	if l == nil {
+		return nil
+	}
+	return &jsonLocation{Country: l.Country, CountryName: l.CountryName, City: l.City, ASN: l.ASN, ASOrg: l.ASOrg}
+}
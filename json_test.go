@@ -0,0 +1,91 @@
+package sniffer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotMarshalJSON(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{IP: "10.0.0.1", Port: 2, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}: {Process: curl, Family: FamilyIPv4, UploadBytes: 4000},
+		{Local: LocalSocket{IP: "10.0.0.1", Port: 1, Protocol: ProtoUDP}, Remote: RemoteSocket{IP: "8.8.8.8", Port: 53}}:  {Process: curl, Family: FamilyIPv4, DownloadBytes: 200},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	b, err := json.Marshal(snapshot)
+	assert.NoError(t, err)
+
+	var out struct {
+		Version int `json:"version"`
+		Totals  struct {
+			UploadBytes int `json:"upload_bytes"`
+		} `json:"totals"`
+		Processes map[string]struct {
+			UploadBytes int `json:"upload_bytes"`
+			Connections int `json:"connections"`
+			TCP         *struct {
+				Connections int `json:"connections"`
+			} `json:"tcp"`
+		} `json:"processes"`
+		Families    map[string]json.RawMessage `json:"families"`
+		RemotePorts []struct {
+			Port    uint16 `json:"port"`
+			Service string `json:"service"`
+		} `json:"remote_ports"`
+		Connections []struct {
+			Conn struct {
+				Protocol  string `json:"protocol"`
+				LocalPort uint16 `json:"local_port"`
+			} `json:"connection"`
+			Data struct {
+				Process string `json:"process"`
+			} `json:"data"`
+		} `json:"connections"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &out))
+
+	assert.Equal(t, SnapshotSchemaVersion, out.Version)
+	assert.Equal(t, 2000, out.Totals.UploadBytes)
+	assert.Equal(t, 2000, out.Processes["<1>:curl"].UploadBytes)
+	assert.Equal(t, 2, out.Processes["<1>:curl"].Connections)
+	assert.Equal(t, 1, out.Processes["<1>:curl"].TCP.Connections)
+	assert.Contains(t, out.Families, "IPv4")
+	assert.Len(t, out.RemotePorts, 2)
+	assert.Equal(t, uint16(53), out.RemotePorts[0].Port)
+	assert.Equal(t, "domain", out.RemotePorts[0].Service)
+
+	// the connections are listed in a stable order
+	assert.Len(t, out.Connections, 2)
+	assert.Equal(t, uint16(1), out.Connections[0].Conn.LocalPort)
+	assert.Equal(t, "udp", out.Connections[0].Conn.Protocol)
+	assert.Equal(t, "<1>:curl", out.Connections[0].Data.Process)
+}
+
+func TestConnectionInfoMarshalJSON(t *testing.T) {
+	info := ConnectionInfo{
+		Interface:   "eth0",
+		Process:     &ProcessInfo{Pid: 1, Name: "curl", User: "alice"},
+		Family:      FamilyIPv6,
+		Scope:       ScopeLocal,
+		UploadBytes: 100,
+		TCPState:    TCPStateEstablished,
+	}
+	b, err := json.Marshal(&info)
+	assert.NoError(t, err)
+
+	var out map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &out))
+	assert.Equal(t, "eth0", out["interface"])
+	assert.Equal(t, "IPv6", out["family"])
+	assert.Equal(t, "local", out["scope"])
+	assert.Equal(t, "established", out["tcp_state"])
+	assert.Equal(t, 100.0, out["upload_bytes"])
+	assert.Equal(t, map[string]interface{}{"pid": 1.0, "name": "curl", "user": "alice"}, out["process"])
+}
@@ -0,0 +1,111 @@
+package sniffer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// labeledNet is a network of the labels file along with its label.
+type labeledNet struct {
+	net   *net.IPNet
+	label string
+}
+
+// HostLabels names the remote hosts after the networks they are in, as told by a file
+// of the user, so the internal infrastructure reads better than its IPs.
+type HostLabels []labeledNet // Most specific networks first
+
+// LoadHostLabels reads the labels file at the path.
+func LoadHostLabels(path string) (HostLabels, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	labels, err := parseHostLabels(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return labels, nil
+}
+
+// parseHostLabels parses a labels file, of lines like "10.2.0.0/16 = staging-k8s #
+// comment", a bare IP standing for its host alone.
+func parseHostLabels(r io.Reader) (HostLabels, error) {
+	var labels HostLabels
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: want CIDR = label", n)
+		}
+		cidr, label := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if label == "" {
+			return nil, fmt.Errorf("line %d: empty label", n)
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid CIDR %q", n, strings.TrimSpace(parts[0]))
+		}
+		labels = append(labels, labeledNet{net: ipNet, label: label})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(labels, func(i, j int) bool {
+		a, _ := labels[i].net.Mask.Size()
+		b, _ := labels[j].net.Mask.Size()
+		return a > b
+	})
+	return labels, nil
+}
+
+// Label returns the label of the most specific network of the IP, empty if none.
+func (l HostLabels) Label(ip string) string {
+	if len(l) == 0 {
+		return ""
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	for _, n := range l {
+		if n.net.Contains(parsed) {
+			return n.label
+		}
+	}
+	return ""
+}
+
+// nameRemote names the remote end of the segment after its label, or else after the
+// name the process of the connection looked up.
+func (c *PcapClient) nameRemote(seg *Segment) {
+	if label := c.labels.Label(seg.Connection.Remote.IP); label != "" {
+		seg.Connection.Remote.IP, seg.Labeled = label, true
+		return
+	}
+	if seg.Connection.Local.Protocol == ProtoTCP && !c.disableDNSResolve {
+		seg.Connection.Remote.IP = c.lookup(seg.Connection.Remote.IP, seg.Process)
+	}
+}
@@ -0,0 +1,51 @@
+package sniffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHostLabels(t *testing.T) {
+	labels, err := parseHostLabels(strings.NewReader(`# the clusters
+10.2.0.0/16 = staging-k8s
+10.2.3.0/24 = staging-db # the databases
+10.9.9.9 = bastion
+
+2001:db8::/32 = lab
+`))
+	assert.NoError(t, err)
+	assert.Len(t, labels, 4)
+
+	// the most specific network wins, whatever the order of the lines
+	assert.Equal(t, "staging-k8s", labels.Label("10.2.0.1"))
+	assert.Equal(t, "staging-db", labels.Label("10.2.3.4"))
+	assert.Equal(t, "bastion", labels.Label("10.9.9.9"))
+	assert.Equal(t, "", labels.Label("10.9.9.8"))
+	assert.Equal(t, "lab", labels.Label("2001:db8::1"))
+	assert.Equal(t, "", labels.Label("example.com"))
+
+	var none HostLabels
+	assert.Equal(t, "", none.Label("10.2.0.1"))
+
+	for _, bad := range []string{"10.2.0.0/16 staging", "10.2.0.0/16 =", "10.2.0.0/33 = staging", "staging = 10.2.0.0/16"} {
+		_, err := parseHostLabels(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestNameRemote(t *testing.T) {
+	labels, _ := parseHostLabels(strings.NewReader("10.2.0.0/16 = staging-k8s"))
+	c := &PcapClient{labels: labels, lookup: func(ip string, process *ProcessInfo) string { return "host-" + ip }}
+
+	seg := &Segment{Connection: Connection{Local: LocalSocket{Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "10.2.0.1"}}}
+	c.nameRemote(seg)
+	assert.Equal(t, "staging-k8s", seg.Connection.Remote.IP)
+	assert.True(t, seg.Labeled)
+
+	seg = &Segment{Connection: Connection{Local: LocalSocket{Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "10.3.0.1"}}}
+	c.nameRemote(seg)
+	assert.Equal(t, "host-10.3.0.1", seg.Connection.Remote.IP)
+	assert.False(t, seg.Labeled)
+}
@@ -0,0 +1,24 @@
+package sniffer
+
+// mirrorDirection picks the direction of a packet between two other hosts, as seen
+// on a mirror port. The host on the local network is taken for the local end, the
+// client for it if both or neither are, telling the client by its ephemeral port. The
+// same end is picked for both directions of a connection.
+func mirrorDirection(local subnets, srcIP, dstIP string, srcPort, dstPort uint16) Direction {
+	srcLocal := local.scopeOf(srcIP) == ScopeLocal
+	dstLocal := local.scopeOf(dstIP) == ScopeLocal
+	switch {
+	case srcLocal && !dstLocal:
+		return DirectionUpload
+	case dstLocal && !srcLocal:
+		return DirectionDownload
+	case srcPort != dstPort:
+		if srcPort > dstPort {
+			return DirectionUpload
+		}
+		return DirectionDownload
+	case srcIP < dstIP:
+		return DirectionUpload
+	}
+	return DirectionDownload
+}
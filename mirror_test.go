@@ -0,0 +1,22 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorDirection(t *testing.T) {
+	local, err := parseSubnets(DefaultLocalSubnets)
+	assert.NoError(t, err)
+
+	assert.Equal(t, DirectionUpload, mirrorDirection(local, "192.168.1.10", "1.1.1.1", 443, 50000))
+	assert.Equal(t, DirectionDownload, mirrorDirection(local, "1.1.1.1", "192.168.1.10", 50000, 443))
+
+	// between local hosts the client is the local end
+	assert.Equal(t, DirectionUpload, mirrorDirection(local, "192.168.1.10", "192.168.1.20", 50000, 22))
+	assert.Equal(t, DirectionDownload, mirrorDirection(local, "192.168.1.20", "192.168.1.10", 22, 50000))
+
+	assert.Equal(t, DirectionUpload, mirrorDirection(local, "192.168.1.10", "192.168.1.20", 0, 0))
+	assert.Equal(t, DirectionDownload, mirrorDirection(local, "192.168.1.20", "192.168.1.10", 0, 0))
+}
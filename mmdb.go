@@ -0,0 +1,306 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// The remote IPs are looked up in MaxMind DB files, the format of the GeoLite2 and
+// GeoIP2 databases, with as little of the format as the lookups need: the records are
+// decoded into maps, slices, strings and numbers.
+
+// mmdbMetadataMarker starts the metadata at the end of a MaxMind DB file.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errMMDBCorrupt is the error of the files not following the format.
+var errMMDBCorrupt = errors.New("corrupt MaxMind DB")
+
+// The data types of the MaxMind DB format.
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+)
+
+// mmdbMaxDepth bounds the nesting of the records, which the pointers could otherwise
+// make endless.
+const mmdbMaxDepth = 32
+
+// mmdbReader looks the IPs up in the search tree of a MaxMind DB held in memory.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint   // Bits of each of the two records of a node
+	ipVersion  uint   // 4 if the tree holds the IPv4 addresses only, 6 otherwise
+	ipv4Start  uint   // Node of ::/96, where the IPv4 addresses start in an IPv6 tree
+	data       []byte // Data section, which the records point into
+}
+
+// openMMDB reads the MaxMind DB file into memory.
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newMMDBReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	end := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if end < 0 {
+		return nil, errors.New("not a MaxMind DB, no metadata")
+	}
+	meta, _, err := mmdbDecoder(buf[end+len(mmdbMetadataMarker):]).decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, errMMDBCorrupt
+	}
+
+	r := &mmdbReader{
+		buf:        buf,
+		nodeCount:  mmdbUint(m["node_count"]),
+		recordSize: mmdbUint(m["record_size"]),
+		ipVersion:  mmdbUint(m["ip_version"]),
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(end) {
+		return nil, errMMDBCorrupt
+	}
+	r.data = buf[treeSize+16 : end]
+
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+	return r, nil
+}
+
+// mmdbUint returns the unsigned number of the metadata, 0 if none.
+func mmdbUint(v interface{}) uint {
+	if n, ok := v.(uint64); ok {
+		return uint(n)
+	}
+	return 0
+}
+
+// record returns the left record of the node if the bit is 0, the right one otherwise.
+func (r *mmdbReader) record(node, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+	return uint(binary.BigEndian.Uint32(r.buf[node*8+bit*4:]))
+}
+
+// lookup returns the record of the network of the IP, nil if the database has none.
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, error) {
+	node, bits := uint(0), 128
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits = v4, 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 || ip.To16() == nil {
+		return nil, nil
+	}
+
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = r.record(node, bit)
+	}
+	switch {
+	case node == r.nodeCount:
+		return nil, nil
+	case node < r.nodeCount || node-r.nodeCount-16 >= uint(len(r.data)):
+		return nil, errMMDBCorrupt
+	}
+	v, _, err := mmdbDecoder(r.data).decode(node-r.nodeCount-16, 0)
+	return v, err
+}
+
+// mmdbDecoder decodes the values of a section of the file, which its pointers are
+// relative to.
+type mmdbDecoder []byte
+
+// decode returns the value at the offset along with the offset following it.
+func (d mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDepth || offset >= uint(len(d)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	ctrl := d[offset]
+	offset++
+
+	typ := uint(ctrl >> 5)
+	if typ == mmdbPointer {
+		ptr, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr, depth+1)
+		return v, next, err
+	}
+	if typ == mmdbExtended {
+		if offset >= uint(len(d)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		typ = 7 + uint(d[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		var v uint
+		for _, b := range d[offset : offset+n] {
+			v = v<<8 | uint(b)
+		}
+		offset += n
+		size = [...]uint{29, 285, 65821}[n-1] + v
+	}
+
+	// each of the entries takes a byte at least
+	if (typ == mmdbMap || typ == mmdbArray) && size > uint(len(d)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			if m[key], offset, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, size)
+		for i := range a {
+			var err error
+			if a[i], offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	b := d[offset : offset+size]
+	offset += size
+	switch typ {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes, mmdbUint128:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		var v uint64
+		for _, x := range b {
+			v = v<<8 | uint64(x)
+		}
+		if typ == mmdbInt32 {
+			return int64(int32(v)), offset, nil
+		}
+		return v, offset, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported MaxMind DB data type %d", typ)
+}
+
+// pointer returns the offset the pointer points to along with the offset following it.
+func (d mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	ss := uint(ctrl>>3) & 0x3
+	n := ss + 1
+	if offset+n > uint(len(d)) {
+		return 0, 0, errMMDBCorrupt
+	}
+	var v uint
+	if ss < 3 {
+		v = uint(ctrl & 0x7)
+	}
+	for _, b := range d[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	switch ss {
+	case 1:
+		v += 2048
+	case 2:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+// mmdbLookupString returns the string at the path of maps of the record, empty if none.
+func mmdbLookupString(record interface{}, path ...string) string {
+	for _, key := range path {
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		record = m[key]
+	}
+	s, _ := record.(string)
+	return s
+}
@@ -0,0 +1,215 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mmdbTestPointer encodes a pointer to the offset of the data section.
+type mmdbTestPointer uint
+
+// mmdbTestNetwork is a network of a MaxMind DB built for the tests along with its record.
+type mmdbTestNetwork struct {
+	cidr   string
+	record interface{}
+}
+
+func mmdbTestControl(buf *bytes.Buffer, typ, size int) {
+	extra := -1
+	if size >= 29 {
+		size, extra = 29, size-29
+	}
+	if typ <= 7 {
+		buf.WriteByte(byte(typ<<5 | size))
+	} else {
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(typ - 7))
+	}
+	if extra >= 0 {
+		buf.WriteByte(byte(extra))
+	}
+}
+
+// mmdbTestEncode encodes the maps, arrays, strings, numbers and pointers of the tests.
+func mmdbTestEncode(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		mmdbTestControl(buf, mmdbMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			mmdbTestEncode(buf, k)
+			mmdbTestEncode(buf, v[k])
+		}
+	case []interface{}:
+		mmdbTestControl(buf, mmdbArray, len(v))
+		for _, e := range v {
+			mmdbTestEncode(buf, e)
+		}
+	case string:
+		mmdbTestControl(buf, mmdbString, len(v))
+		buf.WriteString(v)
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		b = bytes.TrimLeft(b, "\x00")
+		mmdbTestControl(buf, mmdbUint32, len(b))
+		buf.Write(b)
+	case mmdbTestPointer:
+		buf.WriteByte(byte(mmdbPointer<<5 | int(v>>8)&0x7))
+		buf.WriteByte(byte(v))
+	}
+}
+
+type mmdbTestNode struct {
+	child [2]*mmdbTestNode
+	data  [2]int // Offset plus one of the record of the network ending on the branch
+}
+
+// buildMMDB builds a MaxMind DB of the networks, the IPv4 ones under ::/96 in an IPv6
+// tree.
+func buildMMDB(recordSize, ipVersion uint, networks []mmdbTestNetwork) []byte {
+	var data bytes.Buffer
+	root := &mmdbTestNode{}
+	for _, network := range networks {
+		_, ipnet, _ := net.ParseCIDR(network.cidr)
+		ones, _ := ipnet.Mask.Size()
+		ip := []byte(ipnet.IP)
+		if v4 := ipnet.IP.To4(); v4 != nil {
+			ip = v4
+			if ipVersion == 6 {
+				ip, ones = append(make([]byte, 12), v4...), ones+96
+			}
+		}
+
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i>>3] >> (7 - uint(i&7)) & 1
+			if i == ones-1 {
+				node.data[bit] = data.Len() + 1
+				break
+			}
+			if node.child[bit] == nil {
+				node.child[bit] = &mmdbTestNode{}
+			}
+			node = node.child[bit]
+		}
+		mmdbTestEncode(&data, network.record)
+	}
+
+	nodes := []*mmdbTestNode{root}
+	index := map[*mmdbTestNode]uint{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].child {
+			if child != nil {
+				index[child] = uint(len(nodes))
+				nodes = append(nodes, child)
+			}
+		}
+	}
+
+	count := uint(len(nodes))
+	var tree bytes.Buffer
+	for _, node := range nodes {
+		var records [2]uint
+		for bit := range records {
+			switch {
+			case node.child[bit] != nil:
+				records[bit] = index[node.child[bit]]
+			case node.data[bit] > 0:
+				records[bit] = count + 16 + uint(node.data[bit]-1)
+			default:
+				records[bit] = count
+			}
+		}
+		left, right := records[0], records[1]
+		switch recordSize {
+		case 24:
+			tree.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			tree.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24)<<4 | byte(right>>24), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			binary.Write(&tree, binary.BigEndian, []uint32{uint32(left), uint32(right)})
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tree.Bytes())
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.Write(mmdbMetadataMarker)
+	mmdbTestEncode(&buf, map[string]interface{}{
+		"node_count":  uint32(count),
+		"record_size": uint32(recordSize),
+		"ip_version":  uint32(ipVersion),
+	})
+	return buf.Bytes()
+}
+
+func TestMMDBLookup(t *testing.T) {
+	long := "a name longer than the sizes held by the control byte"
+	for _, recordSize := range []uint{24, 28, 32} {
+		for _, ipVersion := range []uint{4, 6} {
+			networks := []mmdbTestNetwork{
+				{"1.0.0.0/8", map[string]interface{}{"name": "one", "asn": uint32(13335)}},
+				{"10.1.0.0/16", map[string]interface{}{"name": long, "tags": []interface{}{"a", "b"}}},
+				{"10.2.0.0/16", map[string]interface{}{"same": mmdbTestPointer(0)}},
+			}
+			if ipVersion == 6 {
+				networks = append(networks, mmdbTestNetwork{"2001:db8::/32", map[string]interface{}{"name": "doc"}})
+			}
+			r, err := newMMDBReader(buildMMDB(recordSize, ipVersion, networks))
+			assert.NoError(t, err)
+
+			record, err := r.lookup(net.ParseIP("1.2.3.4"))
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"name": "one", "asn": uint64(13335)}, record)
+
+			record, err = r.lookup(net.ParseIP("10.1.255.1"))
+			assert.NoError(t, err)
+			assert.Equal(t, long, mmdbLookupString(record, "name"))
+			assert.Equal(t, []interface{}{"a", "b"}, record.(map[string]interface{})["tags"])
+
+			// the pointers point into the data section
+			record, err = r.lookup(net.ParseIP("10.2.0.1"))
+			assert.NoError(t, err)
+			assert.Equal(t, "one", mmdbLookupString(record, "same", "name"))
+
+			record, err = r.lookup(net.ParseIP("10.3.0.1"))
+			assert.NoError(t, err)
+			assert.Nil(t, record)
+
+			record, err = r.lookup(net.ParseIP("2001:db8::1"))
+			assert.NoError(t, err)
+			if ipVersion == 6 {
+				assert.Equal(t, "doc", mmdbLookupString(record, "name"))
+			} else {
+				assert.Nil(t, record)
+			}
+		}
+	}
+}
+
+func TestMMDBCorrupt(t *testing.T) {
+	_, err := newMMDBReader([]byte("not a database"))
+	assert.Error(t, err)
+
+	db := buildMMDB(24, 4, []mmdbTestNetwork{{"1.0.0.0/8", map[string]interface{}{"name": "one"}}})
+	_, err = newMMDBReader(db[:len(db)-5])
+	assert.Error(t, err)
+
+	// a record cut short fails the lookups, not the reader
+	r, err := newMMDBReader(db)
+	assert.NoError(t, err)
+	r.data = r.data[:3]
+	_, err = r.lookup(net.ParseIP("1.2.3.4"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,27 @@
+package sniffer
+
+import "time"
+
+// MonitorStats are the self-metrics of the process monitor, telling whether the
+// segments of unknown processes come from sockets missed between the refreshes or
+// from processes whose sockets can't be read without the privileges.
+type MonitorStats struct {
+	RefreshDuration time.Duration // time the latest refresh took
+	PidsScanned     int           // processes whose sockets the latest refresh read
+	PidsDenied      int           // processes whose sockets the latest refresh was denied
+	Sockets         int           // sockets dumped by the latest refresh
+	Unattributed    int           // sockets of unknown processes in the latest refresh
+
+	// Lookups counts the connections whose process was looked up, Misses those of
+	// unknown processes
+	Lookups uint64
+	Misses  uint64
+}
+
+// HitRate returns the ratio of the lookups finding the process, 1 without lookups.
+func (m MonitorStats) HitRate() float64 {
+	if m.Lookups == 0 {
+		return 1
+	}
+	return float64(m.Lookups-m.Misses) / float64(m.Lookups)
+}
@@ -0,0 +1,12 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMonitorStatsHitRate(t *testing.T) {
+	assert.Equal(t, 1.0, MonitorStats{}.HitRate())
+	assert.Equal(t, 0.75, MonitorStats{Lookups: 8, Misses: 2}.HitRate())
+}
@@ -0,0 +1,78 @@
+package sniffer
+
+import (
+	"net"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Neighbor identifies a host on the LAN by its hardware and protocol address.
+type Neighbor struct {
+	MAC string
+	IP  string
+}
+
+// NeighborInfo counts the ARP/NDP packets sent by a neighbor.
+type NeighborInfo struct {
+	Interface string
+	Requests  int // ARP requests, NDP router/neighbor solicitations
+	Replies   int // ARP replies, NDP router/neighbor advertisements
+}
+
+func (n *NeighborInfo) DivideBy(d int) {
+	n.PerSecond(time.Duration(d) * time.Second)
+}
+
+// PerSecond turns the packets counted over the interval into their averages over a
+// second.
+func (n *NeighborInfo) PerSecond(interval time.Duration) {
+	n.Requests = perSecond(n.Requests, interval)
+	n.Replies = perSecond(n.Replies, interval)
+}
+
+type Neighbors map[Neighbor]*NeighborInfo
+
+// NeighborPacket is an ARP/NDP packet observed on a device.
+type NeighborPacket struct {
+	Interface string
+	Neighbor  Neighbor
+	Reply     bool
+}
+
+// arpNeighborPacket returns the neighbor packet of the ARP request/reply.
+func arpNeighborPacket(device string, arp *layers.ARP) (NeighborPacket, bool) {
+	pkt := NeighborPacket{
+		Interface: device,
+		Neighbor: Neighbor{
+			MAC: net.HardwareAddr(arp.SourceHwAddress).String(),
+			IP:  net.IP(arp.SourceProtAddress).String(),
+		},
+	}
+
+	switch arp.Operation {
+	case layers.ARPRequest:
+		return pkt, true
+	case layers.ARPReply:
+		pkt.Reply = true
+		return pkt, true
+	}
+	return pkt, false
+}
+
+// ndpNeighborPacket returns the neighbor packet of the ICMPv6 neighbor discovery message.
+func ndpNeighborPacket(device string, mac net.HardwareAddr, ip net.IP, icmpType uint8) (NeighborPacket, bool) {
+	pkt := NeighborPacket{
+		Interface: device,
+		Neighbor:  Neighbor{MAC: mac.String(), IP: ip.String()},
+	}
+
+	switch icmpType {
+	case layers.ICMPv6TypeRouterSolicitation, layers.ICMPv6TypeNeighborSolicitation:
+		return pkt, true
+	case layers.ICMPv6TypeRouterAdvertisement, layers.ICMPv6TypeNeighborAdvertisement:
+		pkt.Reply = true
+		return pkt, true
+	}
+	return pkt, false
+}
@@ -0,0 +1,124 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// procNetns returns the inode identifying the network namespace of the process
+func procNetns(pid int32) (uint64, error) {
+	fi, err := os.Stat(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no inode for the network namespace of %d", pid)
+	}
+	return st.Ino, nil
+}
+
+// netnsIPs returns the IPs of the interfaces of the own network namespace, nil if
+// they can't be listed
+func netnsIPs() map[string]bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	ips := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			ips[ipnet.IP.String()] = true
+		}
+	}
+	return ips
+}
+
+// foreignNetns returns a process of each network namespace other than the own one,
+// by the lowest pid, given the namespaces of the processes. The unknown namespaces
+// are zero.
+func foreignNetns(netns map[int32]uint64, own uint64) []int32 {
+	first := make(map[uint64]int32)
+	for pid, ns := range netns {
+		if ns == 0 || ns == own {
+			continue
+		}
+		if prev, ok := first[ns]; !ok || pid < prev {
+			first[ns] = pid
+		}
+	}
+
+	pids := make([]int32, 0, len(first))
+	for _, pid := range first {
+		pids = append(pids, pid)
+	}
+	sort.Slice(pids, func(i, j int) bool { return pids[i] < pids[j] })
+	return pids
+}
+
+// inNetns runs fn in the network namespace of the process, on a thread of its own
+// which is discarded if it fails to get back to the namespace it started from.
+func inNetns(pid int32, fn func()) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		origin, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errc <- err
+			return
+		}
+		defer origin.Close()
+
+		target, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errc <- err
+			return
+		}
+		defer target.Close()
+
+		if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			errc <- err
+			return
+		}
+		fn()
+
+		// the thread stays locked, hence exits along with the goroutine, unless back
+		if err := unix.Setns(int(origin.Fd()), unix.CLONE_NEWNET); err == nil {
+			runtime.UnlockOSThread()
+		}
+		errc <- nil
+	}()
+	return <-errc
+}
+
+// getNetnsSockets dumps the sockets of the network namespaces of the processes into
+// the sockets, the ones of the own namespace being kept over the same ones of other
+// namespaces. The namespaces which fail entering or dumping are skipped.
+func (nl *netlinkConn) getNetnsSockets(netnsPids []int32, inodeMap map[uint32]ProcessInfo, details *socketDetails, sockets OpenSockets) {
+	for _, pid := range netnsPids {
+		var nsSockets OpenSockets
+		var err error
+		if inNetns(pid, func() { nsSockets, err = nl.getDiagSockets(inodeMap, details) }) != nil || err != nil {
+			continue
+		}
+
+		for socket, proc := range nsSockets {
+			if _, ok := sockets[socket]; !ok {
+				sockets[socket] = proc
+			}
+		}
+	}
+}
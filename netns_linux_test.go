@@ -0,0 +1,43 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForeignNetns(t *testing.T) {
+	netns := map[int32]uint64{1: 100, 20: 100, 300: 200, 301: 200, 40: 300, 50: 0}
+	assert.Equal(t, []int32{40, 300}, foreignNetns(netns, 100))
+	assert.Empty(t, foreignNetns(map[int32]uint64{1: 100}, 100))
+}
+
+func TestOwnNetnsOnly(t *testing.T) {
+	pm := NewProcessMonitor(time.Second)
+	pm.netns = 100
+	pm.procs = map[int32]procSockets{1: {netns: 100}, 300: {netns: 200}}
+	assert.Equal(t, []int32{300}, pm.netnsPids())
+
+	// the other namespaces can't be entered once the privileges are dropped
+	pm.SetOwnNetnsOnly(true)
+	assert.Empty(t, pm.netnsPids())
+}
+
+func TestInNetns(t *testing.T) {
+	own, err := procNetns(int32(os.Getpid()))
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var inside uint64
+	err = inNetns(int32(os.Getpid()), func() { inside, _ = procNetns(int32(os.Getpid())) })
+	if err != nil {
+		t.Skip(err) // entering a namespace takes CAP_SYS_ADMIN
+	}
+	assert.Equal(t, own, inside)
+}
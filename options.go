@@ -1,28 +1,248 @@
 package sniffer
 
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"time"
+)
+
 // Options is the options set for the sniffer instance.
 type Options struct {
 	// BPFFilter is the string pcap filter with the BPF syntax
 	// eg. "tcp and port 80"
 	BPFFilter string
 
-	// Interval is the interval for refresh rate in seconds
+	// Interval is the interval for refresh rate in seconds.
+	//
+	// Deprecated: use RefreshInterval, which wins when set.
 	Interval int
 
+	// RefreshInterval is the interval for refresh rate, e.g. 500ms, Interval seconds
+	// if 0
+	RefreshInterval time.Duration
+
 	// ViewMode represents the sniffer view mode, optional: bytes, packets, processes
 	ViewMode ViewMode
 
+	// SortKey is what the tables rank by, optional: total, upload, download, packets,
+	// connections. It's shifted at runtime by the o hotkey
+	SortKey SortKey
+
+	// Rows is the number of rows of each table
+	Rows int
+
+	// ExportDir is the directory the e hotkey exports the processes, the remote
+	// addresses and the connections to, as a timestamped CSV file each
+	ExportDir string
+
 	// DevicesPrefix represents prefixed devices to monitor
 	DevicesPrefix []string
 
-	// Unit of stats in processes mode, optional: B, Kb, KB, Mb, MB, Gb, GB
+	// Unit of stats in processes mode, optional: B, b, Kb, KB, Mb, MB, Gb, GB, or auto
+	// picking the unit of each value
 	Unit Unit
 
+	// Bits shows the stats in the bits units under the auto unit
+	Bits bool
+
 	// DisableDNSResolve decides whether if disable the DNS resolution
 	DisableDNSResolve bool
 
+	// PassiveDNSOnly names remote IPs only after the DNS responses seen on the wire,
+	// without issuing reverse lookups
+	PassiveDNSOnly bool
+
 	// AllDevices specifies whether to listen all devices or not
 	AllDevices bool
+
+	// TunnelOuter attributes tunnelled traffic to the outer tunnel endpoints
+	// instead of the inner connection
+	TunnelOuter bool
+
+	// WirePackets reports GRO/GSO super-packets exceeding the MTU as the number of
+	// packets they stand for on the wire
+	WirePackets bool
+
+	// Goodput ranks and shows the tables of bytes mode by the transport payload bytes
+	// instead of the bytes on the wire
+	Goodput bool
+
+	// VerifyChecksums verifies the IP, TCP and UDP checksums of the received packets,
+	// the corrupt ones are counted apart from the traffic. The loopback and virtual
+	// devices, whose checksums may be left unfinished, are skipped
+	VerifyChecksums bool
+
+	// IncludeLoopback counts the traffic of the loopback devices in the stats, it's
+	// toggled at runtime by the l hotkey, the loopback devices being captured either way
+	IncludeLoopback bool
+
+	// Cumulative ranks the processes and the remote addresses by their totals since
+	// the sniffer started instead of their current rates, it's toggled at runtime by
+	// the t hotkey
+	Cumulative bool
+
+	// LocalSubnets are the CIDRs of the local network, the traffic with the remote
+	// ends out of them is taken for internet traffic
+	LocalSubnets []string
+
+	// Dedup drops the copies of the packets captured on several devices, like a bond
+	// along with its members or a bridge along with its ports
+	Dedup bool
+
+	// Mirror accounts the traffic between other hosts as seen on a switch mirror port,
+	// grouping it by the hosts on the local network instead of the processes. The
+	// devices are put in promiscuous mode
+	Mirror bool
+
+	// ExcludeSelf leaves the traffic of the sniffer itself out of the stats, like its
+	// reverse lookups, which is bucketed under the sniffer otherwise
+	ExcludeSelf bool
+
+	// Pktap captures through the pktap pseudo-device on macOS, which tells the process
+	// of each packet, instead of looking the processes up from the sockets listed by
+	// lsof
+	Pktap bool
+
+	// ProcessRefreshMin and ProcessRefreshMax bound the refresh interval of the process
+	// monitor on Linux, shortened while the segments of unknown processes show up and
+	// lengthened while the sockets stay the same
+	ProcessRefreshMin time.Duration
+	ProcessRefreshMax time.Duration
+
+	// Pids and ProcessNames restrict the processes whose sockets are looked up on
+	// Linux to the given pids and the ones whose name matches the given patterns of
+	// filepath.Match, sparing the walk of the sockets of the others
+	Pids         []int
+	ProcessNames []string
+
+	// WatchPID and WatchProcessName restrict the stats of every view to the process of
+	// the pid and the ones whose name matches the pattern of filepath.Match, along with
+	// their children, none if zero and empty
+	WatchPID         int
+	WatchProcessName string
+
+	// SocketStates are the states of the TCP sockets looked up on Linux, e.g. LISTEN
+	// along with ESTABLISHED to attribute the connections accepted by a listening
+	// socket, the states being those of the kernel
+	SocketStates []string
+
+	// SockDiagTimeout bounds the wait for each reply of the sock_diag dumps of the
+	// sockets on Linux, to raise on the hosts slow to dump lots of sockets
+	SockDiagTimeout time.Duration
+
+	// User is the user the sniffer switches to on Linux once the capture handles and
+	// the netlink sockets are open, not to run with full root. The sockets of the
+	// processes of the other users are attributed by their owner then, and the ones of
+	// the other network namespaces are left unattributed, entering them taking root
+	User string
+
+	// HistorySize is the number of the latest intervals whose throughput is kept in
+	// total and per process, as returned by StatsManager.History
+	HistorySize int
+
+	// RateHistorySize is the number of the latest interval rates kept for each
+	// connection and process in the snapshots, e.g. for sparklines, none if 0
+	RateHistorySize int
+
+	// MaxConnections is the number of connections tracked at most, the traffic of the
+	// rest being folded into an <other> connection a protocol so the sniffer keeps
+	// within its memory under port scans and floods, unlimited if 0
+	MaxConnections int
+
+	// IdleTimeout leaves the connections idle longer than it out of the tables of the
+	// snapshots, as the ones stopped within the window, their traffic staying in the
+	// totals. It takes a window, the stats of an interval being all recent. 0 to keep
+	// them
+	IdleTimeout time.Duration
+
+	// Window sums the stats up over the intervals ended within the latest window
+	// instead of the latest interval only, so the tables refreshed often don't jump
+	// around, 0 to leave it off
+	Window time.Duration
+
+	// PercentileWindow is the window of the latest intervals whose rates the
+	// percentiles of the throughput of the connections and the processes go by
+	PercentileWindow time.Duration
+
+	// StateFile is the file the totals of the processes and the remote addresses are
+	// saved to, restored from when the sniffer restarts, none if empty
+	StateFile string
+
+	// StateSaveInterval is the interval the totals are saved to StateFile at
+	StateSaveInterval time.Duration
+
+	// StoreDir is the directory the rows of the processes and the remote addresses of
+	// each interval are recorded to, in a bbolt database, none if empty
+	StoreDir string
+
+	// StoreRetention is how long the intervals recorded to StoreDir are kept, forever if 0
+	StoreRetention time.Duration
+
+	// ParquetDir is the directory the rows of each interval are written to as Parquet,
+	// a file an hour to analyze with DuckDB or pandas, none if empty
+	ParquetDir string
+
+	// GeoIPDB is the MaxMind GeoLite2 or GeoIP2 City or Country database the remote IPs
+	// are located with, e.g. GeoLite2-City.mmdb, none if empty
+	GeoIPDB string
+
+	// ASNDB is the MaxMind GeoLite2 or GeoIP2 ASN database the autonomous systems of
+	// the remote IPs are looked up in, e.g. GeoLite2-ASN.mmdb, none if empty
+	ASNDB string
+
+	// HostLabels is the file of the labels the remote IPs go by in place of their IPs and
+	// names, of lines like "10.2.0.0/16 = staging-k8s", none if empty
+	HostLabels string
+
+	// CategoryRules is the file of the rules the processes are categorized by in the
+	// categories mode, of lines like "browser name ^(chrome|firefox)$", none if empty
+	CategoryRules string
+
+	// TagsFile is the file the tags of the remote hosts and the connections are saved
+	// to, the g hotkey tagging them, none if empty
+	TagsFile string
+
+	// RecordFile is the session file the stats of each interval are recorded to, to
+	// replay them later on, none if empty
+	RecordFile string
+
+	// ReplayFile is the session file replayed in place of capturing, none if empty
+	ReplayFile string
+
+	// ReplaySpeed is how much faster than recorded ReplayFile is replayed
+	ReplaySpeed float64
+
+	// Seccomp restricts the sniffer on Linux to the syscalls it takes once started,
+	// the others failing with EPERM
+	Seccomp bool
+}
+
+// ParseInterval parses a refresh interval, a duration like 500ms or a bare number of
+// seconds as the interval used to be given.
+func ParseInterval(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval %q", value)
+	}
+	return d, nil
+}
+
+// minInterval is the shortest refresh interval, the refreshes of shorter ones taking
+// longer than the intervals.
+const minInterval = 100 * time.Millisecond
+
+// interval returns the refresh interval, RefreshInterval if set or else Interval
+// seconds.
+func (o Options) interval() time.Duration {
+	if o.RefreshInterval > 0 {
+		return o.RefreshInterval
+	}
+	return time.Duration(o.Interval) * time.Second
 }
 
 func (o Options) Validate() error {
@@ -32,5 +252,80 @@ func (o Options) Validate() error {
 	if err := o.Unit.Validate(); err != nil {
 		return err
 	}
+	if o.Bits && o.Unit != UnitAuto {
+		return errors.New("bits only go with the auto unit")
+	}
+	if err := o.SortKey.Validate(); err != nil {
+		return err
+	}
+	if o.interval() < minInterval {
+		return fmt.Errorf("invalid interval, %v at least", minInterval)
+	}
+	if o.ReplayFile != "" && o.ReplaySpeed <= 0 {
+		return errors.New("invalid replay speed")
+	}
+	if o.ReplayFile != "" && o.RecordFile != "" {
+		return errors.New("a replay is recorded already")
+	}
+	if o.Rows <= 0 {
+		return errors.New("invalid number of rows")
+	}
+	if o.ProcessRefreshMin < 0 || o.ProcessRefreshMax < o.ProcessRefreshMin {
+		return errors.New("invalid process refresh interval bounds")
+	}
+	if o.Pktap && runtime.GOOS != "darwin" {
+		return errors.New("pktap capture is only available on macOS")
+	}
+	if o.User != "" && runtime.GOOS != "linux" {
+		return errors.New("dropping the privileges is only available on Linux")
+	}
+	if o.Seccomp && runtime.GOOS != "linux" {
+		return errors.New("the seccomp sandbox is only available on Linux")
+	}
+	if o.HistorySize < 0 {
+		return errors.New("invalid history size")
+	}
+	if o.RateHistorySize < 0 {
+		return errors.New("invalid rate history size")
+	}
+	if o.MaxConnections < 0 {
+		return errors.New("invalid max connections")
+	}
+	if o.IdleTimeout < 0 {
+		return errors.New("invalid idle timeout")
+	}
+	if o.IdleTimeout > 0 && o.Window == 0 {
+		return errors.New("idle timeout without a window")
+	}
+	if o.Window < 0 {
+		return errors.New("invalid window")
+	}
+	if o.StateFile != "" && o.StateSaveInterval <= 0 {
+		return errors.New("invalid state save interval")
+	}
+	if o.StoreRetention < 0 {
+		return errors.New("invalid store retention")
+	}
+	if o.PercentileWindow < 0 {
+		return errors.New("invalid percentile window")
+	}
+	if o.SockDiagTimeout < 0 {
+		return errors.New("invalid sock_diag timeout")
+	}
+	if _, err := newProcFilter(o.Pids, o.ProcessNames); err != nil {
+		return err
+	}
+	if _, err := newProcessWatch(o.WatchPID, o.WatchProcessName); err != nil {
+		return err
+	}
+	if (o.WatchPID != 0 || o.WatchProcessName != "") && o.Mirror {
+		return errors.New("no process is watched on a mirror port")
+	}
+	if _, err := socketStateMask(o.SocketStates); err != nil {
+		return err
+	}
+	if _, err := parseSubnets(o.LocalSubnets); err != nil {
+		return err
+	}
 	return nil
 }
\ No newline at end of file
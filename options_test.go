@@ -0,0 +1,51 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInterval(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"2":     2 * time.Second,
+		"0.25":  250 * time.Millisecond,
+		"500ms": 500 * time.Millisecond,
+		"1m":    time.Minute,
+	} {
+		d, err := ParseInterval(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, want, d, value)
+	}
+	_, err := ParseInterval("fast")
+	assert.Error(t, err)
+}
+
+func TestRefreshInterval(t *testing.T) {
+	// the deprecated int seconds still count, the refresh interval winning when set
+	assert.Equal(t, 2*time.Second, Options{Interval: 2}.interval())
+	assert.Equal(t, 250*time.Millisecond, Options{RefreshInterval: 250 * time.Millisecond}.interval())
+	assert.Equal(t, 250*time.Millisecond, Options{Interval: 2, RefreshInterval: 250 * time.Millisecond}.interval())
+
+	opt := Options{RefreshInterval: 10 * time.Millisecond, Rows: 1, Unit: UnitKB, SortKey: SortTotal}
+	assert.Error(t, opt.Validate())
+	opt.RefreshInterval = 250 * time.Millisecond
+	assert.NoError(t, opt.Validate())
+	assert.Error(t, Options{Rows: 1, Unit: UnitKB, SortKey: SortTotal}.Validate())
+}
+
+func TestUnitAuto(t *testing.T) {
+	assert.Equal(t, "512.0B", UnitAuto.format(512, false))
+	assert.Equal(t, "1.5KB", UnitAuto.format(1536, false))
+	assert.Equal(t, "2.0GB", UnitAuto.format(2<<30, false))
+	assert.Equal(t, "1.0Kb", UnitAuto.format(128, true))
+	assert.Equal(t, "8.0Mb", UnitAuto.format(1<<20, true))
+	assert.Equal(t, "0.0b", UnitAuto.format(0, true))
+	assert.Equal(t, "1536.0B", UnitB.format(1536, false))
+
+	opt := Options{Interval: 1, Rows: 1, Unit: UnitKB, SortKey: SortTotal, Bits: true}
+	assert.Error(t, opt.Validate())
+	opt.Unit = UnitAuto
+	assert.NoError(t, opt.Validate())
+}
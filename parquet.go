@@ -0,0 +1,424 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The interval aggregates are written to Parquet files readable by DuckDB, pandas and
+// the like, with as little of the format as they need: the columns are required,
+// PLAIN encoded and uncompressed, in a data page each per row group.
+
+const (
+	parquetMagic = "PAR1"
+
+	// parquetFileLayout names the Parquet files, one an hour, sorting by time. A file
+	// of the hour left by a previous run is kept, the next one getting a suffix.
+	parquetFileLayout = "sniffer-20060102-15"
+	parquetFileExt    = ".parquet"
+
+	// parquetRowGroupRows is the rows buffered before they are written as a row group.
+	parquetRowGroupRows = 50000
+)
+
+// The physical types, the converted types and the enums of parquet.thrift.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetRequired     = 0
+	parquetDataPage     = 0
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+)
+
+// The types of the Thrift compact protocol.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes the structs of the Parquet metadata in the Thrift compact
+// protocol.
+type thriftWriter struct {
+	buf   bytes.Buffer
+	last  int16   // Latest field id of the current struct
+	stack []int16 // Latest field ids of the enclosing structs
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	for v >= 0x80 {
+		w.buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	w.buf.WriteByte(byte(v))
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if delta := id - w.last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	w.last = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.str(s)
+}
+
+func (w *thriftWriter) str(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *thriftWriter) list(id int16, elem byte, size int) {
+	w.field(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elem)
+		return
+	}
+	w.buf.WriteByte(0xf0 | elem)
+	w.varint(uint64(size))
+}
+
+// begin starts a struct, the field one or an element of a list.
+func (w *thriftWriter) begin() {
+	w.stack = append(w.stack, w.last)
+	w.last = 0
+}
+
+func (w *thriftWriter) beginField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+// end ends the struct begun last, or the outermost one if none.
+func (w *thriftWriter) end() {
+	w.buf.WriteByte(0)
+	if n := len(w.stack); n > 0 {
+		w.last = w.stack[n-1]
+		w.stack = w.stack[:n-1]
+	}
+}
+
+// parquetRow is a row of the Parquet files, the traffic of a process or a remote
+// address over an interval.
+type parquetRow struct {
+	time    time.Time
+	elapsed float64
+	kind    string
+	StoredRow
+}
+
+// parquetColumn is a column of the Parquet files along with its PLAIN encoding.
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // Converted type, -1 if none
+	encode    func(buf *bytes.Buffer, row *parquetRow)
+}
+
+func int64Column(name string, value func(row *parquetRow) int64) parquetColumn {
+	return parquetColumn{name: name, typ: parquetInt64, converted: -1, encode: func(buf *bytes.Buffer, row *parquetRow) {
+		binary.Write(buf, binary.LittleEndian, value(row))
+	}}
+}
+
+func stringColumn(name string, value func(row *parquetRow) string) parquetColumn {
+	return parquetColumn{name: name, typ: parquetByteArray, converted: parquetUTF8, encode: func(buf *bytes.Buffer, row *parquetRow) {
+		s := value(row)
+		binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}}
+}
+
+// parquetColumns are the columns of the Parquet files, the time being in milliseconds
+// since the epoch and the kind either process or remote_addr.
+var parquetColumns = []parquetColumn{
+	{name: "time", typ: parquetInt64, converted: parquetTimestampMillis, encode: func(buf *bytes.Buffer, row *parquetRow) {
+		binary.Write(buf, binary.LittleEndian, row.time.UnixNano()/int64(time.Millisecond))
+	}},
+	{name: "elapsed_seconds", typ: parquetDouble, converted: -1, encode: func(buf *bytes.Buffer, row *parquetRow) {
+		binary.Write(buf, binary.LittleEndian, math.Float64bits(row.elapsed))
+	}},
+	stringColumn("kind", func(row *parquetRow) string { return row.kind }),
+	stringColumn("name", func(row *parquetRow) string { return row.Name }),
+	int64Column("upload_bytes", func(row *parquetRow) int64 { return int64(row.UploadBytes) }),
+	int64Column("download_bytes", func(row *parquetRow) int64 { return int64(row.DownloadBytes) }),
+	int64Column("upload_packets", func(row *parquetRow) int64 { return int64(row.UploadPackets) }),
+	int64Column("download_packets", func(row *parquetRow) int64 { return int64(row.DownloadPackets) }),
+	int64Column("connections", func(row *parquetRow) int64 { return int64(row.Connections) }),
+}
+
+// parquetChunk is a column chunk written to a Parquet file.
+type parquetChunk struct {
+	offset int64 // Offset of the page header
+	size   int64 // Size of the page header and the page
+	values int64
+}
+
+// parquetRowGroup is a row group written to a Parquet file.
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// parquetFile writes the rows to a Parquet file, a row group each time enough rows
+// are buffered and the metadata once closed.
+type parquetFile struct {
+	f         *os.File
+	offset    int64
+	rows      []parquetRow
+	rowGroups []parquetRowGroup
+	createdBy string // Application told in the metadata
+}
+
+// createParquetFile creates the file of the name in the directory, or the first of
+// the name suffixed -1, -2 and so on that doesn't exist, never truncating a file.
+func createParquetFile(dir, name string) (*parquetFile, error) {
+	path := filepath.Join(dir, name+parquetFileExt)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	for i := 1; os.IsExist(err); i++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, i, parquetFileExt))
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(parquetMagic); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &parquetFile{f: f, offset: int64(len(parquetMagic)), createdBy: "sniffer " + version}, nil
+}
+
+func (p *parquetFile) write(b []byte) error {
+	n, err := p.f.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetFile) add(row parquetRow) error {
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= parquetRowGroupRows {
+		return p.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group, a data page a column.
+func (p *parquetFile) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	rowGroup := parquetRowGroup{rows: int64(len(p.rows))}
+	for _, col := range parquetColumns {
+		var page bytes.Buffer
+		for i := range p.rows {
+			col.encode(&page, &p.rows[i])
+		}
+
+		var header thriftWriter
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(page.Len()))
+		header.beginField(5)
+		header.i32(1, int32(len(p.rows)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.end()
+		header.end()
+
+		chunk := parquetChunk{offset: p.offset, size: int64(header.buf.Len() + page.Len()), values: int64(len(p.rows))}
+		if err := p.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := p.write(page.Bytes()); err != nil {
+			return err
+		}
+		rowGroup.chunks = append(rowGroup.chunks, chunk)
+	}
+	p.rowGroups = append(p.rowGroups, rowGroup)
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// metadata encodes the FileMetaData of the file.
+func (p *parquetFile) metadata() []byte {
+	var w thriftWriter
+	var rows int64
+	for _, rg := range p.rowGroups {
+		rows += rg.rows
+	}
+
+	w.i32(1, 1)
+	w.list(2, thriftStruct, len(parquetColumns)+1)
+	w.begin()
+	w.binary(4, "schema")
+	w.i32(5, int32(len(parquetColumns)))
+	w.end()
+	for _, col := range parquetColumns {
+		w.begin()
+		w.i32(1, col.typ)
+		w.i32(3, parquetRequired)
+		w.binary(4, col.name)
+		if col.converted >= 0 {
+			w.i32(6, col.converted)
+		}
+		w.end()
+	}
+	w.i64(3, rows)
+
+	w.list(4, thriftStruct, len(p.rowGroups))
+	for _, rg := range p.rowGroups {
+		w.begin()
+		var size int64
+		w.list(1, thriftStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			col := parquetColumns[i]
+			size += chunk.size
+			w.begin()
+			w.i64(2, chunk.offset)
+			w.beginField(3)
+			w.i32(1, col.typ)
+			w.list(2, thriftI32, 1)
+			w.zigzag(parquetPlain)
+			w.list(3, thriftBinary, 1)
+			w.str(col.name)
+			w.i32(4, parquetUncompressed)
+			w.i64(5, chunk.values)
+			w.i64(6, chunk.size)
+			w.i64(7, chunk.size)
+			w.i64(9, chunk.offset)
+			w.end()
+			w.end()
+		}
+		w.i64(2, size)
+		w.i64(3, rg.rows)
+		w.end()
+	}
+	w.binary(6, p.createdBy)
+	w.end()
+	return w.buf.Bytes()
+}
+
+// close writes the buffered rows and the metadata and closes the file.
+func (p *parquetFile) close() error {
+	err := p.flush()
+	if err == nil {
+		meta := p.metadata()
+		length := make([]byte, 4)
+		binary.LittleEndian.PutUint32(length, uint32(len(meta)))
+		for _, b := range [][]byte{meta, length, []byte(parquetMagic)} {
+			if err = p.write(b); err != nil {
+				break
+			}
+		}
+	}
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ParquetRecorder records the rows of each interval to the Parquet files of a
+// directory, a file an hour. A file is readable once closed, as the hour ends or the
+// sniffer stops.
+type ParquetRecorder struct {
+	dir string
+
+	mu   sync.Mutex
+	file *parquetFile
+	name string // Name of the open file
+}
+
+// NewParquetRecorder records to the directory, created if missing.
+func NewParquetRecorder(dir string) (*ParquetRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ParquetRecorder{dir: dir}, nil
+}
+
+// Record adds the rows of the interval to the file of its hour, closing the file of
+// the previous hour.
+func (r *ParquetRecorder) Record(interval StoredInterval) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := interval.Time.Format(parquetFileLayout)
+	if r.file == nil || name != r.name {
+		if r.file != nil {
+			err := r.file.close()
+			r.file = nil
+			if err != nil {
+				return err
+			}
+		}
+		f, err := createParquetFile(r.dir, name)
+		if err != nil {
+			return err
+		}
+		r.file, r.name = f, name
+	}
+
+	for _, rows := range []struct {
+		kind string
+		rows []StoredRow
+	}{
+		{"process", interval.Processes},
+		{"remote_addr", interval.RemoteAddrs},
+	} {
+		for _, row := range rows.rows {
+			if err := r.file.add(parquetRow{time: interval.Time, elapsed: interval.Elapsed, kind: rows.kind, StoredRow: row}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the open file, making it readable.
+func (r *ParquetRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.close()
+	r.file = nil
+	return err
+}
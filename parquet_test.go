@@ -0,0 +1,186 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of testdata")
+
+// thriftReader decodes the Thrift compact protocol into the field ids of each struct,
+// as much as the tests check.
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (t *thriftReader) varint() uint64 {
+	v, _ := binary.ReadUvarint(t.r)
+	return v
+}
+
+func (t *thriftReader) zigzag() int64 {
+	v := t.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return t.zigzag()
+	case thriftBinary:
+		b := make([]byte, t.varint())
+		t.r.Read(b)
+		return string(b)
+	case thriftList:
+		header, _ := t.r.ReadByte()
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(t.varint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = t.value(elem)
+		}
+		return list
+	case thriftStruct:
+		return t.structure()
+	}
+	panic("unexpected type")
+}
+
+func (t *thriftReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header, _ := t.r.ReadByte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(t.zigzag())
+		}
+		fields[id] = t.value(header & 0x0f)
+		last = id
+	}
+}
+
+func TestParquetRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	r, err := NewParquetRecorder(dir)
+	assert.NoError(t, err)
+	now := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	assert.NoError(t, r.Record(StoredInterval{
+		Time:        now,
+		Elapsed:     2,
+		Processes:   []StoredRow{{Name: "<1>:curl", UploadBytes: 4000, Connections: 1}},
+		RemoteAddrs: []StoredRow{{Name: "1.1.1.1", UploadBytes: 4000, Connections: 1}},
+	}))
+	assert.NoError(t, r.Record(StoredInterval{Time: now.Add(time.Second), Processes: []StoredRow{{Name: "<2>:wget"}}}))
+	assert.NoError(t, r.Close())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "sniffer-20220102-15.parquet"))
+	assert.NoError(t, err)
+	assert.Equal(t, parquetMagic, string(b[:4]))
+	assert.Equal(t, parquetMagic, string(b[len(b)-4:]))
+
+	length := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	meta := (&thriftReader{bytes.NewReader(b[len(b)-8-length : len(b)-8])}).structure()
+	assert.Equal(t, int64(3), meta[3])
+	schema := meta[2].([]interface{})
+	assert.Len(t, schema, len(parquetColumns)+1)
+	assert.Equal(t, "name", schema[4].(map[int16]interface{})[4])
+
+	rowGroups := meta[4].([]interface{})
+	assert.Len(t, rowGroups, 1)
+	chunks := rowGroups[0].(map[int16]interface{})[1].([]interface{})
+	assert.Len(t, chunks, len(parquetColumns))
+
+	// the name column holds the names of the rows in order
+	chunk := chunks[3].(map[int16]interface{})[3].(map[int16]interface{})
+	assert.Equal(t, int64(3), chunk[5])
+	reader := bytes.NewReader(b[chunk[9].(int64):])
+	header := (&thriftReader{reader}).structure()
+	assert.Equal(t, int64(parquetDataPage), header[1])
+	page := make([]byte, header[2].(int64))
+	reader.Read(page)
+	var names []string
+	for len(page) > 0 {
+		n := binary.LittleEndian.Uint32(page)
+		names = append(names, string(page[4:4+n]))
+		page = page[4+n:]
+	}
+	assert.Equal(t, []string{"<1>:curl", "1.1.1.1", "<2>:wget"}, names)
+
+	// the time column holds milliseconds since the epoch
+	chunk = chunks[0].(map[int16]interface{})[3].(map[int16]interface{})
+	reader = bytes.NewReader(b[chunk[9].(int64):])
+	(&thriftReader{reader}).structure()
+	var millis int64
+	assert.NoError(t, binary.Read(reader, binary.LittleEndian, &millis))
+	assert.Equal(t, now.Unix()*1000, millis)
+}
+
+func TestParquetRecorderReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i, name := range []string{"<1>:curl", "<2>:wget"} {
+		r, err := NewParquetRecorder(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Record(StoredInterval{Time: now.Add(time.Duration(i) * time.Minute), Processes: []StoredRow{{Name: name}}}))
+		assert.NoError(t, r.Close())
+	}
+
+	// the sniffer restarting within the hour keeps the file of the previous run
+	for _, file := range []string{"sniffer-20220102-15.parquet", "sniffer-20220102-15-1.parquet"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		length := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+		meta := (&thriftReader{bytes.NewReader(b[len(b)-8-length : len(b)-8])}).structure()
+		assert.Equal(t, int64(1), meta[3], file)
+	}
+}
+
+func TestParquetFileGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := createParquetFile(dir, "golden")
+	assert.NoError(t, err)
+	p.createdBy = "sniffer"
+	assert.NoError(t, p.add(parquetRow{
+		time:      time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC),
+		elapsed:   2,
+		kind:      "process",
+		StoredRow: StoredRow{Name: "<1>:curl", UploadBytes: 4000, DownloadBytes: 8000, UploadPackets: 3, DownloadPackets: 6, Connections: 1},
+	}))
+	assert.NoError(t, p.close())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "golden.parquet"))
+	assert.NoError(t, err)
+	golden := filepath.Join("testdata", "sniffer.parquet")
+	if *updateGolden {
+		assert.NoError(t, ioutil.WriteFile(golden, b, 0644))
+	}
+
+	// the pages, the schema and the footer are byte for byte the ones of the golden
+	// file, regenerated with -update
+	want, err := ioutil.ReadFile(golden)
+	assert.NoError(t, err)
+	assert.Equal(t, want, b)
+}
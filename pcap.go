@@ -1,10 +1,15 @@
 package sniffer
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 )
 
@@ -22,11 +27,29 @@ type LocalSocket struct {
 type Connection struct {
 	Local  LocalSocket
 	Remote RemoteSocket
+	VNI    uint32 // VXLAN network identifier of the encapsulated connection, 0 otherwise
+}
+
+// OverflowIP is the remote IP of the overflow connections, which the traffic of the
+// connections past Options.MaxConnections is folded into, one a protocol.
+const OverflowIP = "<other>"
+
+func overflowConnection(conn Connection) Connection {
+	return Connection{Local: LocalSocket{Protocol: conn.Local.Protocol}, Remote: RemoteSocket{IP: OverflowIP}}
+}
+
+// Overflow returns whether the connection is an overflow one, standing for the
+// connections past the limit.
+func (c Connection) Overflow() bool {
+	return c.Remote.IP == OverflowIP
 }
 
 type ProcessInfo struct {
 	Pid  int
 	Name string
+	User string // User owning the sockets of the process, empty if unknown
+
+	Container string // Short ID of the container running the process, empty on the host
 }
 
 func (p ProcessInfo) String() string {
@@ -34,12 +57,14 @@ func (p ProcessInfo) String() string {
 }
 
 type (
-	OpenSockets map[LocalSocket]ProcessInfo
+	OpenSockets map[LocalSocket]SocketInfo
 	Utilization map[Connection]*ConnectionInfo
 )
 
+// SocketFetcher lists the open sockets along with their processes, giving up once the
+// context is done.
 type SocketFetcher interface {
-	GetOpenSockets() (OpenSockets, error)
+	GetOpenSockets(ctx context.Context) (OpenSockets, error)
 }
 
 type Protocol string
@@ -47,8 +72,37 @@ type Protocol string
 const (
 	ProtoTCP Protocol = "tcp"
 	ProtoUDP Protocol = "udp"
+	ProtoGRE Protocol = "gre"
+
+	// ProtoICMP stands for the ICMP and ICMPv6 echoes, their identifier taking the
+	// place of the ports like for the ping sockets
+	ProtoICMP Protocol = "icmp"
+)
+
+// ApplicationProtocol is an application protocol recognized from the payload.
+type ApplicationProtocol string
+
+const (
+	AppProtoQUIC       ApplicationProtocol = "quic"
+	AppProtoHTTP2      ApplicationProtocol = "http2"
+	AppProtoGRPC       ApplicationProtocol = "grpc"
+	AppProtoHTTP       ApplicationProtocol = "http"
+	AppProtoTLS        ApplicationProtocol = "tls"
+	AppProtoSSH        ApplicationProtocol = "ssh"
+	AppProtoDNS        ApplicationProtocol = "dns"
+	AppProtoRDP        ApplicationProtocol = "rdp"
+	AppProtoSMTP       ApplicationProtocol = "smtp"
+	AppProtoBitTorrent ApplicationProtocol = "bittorrent"
+	AppProtoDHCP       ApplicationProtocol = "dhcp"
+	AppProtoNTP        ApplicationProtocol = "ntp"
+	AppProtoMDNS       ApplicationProtocol = "mdns"
+	AppProtoSSDP       ApplicationProtocol = "ssdp"
+	AppProtoLLMNR      ApplicationProtocol = "llmnr"
 )
 
+// vxlanPort is the IANA assigned UDP port of VXLAN.
+const vxlanPort = 4789
+
 type Direction uint8
 
 const (
@@ -56,54 +110,307 @@ const (
 	DirectionDownload
 )
 
+// AddressFamily is the IP version of the addresses of a connection.
+type AddressFamily uint8
+
+const (
+	FamilyIPv4 AddressFamily = 4
+	FamilyIPv6 AddressFamily = 6
+)
+
+func (f AddressFamily) String() string {
+	return fmt.Sprintf("IPv%d", f)
+}
+
+// CastType tells whether the destination of a packet is one host or a group of them.
+type CastType uint8
+
+const (
+	CastUnicast CastType = iota
+	CastMulticast
+	CastBroadcast
+)
+
+func (t CastType) String() string {
+	switch t {
+	case CastMulticast:
+		return "multicast"
+	case CastBroadcast:
+		return "broadcast"
+	}
+	return "unicast"
+}
+
+// castOf returns the cast type of the destination IP, broadcasts holds the broadcast
+// addresses of the subnets of the capturing devices.
+func castOf(ip string, broadcasts map[string]bool) CastType {
+	if ip == "255.255.255.255" || broadcasts[ip] {
+		return CastBroadcast
+	}
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.IsMulticast() {
+		return CastMulticast
+	}
+	return CastUnicast
+}
+
+// FlowInfo is what's been learned about a connection from its packets.
+type FlowInfo struct {
+	FirstSeen time.Time // Capture time of the first packet of the connection
+	LastSeen  time.Time // Capture time of the latest packet of the connection
+
+	ServerName string        // Server name, e.g. the TLS SNI
+	JA3        string        // JA3 fingerprint of the TLS client
+	JA4        string        // JA4 fingerprint of the TLS client
+	HTTPMethod string        // Method of the latest plaintext HTTP request
+	HTTPPath   string        // Path of the latest plaintext HTTP request
+	RTT        time.Duration // Smoothed round-trip time of the TCP connection, 0 if unknown
+	RemoteOS   string        // Operating system of the remote end guessed from its SYN
+
+	LocalWindow  int // Latest TCP receive window advertised by the local end
+	RemoteWindow int // Latest TCP receive window advertised by the remote end
+
+	// ApplicationProtocol is the application protocol recognized on the connection,
+	// empty if unknown.
+	ApplicationProtocol ApplicationProtocol
+}
+
+// Duration returns how long the connection has been observed.
+func (f FlowInfo) Duration() time.Duration {
+	return f.LastSeen.Sub(f.FirstSeen)
+}
+
 type ConnectionInfo struct {
-	Interface       string
-	UploadPackets   int
-	DownloadPackets int
-	UploadBytes     int
-	DownloadBytes   int
-	Process         *ProcessInfo // Process info if known
+	FlowInfo
+	Interface            string
+	UploadPackets        int
+	DownloadPackets      int
+	UploadBytes          int
+	DownloadBytes        int
+	UploadPayloadBytes   int           // Goodput of UploadBytes, without the transport headers
+	DownloadPayloadBytes int           // Goodput of DownloadBytes, without the transport headers
+	MPLSLabel            uint32        // Bottom MPLS label if the connection is label switched
+	Process              *ProcessInfo  // Process info if known
+	KernelTCP            *TCPInfo      // Latest quality of the TCP connection measured by the kernel, nil if unknown
+	Cast                 CastType      // Whether the traffic goes to a multicast group or a broadcast
+	Family               AddressFamily // IP version of the connection
+	Loopback             bool          // Whether the traffic is captured on a loopback device
+	Scope                Scope         // Whether the remote end is on the local network
+
+	RetransmittedPackets int      // TCP segments resending sequence numbers sent before
+	RetransmittedBytes   int      // Payload bytes of the retransmitted TCP segments
+	TCPState             TCPState // Latest state of the TCP connection
+	LocalZeroWindows     int      // Times the local end closed its TCP receive window
+	RemoteZeroWindows    int      // Times the remote end closed its TCP receive window
+	DupACKs              int      // Duplicate TCP ACKs
+	OutOfOrderPackets    int      // TCP segments arrived after later ones
+	CorruptPackets       int      // Packets failed the checksum verification, left out of the rest
+
+	Unattributed UnattributedReason // Why the latest segment is of no known process, empty if it is
+	Location     *Location          // Where the remote end is, nil if unknown
+	Labeled      bool               // Whether the remote IP is replaced by its label
 }
 
 type Segment struct {
+	FlowInfo
 	Interface  string
 	DataLen    int
+	PayloadLen int // Bytes of DataLen carried as transport payload
+	Packets    int // Number of packets the segment stands for, 1 if zero
 	Connection Connection
 	Direction  Direction
-	Process    *ProcessInfo // Process info if known, nil otherwise
+	Cast       CastType
+	Family     AddressFamily // IP version of the connection, the inner one if tunnelled
+	Loopback   bool          // Whether the packet is captured on a loopback device
+	Scope      Scope         // Whether the remote end is on the local network
+	TTL        uint8         // TTL or hop limit of the packet, the inner one if tunnelled
+	MPLSLabel  uint32        // Bottom MPLS label if present, 0 otherwise
+	Process    *ProcessInfo  // Process info if known, nil otherwise
+	KernelTCP  *TCPInfo      // Quality of the TCP connection measured by the kernel, nil if unknown
+	Timestamp  time.Time     // Capture time of the packet
+
+	Unattributed UnattributedReason // Why the segment is of no known process, empty if it is
+	Location     *Location          // Where the remote end is, nil if unknown
+	Labeled      bool               // Whether the remote IP is replaced by its label
+
+	Retransmission     bool // Whether the TCP segment resends sequence numbers sent before
+	RetransmittedBytes int  // Payload bytes of the TCP segment sent before
+
+	TCPState   TCPState            // State of the TCP connection after the segment
+	TCPEvent   ConnectionEventType // Lifecycle change the TCP segment made, empty if none
+	ZeroWindow bool                // Whether the TCP segment closed the window of its sender
+	DupACK     bool                // Whether the TCP segment duplicates the previous ACK
+	OutOfOrder bool                // Whether the TCP segment arrived after later ones
+
+	Corrupt bool // Whether the packet failed the checksum verification
+	Self    bool // Whether the sniffer itself sent or received the packet
 }
 
+// connEventsMax bounds the connection events kept between refreshes.
+const connEventsMax = 1024
+
 type Sinker struct {
 	mut         sync.Mutex
 	utilization Utilization
+	neighbors   Neighbors
+	discoveries Discoveries
+	dhcpEvents  []DHCPEvent
+
+	// live holds the TCP connections open across the refreshes along with the time
+	// they were last seen
+	live       map[Connection]time.Time
+	connEvents []ConnectionEvent
+
+	// maxConns is the number of connections tracked at most, the traffic of the rest
+	// being folded into the overflow connections, unlimited if 0
+	maxConns int
 }
 
 func NewSinker() *Sinker {
-	return &Sinker{utilization: make(Utilization)}
+	return &Sinker{
+		utilization: make(Utilization),
+		neighbors:   make(Neighbors),
+		discoveries: make(Discoveries),
+		live:        make(map[Connection]time.Time),
+	}
 }
 
 func (c *Sinker) Fetch(seg Segment) {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
+	if _, ok := c.utilization[seg.Connection]; !ok && c.maxConns > 0 && len(c.utilization) >= c.maxConns {
+		seg.Connection = overflowConnection(seg.Connection)
+		seg.Process = nil
+		seg.Unattributed = ""
+		seg.Location = nil
+		seg.Labeled = false
+	}
 	if _, ok := c.utilization[seg.Connection]; !ok {
 		c.utilization[seg.Connection] = &ConnectionInfo{
 			Interface: seg.Interface,
+			MPLSLabel: seg.MPLSLabel,
 			Process:   seg.Process,
+			Cast:      seg.Cast,
+			Loopback:  seg.Loopback,
+			Family:    seg.Family,
+			Scope:     seg.Scope,
+			Location:  seg.Location,
+			Labeled:   seg.Labeled,
 		}
 	}
+	// the sockets of the connections opened lately show up on the next refresh
+	if c.utilization[seg.Connection].Process == nil {
+		c.utilization[seg.Connection].Process = seg.Process
+	}
+	if p := c.utilization[seg.Connection].Process; p != nil && p.Pid != 0 {
+		c.utilization[seg.Connection].Unattributed = ""
+	} else {
+		c.utilization[seg.Connection].Unattributed = seg.Unattributed
+	}
+
+	if seg.Corrupt {
+		c.utilization[seg.Connection].CorruptPackets++
+		return
+	}
+
+	c.utilization[seg.Connection].FlowInfo = seg.FlowInfo
+	if seg.KernelTCP != nil {
+		c.utilization[seg.Connection].KernelTCP = seg.KernelTCP
+	}
+	if seg.Connection.Local.Protocol == ProtoTCP {
+		c.utilization[seg.Connection].TCPState = seg.TCPState
+		c.trackConnection(seg)
+	}
+
+	packets := seg.Packets
+	if packets == 0 {
+		packets = 1
+	}
+
+	if seg.Retransmission {
+		c.utilization[seg.Connection].RetransmittedPackets += packets
+		c.utilization[seg.Connection].RetransmittedBytes += seg.RetransmittedBytes
+	}
+	if seg.ZeroWindow && seg.Direction == DirectionUpload {
+		c.utilization[seg.Connection].LocalZeroWindows++
+	} else if seg.ZeroWindow {
+		c.utilization[seg.Connection].RemoteZeroWindows++
+	}
+	if seg.DupACK {
+		c.utilization[seg.Connection].DupACKs++
+	}
+	if seg.OutOfOrder {
+		c.utilization[seg.Connection].OutOfOrderPackets += packets
+	}
 
 	switch seg.Direction {
 	case DirectionUpload:
 		c.utilization[seg.Connection].UploadBytes += seg.DataLen
-		c.utilization[seg.Connection].UploadPackets += 1
+		c.utilization[seg.Connection].UploadPayloadBytes += seg.PayloadLen
+		c.utilization[seg.Connection].UploadPackets += packets
 
 	case DirectionDownload:
 		c.utilization[seg.Connection].DownloadBytes += seg.DataLen
-		c.utilization[seg.Connection].DownloadPackets += 1
+		c.utilization[seg.Connection].DownloadPayloadBytes += seg.PayloadLen
+		c.utilization[seg.Connection].DownloadPackets += packets
 	}
 }
 
+// trackConnection keeps the set of live TCP connections up to date.
+func (c *Sinker) trackConnection(seg Segment) {
+	_, live := c.live[seg.Connection]
+	switch {
+	case seg.TCPState == TCPStateClosed:
+		delete(c.live, seg.Connection)
+	case live || c.maxConns <= 0 || len(c.live) < c.maxConns:
+		c.live[seg.Connection] = time.Now()
+	}
+
+	if seg.TCPEvent != "" && len(c.connEvents) < connEventsMax {
+		c.connEvents = append(c.connEvents, ConnectionEvent{
+			Time:       seg.Timestamp,
+			Interface:  seg.Interface,
+			Connection: seg.Connection,
+			Type:       seg.TCPEvent,
+		})
+	}
+}
+
+// FetchPolled records a TCP connection polled from the sockets in place of the
+// capture, which tells none of its traffic.
+func (c *Sinker) FetchPolled(conn Connection, info *ConnectionInfo) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	c.utilization[conn] = info
+	c.live[conn] = time.Now()
+}
+
+// GetConnectionEvents returns the TCP connections opened and closed since the last call.
+func (c *Sinker) GetConnectionEvents() []ConnectionEvent {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	events := c.connEvents
+	c.connEvents = nil
+	return events
+}
+
+// ActiveConnections returns the number of TCP connections currently open, the ones
+// idle longer than the flow timeout are taken for dead.
+func (c *Sinker) ActiveConnections() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	now := time.Now()
+	for conn, lastSeen := range c.live {
+		if now.Sub(lastSeen) > flowTimeout {
+			delete(c.live, conn)
+		}
+	}
+	return len(c.live)
+}
+
 func (c *Sinker) GetUtilization() Utilization {
 	c.mut.Lock()
 	defer c.mut.Unlock()
@@ -113,10 +420,138 @@ func (c *Sinker) GetUtilization() Utilization {
 	return utilization
 }
 
+func (c *Sinker) FetchNeighbor(pkt NeighborPacket) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if _, ok := c.neighbors[pkt.Neighbor]; !ok {
+		c.neighbors[pkt.Neighbor] = &NeighborInfo{Interface: pkt.Interface}
+	}
+
+	if pkt.Reply {
+		c.neighbors[pkt.Neighbor].Replies++
+	} else {
+		c.neighbors[pkt.Neighbor].Requests++
+	}
+}
+
+func (c *Sinker) GetNeighbors() Neighbors {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	neighbors := c.neighbors
+	c.neighbors = make(Neighbors)
+	return neighbors
+}
+
+func (c *Sinker) FetchDiscovery(pkt DiscoveryPacket) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if _, ok := c.discoveries[pkt.IP]; !ok {
+		c.discoveries[pkt.IP] = &DiscoveryInfo{Interface: pkt.Interface}
+	}
+	c.discoveries[pkt.IP].add(pkt)
+}
+
+// GetDiscoveries returns a copy of the devices inventory, which unlike the traffic
+// stats is kept across refreshes.
+func (c *Sinker) GetDiscoveries() Discoveries {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	// the slices are only ever appended to, so sharing them with the copy is safe
+	discoveries := make(Discoveries, len(c.discoveries))
+	for k, v := range c.discoveries {
+		cloned := *v
+		discoveries[k] = &cloned
+	}
+	return discoveries
+}
+
+func (c *Sinker) FetchDHCPEvent(ev DHCPEvent) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if len(c.dhcpEvents) == dhcpMaxEvents {
+		c.dhcpEvents = c.dhcpEvents[1:]
+	}
+	c.dhcpEvents = append(c.dhcpEvents, ev)
+}
+
+// GetDHCPEvents returns a copy of the latest DHCP events, oldest first.
+func (c *Sinker) GetDHCPEvents() []DHCPEvent {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	events := make([]DHCPEvent, len(c.dhcpEvents))
+	copy(events, c.dhcpEvents)
+	return events
+}
+
+// deviceMTU returns the MTU of the device, 0 if unknown.
+func deviceMTU(device string) int {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return 0
+	}
+	return iface.MTU
+}
+
 func ListAllDevices() ([]pcap.Interface, error) {
 	return pcap.FindAllDevs()
 }
 
+// deviceMAC returns the hardware address of the device, nil if unknown.
+func deviceMAC(device string) net.HardwareAddr {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return nil
+	}
+	return iface.HardwareAddr
+}
+
+// ethernetDirection tells the direction of the frame from the MAC of the capturing
+// device, false if neither end has it, or both do as on the loopback devices.
+func ethernetDirection(ether *layers.Ethernet, mac net.HardwareAddr) (Direction, bool) {
+	if len(mac) == 0 || bytes.Equal(ether.SrcMAC, ether.DstMAC) {
+		return 0, false
+	}
+	switch {
+	case bytes.Equal(ether.SrcMAC, mac):
+		return DirectionUpload, true
+	case bytes.Equal(ether.DstMAC, mac):
+		return DirectionDownload, true
+	}
+	return 0, false
+}
+
+// DefaultBPFFilter is the BPF filter of the traffic counted by default. The MPLS
+// frames are matched along on the Ethernet devices only, as libpcap compiles no
+// MPLS match for the others, e.g. the tun and loopback ones.
+const DefaultBPFFilter = "tcp or udp or arp or icmp or icmp6 or ip proto 47 or ip6 proto 47"
+
+// linkBPFFilter returns the filter to set on a device of the link type, the default
+// filter matching the MPLS frames too on the Ethernet devices.
+func linkBPFFilter(filter string, linkType layers.LinkType) string {
+	if filter == DefaultBPFFilter && linkType == layers.LinkTypeEthernet {
+		return filter + " or mpls"
+	}
+	return filter
+}
+
+// deviceLoopback returns whether the device is a loopback one.
+func deviceLoopback(device string) bool {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return false
+	}
+	return iface.Flags&net.FlagLoopback != 0
+}
+
+// listPrefixDevices lists the devices of the prefixes, or all of them. The loopback
+// devices are listed whether their traffic is counted or not, the stats leaving it
+// out, so that it's counted as soon as the l hotkey toggles it.
 func listPrefixDevices(prefix []string, allowAll bool) ([]pcap.Interface, error) {
 	all, err := ListAllDevices()
 	if err != nil {
@@ -5,7 +5,15 @@ package sniffer
 
 import (
 	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -14,43 +22,109 @@ import (
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
 )
 
 type pcapHandler struct {
-	device string
-	handle *afpacket.TPacket
+	device    string
+	mtu       int
+	mac       net.HardwareAddr
+	loopback  bool
+	linkType  layers.LinkType
+	handle    *afpacket.TPacket
+	fragments *fragmentTable
+	flows     *flowTable
+	promisc   *os.File // socket holding the device promiscuous, nil if none
+
+	partialChecksums bool // Whether the checksums of the packets received may be unfinished
 }
 
 type PcapClient struct {
 	ctx               context.Context
 	cancel            context.CancelFunc
 	bindIPs           map[string]bool
+	broadcastIPs      map[string]bool
 	handlers          []*pcapHandler
 	bpfFilter         string
 	Sinker            *Sinker
 	devicesPrefix     []string
 	disableDNSResolve bool
 	allDevices        bool
+	tunnelOuter       bool
+	wirePackets       bool
+	verifyChecksums   bool
+	localSubnets      subnets
+	geoip             *GeoIP      // nil unless the remote IPs are located
+	labels            HostLabels  // Labels the remote IPs go by, none if empty
+	dedup             *dedupTable // nil unless the duplicates are dropped
+	mirror            bool
+	excludeSelf       bool
+	maxConns          int  // Connections tracked at most, the rest folded into the overflow ones
+	degraded          bool // Whether the connections are polled for lack of the capture
 	wg                sync.WaitGroup
 	lookup            Lookup
-	processMonitor    *ProcessMonitor
+	observe           Observe
+	resolver          ProcessResolver
 }
 
-func NewPcapClient(lookup Lookup, opt Options, processMonitor *ProcessMonitor) (*PcapClient, error) {
+func NewPcapClient(lookup Lookup, observe Observe, opt Options, resolver ProcessResolver) (*PcapClient, error) {
+	localSubnets, err := parseSubnets(opt.LocalSubnets)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels HostLabels
+	if opt.HostLabels != "" {
+		if labels, err = LoadHostLabels(opt.HostLabels); err != nil {
+			return nil, err
+		}
+	}
+
+	var geoip *GeoIP
+	if opt.GeoIPDB != "" || opt.ASNDB != "" {
+		if geoip, err = OpenGeoIP(opt.GeoIPDB, opt.ASNDB); err != nil {
+			return nil, err
+		}
+	}
+
 	client := &PcapClient{
 		bindIPs:           make(map[string]bool),
+		broadcastIPs:      make(map[string]bool),
 		Sinker:            NewSinker(),
 		lookup:            lookup,
+		observe:           observe,
 		bpfFilter:         opt.BPFFilter,
 		devicesPrefix:     opt.DevicesPrefix,
 		disableDNSResolve: opt.DisableDNSResolve,
 		allDevices:        opt.AllDevices,
-		processMonitor:    processMonitor,
+		tunnelOuter:       opt.TunnelOuter,
+		wirePackets:       opt.WirePackets,
+		verifyChecksums:   opt.VerifyChecksums,
+		maxConns:          opt.MaxConnections,
+		localSubnets:      localSubnets,
+		geoip:             geoip,
+		labels:            labels,
+		mirror:            opt.Mirror,
+		excludeSelf:       opt.ExcludeSelf,
+		resolver:          resolver,
 	}
+	if opt.Dedup {
+		client.dedup = newDedupTable()
+	}
+	client.Sinker.maxConns = opt.MaxConnections
 
 	client.ctx, client.cancel = context.WithCancel(context.Background())
 	if err := client.getAvailableDevices(); err != nil {
-		return nil, err
+		client.closeHandlers()
+		if !permissionDenied(err) {
+			return nil, err
+		}
+		// without CAP_NET_RAW the connections are polled from the sockets instead,
+		// unless the traffic of other hosts is asked for
+		if _, ok := resolver.(connectionLister); !ok || opt.Mirror || !sockDiagAvailable() {
+			return nil, capabilityError(errors.Cause(err))
+		}
+		client.degraded = true
 	}
 
 	for _, handler := range client.handlers {
@@ -67,35 +141,111 @@ func (c *PcapClient) getAvailableDevices() error {
 	}
 
 	for _, device := range devs {
-		handler, err := c.getHandler(device.Name)
+		linkType := deviceLinkType(device.Name)
+		handler, err := c.getHandler(device.Name, linkType)
 		if err != nil {
 			return errors.Wrapf(err, "get device(%s) name failed", device.Name)
 		}
 
 		if c.bpfFilter != "" {
-			if err = c.setBPFFilter(handler, c.bpfFilter); err != nil {
-				return errors.Wrapf(err, "set bpf-filter(%s) failed", c.bpfFilter)
+			filter := linkBPFFilter(c.bpfFilter, linkType)
+			if err = c.setBPFFilter(handler, linkType, filter); err != nil {
+				return errors.Wrapf(err, "set bpf-filter(%s) failed", filter)
 			}
 		}
 
-		c.handlers = append(c.handlers, &pcapHandler{device: device.Name, handle: handler})
+		// mirror ports deliver the frames addressed to other hosts
+		var promisc *os.File
+		if c.mirror {
+			if promisc, err = setPromiscuous(device.Name); err != nil {
+				return errors.Wrapf(err, "set device(%s) promiscuous failed", device.Name)
+			}
+		}
+
+		loopback := deviceLoopback(device.Name)
+		c.handlers = append(c.handlers, &pcapHandler{
+			device:    device.Name,
+			mtu:       deviceMTU(device.Name),
+			mac:       deviceMAC(device.Name),
+			loopback:  loopback,
+			linkType:  linkType,
+			handle:    handler,
+			fragments: newFragmentTable(),
+			flows:     newFlowTable(c.maxConns),
+			promisc:   promisc,
+
+			partialChecksums: loopback || virtualDevice(sysClassNet, device.Name),
+		})
 		for _, addr := range device.Addresses {
 			c.bindIPs[addr.IP.String()] = true
+			if addr.Broadaddr != nil {
+				c.broadcastIPs[addr.Broadaddr.String()] = true
+			}
 		}
 	}
 
 	if len(c.handlers) == 0 {
-		return errors.New("no available devices found")
+		return ErrNoDevices
 	}
 	return nil
 }
 
-func (c *PcapClient) getHandler(device string) (*afpacket.TPacket, error) {
+// permissionDenied returns whether the error is for lack of the privileges to capture.
+func permissionDenied(err error) bool {
+	cause := errors.Cause(err)
+	return cause == unix.EPERM || cause == unix.EACCES
+}
+
+// deviceLinkType returns the link type of the frames read from the device. Devices
+// without an ethernet header (tun, wireguard, ppp, ...) are captured in cooked mode
+// which delivers bare IP packets.
+func deviceLinkType(device string) layers.LinkType {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/type", device))
+	if err != nil {
+		return layers.LinkTypeEthernet
+	}
+
+	arphrd, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return layers.LinkTypeEthernet
+	}
+
+	switch arphrd {
+	case unix.ARPHRD_ETHER, unix.ARPHRD_LOOPBACK:
+		return layers.LinkTypeEthernet
+	}
+	return layers.LinkTypeRaw
+}
+
+func (c *PcapClient) getHandler(device string, linkType layers.LinkType) (*afpacket.TPacket, error) {
+	if linkType == layers.LinkTypeRaw {
+		return afpacket.NewTPacket(afpacket.OptInterface(device), afpacket.SocketDgram)
+	}
 	return afpacket.NewTPacket(afpacket.OptInterface(device))
 }
 
-func (c *PcapClient) setBPFFilter(h *afpacket.TPacket, filter string) error {
-	pcapBPF, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, 65535, filter)
+// setPromiscuous puts the device in promiscuous mode for as long as the returned
+// socket is open, the kernel counts it along with the other users of the mode.
+func setPromiscuous(device string) (*os.File, error) {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		return nil, err
+	}
+	mreq := &unix.PacketMreq{Ifindex: int32(iface.Index), Type: unix.PACKET_MR_PROMISC}
+	if err = unix.SetsockoptPacketMreq(fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, mreq); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), device), nil
+}
+
+func (c *PcapClient) setBPFFilter(h *afpacket.TPacket, linkType layers.LinkType, filter string) error {
+	pcapBPF, err := pcap.CompileBPFFilter(linkType, 65535, filter)
 	if err != nil {
 		return err
 	}
@@ -111,40 +261,97 @@ func (c *PcapClient) setBPFFilter(h *afpacket.TPacket, filter string) error {
 	return h.SetBPF(bpfIns)
 }
 
-func (c *PcapClient) parsePacket(ph *pcapHandler, decoded []gopacket.Layer) *Segment {
+func (c *PcapClient) parsePacket(ph *pcapHandler, decoded []gopacket.Layer, ts time.Time) *Segment {
 	var srcPort, dstPort uint16
 	var srcIP, dstIP string
 	var protocol Protocol
 	var dataLen int
+	var vni, label uint32
+	var ipHeaderLen, headerLen, payloadLen int
+	var payload []byte
+	var tcp *layers.TCP
+	var family AddressFamily
+	var ttl uint8
 	direction := DirectionDownload
+	var macDirection Direction
+	var macKnown bool
 
 	for _, layerType := range decoded {
 		switch lyr := layerType.(type) {
+		// the MAC of the device tells the direction ahead of the bound IPs, which miss
+		// the NATed, forwarded and newly added addresses
+		case *layers.Ethernet:
+			if srcIP == "" {
+				macDirection, macKnown = ethernetDirection(lyr, ph.mac)
+			}
+
+		case *layers.MPLS:
+			label = lyr.Label
+
+		// the outermost IP layer decides the direction of tunnelled packets
 		case *layers.IPv4:
-			srcIP = lyr.SrcIP.String()
-			dstIP = lyr.DstIP.String()
-			if c.bindIPs[srcIP] {
+			if srcIP == "" && c.bindIPs[lyr.SrcIP.String()] {
 				direction = DirectionUpload
 			}
-
-		case *layers.IPv6:
 			srcIP = lyr.SrcIP.String()
 			dstIP = lyr.DstIP.String()
-			if c.bindIPs[srcIP] {
+			ipHeaderLen = len(lyr.Contents)
+			family = FamilyIPv4
+			ttl = lyr.TTL
+
+		case *layers.IPv6:
+			if srcIP == "" && c.bindIPs[lyr.SrcIP.String()] {
 				direction = DirectionUpload
 			}
+			srcIP = lyr.SrcIP.String()
+			dstIP = lyr.DstIP.String()
+			ipHeaderLen = len(lyr.Contents)
+			family = FamilyIPv6
+			ttl = lyr.HopLimit
+
+		case *layers.GRE:
+			protocol = ProtoGRE
+			dataLen = len(lyr.Contents) + len(lyr.Payload)
+			headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+
+		case *layers.VXLAN:
+			vni = lyr.VNI
 
 		case *layers.TCP:
 			protocol = ProtoTCP
 			srcPort = uint16(lyr.SrcPort)
 			dstPort = uint16(lyr.DstPort)
 			dataLen = len(lyr.Contents) + len(lyr.Payload)
+			headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			payload = lyr.Payload
+			tcp = lyr
 
 		case *layers.UDP:
 			protocol = ProtoUDP
 			srcPort = uint16(lyr.SrcPort)
 			dstPort = uint16(lyr.DstPort)
 			dataLen = len(lyr.Contents) + len(lyr.Payload)
+			headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			payload = lyr.Payload
+
+		// the identifier of the echo stands for the port of the ping sockets
+		case *layers.ICMPv4:
+			if t := lyr.TypeCode.Type(); t == layers.ICMPv4TypeEchoRequest || t == layers.ICMPv4TypeEchoReply {
+				protocol = ProtoICMP
+				srcPort, dstPort = lyr.Id, lyr.Id
+				dataLen = len(lyr.Contents) + len(lyr.Payload)
+				headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			}
+
+		// the identifier and the sequence number of the echo lead the payload
+		case *layers.ICMPv6:
+			if icmpv6Echo(lyr) {
+				srcPort = binary.BigEndian.Uint16(lyr.Payload)
+				dstPort = srcPort
+				protocol = ProtoICMP
+				dataLen = len(lyr.Contents) + len(lyr.Payload)
+				headerLen, payloadLen = len(lyr.Contents)+4, len(lyr.Payload)-4
+			}
 		}
 	}
 
@@ -152,43 +359,73 @@ func (c *PcapClient) parsePacket(ph *pcapHandler, decoded []gopacket.Layer) *Seg
 		return nil
 	}
 
+	// the traffic between other hosts is only seen on a mirror port, where neither
+	// end has the MAC or the IPs of the device
+	switch {
+	case macKnown:
+		direction = macDirection
+	case c.mirror && !c.bindIPs[srcIP] && !c.bindIPs[dstIP]:
+		direction = mirrorDirection(c.localSubnets, srcIP, dstIP, srcPort, dstPort)
+	}
+
 	seg := &Segment{
-		Interface: ph.device,
-		DataLen:   dataLen,
-		Direction: direction,
+		Interface:  ph.device,
+		DataLen:    dataLen,
+		PayloadLen: payloadLen,
+		Direction:  direction,
+		Cast:       castOf(dstIP, c.broadcastIPs),
+		Loopback:   ph.loopback,
+		Family:     family,
+		TTL:        ttl,
+		MPLSLabel:  label,
+		Timestamp:  ts,
+	}
+	if c.wirePackets {
+		seg.Packets, seg.DataLen = wirePackets(ph.mtu, ipHeaderLen, headerLen, payloadLen)
 	}
 
-	var remoteIP string
 	switch seg.Direction {
 	case DirectionUpload:
-		remoteIP = dstIP
-		if protocol == ProtoTCP && !c.disableDNSResolve {
-			remoteIP = c.lookup(dstIP)
-		}
+		seg.Scope = c.localSubnets.scopeOf(dstIP)
 		seg.Connection = Connection{
 			Local:  LocalSocket{IP: srcIP, Port: srcPort, Protocol: protocol},
-			Remote: RemoteSocket{IP: remoteIP, Port: dstPort},
-		}
-		// Lookup process info immediately
-		if c.processMonitor != nil {
-			seg.Process = c.processMonitor.GetProcess(seg.Connection.Local)
+			Remote: RemoteSocket{IP: dstIP, Port: dstPort},
+			VNI:    vni,
 		}
 
 	case DirectionDownload:
-		remoteIP = srcIP
-		if protocol == ProtoTCP && !c.disableDNSResolve {
-			remoteIP = c.lookup(srcIP)
-		}
+		seg.Scope = c.localSubnets.scopeOf(srcIP)
 		seg.Connection = Connection{
 			Local:  LocalSocket{IP: dstIP, Port: dstPort, Protocol: protocol},
-			Remote: RemoteSocket{IP: remoteIP, Port: srcPort},
-		}
-		// Lookup process info immediately
-		if c.processMonitor != nil {
-			seg.Process = c.processMonitor.GetProcess(seg.Connection.Local)
+			Remote: RemoteSocket{IP: srcIP, Port: srcPort},
+			VNI:    vni,
 		}
 	}
 
+	c.locate(seg)
+	c.resolveProcess(seg, srcIP, dstIP, srcPort, dstPort)
+	c.markSelf(seg)
+
+	c.nameRemote(seg)
+
+	if c.corrupt(ph, seg, decoded) {
+		seg.Corrupt = true
+		return seg
+	}
+
+	ph.flows.inspect(seg, tcp, payload)
+	if !c.disableDNSResolve {
+		name, ips := parseDNSResponse(seg, payload)
+		for _, ip := range ips {
+			c.observe(ip, name, dnsClient(seg))
+		}
+	}
+	if pkt, ok := discoveryPacket(seg, payload); ok {
+		c.Sinker.FetchDiscovery(pkt)
+	}
+	if ev, ok := dhcpEvent(seg, payload); ok {
+		c.Sinker.FetchDHCPEvent(ev)
+	}
 	return seg
 }
 
@@ -196,10 +433,12 @@ func (c *PcapClient) listen(ph *pcapHandler) {
 	c.wg.Add(1)
 	defer c.wg.Done()
 
-	decoded := make([]gopacket.Layer, 0, 2)
+	decoded := make([]gopacket.Layer, 0, 5)
 	var payload []byte
-	var ipv4 layers.IPv4
-	var ipv6 layers.IPv6
+	outer, inner := newPacketLayers(), newPacketLayers()
+	var mpls layers.MPLS
+	var gre layers.GRE
+	var vxlan layers.VXLAN
 
 	for {
 		select {
@@ -207,68 +446,235 @@ func (c *PcapClient) listen(ph *pcapHandler) {
 			return
 
 			// decode packets followed by layers
-			// 1) Ethernet Layer
+			// 1) Ethernet Layer (skipped in cooked mode) followed by the MPLS label stack (optional)
 			// 2) IP Layer
-			// 3) TCP/UDP Layer
+			// 3) GRE Layer followed by the inner IP Layer (optional)
+			// 4) TCP/UDP Layer
+			// 5) VXLAN Layer followed by the inner IP and TCP/UDP Layers (optional)
 		default:
 			decoded = decoded[:0]
 			payload = payload[:0]
-			pkt, _, err := ph.handle.ZeroCopyReadPacketData()
+			pkt, ci, err := ph.handle.ZeroCopyReadPacketData()
 			if err != nil {
 				continue
 			}
 
-			var ether layers.Ethernet
-			if err = ether.DecodeFromBytes(pkt, gopacket.NilDecodeFeedback); err != nil {
+			etype := layers.EthernetTypeTransparentEthernetBridging
+			if ph.linkType != layers.LinkTypeEthernet {
+				etype = ipEthernetType(pkt)
+			}
+			outer.ether.SrcMAC = nil
+			if !outer.decode(etype, pkt) {
 				continue
 			}
+			if ph.linkType == layers.LinkTypeEthernet {
+				decoded = append(decoded, &outer.ether)
+			}
 
-			switch ether.EthernetType {
-			case layers.EthernetTypeIPv4, layers.EthernetTypeIPv6:
-			default:
+			switch outer.last() {
+			case layers.LayerTypeARP:
+				if np, ok := arpNeighborPacket(ph.device, &outer.arp); ok {
+					c.Sinker.FetchNeighbor(np)
+				}
 				continue
-			}
 
-			if err = ipv4.DecodeFromBytes(ether.Payload, gopacket.NilDecodeFeedback); err == nil {
-				payload = ipv4.Payload
-				decoded = append(decoded, &ipv4)
-			}
-			if len(payload) == 0 {
-				if err = ipv6.DecodeFromBytes(ether.Payload, gopacket.NilDecodeFeedback); err == nil {
-					payload = ipv6.Payload
-					decoded = append(decoded, &ipv6)
+			case layers.LayerTypeEthernet:
+				switch outer.ether.EthernetType {
+				case layers.EthernetTypeMPLSUnicast, layers.EthernetTypeMPLSMulticast:
+				default:
+					continue
 				}
+
+				etype, data := decodeMPLS(outer.ether.Payload, &mpls)
+				if data == nil || !outer.decode(etype, data) {
+					continue
+				}
+				decoded = append(decoded, &mpls)
 			}
 
-			if len(decoded) == 0 || len(payload) == 0 {
+			if outer.network == nil {
 				continue
 			}
-
-			var tcpPkg layers.TCP
-			if err = tcpPkg.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err == nil {
-				decoded = append(decoded, &tcpPkg)
-				if seg := c.parsePacket(ph, decoded); seg != nil {
-					c.Sinker.Fetch(*seg)
-				}
+			if c.dedup != nil && c.dedup.Duplicate(outer.network, ph.device, ci.Timestamp) {
 				continue
 			}
+			decoded = append(decoded, outer.network)
+
+			// the parser stops ahead of fragments and the protocols decoded below
+			var frag ipFragment
+			transport := outer.transport
+			if transport == nil {
+				var proto layers.IPProtocol
+				if frag, proto, payload = parseFragment(outer.network); len(payload) == 0 {
+					continue
+				}
+
+				// non-first fragments carry no transport header
+				if frag.offset > 0 {
+					if seg := ph.fragments.Follow(frag, len(payload)); seg != nil {
+						c.Sinker.Fetch(*seg)
+					}
+					continue
+				}
 
-			var udpPkg layers.UDP
-			if err = udpPkg.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err == nil {
-				decoded = append(decoded, &udpPkg)
-				if seg := c.parsePacket(ph, decoded); seg != nil {
-					c.Sinker.Fetch(*seg)
+				switch proto {
+				case layers.IPProtocolICMPv6:
+					if np, ok := ndpNeighborPacket(ph.device, outer.ether.SrcMAC, outer.ipv6.SrcIP, payload[0]); ok {
+						c.Sinker.FetchNeighbor(np)
+						continue
+					}
+					transport = outer.decodeEcho(proto, payload)
+
+				case layers.IPProtocolICMPv4:
+					transport = outer.decodeEcho(proto, payload)
+
+				case layers.IPProtocolGRE:
+					if err = gre.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+						continue
+					}
+					decoded = append(decoded, &gre)
+					if c.tunnelOuter {
+						c.fetch(ph, decoded, frag, ci.Timestamp)
+						continue
+					}
+
+					if !inner.decode(gre.Protocol, gre.Payload) || inner.network == nil {
+						continue
+					}
+					decoded = append(decoded, inner.network)
+					transport = inner.transport
+
+				default:
+					transport = decodeTransport(proto, payload, &outer.tcp, &outer.udp)
+				}
+				if transport == nil {
+					continue
 				}
 			}
+			decoded = append(decoded, transport)
+
+			if transport == &outer.udp && outer.udp.DstPort == vxlanPort && !c.tunnelOuter {
+				if err = vxlan.DecodeFromBytes(outer.udp.Payload, gopacket.NilDecodeFeedback); err == nil {
+					if inner.decode(layers.EthernetTypeTransparentEthernetBridging, vxlan.Payload) &&
+						inner.network != nil && inner.transport != nil {
+						decoded = append(decoded, &vxlan, inner.network, inner.transport)
+					}
+				}
+			}
+			c.fetch(ph, decoded, frag, ci.Timestamp)
+		}
+	}
+}
+
+// fetch sinks the segment parsed from the decoded layers, the first fragment of a
+// fragmented datagram is remembered to attribute the following fragments.
+func (c *PcapClient) fetch(ph *pcapHandler, decoded []gopacket.Layer, frag ipFragment, ts time.Time) {
+	seg := c.parsePacket(ph, decoded, ts)
+	if seg == nil || seg.Self && c.excludeSelf {
+		return
+	}
+
+	if frag.more {
+		ph.fragments.First(frag, seg)
+	}
+	c.Sinker.Fetch(*seg)
+}
+
+// decodeMPLS strips the MPLS label stack, keeping the bottom label in the given layer,
+// and returns the ethernet type guessed from the IP version of the payload.
+func decodeMPLS(data []byte, mpls *layers.MPLS) (layers.EthernetType, []byte) {
+	for {
+		if len(data) < 4 {
+			return 0, nil
+		}
+		mpls.Label = binary.BigEndian.Uint32(data[:4]) >> 12
+		mpls.TrafficClass = data[2] >> 1 & 0x07
+		mpls.StackBottom = data[2]&0x01 != 0
+		mpls.TTL = data[3]
+		mpls.Contents, mpls.Payload = data[:4], data[4:]
+
+		data = mpls.Payload
+		if mpls.StackBottom {
+			break
+		}
+	}
+
+	etype := ipEthernetType(data)
+	if etype == 0 {
+		return 0, nil
+	}
+	return etype, data
+}
+
+// ipEthernetType guesses the ethernet type of a bare IP packet from its version.
+func ipEthernetType(data []byte) layers.EthernetType {
+	if len(data) == 0 {
+		return 0
+	}
+	switch data[0] >> 4 {
+	case 4:
+		return layers.EthernetTypeIPv4
+	case 6:
+		return layers.EthernetTypeIPv6
+	}
+	return 0
+}
+
+// Degraded returns whether the capture is unavailable for lack of privileges, the
+// connections being polled from the sockets of the host in its place.
+func (c *PcapClient) Degraded() bool {
+	return c.degraded
+}
+
+// Poll records the TCP connections polled from the sockets when degraded, along with
+// their processes and queues but none of their traffic.
+func (c *PcapClient) Poll() {
+	lister, ok := c.resolver.(connectionLister)
+	if !c.degraded || !ok {
+		return
+	}
+
+	for conn, tcp := range lister.Connections() {
+		process := c.resolver.Resolve(conn)
+		if c.excludeSelf && self.owns(conn.Local, process) {
+			continue
+		}
+		tcp := tcp
+		info := &ConnectionInfo{
+			Process:   process,
+			KernelTCP: &tcp,
+			Family:    FamilyIPv4,
+			Loopback:  net.ParseIP(conn.Remote.IP).IsLoopback(),
+			Scope:     c.localSubnets.scopeOf(conn.Remote.IP),
+			TCPState:  TCPStateEstablished,
+		}
+		if c.geoip != nil && info.Scope == ScopeInternet {
+			info.Location = c.geoip.Lookup(conn.Remote.IP)
+		}
+		if strings.Contains(conn.Remote.IP, ":") {
+			info.Family = FamilyIPv6
 		}
+		if label := c.labels.Label(conn.Remote.IP); label != "" {
+			conn.Remote.IP, info.Labeled = label, true
+		} else if !c.disableDNSResolve {
+			conn.Remote.IP = c.lookup(conn.Remote.IP, process)
+		}
+		c.Sinker.FetchPolled(conn, info)
 	}
 }
 
 func (c *PcapClient) Close() {
 	c.cancel()
 	c.wg.Wait()
+	c.closeHandlers()
+}
 
+func (c *PcapClient) closeHandlers() {
 	for _, handler := range c.handlers {
 		handler.handle.Close()
+		if handler.promisc != nil {
+			handler.promisc.Close()
+		}
 	}
+	c.handlers = nil
 }
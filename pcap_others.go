@@ -4,7 +4,9 @@
 package sniffer
 
 import (
-	"errors"
+	"encoding/binary"
+	"net"
+	"strings"
 	"sync"
 
 	"github.com/google/gopacket"
@@ -13,33 +15,91 @@ import (
 )
 
 type pcapHandler struct {
-	device string
-	handle *pcap.Handle
+	device    string
+	mtu       int
+	mac       net.HardwareAddr
+	loopback  bool
+	pktap     bool // Whether the packets lead with a pktap header
+	handle    *pcap.Handle
+	fragments *fragmentTable
+	flows     *flowTable
+
+	partialChecksums bool // Whether the checksums of the packets received may be unfinished
 }
 
 type PcapClient struct {
 	bindIPs           map[string]bool
+	broadcastIPs      map[string]bool
 	handlers          []*pcapHandler
 	bpfFilter         string
 	Sinker            *Sinker
 	devicesPrefix     []string
 	disableDNSResolve bool
 	allDevices        bool
+	tunnelOuter       bool
+	wirePackets       bool
+	verifyChecksums   bool
+	localSubnets      subnets
+	geoip             *GeoIP      // nil unless the remote IPs are located
+	labels            HostLabels  // Labels the remote IPs go by, none if empty
+	dedup             *dedupTable // nil unless the duplicates are dropped
+	mirror            bool
+	excludeSelf       bool
+	maxConns          int // Connections tracked at most, the rest folded into the overflow ones
+	pktap             bool
 	wg                sync.WaitGroup
 	lookup            Lookup
+	observe           Observe
+	resolver          ProcessResolver
 }
 
-func NewPcapClient(lookup Lookup, opt Options, processMonitor interface{}) (*PcapClient, error) {
+func NewPcapClient(lookup Lookup, observe Observe, opt Options, resolver ProcessResolver) (*PcapClient, error) {
+	localSubnets, err := parseSubnets(opt.LocalSubnets)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels HostLabels
+	if opt.HostLabels != "" {
+		if labels, err = LoadHostLabels(opt.HostLabels); err != nil {
+			return nil, err
+		}
+	}
+
+	var geoip *GeoIP
+	if opt.GeoIPDB != "" || opt.ASNDB != "" {
+		if geoip, err = OpenGeoIP(opt.GeoIPDB, opt.ASNDB); err != nil {
+			return nil, err
+		}
+	}
+
 	client := &PcapClient{
 		bindIPs:           make(map[string]bool),
+		broadcastIPs:      make(map[string]bool),
 		handlers:          make([]*pcapHandler, 0),
 		Sinker:            NewSinker(),
 		lookup:            lookup,
+		observe:           observe,
 		bpfFilter:         opt.BPFFilter,
 		devicesPrefix:     opt.DevicesPrefix,
 		disableDNSResolve: opt.DisableDNSResolve,
 		allDevices:        opt.AllDevices,
+		tunnelOuter:       opt.TunnelOuter,
+		wirePackets:       opt.WirePackets,
+		verifyChecksums:   opt.VerifyChecksums,
+		maxConns:          opt.MaxConnections,
+		localSubnets:      localSubnets,
+		geoip:             geoip,
+		labels:            labels,
+		mirror:            opt.Mirror,
+		excludeSelf:       opt.ExcludeSelf,
+		pktap:             opt.Pktap,
+		resolver:          resolver,
+	}
+	if opt.Dedup {
+		client.dedup = newDedupTable()
 	}
+	client.Sinker.maxConns = opt.MaxConnections
 
 	if err := client.getAvailableDevices(); err != nil {
 		return nil, err
@@ -58,35 +118,105 @@ func (c *PcapClient) getAvailableDevices() error {
 		return err
 	}
 
+	if c.pktap {
+		return c.getPktapDevice(devs)
+	}
+
+	var denied error
 	for _, device := range devs {
 		handler, err := c.getHandler(device.Name, c.bpfFilter)
 		if err != nil {
+			if permissionDenied(err) {
+				denied = err
+			}
 			continue
 		}
+		loopback := deviceLoopback(device.Name)
 		c.handlers = append(c.handlers, &pcapHandler{
-			device: device.Name,
-			handle: handler,
+			device:    device.Name,
+			mtu:       deviceMTU(device.Name),
+			mac:       deviceMAC(device.Name),
+			loopback:  loopback,
+			handle:    handler,
+			fragments: newFragmentTable(),
+			flows:     newFlowTable(c.maxConns),
+
+			partialChecksums: loopback,
 		})
 		for _, addr := range device.Addresses {
 			c.bindIPs[addr.IP.String()] = true
+			if addr.Broadaddr != nil {
+				c.broadcastIPs[addr.Broadaddr.String()] = true
+			}
 		}
 	}
 
+	if len(c.handlers) == 0 && denied != nil {
+		return &CapabilityError{Err: denied}
+	}
 	if len(c.handlers) == 0 {
-		return errors.New("no available devices found")
+		return ErrNoDevices
 	}
 
 	return nil
 }
 
+// getPktapDevice captures the devices through the pktap pseudo-device of macOS, which
+// tells the process of each packet.
+func (c *PcapClient) getPktapDevice(devs []pcap.Interface) error {
+	names := make([]string, 0, len(devs))
+	var loopback bool
+	for _, device := range devs {
+		names = append(names, device.Name)
+		loopback = loopback || deviceLoopback(device.Name)
+		for _, addr := range device.Addresses {
+			c.bindIPs[addr.IP.String()] = true
+			if addr.Broadaddr != nil {
+				c.broadcastIPs[addr.Broadaddr.String()] = true
+			}
+		}
+	}
+	if len(names) == 0 {
+		return ErrNoDevices
+	}
+
+	handler, err := c.getHandler("pktap,"+strings.Join(names, ","), c.bpfFilter)
+	if err != nil && permissionDenied(err) {
+		return &CapabilityError{Err: err}
+	}
+	if err != nil {
+		return err
+	}
+	c.handlers = append(c.handlers, &pcapHandler{
+		device:    "pktap",
+		mtu:       deviceMTU(names[0]),
+		pktap:     true,
+		handle:    handler,
+		fragments: newFragmentTable(),
+		flows:     newFlowTable(c.maxConns),
+
+		// the packets of every device come through alike
+		partialChecksums: loopback,
+	})
+	return nil
+}
+
+// permissionDenied returns whether libpcap failed to open the device for lack of the
+// privileges, e.g. of reading the /dev/bpf devices on macOS.
+func permissionDenied(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "permission") || strings.Contains(msg, "access is denied")
+}
+
 func (c *PcapClient) getHandler(device, filter string) (*pcap.Handle, error) {
-	handle, err := pcap.OpenLive(device, 65535, false, pcap.BlockForever)
+	handle, err := pcap.OpenLive(device, 65535, c.mirror, pcap.BlockForever)
 	if err != nil {
 		return nil, err
 	}
 
-	if c.bpfFilter != "" {
-		if err := handle.SetBPFFilter(filter); err != nil {
+	// the loopback devices of macOS and Npcap are of the null link type, with no MPLS
+	if filter != "" {
+		if err := handle.SetBPFFilter(linkBPFFilter(filter, handle.LinkType())); err != nil {
 			handle.Close()
 			return nil, err
 		}
@@ -95,45 +225,146 @@ func (c *PcapClient) getHandler(device, filter string) (*pcap.Handle, error) {
 	return handle, nil
 }
 
-func (c *PcapClient) parsePacket(device string, packet gopacket.Packet) *Segment {
-	ipLayer := packet.Layer(layers.LayerTypeIPv4)
-	if ipLayer == nil {
-		return nil
-	}
+// parsePacket parses the segment out of the packet, the pktap header of the packet
+// telling its device, direction and process if captured through pktap.
+func (c *PcapClient) parsePacket(ph *pcapHandler, packet gopacket.Packet, tap *pktapHeader) *Segment {
+	var srcPort, dstPort uint16
+	var srcIP, dstIP string
+	var protocol Protocol
+	var dataLen int
+	var vni, label uint32
+	var ipHeaderLen, headerLen, payloadLen int
+	var payload []byte
+	var tcp *layers.TCP
+	var family AddressFamily
+	var ttl uint8
+	var network gopacket.Layer
+	direction := DirectionDownload
+	var macDirection Direction
+	var macKnown bool
+	ts := packet.Metadata().Timestamp
 
-	ipv4pkg := ipLayer.(*layers.IPv4)
-	if ipv4pkg == nil {
-		return nil
+loop:
+	for _, layer := range packet.Layers() {
+		switch lyr := layer.(type) {
+		// the MAC of the device tells the direction ahead of the bound IPs, which miss
+		// the NATed, forwarded and newly added addresses
+		case *layers.Ethernet:
+			if srcIP == "" {
+				macDirection, macKnown = ethernetDirection(lyr, ph.mac)
+			}
+
+		case *layers.MPLS:
+			label = lyr.Label
+
+		// the outermost IP layer decides the direction of tunnelled packets
+		case *layers.IPv4:
+			if srcIP == "" {
+				network = lyr
+				if c.bindIPs[lyr.SrcIP.String()] {
+					direction = DirectionUpload
+				}
+			}
+			srcIP = lyr.SrcIP.String()
+			dstIP = lyr.DstIP.String()
+			ipHeaderLen = len(lyr.Contents)
+			family = FamilyIPv4
+			ttl = lyr.TTL
+
+		case *layers.IPv6:
+			if srcIP == "" {
+				network = lyr
+				if c.bindIPs[lyr.SrcIP.String()] {
+					direction = DirectionUpload
+				}
+			}
+			srcIP = lyr.SrcIP.String()
+			dstIP = lyr.DstIP.String()
+			ipHeaderLen = len(lyr.Contents)
+			family = FamilyIPv6
+			ttl = lyr.HopLimit
+
+		case *layers.GRE:
+			if c.tunnelOuter {
+				protocol = ProtoGRE
+				dataLen = len(lyr.Contents) + len(lyr.Payload)
+				headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+				break loop
+			}
+
+		case *layers.VXLAN:
+			if c.tunnelOuter {
+				break loop
+			}
+			vni = lyr.VNI
+
+		case *layers.TCP:
+			srcPort = uint16(lyr.SrcPort)
+			dstPort = uint16(lyr.DstPort)
+			protocol = ProtoTCP
+			dataLen = len(lyr.Contents) + len(lyr.Payload)
+			headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			payload = lyr.Payload
+			tcp = lyr
+
+		case *layers.UDP:
+			srcPort = uint16(lyr.SrcPort)
+			dstPort = uint16(lyr.DstPort)
+			protocol = ProtoUDP
+			dataLen = len(lyr.Contents) + len(lyr.Payload)
+			headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			payload = lyr.Payload
+
+		// the identifier of the echo stands for the port of the ping sockets
+		case *layers.ICMPv4:
+			if t := lyr.TypeCode.Type(); t == layers.ICMPv4TypeEchoRequest || t == layers.ICMPv4TypeEchoReply {
+				srcPort, dstPort = lyr.Id, lyr.Id
+				protocol = ProtoICMP
+				dataLen = len(lyr.Contents) + len(lyr.Payload)
+				headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			}
+
+		// the identifier and the sequence number of the echo lead the payload
+		case *layers.ICMPv6:
+			if icmpv6Echo(lyr) {
+				srcPort = binary.BigEndian.Uint16(lyr.Payload)
+				dstPort = srcPort
+				protocol = ProtoICMP
+				dataLen = len(lyr.Contents) + len(lyr.Payload)
+				headerLen, payloadLen = len(lyr.Contents)+4, len(lyr.Payload)-4
+			}
+		}
 	}
 
-	direction := DirectionDownload
-	srcIP := ipv4pkg.SrcIP.String()
-	dstIP := ipv4pkg.DstIP.String()
-	if c.bindIPs[srcIP] {
-		direction = DirectionUpload
+	if network != nil && c.dedup != nil && c.dedup.Duplicate(network, ph.device, ts) {
+		return nil
 	}
 
-	var srcPort, dstPort uint16
-	var protocol Protocol
-	var dataLen int
+	// gopacket leaves fragmented datagrams undecoded, the transport header is only
+	// present in the first fragment.
+	frag, proto, data := parseFragment(network)
+	switch {
+	case frag.offset > 0:
+		return ph.fragments.Follow(frag, len(data))
 
-	tcpLayer := packet.Layer(layers.LayerTypeTCP)
-	tcpPkg, ok := tcpLayer.(*layers.TCP)
-	if ok {
-		srcPort = uint16(tcpPkg.SrcPort)
-		dstPort = uint16(tcpPkg.DstPort)
-		protocol = ProtoTCP
-		dataLen = len(tcpPkg.Contents) + len(tcpPkg.Payload)
-	}
+	case frag.more && protocol == "":
+		switch lyr := decodeTransport(proto, data, &layers.TCP{}, &layers.UDP{}).(type) {
+		case *layers.TCP:
+			srcPort = uint16(lyr.SrcPort)
+			dstPort = uint16(lyr.DstPort)
+			protocol = ProtoTCP
+			dataLen = len(lyr.Contents) + len(lyr.Payload)
+			headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			payload = lyr.Payload
+			tcp = lyr
 
-	if protocol == "" {
-		udpLayer := packet.Layer(layers.LayerTypeUDP)
-		udpPkg, ok := udpLayer.(*layers.UDP)
-		if ok {
-			srcPort = uint16(udpPkg.SrcPort)
-			dstPort = uint16(udpPkg.DstPort)
+		case *layers.UDP:
+			srcPort = uint16(lyr.SrcPort)
+			dstPort = uint16(lyr.DstPort)
 			protocol = ProtoUDP
-			dataLen = len(udpPkg.Contents) + len(udpPkg.Payload)
+			dataLen = len(lyr.Contents) + len(lyr.Payload)
+			headerLen, payloadLen = len(lyr.Contents), len(lyr.Payload)
+			payload = lyr.Payload
 		}
 	}
 
@@ -142,43 +373,119 @@ func (c *PcapClient) parsePacket(device string, packet gopacket.Packet) *Segment
 		return nil
 	}
 
+	// the traffic between other hosts is only seen on a mirror port, where neither
+	// end has the MAC or the IPs of the device
+	switch {
+	case tap != nil && tap.directionKnown:
+		direction = tap.direction
+	case macKnown:
+		direction = macDirection
+	case c.mirror && !c.bindIPs[srcIP] && !c.bindIPs[dstIP]:
+		direction = mirrorDirection(c.localSubnets, srcIP, dstIP, srcPort, dstPort)
+	}
+
 	seg := &Segment{
-		Interface: device,
-		DataLen:   dataLen,
-		Direction: direction,
+		Interface:  ph.device,
+		DataLen:    dataLen,
+		PayloadLen: payloadLen,
+		Direction:  direction,
+		Cast:       castOf(dstIP, c.broadcastIPs),
+		Loopback:   ph.loopback,
+		Family:     family,
+		TTL:        ttl,
+		MPLSLabel:  label,
+		Timestamp:  ts,
+	}
+	if c.wirePackets {
+		seg.Packets, seg.DataLen = wirePackets(ph.mtu, ipHeaderLen, headerLen, payloadLen)
 	}
 
-	var remoteIP string
 	switch seg.Direction {
 	case DirectionUpload:
-		remoteIP = dstIP
-		if protocol == ProtoTCP && !c.disableDNSResolve {
-			remoteIP = c.lookup(dstIP)
-		}
+		seg.Scope = c.localSubnets.scopeOf(dstIP)
 		seg.Connection = Connection{
 			Local:  LocalSocket{IP: srcIP, Port: srcPort, Protocol: protocol},
-			Remote: RemoteSocket{IP: remoteIP, Port: dstPort},
+			Remote: RemoteSocket{IP: dstIP, Port: dstPort},
+			VNI:    vni,
 		}
 
 	case DirectionDownload:
-		remoteIP = srcIP
-		if protocol == ProtoTCP && !c.disableDNSResolve {
-			remoteIP = c.lookup(srcIP)
-		}
+		seg.Scope = c.localSubnets.scopeOf(srcIP)
 		seg.Connection = Connection{
 			Local:  LocalSocket{IP: dstIP, Port: dstPort, Protocol: protocol},
-			Remote: RemoteSocket{IP: remoteIP, Port: srcPort},
+			Remote: RemoteSocket{IP: srcIP, Port: srcPort},
+			VNI:    vni,
 		}
 	}
+	if tap != nil {
+		seg.Interface = tap.device
+		seg.Loopback = tap.loopback()
+	}
+	c.locate(seg)
+	c.resolveProcess(seg, srcIP, dstIP, srcPort, dstPort)
+	if tap != nil && tap.process() != nil {
+		seg.Process = tap.process()
+		seg.Unattributed = ""
+	}
+	c.markSelf(seg)
+
+	c.nameRemote(seg)
+
+	if c.corrupt(ph, seg, packet.Layers()) {
+		seg.Corrupt = true
+		return seg
+	}
 
+	ph.flows.inspect(seg, tcp, payload)
+	if !c.disableDNSResolve {
+		name, ips := parseDNSResponse(seg, payload)
+		for _, ip := range ips {
+			c.observe(ip, name, dnsClient(seg))
+		}
+	}
+	if pkt, ok := discoveryPacket(seg, payload); ok {
+		c.Sinker.FetchDiscovery(pkt)
+	}
+	if ev, ok := dhcpEvent(seg, payload); ok {
+		c.Sinker.FetchDHCPEvent(ev)
+	}
+	if frag.more {
+		ph.fragments.First(frag, seg)
+	}
 	return seg
 }
 
+func (c *PcapClient) parseNeighbor(device string, packet gopacket.Packet) (NeighborPacket, bool) {
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		return arpNeighborPacket(device, arp)
+	}
+
+	icmp, ok := packet.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6)
+	if !ok {
+		return NeighborPacket{}, false
+	}
+	ipv6, ok := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if !ok {
+		return NeighborPacket{}, false
+	}
+
+	var mac net.HardwareAddr
+	if ether, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok {
+		mac = ether.SrcMAC
+	}
+	return ndpNeighborPacket(device, mac, ipv6.SrcIP, icmp.TypeCode.Type())
+}
+
 func (c *PcapClient) listen(ph *pcapHandler) {
 	c.wg.Add(1)
 	defer c.wg.Done()
 
-	packetSource := gopacket.NewPacketSource(ph.handle, ph.handle.LinkType())
+	// the pktap packets are decoded past their header
+	var decoder gopacket.Decoder = ph.handle.LinkType()
+	if ph.pktap {
+		decoder = gopacket.DecodePayload
+	}
+	packetSource := gopacket.NewPacketSource(ph.handle, decoder)
 	packetSource.Lazy = true
 	packetSource.NoCopy = true
 
@@ -188,8 +495,21 @@ func (c *PcapClient) listen(ph *pcapHandler) {
 			if !ok {
 				return
 			}
-			seg := c.parsePacket(ph.device, packet)
-			if seg == nil {
+			device := ph.device
+			var tap *pktapHeader
+			if ph.pktap {
+				if packet, tap = pktapPacket(packet); tap == nil {
+					continue
+				}
+				device = tap.device
+			}
+			if np, ok := c.parseNeighbor(device, packet); ok {
+				c.Sinker.FetchNeighbor(np)
+				continue
+			}
+
+			seg := c.parsePacket(ph, packet, tap)
+			if seg == nil || seg.Self && c.excludeSelf {
 				continue
 			}
 			c.Sinker.Fetch(*seg)
@@ -197,6 +517,27 @@ func (c *PcapClient) listen(ph *pcapHandler) {
 	}
 }
 
+// pktapPacket returns the packet following the pktap header of the packet along with
+// the header, a nil header if the packet is malformed.
+func pktapPacket(packet gopacket.Packet) (gopacket.Packet, *pktapHeader) {
+	h, data, ok := parsePktapHeader(packet.Data())
+	if !ok {
+		return nil, nil
+	}
+
+	inner := gopacket.NewPacket(data, h.linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	inner.Metadata().CaptureInfo = packet.Metadata().CaptureInfo
+	return inner, &h
+}
+
+// Degraded returns false, the capture being required off Linux.
+func (c *PcapClient) Degraded() bool {
+	return false
+}
+
+// Poll does nothing, the capture being required off Linux.
+func (c *PcapClient) Poll() {}
+
 func (c *PcapClient) Close() {
 	for _, handler := range c.handlers {
 		handler.handle.Close()
@@ -0,0 +1,134 @@
+package sniffer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCastOf(t *testing.T) {
+	broadcasts := map[string]bool{"192.168.1.255": true}
+
+	assert.Equal(t, CastUnicast, castOf("192.168.1.10", broadcasts))
+	assert.Equal(t, CastUnicast, castOf("2001:db8::1", broadcasts))
+	assert.Equal(t, CastBroadcast, castOf("192.168.1.255", broadcasts))
+	assert.Equal(t, CastBroadcast, castOf("255.255.255.255", nil))
+	assert.Equal(t, CastMulticast, castOf("224.0.0.251", broadcasts))
+	assert.Equal(t, CastMulticast, castOf("ff02::fb", broadcasts))
+}
+
+func TestEthernetDirection(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	peer := net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02}
+	broadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	zero := net.HardwareAddr{0, 0, 0, 0, 0, 0}
+
+	direction, ok := ethernetDirection(&layers.Ethernet{SrcMAC: mac, DstMAC: peer}, mac)
+	assert.True(t, ok)
+	assert.Equal(t, DirectionUpload, direction)
+
+	direction, ok = ethernetDirection(&layers.Ethernet{SrcMAC: peer, DstMAC: mac}, mac)
+	assert.True(t, ok)
+	assert.Equal(t, DirectionDownload, direction)
+
+	// the broadcasts and the frames between other hosts fall back to the IPs
+	_, ok = ethernetDirection(&layers.Ethernet{SrcMAC: peer, DstMAC: broadcast}, mac)
+	assert.False(t, ok)
+
+	// so do the loopback devices, with no MAC at all
+	_, ok = ethernetDirection(&layers.Ethernet{SrcMAC: zero, DstMAC: zero}, zero)
+	assert.False(t, ok)
+	_, ok = ethernetDirection(&layers.Ethernet{SrcMAC: mac, DstMAC: peer}, nil)
+	assert.False(t, ok)
+}
+
+func TestSinkerFetchPolled(t *testing.T) {
+	s := NewSinker()
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	s.FetchPolled(conn, &ConnectionInfo{KernelTCP: &TCPInfo{SendQueue: 1 << 20}})
+
+	assert.Equal(t, 1, s.ActiveConnections())
+	utilization := s.GetUtilization()
+	assert.Equal(t, uint32(1<<20), utilization[conn].KernelTCP.SendQueue)
+	assert.Zero(t, utilization[conn].UploadBytes)
+}
+
+func TestSinkerUnattributed(t *testing.T) {
+	s := NewSinker()
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	s.Fetch(Segment{Connection: conn, DataLen: 100, Unattributed: UnattributedNoSocket})
+	assert.Equal(t, UnattributedNoSocket, s.GetUtilization()[conn].Unattributed)
+
+	// the connection is attributed once its socket shows up
+	s.Fetch(Segment{Connection: conn, DataLen: 100, Unattributed: UnattributedNoSocket})
+	s.Fetch(Segment{Connection: conn, DataLen: 100, Process: &ProcessInfo{Pid: 1, Name: "curl"}})
+	utilization := s.GetUtilization()
+	assert.Empty(t, utilization[conn].Unattributed)
+	assert.Equal(t, "curl", utilization[conn].Process.Name)
+}
+
+func TestSinkerMaxConnections(t *testing.T) {
+	s := NewSinker()
+	s.maxConns = 2
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	for port := uint16(1); port <= 4; port++ {
+		s.Fetch(Segment{
+			Connection: Connection{Local: LocalSocket{IP: "10.0.0.1", Port: port, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}},
+			Process:    curl,
+			DataLen:    100,
+			TCPState:   TCPStateEstablished,
+		})
+	}
+
+	assert.Equal(t, 2, s.ActiveConnections())
+	utilization := s.GetUtilization()
+	assert.Len(t, utilization, 3)
+	other := utilization[Connection{Local: LocalSocket{Protocol: ProtoTCP}, Remote: RemoteSocket{IP: OverflowIP}}]
+	assert.Equal(t, 200, other.UploadBytes)
+	assert.Equal(t, 2, other.UploadPackets)
+	assert.Nil(t, other.Process)
+
+	// the overflow connection is accounted to <other> in the snapshots
+	m := NewStatsManager(Options{Interval: 1, ViewMode: ModeTableBytes})
+	m.put(Stat{Utilization: utilization}, time.Now())
+	snapshot := m.getSnapshot()
+	assert.Equal(t, 200, snapshot.Processes[OverflowIP].UploadBytes)
+	assert.Equal(t, 200, snapshot.RemoteAddrs[OverflowIP].UploadBytes)
+}
+
+func TestFlowTableMax(t *testing.T) {
+	table := newFlowTable(1)
+	a := Connection{Local: LocalSocket{Port: 1}}
+	b := Connection{Local: LocalSocket{Port: 2}}
+	table.Get(a).ServerName = "a"
+	table.Get(b).ServerName = "b"
+
+	assert.Len(t, table.entries, 1)
+	assert.Equal(t, "a", table.Get(a).ServerName)
+	assert.Empty(t, table.Get(b).ServerName)
+}
+
+func TestLinkBPFFilter(t *testing.T) {
+	assert.Equal(t, DefaultBPFFilter+" or mpls", linkBPFFilter(DefaultBPFFilter, layers.LinkTypeEthernet))
+	assert.Equal(t, DefaultBPFFilter, linkBPFFilter(DefaultBPFFilter, layers.LinkTypeRaw))
+	assert.Equal(t, "tcp port 443", linkBPFFilter("tcp port 443", layers.LinkTypeEthernet))
+
+	if _, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, 65535, "tcp"); err != nil {
+		t.Skip(err) // libpcap is unavailable
+	}
+	// the tun and wireguard devices are captured as bare IP packets
+	for _, linkType := range []layers.LinkType{layers.LinkTypeEthernet, layers.LinkTypeRaw, layers.LinkTypeNull} {
+		_, err := pcap.CompileBPFFilter(linkType, 65535, linkBPFFilter(DefaultBPFFilter, linkType))
+		assert.NoError(t, err, linkType.String())
+	}
+}
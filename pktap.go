@@ -0,0 +1,84 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	pktapHeaderMinLen = 108 // up to pth_flowid
+	pktapFlagDirIn    = 0x1
+	pktapFlagDirOut   = 0x2
+
+	dltNull = 0
+	dltRaw  = 12
+)
+
+// pktapHeader is the header the pktap pseudo-device of macOS puts ahead of each
+// packet, telling the device the packet went through and the process it belongs to.
+type pktapHeader struct {
+	linkType       layers.LinkType // Link type of the packet following the header
+	device         string
+	direction      Direction
+	directionKnown bool
+	pid            int // 0 if the packet isn't of a process
+	comm           string
+}
+
+// parsePktapHeader parses the header out of the data of a pktap packet, returning
+// the packet following it, false if the data is too short. The fields are in the
+// byte order of the host, little endian on the Macs.
+func parsePktapHeader(data []byte) (pktapHeader, []byte, bool) {
+	if len(data) < pktapHeaderMinLen {
+		return pktapHeader{}, nil, false
+	}
+	length := int(binary.LittleEndian.Uint32(data))
+	if length < pktapHeaderMinLen || length > len(data) {
+		return pktapHeader{}, nil, false
+	}
+
+	h := pktapHeader{
+		linkType: layers.LinkType(binary.LittleEndian.Uint32(data[8:])),
+		device:   cString(data[12:36]),
+		comm:     cString(data[56:73]),
+	}
+	// DLT_RAW is numbered apart from its link type
+	if h.linkType == dltRaw {
+		h.linkType = layers.LinkTypeRaw
+	}
+
+	switch flags := binary.LittleEndian.Uint32(data[36:]); {
+	case flags&pktapFlagDirOut != 0:
+		h.direction, h.directionKnown = DirectionUpload, true
+	case flags&pktapFlagDirIn != 0:
+		h.direction, h.directionKnown = DirectionDownload, true
+	}
+	if pid := int32(binary.LittleEndian.Uint32(data[52:])); pid > 0 {
+		h.pid = int(pid)
+	}
+	return h, data[length:], true
+}
+
+// loopback returns whether the packet went through a loopback device, the only ones
+// of the DLT_NULL link type.
+func (h pktapHeader) loopback() bool {
+	return h.linkType == dltNull
+}
+
+// process returns the process of the packet, nil if unknown.
+func (h pktapHeader) process() *ProcessInfo {
+	if h.pid == 0 {
+		return nil
+	}
+	return &ProcessInfo{Pid: h.pid, Name: h.comm}
+}
+
+// cString returns the NUL terminated string of b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
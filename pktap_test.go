@@ -0,0 +1,56 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePktapHeader(t *testing.T) {
+	header := func(dlt, flags uint32, pid int32, device, comm string) []byte {
+		b := make([]byte, 156)
+		binary.LittleEndian.PutUint32(b, uint32(len(b)))
+		binary.LittleEndian.PutUint32(b[4:], 1)
+		binary.LittleEndian.PutUint32(b[8:], dlt)
+		copy(b[12:36], device)
+		binary.LittleEndian.PutUint32(b[36:], flags)
+		binary.LittleEndian.PutUint32(b[52:], uint32(pid))
+		copy(b[56:73], comm)
+		return b
+	}
+
+	h, packet, ok := parsePktapHeader(append(header(1, pktapFlagDirOut, 4242, "en0", "curl"), 0xaa, 0xbb))
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0xaa, 0xbb}, packet)
+	assert.Equal(t, pktapHeader{
+		linkType:       layers.LinkTypeEthernet,
+		device:         "en0",
+		direction:      DirectionUpload,
+		directionKnown: true,
+		pid:            4242,
+		comm:           "curl",
+	}, h)
+	assert.Equal(t, &ProcessInfo{Pid: 4242, Name: "curl"}, h.process())
+	assert.False(t, h.loopback())
+
+	h, _, ok = parsePktapHeader(header(dltRaw, pktapFlagDirIn, -1, "utun3", ""))
+	assert.True(t, ok)
+	assert.Equal(t, layers.LinkTypeRaw, h.linkType)
+	assert.Equal(t, DirectionDownload, h.direction)
+	assert.Nil(t, h.process())
+
+	h, _, ok = parsePktapHeader(header(dltNull, 0, 0, "lo0", ""))
+	assert.True(t, ok)
+	assert.True(t, h.loopback())
+	assert.False(t, h.directionKnown)
+
+	// truncated headers
+	_, _, ok = parsePktapHeader(header(1, 0, 1, "en0", "curl")[:100])
+	assert.False(t, ok)
+	b := header(1, 0, 1, "en0", "curl")
+	binary.LittleEndian.PutUint32(b, 200)
+	_, _, ok = parsePktapHeader(b)
+	assert.False(t, ok)
+}
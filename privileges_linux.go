@@ -0,0 +1,49 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// dropPrivileges switches every thread of the process to the user and its primary
+// group once the capture handles and the netlink sockets are open, which stay usable.
+// The set*id calls of syscall switch every thread as of Go 1.16, and fail before. The
+// sockets of the processes of the other users are attributed by their owner from then
+// on, their /proc entries being unreadable.
+func dropPrivileges(name string) error {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+
+	// the groups go first, setgid and setgroups taking the privileges given up by setuid
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+
+	// root regains its privileges as long as any id is left behind
+	if os.Geteuid() != uid || os.Getegid() != gid || syscall.Setuid(0) == nil {
+		return fmt.Errorf("failed to drop the privileges to %s", name)
+	}
+	return nil
+}
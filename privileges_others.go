@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package sniffer
+
+import "errors"
+
+// dropPrivileges fails, the privileges only being dropped on Linux.
+func dropPrivileges(name string) error {
+	return errors.New("dropping the privileges is only supported on Linux")
+}
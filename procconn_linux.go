@@ -0,0 +1,139 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// the proc connector of linux/cn_proc.h, multicasting the process events
+	cnIdxProc         = 1
+	cnValProc         = 1
+	procCnMcastListen = 1
+
+	procEventFork = 0x00000001
+	procEventExec = 0x00000002
+	procEventExit = 0x80000000
+
+	sizeOfCnMsg = 20
+
+	// procConnectorTimeout bounds the blocking reads of the events, for the reader to
+	// notice being stopped
+	procConnectorTimeout = 500 * time.Millisecond
+)
+
+// procEvent is a fork, an exec or an exit of a process, the threads left out.
+type procEvent struct {
+	what uint32
+	pid  int32
+}
+
+// parseProcEvent parses the proc_event following the cn_msg of a proc connector
+// message, false if it isn't the fork, exec or exit of a process.
+/* cn_proc.h
+struct proc_event {
+	enum what what;
+	__u32 cpu;
+	__u64 __attribute__((aligned(8))) timestamp_ns;
+	union {
+		struct fork_proc_event { pid_t parent_pid, parent_tgid, child_pid, child_tgid; } fork;
+		struct exec_proc_event { pid_t process_pid, process_tgid; } exec;
+		struct exit_proc_event { pid_t process_pid, process_tgid; __u32 exit_code, exit_signal; ... } exit;
+		...
+	} event_data;
+};
+*/
+func parseProcEvent(data []byte, order binary.ByteOrder) (procEvent, bool) {
+	if len(data) < sizeOfCnMsg+16+16 {
+		return procEvent{}, false
+	}
+	event := data[sizeOfCnMsg:]
+	what := order.Uint32(event[0:4])
+	fields := event[16:]
+
+	switch what {
+	case procEventFork:
+		pid, tgid := int32(order.Uint32(fields[8:12])), int32(order.Uint32(fields[12:16]))
+		return procEvent{what: what, pid: tgid}, pid == tgid
+	case procEventExec, procEventExit:
+		pid, tgid := int32(order.Uint32(fields[0:4])), int32(order.Uint32(fields[4:8]))
+		return procEvent{what: what, pid: tgid}, pid == tgid
+	}
+	return procEvent{}, false
+}
+
+// procConnector receives the process events of the kernel, which takes CAP_NET_ADMIN.
+type procConnector struct {
+	fd int
+}
+
+func dialProcConnector() (*procConnector, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, err
+	}
+	pc := &procConnector{fd: fd}
+
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		pc.Close()
+		return nil, err
+	}
+	timeout := syscall.NsecToTimeval(procConnectorTimeout.Nanoseconds())
+	if err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	// nlmsghdr, cn_msg and the listen operation
+	order := getNativeEndian()
+	msg := make([]byte, unix.SizeofNlMsghdr+sizeOfCnMsg+4)
+	order.PutUint32(msg[0:4], uint32(len(msg)))
+	order.PutUint16(msg[4:6], unix.NLMSG_DONE)
+	order.PutUint32(msg[12:16], uint32(os.Getpid()))
+	cn := msg[unix.SizeofNlMsghdr:]
+	order.PutUint32(cn[0:4], cnIdxProc)
+	order.PutUint32(cn[4:8], cnValProc)
+	order.PutUint16(cn[16:18], 4)
+	order.PutUint32(cn[sizeOfCnMsg:], procCnMcastListen)
+
+	if err = unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		pc.Close()
+		return nil, err
+	}
+	return pc, nil
+}
+
+// read reads the next batch of events, none if the read timed out.
+func (pc *procConnector) read(buffer []byte) ([]procEvent, error) {
+	n, _, err := unix.Recvfrom(pc.fd, buffer, 0)
+	if err == unix.EAGAIN || err == unix.EINTR {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buffer[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	var events []procEvent
+	for _, msg := range msgs {
+		if event, ok := parseProcEvent(msg.Data, getNativeEndian()); ok {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (pc *procConnector) Close() error {
+	return syscall.Close(pc.fd)
+}
@@ -0,0 +1,45 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcEvent(t *testing.T) {
+	event := func(what uint32, fields ...uint32) []byte {
+		data := make([]byte, sizeOfCnMsg+16+24)
+		binary.LittleEndian.PutUint32(data[sizeOfCnMsg:], what)
+		for i, f := range fields {
+			binary.LittleEndian.PutUint32(data[sizeOfCnMsg+16+4*i:], f)
+		}
+		return data
+	}
+
+	e, ok := parseProcEvent(event(procEventFork, 1, 1, 4242, 4242), binary.LittleEndian)
+	assert.True(t, ok)
+	assert.Equal(t, procEvent{what: procEventFork, pid: 4242}, e)
+
+	// the new threads are left out
+	_, ok = parseProcEvent(event(procEventFork, 4242, 4242, 4243, 4242), binary.LittleEndian)
+	assert.False(t, ok)
+
+	e, ok = parseProcEvent(event(procEventExec, 4242, 4242), binary.LittleEndian)
+	assert.True(t, ok)
+	assert.Equal(t, procEvent{what: procEventExec, pid: 4242}, e)
+
+	e, ok = parseProcEvent(event(procEventExit, 4242, 4242, 0, 17), binary.LittleEndian)
+	assert.True(t, ok)
+	assert.Equal(t, procEvent{what: procEventExit, pid: 4242}, e)
+
+	// uid and gid changes
+	_, ok = parseProcEvent(event(0x4, 4242, 4242), binary.LittleEndian)
+	assert.False(t, ok)
+
+	_, ok = parseProcEvent(make([]byte, sizeOfCnMsg), binary.LittleEndian)
+	assert.False(t, ok)
+}
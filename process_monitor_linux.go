@@ -4,36 +4,167 @@
 package sniffer
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketLinger is how long a closed connection keeps the process of its socket, for
+// its last packets to be attributed even if another process reuses its local port.
+const socketLinger = 10 * time.Second
+
+// The bounds of the refresh interval unless configured otherwise
+const (
+	defaultRefreshMin = 500 * time.Millisecond
+	defaultRefreshMax = 10 * time.Second
 )
 
+// walkInterval is the shortest interval between the walks of every process for the
+// sockets of unknown processes, which the processes opening sockets keep around.
+const walkInterval = 10 * time.Second
+
+// socketOwner is the process of the socket of a connection, identified by its cookie.
+type socketOwner struct {
+	cookie uint64
+	proc   ProcessInfo
+	seen   time.Time
+}
+
+// procSockets are the socket inodes of a process.
+type procSockets struct {
+	info    ProcessInfo
+	inodes  []uint32
+	netns   uint64 // the network namespace of the process, zero if unknown
+	started uint64 // the start time of the process in clock ticks since boot, zero if unknown
+}
+
 // ProcessMonitor maintains a real-time map of sockets to processes
 type ProcessMonitor struct {
+	// lookups and misses count the connections looked up and those of unknown
+	// processes, first for their 64-bit alignment
+	lookups uint64
+	misses  uint64
+
 	mu              sync.RWMutex
-	socketMap       map[LocalSocket]ProcessInfo // socket -> process mapping
+	socketMap       OpenSockets                // socket -> process mapping
+	tcpInfos        map[Connection]TCPInfo     // connection -> kernel measured quality
+	connOwners      map[Connection]socketOwner // connection -> process of its socket
+	localIPs        map[string]bool            // IPs of the own network namespace, nil if unknown
 	refreshInterval time.Duration
+	minInterval     time.Duration
+	maxInterval     time.Duration
+	changed         bool // whether the latest refresh changed the socket map
+	stats           MonitorStats
+	lastLookups     uint64 // lookups as of the latest refresh interval adapted
+	lastMisses      uint64
 	ctx             context.Context
 	cancel          context.CancelFunc
 	wg              sync.WaitGroup
 	nlConn          *netlinkConn
+	netns           uint64 // the own network namespace
+	ownNetnsOnly    bool   // whether the sockets of the other network namespaces are left undumped
+
+	procsMu  sync.Mutex
+	procs    map[int32]procSockets // pid -> sockets, kept up to date by the process events
+	events   *procConnector        // nil if the proc connector is unavailable
+	watching bool                  // whether the process events are applied
+	stale    bool                  // whether process events were lost since the latest walk
+	walked   time.Time             // when every process was walked last
 }
 
 // NewProcessMonitor creates a new process monitor
 func NewProcessMonitor(refreshInterval time.Duration) *ProcessMonitor {
 	ctx, cancel := context.WithCancel(context.Background())
+	netns, _ := procNetns(int32(os.Getpid()))
 	return &ProcessMonitor{
-		socketMap:       make(map[LocalSocket]ProcessInfo),
+		socketMap:       make(OpenSockets),
+		tcpInfos:        make(map[Connection]TCPInfo),
+		connOwners:      make(map[Connection]socketOwner),
 		refreshInterval: refreshInterval,
+		minInterval:     defaultRefreshMin,
+		maxInterval:     defaultRefreshMax,
 		ctx:             ctx,
 		cancel:          cancel,
 		nlConn:          &netlinkConn{},
+		netns:           netns,
+		procs:           make(map[int32]procSockets),
+	}
+}
+
+// SetRefreshBounds bounds the refresh interval, which shortens while the processes of
+// many connections are unknown and lengthens while the socket map stays the same. A
+// zero bound keeps the default one.
+func (pm *ProcessMonitor) SetRefreshBounds(min, max time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if min > 0 {
+		pm.minInterval = min
+	}
+	if max > 0 {
+		pm.maxInterval = max
+	}
+	if pm.maxInterval < pm.minInterval {
+		pm.maxInterval = pm.minInterval
+	}
+}
+
+// SetSockDiagTimeout bounds the wait for each reply of the socket dumps, zero for the
+// default one.
+func (pm *ProcessMonitor) SetSockDiagTimeout(timeout time.Duration) {
+	pm.nlConn.setTimeout(timeout)
+}
+
+// SetOwnNetnsOnly leaves the sockets of the network namespaces other than the own one
+// undumped, as entering them takes the privileges dropped by Options.User.
+func (pm *ProcessMonitor) SetOwnNetnsOnly(own bool) {
+	pm.ownNetnsOnly = own
+}
+
+// SetProcessFilter restricts the processes whose sockets are looked up to the pids
+// and the ones whose name matches the patterns, every one if both are empty. The
+// sockets of the others are left unattributed.
+func (pm *ProcessMonitor) SetProcessFilter(pids []int, names []string) error {
+	filter, err := newProcFilter(pids, names)
+	if err != nil {
+		return err
+	}
+	pm.nlConn.setFilter(filter)
+	return nil
+}
+
+// SetSocketStates sets the states of the TCP sockets looked up, the established ones
+// if empty. The listening sockets attribute the connections accepted since the
+// latest refresh by their local port.
+func (pm *ProcessMonitor) SetSocketStates(states []string) error {
+	mask, err := socketStateMask(states)
+	if err != nil {
+		return err
 	}
+	pm.nlConn.setTCPStates(mask)
+	return nil
 }
 
 // Start begins monitoring processes and their sockets
 func (pm *ProcessMonitor) Start() error {
+	// The process events spare walking every process, when permitted
+	if pc, err := dialProcConnector(); err == nil {
+		pm.events = pc
+		pm.watching = true
+		pm.wg.Add(1)
+		go pm.watchProcs()
+	}
+
 	// Initial refresh
 	if err := pm.RefreshProcesses(); err != nil {
 		return err
@@ -43,15 +174,18 @@ func (pm *ProcessMonitor) Start() error {
 	pm.wg.Add(1)
 	go func() {
 		defer pm.wg.Done()
-		ticker := time.NewTicker(pm.refreshInterval)
-		defer ticker.Stop()
+		interval := pm.refreshInterval
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
 
 		for {
 			select {
 			case <-pm.ctx.Done():
 				return
-			case <-ticker.C:
+			case <-timer.C:
 				pm.RefreshProcesses()
+				interval = pm.nextRefresh(interval)
+				timer.Reset(interval)
 			}
 		}
 	}()
@@ -59,76 +193,526 @@ func (pm *ProcessMonitor) Start() error {
 	return nil
 }
 
+// Refresh does nothing, the monitor refreshing in the background, to be a
+// ProcessResolver
+func (pm *ProcessMonitor) Refresh(ctx context.Context) error {
+	return nil
+}
+
+// Resolve returns the process of the connection, see GetConnectionProcess
+func (pm *ProcessMonitor) Resolve(conn Connection) *ProcessInfo {
+	return pm.GetConnectionProcess(conn)
+}
+
+// Close stops the process monitor
+func (pm *ProcessMonitor) Close() {
+	pm.Stop()
+}
+
 // Stop stops the process monitor
 func (pm *ProcessMonitor) Stop() {
 	pm.cancel()
 	pm.wg.Wait()
+	if pm.events != nil {
+		pm.events.Close()
+	}
 }
 
-// RefreshProcesses updates the socket-to-process mapping
-func (pm *ProcessMonitor) RefreshProcesses() error {
-	// Get all PIDs
+// nextRefresh returns the interval until the next refresh from the lookups since the
+// latest one
+func (pm *ProcessMonitor) nextRefresh(cur time.Duration) time.Duration {
+	total, totalMisses := atomic.LoadUint64(&pm.lookups), atomic.LoadUint64(&pm.misses)
+	lookups, misses := total-pm.lastLookups, totalMisses-pm.lastMisses
+	pm.lastLookups, pm.lastMisses = total, totalMisses
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return nextInterval(cur, pm.minInterval, pm.maxInterval, lookups, misses, pm.changed)
+}
+
+// nextInterval halves the refresh interval when more than a tenth of the connections
+// looked up belong to unknown processes, and lengthens it by half when the socket map
+// stayed the same, within the bounds.
+func nextInterval(cur, min, max time.Duration, lookups, misses uint64, changed bool) time.Duration {
+	switch {
+	case misses*10 > lookups:
+		cur /= 2
+	case !changed:
+		cur += cur / 2
+	}
+
+	if cur < min {
+		return min
+	}
+	if cur > max {
+		return max
+	}
+	return cur
+}
+
+// watchProcs applies the process events to the sockets of the processes until the
+// monitor stops or the events fail.
+func (pm *ProcessMonitor) watchProcs() {
+	defer pm.wg.Done()
+
+	buffer := make([]byte, os.Getpagesize())
+	for pm.ctx.Err() == nil {
+		events, err := pm.events.read(buffer)
+		if err != nil {
+			pm.procsMu.Lock()
+			pm.stale = true
+			pm.watching = err == unix.ENOBUFS // the events overflowing the socket are lost
+			pm.procsMu.Unlock()
+			if err != unix.ENOBUFS {
+				return
+			}
+			continue
+		}
+
+		for _, event := range events {
+			pm.applyEvent(event)
+		}
+	}
+}
+
+// applyEvent rescans the process forked or executed, and forgets the one exited.
+func (pm *ProcessMonitor) applyEvent(event procEvent) {
+	var ps procSockets
+	ok := false
+	if event.what != procEventExit {
+		var err error
+		ps, err = pm.scanProc(event.pid)
+		ok = err == nil
+	}
+
+	pm.procsMu.Lock()
+	defer pm.procsMu.Unlock()
+	if ok {
+		pm.procs[event.pid] = ps
+	} else {
+		delete(pm.procs, event.pid)
+	}
+}
+
+// scanProc reads the sockets of the process, failing if it is gone or denied
+func (pm *ProcessMonitor) scanProc(pid int32) (procSockets, error) {
+	name, inodes, err := pm.nlConn.getProcInodes(pid)
+	if err != nil {
+		return procSockets{}, err
+	}
+	netns, _ := procNetns(pid)
+	started, _ := procStarted(pid)
+	return procSockets{info: ProcessInfo{Pid: int(pid), Name: name}, inodes: inodes, netns: netns, started: started}, nil
+}
+
+// procStarted returns the start time of the process in clock ticks since boot, which
+// tells a process reusing the pid of an exited one.
+func procStarted(pid int32) (uint64, error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	return parseProcStarted(stat)
+}
+
+// parseProcStarted parses the start time, the 22nd field, of /proc/<pid>/stat. The
+// fields are counted from the end of the command name, which may hold spaces and
+// parentheses.
+func parseProcStarted(stat []byte) (uint64, error) {
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, errors.New("no command name in the process stat")
+	}
+	fields := bytes.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return 0, errors.New("no start time in the process stat")
+	}
+	return strconv.ParseUint(string(fields[19]), 10, 64)
+}
+
+// changedProc reports whether the process of the pid is not the one scanned, its pid
+// being reused by another process or the process executing another program.
+func changedProc(pid int32, ps procSockets) bool {
+	started, err := procStarted(pid)
+	if err != nil || started != ps.started {
+		return true
+	}
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	return err == nil && filepath.Base(exe) != ps.info.Name
+}
+
+// procScan counts the processes whose sockets a walk read and those it was denied
+type procScan struct {
+	scanned, denied int
+}
+
+// add reads the sockets of the process into procs, counting it
+func (s *procScan) add(pm *ProcessMonitor, pid int32, procs map[int32]procSockets) {
+	s.scanned++
+	ps, err := pm.scanProc(pid)
+	switch {
+	case err == nil:
+		procs[pid] = ps
+	case os.IsPermission(err):
+		s.denied++
+	}
+}
+
+// scanProcs walks every process, replacing the sockets of the processes
+func (pm *ProcessMonitor) scanProcs() (procScan, error) {
+	var scan procScan
 	pids, err := pm.nlConn.listPids()
 	if err != nil {
-		return err
+		return scan, err
+	}
+
+	procs := make(map[int32]procSockets, len(pids))
+	for _, pid := range pids {
+		scan.add(pm, pid, procs)
+	}
+
+	pm.procsMu.Lock()
+	pm.procs = procs
+	pm.stale = false
+	pm.walked = time.Now()
+	pm.procsMu.Unlock()
+	return scan, nil
+}
+
+// diffProcs reads the sockets of the processes started since the latest walk, along
+// with the ones whose pid was reused or which executed another program, and forgets
+// the exited ones, merging them into the sockets of the processes
+func (pm *ProcessMonitor) diffProcs() (procScan, error) {
+	var scan procScan
+	pids, err := pm.nlConn.listPids()
+	if err != nil {
+		return scan, err
+	}
+
+	alive := make(map[int32]bool, len(pids))
+	for _, pid := range pids {
+		alive[pid] = true
+	}
+	pm.procsMu.Lock()
+	known := make(map[int32]procSockets, len(pm.procs))
+	for pid, ps := range pm.procs {
+		if alive[pid] {
+			known[pid] = ps
+		} else {
+			delete(pm.procs, pid)
+		}
+	}
+	pm.procsMu.Unlock()
+
+	var started []int32
+	for _, pid := range pids {
+		if ps, ok := known[pid]; !ok || changedProc(pid, ps) {
+			started = append(started, pid)
+		}
+	}
+
+	procs := make(map[int32]procSockets, len(started))
+	for _, pid := range started {
+		scan.add(pm, pid, procs)
+	}
+
+	pm.procsMu.Lock()
+	for pid, ps := range procs {
+		pm.procs[pid] = ps
+	}
+	pm.procsMu.Unlock()
+	return scan, nil
+}
+
+// inodeMap returns the inode to process map of the sockets of the processes
+func (pm *ProcessMonitor) inodeMap() map[uint32]ProcessInfo {
+	pm.procsMu.Lock()
+	defer pm.procsMu.Unlock()
+
+	inodeMap := make(map[uint32]ProcessInfo)
+	for _, ps := range pm.procs {
+		for _, inode := range ps.inodes {
+			inodeMap[inode] = ps.info
+		}
+	}
+	return inodeMap
+}
+
+// netnsPids returns a process of each network namespace of the processes other than
+// the own one
+func (pm *ProcessMonitor) netnsPids() []int32 {
+	if pm.ownNetnsOnly {
+		return nil
+	}
+	pm.procsMu.Lock()
+	defer pm.procsMu.Unlock()
+
+	netns := make(map[int32]uint64, len(pm.procs))
+	for pid, ps := range pm.procs {
+		netns[pid] = ps.netns
+	}
+	return foreignNetns(netns, pm.netns)
+}
+
+// unattributed counts the sockets of unknown processes
+func unattributed(sockets OpenSockets) int {
+	n := 0
+	for _, proc := range sockets {
+		if proc.Name == "" {
+			n++
+		}
 	}
+	return n
+}
 
-	// Build inode to process map
-	inodeMap := pm.nlConn.getAllProcsInodes(pids...)
+// RefreshProcesses updates the socket-to-process mapping
+func (pm *ProcessMonitor) RefreshProcesses() error {
+	start := time.Now()
+
+	// Walk every process at first or once process events were lost, the process events
+	// keep them up to date from then on, or the changes of the pids without them
+	pm.procsMu.Lock()
+	walk := pm.stale || len(pm.procs) == 0
+	diff := !walk && !pm.watching
+	pm.procsMu.Unlock()
+	var scan procScan
+	var err error
+	switch {
+	case walk:
+		if scan, err = pm.scanProcs(); err != nil {
+			return err
+		}
+	case diff:
+		if scan, err = pm.diffProcs(); err != nil {
+			return err
+		}
+	}
 
 	// Get all open sockets
-	openSockets, err := pm.nlConn.getOpenSockets(inodeMap)
+	inodeMap := pm.inodeMap()
+	details := newSocketDetails()
+	openSockets, err := pm.nlConn.getOpenSockets(inodeMap, pm.netnsPids(), details)
 	if err != nil {
 		return err
 	}
 
+	// The processes open sockets without any event or pid change, walk them for the
+	// unknown ones, at most once a walk interval not to walk them on each refresh while
+	// sockets of no process are left, e.g. the ones of the processes denied
+	pm.procsMu.Lock()
+	walked := pm.walked
+	pm.procsMu.Unlock()
+	if !walk && unattributed(openSockets) > 0 && time.Since(walked) >= walkInterval {
+		rescan, err := pm.scanProcs()
+		if err != nil {
+			return err
+		}
+		scan.scanned += rescan.scanned
+		scan.denied += rescan.denied
+		inodeMap = pm.inodeMap()
+		details = newSocketDetails()
+		if openSockets, err = pm.nlConn.getOpenSockets(inodeMap, pm.netnsPids(), details); err != nil {
+			return err
+		}
+	}
+
 	// Update the socket map
 	pm.mu.Lock()
+	pm.changed = !sameSockets(pm.socketMap, openSockets)
 	pm.socketMap = openSockets
+	pm.tcpInfos = details.tcpInfos
+	pm.connOwners = pm.updateOwners(details.cookies, inodeMap, time.Now())
+	pm.localIPs = netnsIPs()
+	pm.stats = MonitorStats{
+		RefreshDuration: time.Since(start),
+		PidsScanned:     scan.scanned,
+		PidsDenied:      scan.denied,
+		Sockets:         len(openSockets),
+		Unattributed:    unattributed(openSockets),
+	}
 	pm.mu.Unlock()
 
 	return nil
 }
 
+// sameSockets reports whether the sockets belong to the same processes
+func sameSockets(a, b OpenSockets) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for socket, proc := range a {
+		if other, ok := b[socket]; !ok || other != proc {
+			return false
+		}
+	}
+	return true
+}
+
+// updateOwners returns the processes of the sockets of the connections dumped, the
+// caller holding the lock. A socket keeps its process while its cookie stays the same
+// even once its inode can't be resolved, e.g. after the process handed it over and
+// exited, and the connections closed lately linger.
+func (pm *ProcessMonitor) updateOwners(cookies map[Connection]socketCookie, inodeMap map[uint32]ProcessInfo, now time.Time) map[Connection]socketOwner {
+	owners := make(map[Connection]socketOwner, len(cookies))
+	for conn, sc := range cookies {
+		owner := socketOwner{cookie: sc.cookie, seen: now}
+		prev, known := pm.connOwners[conn]
+		if proc, ok := inodeMap[sc.inode]; ok {
+			owner.proc = proc
+		} else if known && prev.cookie == sc.cookie {
+			owner.proc = prev.proc
+		} else {
+			continue
+		}
+		owners[conn] = owner
+	}
+
+	for conn, prev := range pm.connOwners {
+		if _, ok := cookies[conn]; !ok && now.Sub(prev.seen) < socketLinger {
+			owners[conn] = prev
+		}
+	}
+	return owners
+}
+
+// GetConnectionProcess returns the process info for the socket of a connection, or
+// the one of its local socket if unknown. The remote end is identified by its IP, not
+// its resolved name.
+func (pm *ProcessMonitor) GetConnectionProcess(conn Connection) *ProcessInfo {
+	atomic.AddUint64(&pm.lookups, 1)
+	pm.mu.RLock()
+	owner, ok := pm.connOwners[conn]
+	pm.mu.RUnlock()
+
+	if ok {
+		return &owner.proc
+	}
+	proc := pm.GetProcess(conn.Local)
+	if proc == nil {
+		atomic.AddUint64(&pm.misses, 1)
+	}
+	return proc
+}
+
 // GetProcess returns the process info for a given socket, or nil if unknown
 func (pm *ProcessMonitor) GetProcess(socket LocalSocket) *ProcessInfo {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
+	if proc := pm.lookupProcess(socket); proc != nil {
+		return proc
+	}
+
+	// Try the raw ICMP sockets, receiving the echoes of every identifier
+	if socket.Protocol == ProtoICMP && socket.Port != 0 {
+		socket.Port = 0
+		return pm.lookupProcess(socket)
+	}
+
+	return nil
+}
+
+// lookupProcess looks the socket up in the socket map, the caller holding the lock
+func (pm *ProcessMonitor) lookupProcess(socket LocalSocket) *ProcessInfo {
+	if proc, ok := pm.lookupSocket(socket); ok {
+		owner := proc.Owner()
+		return &owner
+	}
+	return nil
+}
+
+// lookupSocket looks the socket up in the socket map, or the wildcard one bound to its
+// port, the caller holding the lock
+func (pm *ProcessMonitor) lookupSocket(socket LocalSocket) (SocketInfo, bool) {
 	// Try exact match first
 	if proc, ok := pm.socketMap[socket]; ok {
-		return &proc
+		return proc, true
 	}
 
-	// Try with wildcard IP (for listening sockets)
+	// Try with wildcard IP (for listening sockets), 0.0.0.0 (another form of
+	// wildcard) and :: for IPv6
 	wildcardSocket := socket
-	wildcardSocket.IP = "*"
-	if proc, ok := pm.socketMap[wildcardSocket]; ok {
-		return &proc
+	for _, ip := range []string{"*", "0.0.0.0", "::"} {
+		wildcardSocket.IP = ip
+		if proc, ok := pm.socketMap[wildcardSocket]; ok {
+			return proc, true
+		}
 	}
 
-	// Try with 0.0.0.0 (another form of wildcard)
-	wildcardSocket.IP = "0.0.0.0"
-	if proc, ok := pm.socketMap[wildcardSocket]; ok {
-		return &proc
-	}
+	return SocketInfo{}, false
+}
+
+// Unattributed tells why the connection is of no known process: its socket is unknown,
+// of a process whose /proc entry was unreadable, or of another network namespace if
+// its local IP is of none of the own interfaces
+func (pm *ProcessMonitor) Unattributed(conn Connection) UnattributedReason {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 
-	// Try with :: for IPv6
-	wildcardSocket.IP = "::"
-	if proc, ok := pm.socketMap[wildcardSocket]; ok {
-		return &proc
+	socket := conn.Local
+	if socket.Protocol == ProtoICMP && socket.Port != 0 {
+		if _, ok := pm.lookupSocket(socket); !ok {
+			socket.Port = 0
+		}
+	}
+	if proc, ok := pm.lookupSocket(socket); ok {
+		if proc.Name == "" {
+			return UnattributedDenied
+		}
+		return UnattributedNoSocket
+	}
+	if pm.localIPs != nil && !pm.localIPs[conn.Local.IP] {
+		return UnattributedNamespace
 	}
+	return UnattributedNoSocket
+}
+
+// Stats returns the self-metrics of the monitor
+func (pm *ProcessMonitor) Stats() MonitorStats {
+	pm.mu.RLock()
+	stats := pm.stats
+	pm.mu.RUnlock()
+
+	stats.Lookups = atomic.LoadUint64(&pm.lookups)
+	stats.Misses = atomic.LoadUint64(&pm.misses)
+	return stats
+}
+
+// GetTCPInfo returns the kernel measured quality of a TCP connection of the host, or
+// nil if unknown. The remote end is identified by its IP, not its resolved name.
+func (pm *ProcessMonitor) GetTCPInfo(conn Connection) *TCPInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 
+	if info, ok := pm.tcpInfos[conn]; ok {
+		return &info
+	}
 	return nil
 }
 
-// GetAllProcessSockets returns all current socket-to-process mappings
-func (pm *ProcessMonitor) GetAllProcessSockets() map[LocalSocket]ProcessInfo {
+// Connections returns the TCP connections of the host along with their kernel measured
+// quality, leaving the listening sockets out.
+func (pm *ProcessMonitor) Connections() map[Connection]TCPInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	conns := make(map[Connection]TCPInfo, len(pm.tcpInfos))
+	for conn, info := range pm.tcpInfos {
+		if conn.Remote.Port != 0 {
+			conns[conn] = info
+		}
+	}
+	return conns
+}
+
+// GetAllProcessSockets returns all current socket-to-process mappings along with the
+// states of the sockets
+func (pm *ProcessMonitor) GetAllProcessSockets() OpenSockets {
 	pm.mu.RLock()
 	defer pm.mu.RUnlock()
 
 	// Return a copy to avoid race conditions
-	result := make(map[LocalSocket]ProcessInfo)
+	result := make(OpenSockets)
 	for k, v := range pm.socketMap {
 		result[k] = v
 	}
@@ -0,0 +1,117 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMonitorUpdateOwners(t *testing.T) {
+	pm := NewProcessMonitor(time.Second)
+	curl := ProcessInfo{Pid: 100, Name: "curl"}
+	wget := ProcessInfo{Pid: 200, Name: "wget"}
+
+	local := LocalSocket{IP: "10.0.0.1", Port: 40000, Protocol: ProtoTCP}
+	first := Connection{Local: local, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}
+	second := Connection{Local: local, Remote: RemoteSocket{IP: "8.8.8.8", Port: 443}}
+
+	now := time.Now()
+	pm.connOwners = pm.updateOwners(map[Connection]socketCookie{first: {cookie: 1, inode: 10}}, map[uint32]ProcessInfo{10: curl}, now)
+	assert.Equal(t, curl, pm.connOwners[first].proc)
+
+	// the inode is gone but the socket is the same
+	now = now.Add(time.Second)
+	pm.connOwners = pm.updateOwners(map[Connection]socketCookie{first: {cookie: 1, inode: 10}}, nil, now)
+	assert.Equal(t, curl, pm.connOwners[first].proc)
+
+	// the local port is reused by another process, the closed connection lingers
+	now = now.Add(time.Second)
+	pm.connOwners = pm.updateOwners(map[Connection]socketCookie{second: {cookie: 2, inode: 20}}, map[uint32]ProcessInfo{20: wget}, now)
+	assert.Equal(t, &curl, pm.GetConnectionProcess(first))
+	assert.Equal(t, &wget, pm.GetConnectionProcess(second))
+
+	now = now.Add(socketLinger)
+	pm.connOwners = pm.updateOwners(map[Connection]socketCookie{second: {cookie: 2, inode: 20}}, map[uint32]ProcessInfo{20: wget}, now)
+	assert.Nil(t, pm.GetConnectionProcess(first))
+
+	// a new socket of the same connection is not the old one
+	pm.connOwners = pm.updateOwners(map[Connection]socketCookie{second: {cookie: 3, inode: 30}}, nil, now)
+	_, ok := pm.connOwners[second]
+	assert.False(t, ok)
+}
+
+func TestProcessMonitorUnattributed(t *testing.T) {
+	pm := NewProcessMonitor(time.Second)
+	pm.localIPs = map[string]bool{"10.0.0.1": true}
+	pm.socketMap = OpenSockets{
+		{IP: "10.0.0.1", Port: 40000, Protocol: ProtoTCP}: {UID: 1000},
+		{IP: "*", Port: 53, Protocol: ProtoUDP}:           {ProcessInfo: ProcessInfo{Pid: 100, Name: "dnsmasq"}, UID: 0},
+	}
+	conn := func(ip string, port uint16) Connection {
+		return Connection{Local: LocalSocket{IP: ip, Port: port, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}
+	}
+
+	assert.Equal(t, UnattributedDenied, pm.Unattributed(conn("10.0.0.1", 40000)))
+	assert.Equal(t, UnattributedNoSocket, pm.Unattributed(conn("10.0.0.1", 40001)))
+	assert.Equal(t, UnattributedNamespace, pm.Unattributed(conn("172.17.0.2", 40000)))
+
+	// the namespaces are unknown without the own IPs
+	pm.localIPs = nil
+	assert.Equal(t, UnattributedNoSocket, pm.Unattributed(conn("172.17.0.2", 40000)))
+}
+
+func TestNextInterval(t *testing.T) {
+	min, max := time.Second, 8*time.Second
+
+	assert.Equal(t, 2*time.Second, nextInterval(4*time.Second, min, max, 100, 20, true))
+	assert.Equal(t, min, nextInterval(time.Second, min, max, 100, 20, false))
+	assert.Equal(t, 6*time.Second, nextInterval(4*time.Second, min, max, 100, 5, false))
+	assert.Equal(t, max, nextInterval(6*time.Second, min, max, 0, 0, false))
+	assert.Equal(t, 4*time.Second, nextInterval(4*time.Second, min, max, 100, 5, true))
+	assert.Equal(t, min, nextInterval(100*time.Millisecond, min, max, 0, 0, true))
+}
+
+func TestSameSockets(t *testing.T) {
+	socket := LocalSocket{IP: "10.0.0.1", Port: 40000, Protocol: ProtoTCP}
+	curl := OpenSockets{socket: {ProcessInfo: ProcessInfo{Pid: 100, Name: "curl"}, State: StateEstablished}}
+
+	assert.True(t, sameSockets(curl, OpenSockets{socket: {ProcessInfo: ProcessInfo{Pid: 100, Name: "curl"}, State: StateEstablished}}))
+	assert.False(t, sameSockets(curl, OpenSockets{socket: {ProcessInfo: ProcessInfo{Pid: 200, Name: "wget"}, State: StateEstablished}}))
+	assert.False(t, sameSockets(curl, OpenSockets{}))
+}
+
+func TestParseProcStarted(t *testing.T) {
+	// the command name may hold spaces and parentheses
+	stat := []byte("4242 (my (odd) cmd) S 1 4242 4242 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 98765 1000 10 0 0 0")
+	started, err := parseProcStarted(stat)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(98765), started)
+
+	_, err = parseProcStarted([]byte("4242 (cmd) S 1"))
+	assert.Error(t, err)
+}
+
+func TestChangedProc(t *testing.T) {
+	pm := NewProcessMonitor(time.Second)
+	pid := int32(os.Getpid())
+	ps, err := pm.scanProc(pid)
+	if err != nil {
+		t.Skip(err)
+	}
+	assert.False(t, changedProc(pid, ps))
+
+	// another process reusing the pid starts later
+	reused := ps
+	reused.started++
+	assert.True(t, changedProc(pid, reused))
+
+	// the process executing another program keeps its pid and start time
+	executed := ps
+	executed.info.Name = "other"
+	assert.True(t, changedProc(pid, executed))
+}
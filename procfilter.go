@@ -0,0 +1,54 @@
+package sniffer
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// procFilter restricts the processes whose sockets are looked up to the given pids
+// and the ones whose name matches the given patterns. Nil allows every process.
+type procFilter struct {
+	pids  map[int32]bool
+	names []string
+}
+
+// newProcFilter returns the filter of the pids and name patterns, the patterns being
+// those of filepath.Match, or nil if both are empty.
+func newProcFilter(pids []int, names []string) (*procFilter, error) {
+	if len(pids) == 0 && len(names) == 0 {
+		return nil, nil
+	}
+
+	f := &procFilter{pids: make(map[int32]bool, len(pids))}
+	for _, pid := range pids {
+		if pid <= 0 {
+			return nil, fmt.Errorf("invalid pid %d", pid)
+		}
+		f.pids[int32(pid)] = true
+	}
+	for _, name := range names {
+		if _, err := filepath.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("invalid process name pattern %q", name)
+		}
+		f.names = append(f.names, name)
+	}
+	return f, nil
+}
+
+// skipPid reports whether the process is filtered out whatever its name.
+func (f *procFilter) skipPid(pid int32) bool {
+	return f != nil && len(f.names) == 0 && !f.pids[pid]
+}
+
+// allow reports whether the sockets of the process are looked up.
+func (f *procFilter) allow(pid int32, name string) bool {
+	if f == nil || f.pids[pid] {
+		return true
+	}
+	for _, pattern := range f.names {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcFilter(t *testing.T) {
+	f, err := newProcFilter(nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+	assert.True(t, f.allow(1, "init"))
+	assert.False(t, f.skipPid(1))
+
+	f, err = newProcFilter([]int{42}, nil)
+	assert.NoError(t, err)
+	assert.False(t, f.skipPid(42))
+	assert.True(t, f.skipPid(43))
+
+	f, err = newProcFilter([]int{42}, []string{"nginx*", "redis-server"})
+	assert.NoError(t, err)
+	assert.False(t, f.skipPid(43))
+	assert.True(t, f.allow(42, "curl"))
+	assert.True(t, f.allow(43, "nginx-worker"))
+	assert.True(t, f.allow(44, "redis-server"))
+	assert.False(t, f.allow(45, "redis-cli"))
+
+	_, err = newProcFilter([]int{-1}, nil)
+	assert.Error(t, err)
+	_, err = newProcFilter(nil, []string{"["})
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package sniffer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// procNetSocket is a socket listed in a /proc/net table, like tcp, udp, raw and icmp.
+type procNetSocket struct {
+	LocalIP    string
+	LocalPort  uint16
+	RemoteIP   string
+	RemotePort uint16
+	State      uint8
+	UID        uint32
+	Inode      uint32
+}
+
+// parseProcNetAddr parses an address of a /proc/net table, the IP printed in hex as
+// 32-bit words in the byte order of the host and the port as a hex number.
+func parseProcNetAddr(s string, order binary.ByteOrder) (string, uint16, error) {
+	colon := strings.IndexByte(s, ':')
+	if colon < 0 {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	raw, err := hex.DecodeString(s[:colon])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+	port, err := strconv.ParseUint(s[colon+1:], 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid address %q", s)
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		order.PutUint32(ip[i:], binary.BigEndian.Uint32(raw[i:]))
+	}
+	return ip.String(), uint16(port), nil
+}
+
+// parseProcNet parses a /proc/net socket table, the lines failing to parse are skipped.
+func parseProcNet(r io.Reader, order binary.ByteOrder) ([]procNetSocket, error) {
+	var sockets []procNetSocket
+	scanner := bufio.NewScanner(r)
+
+	// the header line goes first
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		var sock procNetSocket
+		var err error
+		if sock.LocalIP, sock.LocalPort, err = parseProcNetAddr(fields[1], order); err != nil {
+			continue
+		}
+		if sock.RemoteIP, sock.RemotePort, err = parseProcNetAddr(fields[2], order); err != nil {
+			continue
+		}
+		state, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			continue
+		}
+		uid, err := strconv.ParseUint(fields[7], 10, 32)
+		if err != nil {
+			continue
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 32)
+		if err != nil {
+			continue
+		}
+		sock.State, sock.UID, sock.Inode = uint8(state), uint32(uid), uint32(inode)
+		sockets = append(sockets, sock)
+	}
+	return sockets, scanner.Err()
+}
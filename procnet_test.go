@@ -0,0 +1,35 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcNet(t *testing.T) {
+	table := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  12: 00000000:0003 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 41265 2 0000000000000000 0
+  13: 0100007F:2F6A 0100007F:01BB 01 00000000:00000000 00:00000000 00000000  1000        0 52013 1 0000000000000000 0
+  14: broken
+`
+	sockets, err := parseProcNet(strings.NewReader(table), binary.LittleEndian)
+	assert.NoError(t, err)
+	assert.Equal(t, []procNetSocket{
+		{LocalIP: "0.0.0.0", LocalPort: 3, RemoteIP: "0.0.0.0", State: 7, Inode: 41265},
+		{LocalIP: "127.0.0.1", LocalPort: 12138, RemoteIP: "127.0.0.1", RemotePort: 443, State: 1, UID: 1000, Inode: 52013},
+	}, sockets)
+
+	ip, port, err := parseProcNetAddr("0000000000000000FFFF00000100007F:0035", binary.LittleEndian)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip)
+	assert.Equal(t, uint16(53), port)
+
+	ip, _, err = parseProcNetAddr("B80D0120000000000000000001000000:0050", binary.LittleEndian)
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", ip)
+
+	_, _, err = parseProcNetAddr("0100007F", binary.LittleEndian)
+	assert.Error(t, err)
+}
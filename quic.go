@@ -0,0 +1,256 @@
+package sniffer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// quicPort is the UDP port QUIC is recognized on.
+const quicPort = 443
+
+const (
+	quicVersion1 = 0x00000001
+	quicVersion2 = 0x6b3343cf
+
+	quicFramePadding         = 0x00
+	quicFramePing            = 0x01
+	quicFrameACK             = 0x02
+	quicFrameACKECN          = 0x03
+	quicFrameCrypto          = 0x06
+	quicFrameConnectionClose = 0x1c
+)
+
+// quicMaxCrypto bounds the CRYPTO stream buffered while waiting for the rest of a
+// ClientHello spanning several Initial packets.
+const quicMaxCrypto = 16 << 10
+
+// quicInitialParams are the version specific parameters of the Initial packet
+// protection, see RFC 9001 and RFC 9369.
+type quicInitialParams struct {
+	packetType byte
+	salt       []byte
+	label      string
+}
+
+var quicVersions = map[uint32]quicInitialParams{
+	quicVersion1: {
+		packetType: 0,
+		salt: []byte{
+			0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+			0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+		},
+		label: "quic",
+	},
+	quicVersion2: {
+		packetType: 1,
+		salt: []byte{
+			0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+			0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9,
+		},
+		label: "quicv2",
+	},
+}
+
+// varint reads a QUIC variable-length integer.
+func (r *tlsReader) varint() uint64 {
+	if len(*r) == 0 {
+		return 0
+	}
+	n := 1 << ((*r)[0] >> 6)
+	b := r.next(n)
+	if len(b) < n {
+		return 0
+	}
+
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// hkdfExtract is HKDF-Extract with SHA-256.
+func hkdfExtract(salt, secret []byte) []byte {
+	h := hmac.New(sha256.New, salt)
+	h.Write(secret)
+	return h.Sum(nil)
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label of TLS 1.3 with an empty context, the output is
+// at most one SHA-256 block long.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	info := []byte{byte(length >> 8), byte(length), byte(len("tls13 ") + len(label))}
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0, 1) // empty context, first block
+
+	h := hmac.New(sha256.New, secret)
+	h.Write(info)
+	return h.Sum(nil)[:length]
+}
+
+// quicInitialKeys derives the key, IV and header protection key protecting the client
+// Initial packets sent to the given destination connection ID.
+func quicInitialKeys(params quicInitialParams, dcid []byte) (key, iv, hp []byte) {
+	secret := hkdfExpandLabel(hkdfExtract(params.salt, dcid), "client in", sha256.Size)
+	key = hkdfExpandLabel(secret, params.label+" key", 16)
+	iv = hkdfExpandLabel(secret, params.label+" iv", 12)
+	hp = hkdfExpandLabel(secret, params.label+" hp", 16)
+	return key, iv, hp
+}
+
+// openQUICInitial removes the protection of the client Initial packet at the beginning
+// of a UDP datagram and returns its frames, nil if the datagram doesn't start with one.
+func openQUICInitial(data []byte) []byte {
+	// long header with the fixed bit set
+	if len(data) < 7 || data[0]&0xc0 != 0xc0 {
+		return nil
+	}
+	params, ok := quicVersions[binary.BigEndian.Uint32(data[1:5])]
+	if !ok || (data[0]>>4)&0x03 != params.packetType {
+		return nil
+	}
+
+	r := tlsReader(data[5:])
+	dcid := r.next(int(r.uint8()))
+	r.next(int(r.uint8()))  // source connection id
+	r.next(int(r.varint())) // token
+	length := r.varint()
+	pnOffset := len(data) - len(r)
+
+	// the header protection sample starts 4 bytes after the packet number
+	if len(dcid) == 0 || length < 4+16 || length > uint64(len(r)) {
+		return nil
+	}
+	key, iv, hp := quicInitialKeys(params, dcid)
+
+	block, err := aes.NewCipher(hp)
+	if err != nil {
+		return nil
+	}
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, data[pnOffset+4:pnOffset+4+16])
+
+	// the captured packet is left untouched
+	header := make([]byte, pnOffset+4)
+	copy(header, data)
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+	header = header[:pnOffset+pnLen]
+
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOffset+i])
+	}
+	for i := 0; i < 8; i++ {
+		iv[len(iv)-1-i] ^= byte(pn >> (8 * i))
+	}
+
+	if block, err = aes.NewCipher(key); err != nil {
+		return nil
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil
+	}
+	plain, err := aead.Open(nil, iv, data[pnOffset+pnLen:pnOffset+int(length)], header)
+	if err != nil {
+		return nil
+	}
+	return plain
+}
+
+// quicCryptoFrame is a chunk of the CRYPTO stream.
+type quicCryptoFrame struct {
+	offset uint64
+	data   []byte
+}
+
+// parseQUICCryptoFrames returns the CRYPTO frames of an Initial packet's payload, the
+// other frames allowed in Initial packets are skipped.
+func parseQUICCryptoFrames(plain []byte) []quicCryptoFrame {
+	var frames []quicCryptoFrame
+	r := tlsReader(plain)
+	for len(r) > 0 {
+		switch frameType := r.varint(); frameType {
+		case quicFramePadding, quicFramePing:
+		case quicFrameACK, quicFrameACKECN:
+			r.varint() // largest acknowledged
+			r.varint() // ack delay
+			ranges := r.varint()
+			r.varint() // first ack range
+			for i := uint64(0); i < ranges && len(r) > 0; i++ {
+				r.varint() // gap
+				r.varint() // ack range length
+			}
+			if frameType == quicFrameACKECN {
+				// ECN counts
+				r.varint()
+				r.varint()
+				r.varint()
+			}
+		case quicFrameCrypto:
+			offset := r.varint()
+			length := r.varint()
+			if length > uint64(len(r)) {
+				return frames
+			}
+			frames = append(frames, quicCryptoFrame{offset: offset, data: r.next(int(length))})
+		case quicFrameConnectionClose:
+			r.varint() // error code
+			r.varint() // frame type
+			r.next(int(r.varint()))
+		default:
+			return frames
+		}
+	}
+	return frames
+}
+
+// quicCrypto reassembles the CRYPTO stream of the client Initial packets of a connection.
+type quicCrypto struct {
+	stream  []byte
+	pending []quicCryptoFrame
+}
+
+// Add appends the frames to the stream and returns the ClientHello once the stream
+// holds all of it.
+func (c *quicCrypto) Add(frames []quicCryptoFrame) *clientHello {
+	for _, f := range frames {
+		if f.offset+uint64(len(f.data)) <= quicMaxCrypto {
+			c.pending = append(c.pending, f)
+		}
+	}
+
+	// frames may arrive out of order or overlap when retransmitted
+	for progress := true; progress; {
+		progress = false
+		for i := 0; i < len(c.pending); i++ {
+			f := c.pending[i]
+			size := uint64(len(c.stream))
+			if f.offset > size {
+				continue
+			}
+			if end := f.offset + uint64(len(f.data)); end > size {
+				c.stream = append(c.stream, f.data[size-f.offset:]...)
+				progress = true
+			}
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			i--
+		}
+	}
+
+	// handshake header: type(1) length(3)
+	if len(c.stream) < 4 {
+		return nil
+	}
+	size := 4 + (int(c.stream[1])<<16 | int(c.stream[2])<<8 | int(c.stream[3]))
+	if len(c.stream) < size {
+		return nil
+	}
+	return parseHandshakeClientHello(c.stream[:size])
+}
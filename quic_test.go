@@ -0,0 +1,73 @@
+package sniffer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/tls"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQUICInitialKeys(t *testing.T) {
+	// RFC 9001, Appendix A.1
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	key, iv, hp := quicInitialKeys(quicVersions[quicVersion1], dcid)
+	assert.Equal(t, "1f369613dd76d5467730efcbe3b1a22d", hex.EncodeToString(key))
+	assert.Equal(t, "fa044b2f42a3fd3b46fb255c", hex.EncodeToString(iv))
+	assert.Equal(t, "9f50449e04a0e810283a1e9933adedd2", hex.EncodeToString(hp))
+}
+
+// sealQUICInitial protects a QUIC v1 client Initial packet carrying the given frames.
+func sealQUICInitial(dcid []byte, pn byte, frames []byte) []byte {
+	key, iv, hp := quicInitialKeys(quicVersions[quicVersion1], dcid)
+	iv[len(iv)-1] ^= pn
+
+	header := []byte{0xc0, 0, 0, 0, 1, byte(len(dcid))}
+	header = append(header, dcid...)
+	header = append(header, 0, 0) // source connection id, token
+	length := 1 + len(frames) + 16
+	header = append(header, 0x40|byte(length>>8), byte(length), pn)
+
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	packet := aead.Seal(append([]byte{}, header...), iv, frames, header)
+
+	pnOffset := len(header) - 1
+	mask := make([]byte, aes.BlockSize)
+	block, _ = aes.NewCipher(hp)
+	block.Encrypt(mask, packet[pnOffset+4:])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	return packet
+}
+
+func cryptoFrame(offset int, data []byte) []byte {
+	frame := []byte{quicFrameCrypto, 0x40 | byte(offset>>8), byte(offset), 0x40 | byte(len(data)>>8), byte(len(data))}
+	return append(frame, data...)
+}
+
+func TestQUICClientHello(t *testing.T) {
+	record := captureClientHello(t, &tls.Config{ServerName: "example.com"})
+	msg := record[5:]
+	dcid := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	// the ClientHello is split over two packets, the second one arriving first
+	half := len(msg) / 2
+	second := sealQUICInitial(dcid, 1, append(cryptoFrame(half, msg[half:]), make([]byte, 32)...))
+	first := sealQUICInitial(dcid, 0, append([]byte{quicFramePing}, cryptoFrame(0, msg[:half])...))
+
+	flow := &flowState{}
+	inspectQUICUpload(flow, second)
+	assert.Equal(t, AppProtoQUIC, flow.ApplicationProtocol)
+	assert.Equal(t, "", flow.ServerName)
+
+	inspectQUICUpload(flow, first)
+	assert.Equal(t, "example.com", flow.ServerName)
+	assert.Equal(t, "q", flow.JA4[:1])
+
+	// a corrupted packet fails authentication
+	first[len(first)-1] ^= 1
+	assert.Nil(t, openQUICInitial(first))
+}
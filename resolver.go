@@ -0,0 +1,164 @@
+package sniffer
+
+import (
+	"context"
+	"sync"
+)
+
+// ProcessResolver attributes the connections of the host to their processes, the
+// capture looking the process of each segment up as it goes.
+type ProcessResolver interface {
+	// Refresh updates the sockets of the processes ahead of a snapshot, giving up once
+	// the context is done. The resolvers keeping up on their own do nothing.
+	Refresh(ctx context.Context) error
+
+	// Resolve returns the process of the connection, whose remote end is identified by
+	// its IP, or nil if unknown.
+	Resolve(conn Connection) *ProcessInfo
+
+	// Close stops the resolver.
+	Close()
+}
+
+// tcpInfoResolver is a ProcessResolver knowing the kernel measured quality of the TCP
+// connections of the host.
+type tcpInfoResolver interface {
+	GetTCPInfo(conn Connection) *TCPInfo
+}
+
+// connectionLister is a ProcessResolver listing the TCP connections of the host along
+// with their kernel measured quality, which stand in for the capture when degraded.
+type connectionLister interface {
+	Connections() map[Connection]TCPInfo
+}
+
+// monitorStatsResolver is a ProcessResolver reporting its self-metrics.
+type monitorStatsResolver interface {
+	Stats() MonitorStats
+}
+
+// UnattributedReason tells why the traffic of a connection is attributed to no process.
+type UnattributedReason string
+
+const (
+	// UnattributedNoSocket is the traffic of no socket the resolver knows, e.g. of the
+	// sockets opened and closed between its refreshes.
+	UnattributedNoSocket UnattributedReason = "no socket"
+	// UnattributedDenied is the traffic of a socket whose process can't be told
+	// without the privileges to read its /proc entry, named after its user if known.
+	UnattributedDenied UnattributedReason = "permission denied"
+	// UnattributedNamespace is the traffic of a local IP of another network namespace
+	// whose sockets can't be listed, e.g. of a container.
+	UnattributedNamespace UnattributedReason = "other namespace"
+)
+
+// UnattributedReasons are the reasons in the order they are reported.
+var UnattributedReasons = []UnattributedReason{UnattributedNoSocket, UnattributedDenied, UnattributedNamespace}
+
+// unattributedResolver is a ProcessResolver telling why it resolves no process of a
+// connection, the segments of the rest being of no socket.
+type unattributedResolver interface {
+	Unattributed(conn Connection) UnattributedReason
+}
+
+// socketResolver resolves the processes by the local sockets of the connections from
+// the sockets a SocketFetcher lists on each refresh.
+type socketResolver struct {
+	fetcher SocketFetcher
+
+	mu      sync.RWMutex
+	sockets OpenSockets
+}
+
+func newSocketResolver(fetcher SocketFetcher) *socketResolver {
+	return &socketResolver{fetcher: fetcher, sockets: make(OpenSockets)}
+}
+
+// Refresh lists the open sockets, keeping the previous ones if it fails.
+func (r *socketResolver) Refresh(ctx context.Context) error {
+	sockets, err := r.fetcher.GetOpenSockets(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.sockets = sockets
+	r.mu.Unlock()
+	return nil
+}
+
+// Resolve returns the process of the local socket of the connection, or of the socket
+// bound to every IP on its port.
+func (r *socketResolver) Resolve(conn Connection) *ProcessInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, ip := range []string{conn.Local.IP, "*"} {
+		socket := conn.Local
+		socket.IP = ip
+		if info, ok := r.sockets[socket]; ok {
+			owner := info.Owner()
+			return &owner
+		}
+	}
+	return nil
+}
+
+// Unattributed tells whether the local socket of the connection is unknown or of an
+// unknown process.
+func (r *socketResolver) Unattributed(conn Connection) UnattributedReason {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, ip := range []string{conn.Local.IP, "*"} {
+		socket := conn.Local
+		socket.IP = ip
+		if info, ok := r.sockets[socket]; ok && info.Name == "" {
+			return UnattributedDenied
+		}
+	}
+	return UnattributedNoSocket
+}
+
+func (r *socketResolver) Close() {}
+
+// nopResolver resolves no process, the capture telling the processes of the packets.
+type nopResolver struct{}
+
+func (nopResolver) Refresh(ctx context.Context) error    { return nil }
+func (nopResolver) Resolve(conn Connection) *ProcessInfo { return nil }
+func (nopResolver) Close()                               {}
+
+// resolveProcess looks the process of the segment up, by the connection keyed by the
+// IPs ahead of the remote IP being named after the lookups of the process. The kernel
+// measures the TCP connections of the host on top, with the resolvers knowing it.
+func (c *PcapClient) resolveProcess(seg *Segment, srcIP, dstIP string, srcPort, dstPort uint16) {
+	if c.resolver == nil {
+		return
+	}
+
+	conn := Connection{Local: seg.Connection.Local, Remote: RemoteSocket{IP: dstIP, Port: dstPort}}
+	if seg.Direction == DirectionDownload {
+		conn.Remote = RemoteSocket{IP: srcIP, Port: srcPort}
+	}
+	seg.Process = c.resolver.Resolve(conn)
+	if seg.Process == nil || seg.Process.Pid == 0 {
+		seg.Unattributed = UnattributedNoSocket
+		if r, ok := c.resolver.(unattributedResolver); ok {
+			seg.Unattributed = r.Unattributed(conn)
+		}
+	}
+	if r, ok := c.resolver.(tcpInfoResolver); ok && conn.Local.Protocol == ProtoTCP {
+		seg.KernelTCP = r.GetTCPInfo(conn)
+	}
+}
+
+// MonitorStats returns the self-metrics of the process resolver, nil if it has none.
+func (c *PcapClient) MonitorStats() *MonitorStats {
+	r, ok := c.resolver.(monitorStatsResolver)
+	if !ok {
+		return nil
+	}
+	stats := r.Stats()
+	return &stats
+}
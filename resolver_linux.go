@@ -0,0 +1,29 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+// NewProcessResolver starts a ProcessMonitor resolving the processes as configured.
+func NewProcessResolver(opt Options) (ProcessResolver, error) {
+	interval := opt.ProcessRefreshMin
+	if interval <= 0 {
+		interval = defaultRefreshMin
+	}
+
+	pm := NewProcessMonitor(interval)
+	pm.SetRefreshBounds(opt.ProcessRefreshMin, opt.ProcessRefreshMax)
+	pm.SetSockDiagTimeout(opt.SockDiagTimeout)
+	pm.SetOwnNetnsOnly(opt.User != "")
+	if err := pm.SetProcessFilter(opt.Pids, opt.ProcessNames); err != nil {
+		return nil, err
+	}
+	if err := pm.SetSocketStates(opt.SocketStates); err != nil {
+		return nil, err
+	}
+
+	if err := pm.Start(); err != nil {
+		pm.Stop()
+		return nil, err
+	}
+	return pm, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package sniffer
+
+// NewProcessResolver returns a resolver of the processes from the sockets the
+// SocketFetcher of the platform lists on each refresh, or none if the pktap capture
+// tells them.
+func NewProcessResolver(opt Options) (ProcessResolver, error) {
+	if opt.Pktap {
+		return nopResolver{}, nil
+	}
+	return newSocketResolver(GetSocketFetcher()), nil
+}
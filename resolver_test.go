@@ -0,0 +1,46 @@
+package sniffer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticFetcher struct {
+	sockets OpenSockets
+	err     error
+}
+
+func (f *staticFetcher) GetOpenSockets(context.Context) (OpenSockets, error) {
+	return f.sockets, f.err
+}
+
+func TestSocketResolver(t *testing.T) {
+	curl := ProcessInfo{Pid: 100, Name: "curl", Container: containerOf(100)}
+	nginx := ProcessInfo{Pid: 200, Name: "nginx", Container: containerOf(200)}
+	fetcher := &staticFetcher{sockets: OpenSockets{
+		{IP: "10.0.0.1", Port: 40000, Protocol: ProtoTCP}: {ProcessInfo: curl, UID: -1},
+		{IP: "*", Port: 53, Protocol: ProtoUDP}:           {ProcessInfo: nginx, UID: -1},
+		{IP: "10.0.0.1", Port: 40001, Protocol: ProtoTCP}: {UID: 1000},
+	}}
+	r := newSocketResolver(fetcher)
+	conn := func(port uint16, proto Protocol) Connection {
+		return Connection{Local: LocalSocket{IP: "10.0.0.1", Port: port, Protocol: proto}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}
+	}
+
+	assert.Nil(t, r.Resolve(conn(40000, ProtoTCP)))
+	assert.NoError(t, r.Refresh(context.Background()))
+	assert.Equal(t, &curl, r.Resolve(conn(40000, ProtoTCP)))
+	assert.Equal(t, &nginx, r.Resolve(conn(53, ProtoUDP)))
+	assert.Nil(t, r.Resolve(conn(53, ProtoTCP)))
+	assert.Equal(t, &ProcessInfo{Name: "uid 1000", User: userName(1000)}, r.Resolve(conn(40001, ProtoTCP)))
+	assert.Equal(t, UnattributedDenied, r.Unattributed(conn(40001, ProtoTCP)))
+	assert.Equal(t, UnattributedNoSocket, r.Unattributed(conn(53, ProtoTCP)))
+
+	// the sockets listed before stay on failures
+	fetcher.sockets, fetcher.err = nil, errors.New("lsof failed")
+	assert.Error(t, r.Refresh(context.Background()))
+	assert.Equal(t, &curl, r.Resolve(conn(40000, ProtoTCP)))
+}
@@ -0,0 +1,115 @@
+//go:build windows
+// +build windows
+
+package sniffer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// etwLinger is how long a socket told by ETW keeps its process once seen last.
+const etwLinger = 10 * time.Second
+
+type etwSocket struct {
+	pid  uint32
+	seen time.Time
+}
+
+// etwResolver supplements the polled sockets with the sockets the Kernel-Network ETW
+// provider tells as they're used, attributing the connections too short-lived to make
+// it into a poll of the connection tables.
+type etwResolver struct {
+	*socketResolver
+	session *etwSession
+	ps      *psutilConn
+
+	mu      sync.RWMutex
+	sockets map[LocalSocket]etwSocket
+	names   map[uint32]ProcessInfo
+}
+
+// NewProcessResolver returns a resolver of the processes from the sockets polled on
+// each refresh, along with the sockets told by ETW if the session starts, e.g. run
+// as an administrator.
+func NewProcessResolver(opt Options) (ProcessResolver, error) {
+	ps := &psutilConn{}
+	r := &etwResolver{
+		socketResolver: newSocketResolver(ps),
+		ps:             ps,
+		sockets:        make(map[LocalSocket]etwSocket),
+		names:          make(map[uint32]ProcessInfo),
+	}
+
+	session, err := startETW(r.observe)
+	if err != nil {
+		return r.socketResolver, nil
+	}
+	r.session = session
+	return r, nil
+}
+
+// observe records the process of the socket, naming the process while it's alive.
+func (r *etwResolver) observe(socket LocalSocket, pid uint32) {
+	r.mu.RLock()
+	_, named := r.names[pid]
+	r.mu.RUnlock()
+
+	var info ProcessInfo
+	if !named {
+		info = r.ps.getProcName(context.Background(), int32(pid))
+	}
+
+	r.mu.Lock()
+	r.sockets[socket] = etwSocket{pid: pid, seen: time.Now()}
+	if !named {
+		r.names[pid] = info
+	}
+	r.mu.Unlock()
+}
+
+// Refresh polls the open sockets and forgets the sockets ETW hasn't told of lately.
+func (r *etwResolver) Refresh(ctx context.Context) error {
+	err := r.socketResolver.Refresh(ctx)
+
+	deadline := time.Now().Add(-etwLinger)
+	r.mu.Lock()
+	pids := make(map[uint32]bool)
+	for socket, s := range r.sockets {
+		if s.seen.Before(deadline) {
+			delete(r.sockets, socket)
+			continue
+		}
+		pids[s.pid] = true
+	}
+	for pid := range r.names {
+		if !pids[pid] {
+			delete(r.names, pid)
+		}
+	}
+	r.mu.Unlock()
+	return err
+}
+
+// Resolve returns the process of the polled socket of the connection, or else of the
+// socket told by ETW.
+func (r *etwResolver) Resolve(conn Connection) *ProcessInfo {
+	if info := r.socketResolver.Resolve(conn); info != nil {
+		return info
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sockets[conn.Local]
+	if !ok {
+		return nil
+	}
+	info := r.names[s.pid]
+	return &info
+}
+
+func (r *etwResolver) Close() {
+	r.session.Close()
+}
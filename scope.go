@@ -0,0 +1,65 @@
+package sniffer
+
+import (
+	"fmt"
+	"net"
+)
+
+// Scope tells whether the remote end of a connection is on the local network or
+// out on the internet.
+type Scope uint8
+
+const (
+	ScopeInternet Scope = iota
+	ScopeLocal
+)
+
+func (s Scope) String() string {
+	if s == ScopeLocal {
+		return "local"
+	}
+	return "internet"
+}
+
+// DefaultLocalSubnets are the private and link-local ranges of RFC 1918, RFC 3927,
+// RFC 4193 and RFC 4291.
+var DefaultLocalSubnets = []string{
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"169.254.0.0/16",
+	"fc00::/7",
+	"fe80::/10",
+}
+
+type subnets []*net.IPNet
+
+func parseSubnets(cidrs []string) (subnets, error) {
+	var nets subnets
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local subnet %q", cidr)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// scopeOf returns the scope of the remote IP, the loopback, multicast and broadcast
+// addresses never leave the local network.
+func (s subnets) scopeOf(ip string) Scope {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ScopeInternet
+	}
+	if parsed.IsLoopback() || parsed.IsMulticast() || parsed.Equal(net.IPv4bcast) {
+		return ScopeLocal
+	}
+	for _, ipNet := range s {
+		if ipNet.Contains(parsed) {
+			return ScopeLocal
+		}
+	}
+	return ScopeInternet
+}
@@ -0,0 +1,25 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeOf(t *testing.T) {
+	nets, err := parseSubnets(DefaultLocalSubnets)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ScopeLocal, nets.scopeOf("192.168.1.20"))
+	assert.Equal(t, ScopeLocal, nets.scopeOf("172.20.0.1"))
+	assert.Equal(t, ScopeLocal, nets.scopeOf("fd12:3456::1"))
+	assert.Equal(t, ScopeLocal, nets.scopeOf("127.0.0.1"))
+	assert.Equal(t, ScopeLocal, nets.scopeOf("224.0.0.251"))
+	assert.Equal(t, ScopeLocal, nets.scopeOf("255.255.255.255"))
+	assert.Equal(t, ScopeInternet, nets.scopeOf("172.32.0.1"))
+	assert.Equal(t, ScopeInternet, nets.scopeOf("2001:4860:4860::8888"))
+	assert.Equal(t, ScopeInternet, nets.scopeOf("example.com"))
+
+	_, err = parseSubnets([]string{"10.0.0.0"})
+	assert.Error(t, err)
+}
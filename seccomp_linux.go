@@ -0,0 +1,102 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package sniffer
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// The constants of linux/seccomp.h.
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+	seccompRetAllow        = 0x7fff0000
+	seccompRetErrno        = 0x00050000
+)
+
+// seccompSyscalls are the syscalls of the capture, the netlink dumps, the DNS lookups,
+// the UI, the history store and the Go runtime, along with the ones of the architecture.
+var seccompSyscalls = []uintptr{
+	// files, memory and signals
+	unix.SYS_READ, unix.SYS_WRITE, unix.SYS_READV, unix.SYS_WRITEV, unix.SYS_PREAD64,
+	unix.SYS_PWRITE64, unix.SYS_CLOSE, unix.SYS_FSTAT, unix.SYS_LSEEK, unix.SYS_OPENAT,
+	unix.SYS_GETDENTS64, unix.SYS_READLINKAT, unix.SYS_FACCESSAT, unix.SYS_FACCESSAT2,
+	unix.SYS_STATX, unix.SYS_FSTATFS, unix.SYS_FCNTL, unix.SYS_DUP, unix.SYS_DUP3,
+	unix.SYS_PIPE2, unix.SYS_IOCTL, unix.SYS_MMAP, unix.SYS_MUNMAP, unix.SYS_MPROTECT,
+	unix.SYS_MADVISE, unix.SYS_MINCORE, unix.SYS_BRK, unix.SYS_RT_SIGACTION,
+	unix.SYS_RT_SIGPROCMASK, unix.SYS_RT_SIGRETURN, unix.SYS_SIGALTSTACK,
+	unix.SYS_RENAMEAT, unix.SYS_UNLINKAT, unix.SYS_MKDIRAT, unix.SYS_FLOCK, unix.SYS_FSYNC,
+	unix.SYS_FDATASYNC, unix.SYS_FTRUNCATE,
+
+	// threads, time and polling
+	unix.SYS_CLONE, unix.SYS_CLONE3, unix.SYS_SET_ROBUST_LIST, unix.SYS_RSEQ,
+	unix.SYS_FUTEX, unix.SYS_SCHED_YIELD, unix.SYS_SCHED_GETAFFINITY, unix.SYS_NANOSLEEP,
+	unix.SYS_CLOCK_GETTIME, unix.SYS_CLOCK_NANOSLEEP, unix.SYS_GETTIMEOFDAY,
+	unix.SYS_RESTART_SYSCALL, unix.SYS_MEMBARRIER, unix.SYS_EPOLL_CREATE1,
+	unix.SYS_EPOLL_CTL, unix.SYS_EPOLL_PWAIT, unix.SYS_EPOLL_PWAIT2, unix.SYS_EVENTFD2,
+	unix.SYS_PPOLL, unix.SYS_PSELECT6, unix.SYS_GETRANDOM, unix.SYS_EXIT,
+	unix.SYS_EXIT_GROUP, unix.SYS_TGKILL, unix.SYS_TKILL,
+
+	// process identity
+	unix.SYS_GETPID, unix.SYS_GETTID, unix.SYS_GETUID, unix.SYS_GETEUID, unix.SYS_GETGID,
+	unix.SYS_GETEGID, unix.SYS_UNAME, unix.SYS_PRLIMIT64,
+
+	// sockets, the sockets of the other network namespaces
+	unix.SYS_SOCKET, unix.SYS_CONNECT, unix.SYS_BIND, unix.SYS_SENDTO, unix.SYS_RECVFROM,
+	unix.SYS_SENDMSG, unix.SYS_RECVMSG, unix.SYS_SENDMMSG, unix.SYS_RECVMMSG,
+	unix.SYS_SETSOCKOPT, unix.SYS_GETSOCKOPT, unix.SYS_GETSOCKNAME, unix.SYS_GETPEERNAME,
+	unix.SYS_SHUTDOWN, unix.SYS_SETNS,
+}
+
+// seccompProgram returns the filter allowing the syscalls on the architecture, the
+// others failing with EPERM rather than killing the process.
+func seccompProgram(arch uint32, syscalls []uintptr) ([]bpf.RawInstruction, error) {
+	// the jumps skip at most 255 instructions
+	n := len(syscalls)
+	if n > 254 {
+		return nil, fmt.Errorf("too many syscalls to allow: %d", n)
+	}
+
+	prog := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: 4, Size: 4}, // seccomp_data.arch
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: arch, SkipFalse: uint8(n + 1)},
+		bpf.LoadAbsolute{Off: 0, Size: 4}, // seccomp_data.nr
+	}
+	for i, nr := range syscalls {
+		prog = append(prog, bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(nr), SkipTrue: uint8(n - i)})
+	}
+	prog = append(prog,
+		bpf.RetConstant{Val: seccompRetErrno | uint32(unix.EPERM)},
+		bpf.RetConstant{Val: seccompRetAllow},
+	)
+	return bpf.Assemble(prog)
+}
+
+// installSeccomp restricts every thread of the process to the syscalls the sniffer
+// takes once started, shrinking what's left to exploit of a sniffer run as root.
+func installSeccomp() error {
+	raw, err := seccompProgram(seccompArch, append(seccompSyscalls, seccompArchSyscalls...))
+	if err != nil {
+		return err
+	}
+	filter := make([]unix.SockFilter, len(raw))
+	for i, ins := range raw {
+		filter[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	// the filters are only installed unprivileged along with no_new_privs
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("seccomp: %w", errno)
+	}
+	return nil
+}
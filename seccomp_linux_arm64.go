@@ -0,0 +1,10 @@
+package sniffer
+
+import "golang.org/x/sys/unix"
+
+// seccompArch is AUDIT_ARCH_AARCH64.
+const seccompArch = 0xc00000b7
+
+var seccompArchSyscalls = []uintptr{
+	unix.SYS_FSTATAT,
+}
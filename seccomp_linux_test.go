@@ -0,0 +1,86 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package sniffer
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestSeccompProgram(t *testing.T) {
+	raw, err := seccompProgram(seccompArch, []uintptr{unix.SYS_READ, unix.SYS_WRITE})
+	assert.NoError(t, err)
+	prog, ok := bpf.Disassemble(raw)
+	assert.True(t, ok)
+	vm, err := bpf.NewVM(prog)
+	assert.NoError(t, err)
+
+	// the VM loads in network byte order, the kernel in the native one
+	run := func(nr, arch uint32) int {
+		data := make([]byte, 16)
+		binary.BigEndian.PutUint32(data, nr)
+		binary.BigEndian.PutUint32(data[4:], arch)
+		ret, err := vm.Run(data)
+		assert.NoError(t, err)
+		return ret
+	}
+	assert.Equal(t, seccompRetAllow, run(unix.SYS_READ, seccompArch))
+	assert.Equal(t, seccompRetAllow, run(unix.SYS_WRITE, seccompArch))
+	assert.Equal(t, seccompRetErrno|int(unix.EPERM), run(unix.SYS_PTRACE, seccompArch))
+	assert.Equal(t, seccompRetErrno|int(unix.EPERM), run(unix.SYS_READ, 0x40000003))
+
+	_, err = seccompProgram(seccompArch, make([]uintptr, 255))
+	assert.Error(t, err)
+}
+
+// TestSeccompRecorders opens the history store and the Parquet recorder of fresh
+// directories under the sandbox, in a process of its own as the filter can't be
+// removed once installed.
+func TestSeccompRecorders(t *testing.T) {
+	if dir := os.Getenv("SNIFFER_SECCOMP_DIR"); dir != "" {
+		if err := installSeccomp(); err != nil {
+			t.Skip(err)
+		}
+		store, err := OpenHistoryStore(filepath.Join(dir, "store"), time.Hour)
+		assert.NoError(t, err)
+		parquet, err := NewParquetRecorder(filepath.Join(dir, "parquet"))
+		assert.NoError(t, err)
+
+		interval := StoredInterval{Time: time.Now(), Elapsed: 2, Processes: []StoredRow{{Name: "<1>:curl"}}}
+		for _, r := range []IntervalRecorder{store, parquet} {
+			assert.NoError(t, r.Record(interval))
+			assert.NoError(t, r.Close())
+		}
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSeccompRecorders$", "-test.v")
+	cmd.Env = append(os.Environ(), "SNIFFER_SECCOMP_DIR="+dir)
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+	if strings.Contains(string(out), "--- SKIP") {
+		t.Skip(string(out))
+	}
+
+	for _, sub := range []string{"store", "parquet"} {
+		files, err := ioutil.ReadDir(filepath.Join(dir, sub))
+		assert.NoError(t, err)
+		assert.Len(t, files, 1, sub)
+	}
+}
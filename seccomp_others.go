@@ -0,0 +1,11 @@
+//go:build !linux || (!amd64 && !arm64)
+// +build !linux !amd64,!arm64
+
+package sniffer
+
+import "errors"
+
+// installSeccomp fails, the filter only being written for Linux on amd64 and arm64.
+func installSeccomp() error {
+	return errors.New("the seccomp sandbox is only supported on Linux on amd64 and arm64")
+}
@@ -0,0 +1,96 @@
+package sniffer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// selfLinger is how long the socket of a connection dialed by the sniffer is taken
+// for its own once dialed, the packets of the lookups trailing their sockets.
+const selfLinger = time.Minute
+
+// selfTraffic tells the traffic of the sniffer itself, by its pid and by the sockets
+// of the connections it dials, the reverse lookups being too short-lived for the
+// process resolvers to catch.
+type selfTraffic struct {
+	process ProcessInfo
+
+	mu      sync.Mutex
+	sockets map[LocalSocket]time.Time // socket -> when dialed
+	dialer  net.Dialer
+}
+
+// self is the traffic of the running sniffer.
+var self = newSelfTraffic(os.Getpid(), filepath.Base(os.Args[0]))
+
+func newSelfTraffic(pid int, name string) *selfTraffic {
+	return &selfTraffic{
+		process: ProcessInfo{Pid: pid, Name: name},
+		sockets: make(map[LocalSocket]time.Time),
+	}
+}
+
+// Dial dials the address as a net.Dialer, the local socket of the connection being
+// taken for the sniffer's.
+func (s *selfTraffic) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := s.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	s.add(conn.LocalAddr(), time.Now())
+	return conn, nil
+}
+
+func (s *selfTraffic) add(addr net.Addr, now time.Time) {
+	var socket LocalSocket
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		socket = LocalSocket{IP: a.IP.String(), Port: uint16(a.Port), Protocol: ProtoUDP}
+	case *net.TCPAddr:
+		socket = LocalSocket{IP: a.IP.String(), Port: uint16(a.Port), Protocol: ProtoTCP}
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for old, dialed := range s.sockets {
+		if now.Sub(dialed) > selfLinger {
+			delete(s.sockets, old)
+		}
+	}
+	s.sockets[socket] = now
+}
+
+// owns returns whether the sniffer owns the local socket, dialed lately, or is the
+// process of the traffic.
+func (s *selfTraffic) owns(socket LocalSocket, process *ProcessInfo) bool {
+	if process != nil && process.Pid == s.process.Pid {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.sockets[socket]
+	return ok
+}
+
+// markSelf takes the segment for the sniffer's own traffic if the sniffer owns its
+// socket, bucketing it under the sniffer.
+func (c *PcapClient) markSelf(seg *Segment) {
+	if self.owns(seg.Connection.Local, seg.Process) {
+		process := self.process
+		if uid := os.Getuid(); uid >= 0 {
+			process.User = userName(uid)
+		}
+		seg.Process = &process
+		seg.Unattributed = ""
+		seg.Self = true
+	}
+}
@@ -0,0 +1,23 @@
+package sniffer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTraffic(t *testing.T) {
+	s := newSelfTraffic(4242, "sniffer")
+	now := time.Now()
+	s.add(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 50000}, now.Add(-2*selfLinger))
+	s.add(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 50001}, now)
+
+	assert.True(t, s.owns(LocalSocket{IP: "10.0.0.1", Port: 50001, Protocol: ProtoUDP}, nil))
+	assert.True(t, s.owns(LocalSocket{IP: "10.0.0.1", Port: 443, Protocol: ProtoTCP}, &ProcessInfo{Pid: 4242}))
+	assert.False(t, s.owns(LocalSocket{IP: "10.0.0.1", Port: 50001, Protocol: ProtoTCP}, &ProcessInfo{Pid: 1}))
+
+	// the sockets dialed long ago are forgotten
+	assert.False(t, s.owns(LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoUDP}, nil))
+}
@@ -0,0 +1,133 @@
+package sniffer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RemotePort is a port of the remote ends of the connections, standing for the service
+// the traffic goes to.
+type RemotePort struct {
+	Port     uint16
+	Protocol Protocol
+}
+
+// Service returns the name of the service registered for the port, empty if unknown.
+func (p RemotePort) Service() string {
+	servicesOnce.Do(loadServices)
+	return services[p]
+}
+
+func (p RemotePort) String() string {
+	if name := p.Service(); name != "" {
+		return fmt.Sprintf("%d/%s (%s)", p.Port, p.Protocol, name)
+	}
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+// RemoteService returns the name of the service registered for the remote port of the
+// connection, empty if unknown.
+func (c Connection) RemoteService() string {
+	return RemotePort{Port: c.Remote.Port, Protocol: c.Local.Protocol}.Service()
+}
+
+// builtinServices name the ports of the common services, for the hosts lacking a
+// services database.
+var builtinServices = map[RemotePort]string{
+	{21, ProtoTCP}:    "ftp",
+	{22, ProtoTCP}:    "ssh",
+	{23, ProtoTCP}:    "telnet",
+	{25, ProtoTCP}:    "smtp",
+	{53, ProtoTCP}:    "domain",
+	{53, ProtoUDP}:    "domain",
+	{67, ProtoUDP}:    "bootps",
+	{80, ProtoTCP}:    "http",
+	{110, ProtoTCP}:   "pop3",
+	{123, ProtoUDP}:   "ntp",
+	{143, ProtoTCP}:   "imap",
+	{389, ProtoTCP}:   "ldap",
+	{443, ProtoTCP}:   "https",
+	{443, ProtoUDP}:   "https",
+	{465, ProtoTCP}:   "submissions",
+	{587, ProtoTCP}:   "submission",
+	{636, ProtoTCP}:   "ldaps",
+	{853, ProtoTCP}:   "domain-s",
+	{993, ProtoTCP}:   "imaps",
+	{995, ProtoTCP}:   "pop3s",
+	{1194, ProtoUDP}:  "openvpn",
+	{3306, ProtoTCP}:  "mysql",
+	{3389, ProtoTCP}:  "ms-wbt-server",
+	{5432, ProtoTCP}:  "postgresql",
+	{6379, ProtoTCP}:  "redis",
+	{5353, ProtoUDP}:  "mdns",
+	{8080, ProtoTCP}:  "http-alt",
+	{27017, ProtoTCP}: "mongodb",
+}
+
+var (
+	servicesOnce sync.Once
+	services     map[RemotePort]string
+)
+
+// servicesPath returns the path of the services database of the host.
+func servicesPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("SystemRoot"), "System32", "drivers", "etc", "services")
+	}
+	return "/etc/services"
+}
+
+// loadServices names the ports after the services database of the host, on top of the
+// builtin names.
+func loadServices() {
+	services = make(map[RemotePort]string, len(builtinServices))
+	for port, name := range builtinServices {
+		services[port] = name
+	}
+
+	f, err := os.Open(servicesPath())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	for port, name := range parseServices(f) {
+		services[port] = name
+	}
+}
+
+// parseServices parses a services database, of lines like "https 443/tcp # comment",
+// the first name of a port winning.
+func parseServices(r io.Reader) map[RemotePort]string {
+	names := make(map[RemotePort]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		parts := strings.SplitN(fields[1], "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		port, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			continue
+		}
+		key := RemotePort{Port: uint16(port), Protocol: Protocol(strings.ToLower(parts[1]))}
+		if _, ok := names[key]; !ok {
+			names[key] = fields[0]
+		}
+	}
+	return names
+}
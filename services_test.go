@@ -0,0 +1,42 @@
+package sniffer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServices(t *testing.T) {
+	db := `# Network services, Internet style
+ssh		22/tcp				# SSH Remote Login Protocol
+https		443/tcp				# http protocol over TLS/SSL
+https		443/udp				# HTTP/3
+www		80/tcp		http		# WorldWideWeb HTTP
+http		80/tcp
+postgresql	5432/TCP			# PostgreSQL Database
+bogus		notaport/tcp
+`
+	names := parseServices(strings.NewReader(db))
+	assert.Equal(t, "ssh", names[RemotePort{Port: 22, Protocol: ProtoTCP}])
+	assert.Equal(t, "https", names[RemotePort{Port: 443, Protocol: ProtoUDP}])
+	assert.Equal(t, "www", names[RemotePort{Port: 80, Protocol: ProtoTCP}])
+	assert.Equal(t, "postgresql", names[RemotePort{Port: 5432, Protocol: ProtoTCP}])
+	assert.Len(t, names, 5)
+}
+
+func TestRemotePortString(t *testing.T) {
+	servicesOnce.Do(loadServices)
+	assert.Equal(t, "5432/tcp (postgresql)", RemotePort{Port: 5432, Protocol: ProtoTCP}.String())
+	assert.Equal(t, "64999/udp", RemotePort{Port: 64999, Protocol: ProtoUDP}.String())
+}
+
+func TestConnectionRemoteService(t *testing.T) {
+	conn := Connection{Local: LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 22}}
+	assert.Equal(t, "ssh", conn.RemoteService())
+
+	// the service goes by the remote port, not the local one
+	conn.Remote.Port = 64999
+	conn.Local.Port = 22
+	assert.Empty(t, conn.RemoteService())
+}
@@ -0,0 +1,183 @@
+package sniffer
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// sessionVersion is the version of the session files, told at their start.
+const sessionVersion = 1
+
+// recordedStat is the stats of an interval as recorded in a session file.
+type recordedStat struct {
+	Time time.Time // When the stats were put
+	Stat Stat
+}
+
+// SessionRecorder records the stats of each interval to a session file, to replay what
+// the sniffer saw later on, e.g. while reviewing an incident. The stats are recorded
+// rather than the snapshots, so the replays go through every view mode, scope and
+// sort alike.
+type SessionRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	enc  *gob.Encoder
+}
+
+// CreateSession creates the session file at the path, truncated if it exists.
+func CreateSession(path string) (*SessionRecorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	r := &SessionRecorder{file: f, buf: buf, enc: gob.NewEncoder(buf)}
+	if err := r.enc.Encode(sessionVersion); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Record appends the stats put at the time to the session, flushed to the file right
+// away not to lose them on a crash.
+func (r *SessionRecorder) Record(stat Stat, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	if err := r.enc.Encode(recordedStat{Time: now, Stat: stat}); err != nil {
+		return err
+	}
+	return r.buf.Flush()
+}
+
+// Close closes the session file.
+func (r *SessionRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.buf.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	return err
+}
+
+// SessionPlayer replays the stats recorded in a session file, at their original pace
+// sped up by the speed.
+type SessionPlayer struct {
+	file  *os.File
+	dec   *gob.Decoder
+	speed float64
+	next  *recordedStat // Stats read ahead, nil once all are played
+}
+
+// OpenSession opens the session file at the path to replay at the speed, 2 replaying
+// twice as fast as recorded.
+func OpenSession(path string, speed float64) (*SessionPlayer, error) {
+	if speed <= 0 {
+		return nil, fmt.Errorf("invalid replay speed %v", speed)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &SessionPlayer{file: f, dec: gob.NewDecoder(bufio.NewReader(f)), speed: speed}
+	var version int
+	if err := p.dec.Decode(&version); err != nil || version != sessionVersion {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a session file of version %d", path, sessionVersion)
+	}
+	if err := p.readAhead(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// readAhead reads the next stats of the session, the ones cut short by a crash ending
+// it.
+func (p *SessionPlayer) readAhead() error {
+	var next recordedStat
+	switch err := p.dec.Decode(&next); err {
+	case nil:
+		p.next = &next
+	case io.EOF, io.ErrUnexpectedEOF:
+		p.next = nil
+	default:
+		return err
+	}
+	return nil
+}
+
+// Next returns the next stats of the session along with when they were put and how
+// long to wait for the ones after at the speed, 0 if they are the last. It returns
+// io.EOF once all are played.
+func (p *SessionPlayer) Next() (Stat, time.Time, time.Duration, error) {
+	if p.next == nil {
+		return Stat{}, time.Time{}, 0, io.EOF
+	}
+	current := *p.next
+	if err := p.readAhead(); err != nil {
+		return Stat{}, time.Time{}, 0, err
+	}
+
+	var wait time.Duration
+	if p.next != nil {
+		wait = time.Duration(float64(p.next.Time.Sub(current.Time)) / p.speed)
+		if wait <= 0 {
+			wait = time.Millisecond
+		}
+	}
+	return current.Stat, current.Time, wait, nil
+}
+
+// Play puts the stats of the session into the manager at their pace, calling back
+// after each, until all are played or the context is done.
+func (p *SessionPlayer) Play(ctx context.Context, s *StatsManager, played func()) error {
+	for {
+		stat, at, wait, err := p.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.put(stat, at)
+		played()
+		if wait == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Close closes the session file.
+func (p *SessionPlayer) Close() error {
+	return p.file.Close()
+}
+
+// RecordSession records the stats put from now on to the session, closed along with
+// the recorders.
+func (s *StatsManager) RecordSession(r *SessionRecorder) {
+	s.session = r
+}
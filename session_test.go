@@ -0,0 +1,66 @@
+package sniffer
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "incident.session")
+
+	session, err := CreateSession(path)
+	assert.NoError(t, err)
+	s := NewStatsManager(Options{Interval: 2})
+	s.RecordSession(session)
+
+	start := time.Date(2022, 1, 1, 3, 0, 0, 0, time.UTC)
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	conn := Connection{Local: LocalSocket{Port: 1, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}
+	for i := 0; i < 3; i++ {
+		s.put(Stat{
+			Utilization: Utilization{
+				conn: {Process: curl, UploadBytes: 1000 * (i + 1), KernelTCP: &TCPInfo{RTT: time.Millisecond}},
+			},
+			Neighbors: Neighbors{{MAC: "aa:bb", IP: "10.0.0.1"}: {Requests: 2}},
+			Monitor:   &MonitorStats{Sockets: 3},
+		}, start.Add(time.Duration(i)*2*time.Second))
+	}
+	assert.NoError(t, s.CloseRecorders())
+
+	// the stats come back at the pace recorded, sped up
+	player, err := OpenSession(path, 4)
+	assert.NoError(t, err)
+	stat, at, wait, err := player.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, start, at.UTC())
+	assert.Equal(t, 500*time.Millisecond, wait)
+	assert.Equal(t, 1000, stat.Utilization[conn].UploadBytes)
+	assert.Equal(t, "curl", stat.Utilization[conn].Process.Name)
+	assert.Equal(t, 3, stat.Monitor.Sockets)
+	assert.NoError(t, player.Close())
+
+	// the replays go through a manager of their own
+	player, err = OpenSession(path, 1000)
+	assert.NoError(t, err)
+	defer player.Close()
+	replayed := NewStatsManager(Options{Interval: 2})
+	var played int
+	assert.NoError(t, player.Play(context.Background(), replayed, func() { played++ }))
+	assert.Equal(t, 3, played)
+	assert.Equal(t, 1500, replayed.getSnapshot().Processes[curl.String()].UploadBytes)
+	_, _, _, err = player.Next()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = OpenSession(path, 0)
+	assert.Error(t, err)
+}
@@ -4,9 +4,12 @@
 package sniffer
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gizak/termui/v3"
 )
@@ -19,61 +22,200 @@ func exit(s string) {
 
 func DefaultOptions() Options {
 	return Options{
-		BPFFilter:         "tcp or udp",
+		BPFFilter:         DefaultBPFFilter,
 		Interval:          2,
 		ViewMode:          ModeTableBytes,
 		Unit:              UnitKB,
+		SortKey:           SortTotal,
+		Rows:              64,
+		MaxConnections:    100000,
+		ExportDir:         ".",
 		DevicesPrefix:     []string{"en", "lo", "eth", "em", "bond"},
 		DisableDNSResolve: false,
+		PassiveDNSOnly:    false,
 		AllDevices:        false,
+		TunnelOuter:       false,
+		WirePackets:       false,
+		Goodput:           false,
+		VerifyChecksums:   false,
+		IncludeLoopback:   true,
+		Cumulative:        false,
+		LocalSubnets:      DefaultLocalSubnets,
+		Dedup:             false,
+		Mirror:            false,
+		ExcludeSelf:       false,
+		Pktap:             false,
+		ProcessRefreshMin: 500 * time.Millisecond,
+		ProcessRefreshMax: 10 * time.Second,
+		SockDiagTimeout:   200 * time.Millisecond,
+		HistorySize:       60,
+		RateHistorySize:   30,
+		PercentileWindow:  5 * time.Minute,
+		StateSaveInterval: time.Minute,
+		StoreRetention:    7 * 24 * time.Hour,
+		ReplaySpeed:       1,
+		SocketStates:      []string{StateEstablished.String()},
 	}
 }
 
 type Sniffer struct {
-	Opts          Options
-	DnsResolver   *DNSResolver
-	PcapClient    *PcapClient
-	StatsManager  *StatsManager
-	Ui            *UIComponent
-	SocketFetcher SocketFetcher
+	Opts         Options
+	DnsResolver  *DNSResolver
+	PcapClient   *PcapClient
+	StatsManager *StatsManager
+	Ui           *UIComponent
+	Resolver     ProcessResolver
+
+	tagging  bool   // Whether the keys typed go to the tag prompt
+	tagInput string // Tag command typed so far
+
+	player     *SessionPlayer // Session replayed in place of capturing, nil if none
+	replayWait time.Duration  // Wait for the next stats replayed, 0 once all are
 }
 
 func NewSniffer(opts Options) (*Sniffer, error) {
-	dnsResolver := NewDnsResolver()
-	pcapClient, err := NewPcapClient(dnsResolver.Lookup, opts, nil)
+	if opts.ReplayFile != "" {
+		return newReplaySniffer(opts)
+	}
+
+	dnsResolver := NewDnsResolver(opts)
+	resolver, err := NewProcessResolver(opts)
 	if err != nil {
 		return nil, err
 	}
+	pcapClient, err := NewPcapClient(dnsResolver.Lookup, dnsResolver.Observe, opts, resolver)
+	if err != nil {
+		resolver.Close()
+		return nil, err
+	}
+	if opts.User != "" {
+		if err := dropPrivileges(opts.User); err != nil {
+			pcapClient.Close()
+			resolver.Close()
+			return nil, err
+		}
+	}
+	statsManager := NewStatsManager(opts)
+	if err := statsManager.LoadState(); err != nil {
+		pcapClient.Close()
+		resolver.Close()
+		return nil, err
+	}
+	if opts.CategoryRules != "" {
+		rules, err := LoadCategoryRules(opts.CategoryRules)
+		if err != nil {
+			pcapClient.Close()
+			resolver.Close()
+			return nil, err
+		}
+		statsManager.SetCategories(rules)
+	}
+	if opts.TagsFile != "" {
+		tags, err := OpenTags(opts.TagsFile)
+		if err != nil {
+			pcapClient.Close()
+			resolver.Close()
+			return nil, err
+		}
+		statsManager.SetTags(tags)
+	}
+	if opts.StoreDir != "" {
+		store, err := OpenHistoryStore(opts.StoreDir, opts.StoreRetention)
+		if err != nil {
+			pcapClient.Close()
+			resolver.Close()
+			return nil, err
+		}
+		statsManager.AddRecorder(store)
+	}
+	if opts.ParquetDir != "" {
+		recorder, err := NewParquetRecorder(opts.ParquetDir)
+		if err != nil {
+			statsManager.CloseRecorders()
+			pcapClient.Close()
+			resolver.Close()
+			return nil, err
+		}
+		statsManager.AddRecorder(recorder)
+	}
+	if opts.RecordFile != "" {
+		session, err := CreateSession(opts.RecordFile)
+		if err != nil {
+			statsManager.CloseRecorders()
+			pcapClient.Close()
+			resolver.Close()
+			return nil, err
+		}
+		statsManager.RecordSession(session)
+	}
+	// the sandbox goes last, once the state, the tags, the recorders and the session
+	// are open
+	if opts.Seccomp {
+		if err := installSeccomp(); err != nil {
+			statsManager.CloseRecorders()
+			pcapClient.Close()
+			resolver.Close()
+			return nil, err
+		}
+	}
 
 	return &Sniffer{
-		Opts:          opts,
-		DnsResolver:   dnsResolver,
-		PcapClient:    pcapClient,
-		StatsManager:  NewStatsManager(opts),
-		Ui:            NewUIComponent(opts),
-		SocketFetcher: GetSocketFetcher(),
+		Opts:         opts,
+		DnsResolver:  dnsResolver,
+		PcapClient:   pcapClient,
+		StatsManager: statsManager,
+		Ui:           NewUIComponent(opts),
+		Resolver:     resolver,
 	}, nil
 }
 
+// newReplaySniffer returns the sniffer replaying the session of Options.ReplayFile,
+// which captures nothing and needs no privileges.
+func newReplaySniffer(opts Options) (*Sniffer, error) {
+	player, err := OpenSession(opts.ReplayFile, opts.ReplaySpeed)
+	if err != nil {
+		return nil, err
+	}
+	// the totals replayed are not the ones of this host to save
+	opts.StateFile = ""
+	return &Sniffer{
+		Opts:         opts,
+		StatsManager: NewStatsManager(opts),
+		Ui:           NewUIComponent(opts),
+		player:       player,
+	}, nil
+}
+
+// SwitchViewMode shows the next view mode, of the stats counted so far rather than from
+// scratch, the plots being drawn back over the history.
 func (s *Sniffer) SwitchViewMode() {
-	s.Opts.ViewMode = (s.Opts.ViewMode + 1) % 3
-	s.StatsManager = NewStatsManager(s.Opts)
+	s.Opts.ViewMode = (s.Opts.ViewMode + 1) % 7
+	s.StatsManager.SetViewMode(s.Opts.ViewMode)
 
 	s.Ui.Close()
 	s.Ui = NewUIComponent(s.Opts)
+	if pv, ok := s.Ui.viewer.(*PlotViewer); ok {
+		pv.backfill(s.StatsManager.History(), s.Opts.interval())
+	}
+	s.Ui.viewer.Render(s.StatsManager.GetStats())
 }
 
 func (s *Sniffer) Start() {
 	events := termui.PollEvents()
-	s.Refresh()
 	var paused bool
 
-	ticker := time.NewTicker(time.Duration(s.Opts.Interval) * time.Second)
+	ticker := time.NewTicker(s.Opts.interval())
 	defer ticker.Stop()
+	s.Refresh()
+	s.pace(ticker)
 
 	for {
 		select {
 		case e := <-events:
+			if s.tagging {
+				s.typeTag(e.ID)
+				continue
+			}
 			switch e.ID {
 			case "<Tab>":
 				s.Ui.viewer.Shift()
@@ -84,6 +226,31 @@ func (s *Sniffer) Start() {
 				s.Ui.viewer.Resize(payload.Width, payload.Height)
 			case "s", "S":
 				s.SwitchViewMode()
+			case "o", "O":
+				if tv, ok := s.Ui.viewer.(*TableViewer); ok {
+					tv.ShiftSort()
+					s.Opts.SortKey = tv.sortKey
+				}
+			case "i", "I":
+				if tv, ok := s.Ui.viewer.(*TableViewer); ok {
+					tv.ShiftAggregate()
+				}
+			case "r", "R":
+				if tv, ok := s.Ui.viewer.(*TableViewer); ok {
+					tv.SortByRTT()
+				}
+			case "l", "L":
+				s.Opts.IncludeLoopback = !s.Opts.IncludeLoopback
+				s.StatsManager.SetLoopback(s.Opts.IncludeLoopback)
+			case "t", "T":
+				s.Opts.Cumulative = !s.Opts.Cumulative
+				s.StatsManager.SetCumulative(s.Opts.Cumulative)
+			case "w", "W":
+				s.StatsManager.ShiftScope()
+			case "e", "E":
+				s.Export(time.Now())
+			case "g", "G":
+				s.startTagging()
 			case "q", "Q", "<C-c>":
 				return
 			}
@@ -91,24 +258,163 @@ func (s *Sniffer) Start() {
 		case <-ticker.C:
 			if !paused {
 				s.Refresh()
+				s.pace(ticker)
 			}
 		}
 	}
 }
 
+// pace ticks the refreshes of a replay at the pace of the session, stopping once all
+// the stats are replayed.
+func (s *Sniffer) pace(ticker *time.Ticker) {
+	if s.player == nil {
+		return
+	}
+	if s.replayWait > 0 {
+		ticker.Reset(s.replayWait)
+	} else {
+		ticker.Stop()
+	}
+}
+
+// replay puts the next stats of the replayed session, telling in the footer once all
+// are replayed.
+func (s *Sniffer) replay() {
+	stat, at, wait, err := s.player.Next()
+	s.replayWait = wait
+	tv, _ := s.Ui.viewer.(*TableViewer)
+	if err != nil {
+		if tv != nil && err != io.EOF {
+			tv.Notify(fmt.Sprintf("Replay failed: %v", err))
+		}
+		return
+	}
+	s.StatsManager.put(stat, at)
+	s.Ui.viewer.Render(s.StatsManager.GetStats())
+	if tv != nil {
+		status := fmt.Sprintf("Replay of %s", at.Format(timeFormat))
+		if wait == 0 {
+			status = "Replay ended at " + at.Format(timeFormat)
+		}
+		tv.Notify(status)
+	}
+}
+
+// tagPrompt is told in the footer while a tag command is typed.
+const tagPrompt = "Tag (<target> <tag> or <target> -<tag>): "
+
+// startTagging prompts for a tag command in the footer, the keys typed going to it
+// until Enter applies it or Escape cancels it.
+func (s *Sniffer) startTagging() {
+	tv, ok := s.Ui.viewer.(*TableViewer)
+	if !ok {
+		return
+	}
+	if s.StatsManager.tags == nil {
+		tv.Notify("Tagging needs --tags-file")
+		return
+	}
+	s.tagging, s.tagInput = true, ""
+	tv.Notify(tagPrompt + "_")
+}
+
+// typeTag takes a key typed at the tag prompt.
+func (s *Sniffer) typeTag(key string) {
+	tv, ok := s.Ui.viewer.(*TableViewer)
+	if !ok {
+		s.tagging = false
+		return
+	}
+	switch key {
+	case "<Enter>":
+		s.tagging = false
+		msg, err := s.StatsManager.tags.Apply(s.tagInput)
+		if err != nil {
+			msg = fmt.Sprintf("Tagging failed: %v", err)
+		}
+		tv.Render(s.StatsManager.GetStats())
+		tv.Notify(msg)
+		return
+	case "<Escape>", "<C-c>":
+		s.tagging = false
+		tv.Notify("Tagging canceled")
+		return
+	case "<Backspace>", "<C-<Backspace>>":
+		if _, size := utf8.DecodeLastRuneInString(s.tagInput); size > 0 {
+			s.tagInput = s.tagInput[:len(s.tagInput)-size]
+		}
+	case "<Space>":
+		s.tagInput += " "
+	default:
+		// the special keys go by their names in brackets
+		if utf8.RuneCountInString(key) == 1 {
+			s.tagInput += key
+		}
+	}
+	tv.Notify(tagPrompt + s.tagInput + "_")
+}
+
+// Export exports the tables of the latest snapshot to Options.ExportDir as CSV, the
+// files written or the error being told in the footer.
+func (s *Sniffer) Export(now time.Time) {
+	tv, ok := s.Ui.viewer.(*TableViewer)
+	if !ok {
+		return
+	}
+	paths, err := s.StatsManager.getSnapshot().ExportCSV(s.Opts.ExportDir, now)
+	if err != nil {
+		tv.Notify(fmt.Sprintf("Export failed: %v", err))
+		return
+	}
+	tv.Notify(fmt.Sprintf("Exported %d tables to %s", len(paths), s.Opts.ExportDir))
+}
+
 func (s *Sniffer) Close() {
 	s.Ui.Close()
+	if err := s.StatsManager.SaveState(); err != nil {
+		fmt.Fprintln(os.Stderr, "Save state failed:", err)
+	}
+	if err := s.StatsManager.CloseRecorders(); err != nil {
+		fmt.Fprintln(os.Stderr, "Close recorders failed:", err)
+	}
+	if s.player != nil {
+		s.player.Close()
+		return
+	}
 	s.PcapClient.Close()
+	s.Resolver.Close()
 	s.DnsResolver.Close()
 }
 
 func (s *Sniffer) Refresh() {
-	utilization := s.PcapClient.Sinker.GetUtilization()
-	openSockets, err := s.SocketFetcher.GetOpenSockets()
-	if err != nil {
+	if s.player != nil {
+		s.replay()
 		return
 	}
 
-	s.StatsManager.Put(Stat{OpenSockets: openSockets, Utilization: utilization})
+	// the sockets are due before the next refresh
+	ctx, cancel := context.WithTimeout(context.Background(), s.Opts.interval())
+	defer cancel()
+	if err := s.Resolver.Refresh(ctx); err != nil {
+		return
+	}
+	s.PcapClient.Poll()
+
+	utilization := s.PcapClient.Sinker.GetUtilization()
+
+	neighbors := s.PcapClient.Sinker.GetNeighbors()
+	discoveries := s.PcapClient.Sinker.GetDiscoveries()
+	dhcpEvents := s.PcapClient.Sinker.GetDHCPEvents()
+	connEvents := s.PcapClient.Sinker.GetConnectionEvents()
+	s.StatsManager.Put(Stat{
+		Utilization:       utilization,
+		Neighbors:         neighbors,
+		Discoveries:       discoveries,
+		DHCPEvents:        dhcpEvents,
+		ConnectionEvents:  connEvents,
+		ActiveConnections: s.PcapClient.Sinker.ActiveConnections(),
+		Monitor:           s.PcapClient.MonitorStats(),
+		Degraded:          s.PcapClient.Degraded(),
+	})
 	s.Ui.viewer.Render(s.StatsManager.GetStats())
 }
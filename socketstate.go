@@ -0,0 +1,116 @@
+package sniffer
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SocketState is the state of a socket, numbered as the TCP states of the Linux
+// kernel. The UDP sockets are ESTABLISHED once connected and CLOSE otherwise.
+type SocketState uint8
+
+const (
+	StateUnknown SocketState = iota
+	StateEstablished
+	StateSynSent
+	StateSynRecv
+	StateFinWait1
+	StateFinWait2
+	StateTimeWait
+	StateClose
+	StateCloseWait
+	StateLastAck
+	StateListen
+	StateClosing
+	StateNewSynRecv
+)
+
+var socketStateNames = []string{
+	StateUnknown:     "UNKNOWN",
+	StateEstablished: "ESTABLISHED",
+	StateSynSent:     "SYN_SENT",
+	StateSynRecv:     "SYN_RECV",
+	StateFinWait1:    "FIN_WAIT1",
+	StateFinWait2:    "FIN_WAIT2",
+	StateTimeWait:    "TIME_WAIT",
+	StateClose:       "CLOSE",
+	StateCloseWait:   "CLOSE_WAIT",
+	StateLastAck:     "LAST_ACK",
+	StateListen:      "LISTEN",
+	StateClosing:     "CLOSING",
+	StateNewSynRecv:  "NEW_SYN_RECV",
+}
+
+func (s SocketState) String() string {
+	if int(s) < len(socketStateNames) {
+		return socketStateNames[s]
+	}
+	return fmt.Sprintf("STATE(%d)", uint8(s))
+}
+
+// ParseSocketState returns the state of the given name, case insensitive.
+func ParseSocketState(name string) (SocketState, error) {
+	for state, stateName := range socketStateNames {
+		if strings.EqualFold(name, stateName) {
+			return SocketState(state), nil
+		}
+	}
+	return StateUnknown, fmt.Errorf("invalid socket state %q", name)
+}
+
+// socketStateMask returns the bit mask of the named states, bit n standing for the
+// state n, as the state filter of the sock_diag requests.
+func socketStateMask(names []string) (uint32, error) {
+	var mask uint32
+	for _, name := range names {
+		state, err := ParseSocketState(name)
+		if err != nil {
+			return 0, err
+		}
+		mask |= 1 << state
+	}
+	return mask, nil
+}
+
+// SocketInfo is the process of a socket along with the state and the owner of the
+// socket.
+type SocketInfo struct {
+	ProcessInfo
+	State SocketState
+	UID   int // User owning the socket, -1 if unknown
+}
+
+// Owner returns the process of the socket along with its container and the user owning
+// the socket, named after the user if the process is unknown, e.g. its /proc entry
+// being unreadable.
+func (s SocketInfo) Owner() ProcessInfo {
+	owner := s.ProcessInfo
+	owner.Container = containerOf(owner.Pid)
+	if s.UID < 0 {
+		return owner
+	}
+	if owner.Name == "" {
+		owner = ProcessInfo{Name: fmt.Sprintf("uid %d", s.UID)}
+	}
+	owner.User = userName(s.UID)
+	return owner
+}
+
+// userNames caches the names of the users by their uid.
+var userNames sync.Map
+
+// userName returns the name of the user of the uid, the uid itself if unnamed.
+func userName(uid int) string {
+	if name, ok := userNames.Load(uid); ok {
+		return name.(string)
+	}
+	name := strconv.Itoa(uid)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	userNames.Store(uid, name)
+	return name
+}
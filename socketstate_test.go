@@ -0,0 +1,33 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketState(t *testing.T) {
+	state, err := ParseSocketState("listen")
+	assert.NoError(t, err)
+	assert.Equal(t, StateListen, state)
+	assert.Equal(t, "TIME_WAIT", StateTimeWait.String())
+	assert.Equal(t, "STATE(42)", SocketState(42).String())
+
+	_, err = ParseSocketState("FIN_WAIT_1")
+	assert.Error(t, err)
+
+	mask, err := socketStateMask([]string{"ESTABLISHED", "LISTEN"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1<<1|1<<10), mask)
+	mask, err = socketStateMask(nil)
+	assert.NoError(t, err)
+	assert.Zero(t, mask)
+}
+
+func TestSocketInfoOwner(t *testing.T) {
+	curl := ProcessInfo{Pid: 100, Name: "curl", Container: containerOf(100)}
+	assert.Equal(t, ProcessInfo{Pid: 100, Name: "curl", User: userName(1000), Container: containerOf(100)}, SocketInfo{ProcessInfo: curl, UID: 1000}.Owner())
+	assert.Equal(t, curl, SocketInfo{ProcessInfo: curl, UID: -1}.Owner())
+	assert.Equal(t, ProcessInfo{Name: "uid 1000", User: userName(1000)}, SocketInfo{UID: 1000}.Owner())
+	assert.Equal(t, ProcessInfo{}, SocketInfo{UID: -1}.Owner())
+}
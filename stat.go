@@ -2,46 +2,192 @@ package sniffer
 
 import (
 	"sort"
+	"time"
 )
 
 const (
 	unknownProcessName = "<UNKNOWN>"
+	unknownUserName    = "<UNKNOWN>"
 )
 
 type Stat struct {
-	OpenSockets OpenSockets
 	Utilization Utilization
+	Neighbors   Neighbors
+	Discoveries Discoveries
+	DHCPEvents  []DHCPEvent
+
+	ConnectionEvents  []ConnectionEvent
+	ActiveConnections int
+	Monitor           *MonitorStats
+	Degraded          bool
 }
 
 type ConnectionData struct {
-	DownloadBytes   int
-	UploadBytes     int
-	UploadPackets   int
-	DownloadPackets int
-	ProcessName     string
-	InterfaceName   string
+	DownloadBytes        int
+	UploadBytes          int
+	UploadPayloadBytes   int
+	DownloadPayloadBytes int
+	UploadPackets        int
+	DownloadPackets      int
+	ProcessName          string
+	InterfaceName        string
+	ServerName           string
+	RemoteOS             string
+	CommunityID          string // community ID of the 5-tuple, to match the records of other tools
+	Labeled              bool   // whether the remote IP is replaced by its label
+	Application          ApplicationProtocol
+
+	RetransmittedPackets int
+	RetransmittedBytes   int
+	RTT                  time.Duration
+	KernelTCP            *TCPInfo // quality of the TCP connection measured by the kernel, nil if unknown
+	FirstSeen            time.Time
+	LastSeen             time.Time
+	LocalWindow          int
+	RemoteWindow         int
+	LocalZeroWindows     int
+	RemoteZeroWindows    int
+	DupACKs              int
+	OutOfOrderPackets    int
+	CorruptPackets       int
+
+	UploadRate   float64 // Bytes per second uploaded over the time actually elapsed
+	DownloadRate float64 // Bytes per second downloaded over the time actually elapsed
+
+	Bandwidth // Peak and average rates since first seen
+}
+
+// Duration returns how long the connection has been observed.
+func (d *ConnectionData) Duration() time.Duration {
+	return d.LastSeen.Sub(d.FirstSeen)
+}
+
+// Bytes returns the upload and download bytes, the payload only ones if goodput.
+func (d *ConnectionData) Bytes(goodput bool) (int, int) {
+	if goodput {
+		return d.UploadPayloadBytes, d.DownloadPayloadBytes
+	}
+	return d.UploadBytes, d.DownloadBytes
 }
 
 type NetworkData struct {
-	UploadBytes     int
-	DownloadBytes   int
-	UploadPackets   int
-	DownloadPackets int
-	ConnCount       int
+	UploadBytes          int
+	DownloadBytes        int
+	UploadPayloadBytes   int
+	DownloadPayloadBytes int
+	UploadPackets        int
+	DownloadPackets      int
+	ConnCount            int
+
+	UploadRate   float64 // Bytes per second uploaded over the time actually elapsed
+	DownloadRate float64 // Bytes per second downloaded over the time actually elapsed
+
+	Bandwidth // Peak and average rates since first seen, of the processes only
+
+	// TCP and UDP are the subtotals of the TCP and the UDP connections, of the
+	// processes and the remote addresses only, nil if none
+	TCP *NetworkData
+	UDP *NetworkData
+}
+
+// Bytes returns the upload and download bytes, the payload only ones if goodput.
+func (d *NetworkData) Bytes(goodput bool) (int, int) {
+	if goodput {
+		return d.UploadPayloadBytes, d.DownloadPayloadBytes
+	}
+	return d.UploadBytes, d.DownloadBytes
+}
+
+// add counts the traffic of the connection in.
+func (d *NetworkData) add(info *ConnectionInfo) {
+	d.UploadBytes += info.UploadBytes
+	d.DownloadBytes += info.DownloadBytes
+	d.UploadPayloadBytes += info.UploadPayloadBytes
+	d.DownloadPayloadBytes += info.DownloadPayloadBytes
+	d.UploadPackets += info.UploadPackets
+	d.DownloadPackets += info.DownloadPackets
+}
+
+// addProtocol counts the traffic of the connection in the subtotal of its protocol, as
+// a new connection if not visited yet.
+func (d *NetworkData) addProtocol(proto Protocol, info *ConnectionInfo, visited bool) {
+	var subtotal **NetworkData
+	switch proto {
+	case ProtoTCP:
+		subtotal = &d.TCP
+	case ProtoUDP:
+		subtotal = &d.UDP
+	default:
+		return
+	}
+	if *subtotal == nil {
+		*subtotal = &NetworkData{}
+	}
+	(*subtotal).add(info)
+	if !visited {
+		(*subtotal).ConnCount++
+	}
+}
+
+// setRates sets the rates of the bytes counted over the elapsed time.
+func (d *NetworkData) setRates(elapsed time.Duration) {
+	d.UploadRate, d.DownloadRate = bytesRate(d.UploadBytes, elapsed), bytesRate(d.DownloadBytes, elapsed)
+	for _, subtotal := range []*NetworkData{d.TCP, d.UDP} {
+		if subtotal != nil {
+			subtotal.setRates(elapsed)
+		}
+	}
 }
 
 func (d *NetworkData) DivideBy(n int) {
-	d.UploadBytes /= n
-	d.DownloadBytes /= n
-	d.UploadPackets /= n
-	d.DownloadPackets /= n
+	d.PerSecond(time.Duration(n) * time.Second)
+}
+
+// PerSecond turns the bytes and the packets counted over the interval into their
+// averages over a second.
+func (d *NetworkData) PerSecond(interval time.Duration) {
+	for _, n := range []*int{&d.UploadBytes, &d.DownloadBytes, &d.UploadPayloadBytes, &d.DownloadPayloadBytes, &d.UploadPackets, &d.DownloadPackets} {
+		*n = perSecond(*n, interval)
+	}
+	for _, subtotal := range []*NetworkData{d.TCP, d.UDP} {
+		if subtotal != nil {
+			subtotal.PerSecond(interval)
+		}
+	}
+}
+
+// perSecond returns the average over a second of the count over the interval.
+func perSecond(n int, interval time.Duration) int {
+	if interval <= 0 {
+		return n
+	}
+	return int(float64(n) * float64(time.Second) / float64(interval))
+}
+
+// setRates sets the rates of the bytes counted over the elapsed time.
+func (d *ConnectionData) setRates(elapsed time.Duration) {
+	d.UploadRate, d.DownloadRate = bytesRate(d.UploadBytes, elapsed), bytesRate(d.DownloadBytes, elapsed)
+}
+
+// bytesRate returns the bytes per second over the elapsed time, 0 if none elapsed.
+func bytesRate(bytes int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed.Seconds()
 }
 
 func (d *ConnectionData) DivideBy(n int) {
-	d.UploadBytes /= n
-	d.DownloadBytes /= n
-	d.UploadPackets /= n
-	d.DownloadPackets /= n
+	d.PerSecond(time.Duration(n) * time.Second)
+}
+
+// PerSecond turns the bytes and the packets counted over the interval into their
+// averages over a second.
+func (d *ConnectionData) PerSecond(interval time.Duration) {
+	for _, n := range []*int{&d.UploadBytes, &d.DownloadBytes, &d.UploadPayloadBytes, &d.DownloadPayloadBytes,
+		&d.UploadPackets, &d.DownloadPackets, &d.RetransmittedPackets, &d.RetransmittedBytes} {
+		*n = perSecond(*n, interval)
+	}
 }
 
 type ProcessesResult struct {
@@ -50,8 +196,9 @@ type ProcessesResult struct {
 }
 
 type RemoteAddrsResult struct {
-	Addr string
-	Data *NetworkData
+	Addr     string
+	Data     *NetworkData
+	Location *Location // Where the remote address is, nil if unknown
 }
 
 type ConnectionsResult struct {
@@ -59,33 +206,144 @@ type ConnectionsResult struct {
 	Data *ConnectionData
 }
 
+type NeighborsResult struct {
+	Neighbor Neighbor
+	Data     *NeighborInfo
+}
+
+type ApplicationsResult struct {
+	Application ApplicationProtocol
+	Data        *NetworkData
+}
+
+type InterfacesResult struct {
+	Interface string
+	Data      *NetworkData
+}
+
+type RemotePortsResult struct {
+	Port RemotePort
+	Data *NetworkData
+}
+
+type UsersResult struct {
+	User string
+	Data *NetworkData
+}
+
+type ContainersResult struct {
+	Container string
+	Data      *NetworkData
+}
+
+type CategoriesResult struct {
+	Category string
+	Data     *NetworkData
+}
+
+type CountriesResult struct {
+	Country string
+	Data    *NetworkData
+}
+
+type ASNsResult struct {
+	AS   string
+	Data *NetworkData
+}
+
+type ViewResult struct {
+	Group string
+	Data  *NetworkData
+}
+
+type DiscoveriesResult struct {
+	IP   string
+	Data *DiscoveryInfo
+}
+
 type Snapshot struct {
 	Processes            map[string]*NetworkData
 	RemoteAddrs          map[string]*NetworkData
+	Applications         map[ApplicationProtocol]*NetworkData
+	Families             map[AddressFamily]*NetworkData // Totals of each IP version
+	Interfaces           map[string]*NetworkData        // Totals of each device
+	RemotePorts          map[RemotePort]*NetworkData    // Totals of each remote TCP and UDP port
+	Users                map[string]*NetworkData        // Totals of each user owning the sockets, none on a mirror port
+	Containers           map[string]*NetworkData        // Totals of each container by its short ID, none of the host
+	Categories           map[string]*NetworkData        // Totals of each category of the processes, none without rules
+	Countries            map[string]*NetworkData        // Totals of each country of the remote ends by its ISO code, none without a GeoIP database
+	ASNs                 map[string]*NetworkData        // Totals of each autonomous system of the remote ends, none without an ASN database
+	RemoteLocations      map[string]*Location           // Location of each of the RemoteAddrs, if known
+	Scopes               map[Scope]*NetworkData         // Totals of the local and internet traffic
+	Scope                *Scope                         // Scope the rest is limited to, nil if none
 	Connections          map[Connection]*ConnectionData
+	EvictedConnections   int // Connections idle longer than Options.IdleTimeout left out of the tables
+	Neighbors            Neighbors
+	Discoveries          Discoveries
+	DHCPEvents           []DHCPEvent
+	ConnectionEvents     []ConnectionEvent
+	ActiveConnections    int           // TCP connections open, whether they carried traffic or not
+	Elapsed              time.Duration // Time the traffic was counted over, between the latest stats put or over the window
+	Monitor              *MonitorStats // Self-metrics of the process monitor, nil without one
+	Degraded             bool          // Whether the connections are polled without their traffic
 	TotalUploadBytes     int
 	TotalDownloadBytes   int
 	TotalUploadPackets   int
 	TotalDownloadPackets int
 	TotalConnections     int
+
+	TotalUploadPayloadBytes   int
+	TotalDownloadPayloadBytes int
+	Goodput                   bool // Whether the bytes rankings go by payload bytes
+
+	ProcessTotals    map[string]*NetworkData // Totals of the processes since started
+	RemoteAddrTotals map[string]*NetworkData // Totals of the remote addresses since started
+	Cumulative       bool                    // Whether the processes and the remote addresses rank by their totals
+
+	// Unattributed is the traffic of no known process, left out of the rest, by why
+	// it is unattributed. There is none on a mirror port.
+	Unattributed map[UnattributedReason]*NetworkData
+
+	// Tags are the tags of the remote hosts and of the connections to their ports, as
+	// the user tagged them, none without a tags file.
+	Tags map[string][]string
+
+	// Views are the groups of each view of the aggregators added to the manager, by
+	// the names of the views.
+	Views map[string]map[string]*NetworkData
+
+	// Watch is the process the rest is restricted to along with its children, by its
+	// pid or its name, and Watched the pids of them, none if not watching
+	Watch   string
+	Watched []int
+
+	// Throughput is the traffic of all the devices, of known processes or not and
+	// whatever the process filters and the scope, the loopback one only if counted.
+	Throughput *NetworkData
 }
 
+// TopNProcesses returns the processes with the most traffic, by their totals since
+// started if cumulative.
 func (s *Snapshot) TopNProcesses(n int, mode ViewMode) []ProcessesResult {
+	return s.TopNProcessesBy(n, mode, SortTotal)
+}
+
+// TopNProcessesBy returns the processes ranking first by the sort key, by their totals
+// since started if cumulative.
+func (s *Snapshot) TopNProcessesBy(n int, mode ViewMode, key SortKey) []ProcessesResult {
+	processes := s.Processes
+	if s.Cumulative {
+		processes = s.ProcessTotals
+	}
+
 	var items []ProcessesResult
-	for k, v := range s.Processes {
+	for k, v := range processes {
 		items = append(items, ProcessesResult{ProcessName: k, Data: v})
 	}
 
-	switch mode {
-	case ModeTableBytes:
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].Data.DownloadBytes+items[i].Data.UploadBytes > items[j].Data.DownloadBytes+items[j].Data.UploadBytes
-		})
-	case ModeTablePackets:
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].Data.DownloadPackets+items[i].Data.UploadPackets > items[j].Data.DownloadPackets+items[j].Data.UploadPackets
-		})
-	}
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
 
 	if len(items) < n {
 		n = len(items)
@@ -93,22 +351,298 @@ func (s *Snapshot) TopNProcesses(n int, mode ViewMode) []ProcessesResult {
 	return items[:n]
 }
 
+// TopNRemoteAddrs returns the remote addresses with the most traffic, by their totals
+// since started if cumulative.
 func (s *Snapshot) TopNRemoteAddrs(n int, mode ViewMode) []RemoteAddrsResult {
+	return s.TopNRemoteAddrsBy(n, mode, SortTotal)
+}
+
+// TopNRemoteAddrsBy returns the remote addresses ranking first by the sort key, by
+// their totals since started if cumulative.
+func (s *Snapshot) TopNRemoteAddrsBy(n int, mode ViewMode, key SortKey) []RemoteAddrsResult {
+	remoteAddrs := s.RemoteAddrs
+	if s.Cumulative {
+		remoteAddrs = s.RemoteAddrTotals
+	}
+
 	var items []RemoteAddrsResult
-	for k, v := range s.RemoteAddrs {
-		items = append(items, RemoteAddrsResult{Addr: k, Data: v})
+	for k, v := range remoteAddrs {
+		items = append(items, RemoteAddrsResult{Addr: k, Data: v, Location: s.RemoteLocations[k]})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// rank is what the rankings go by.
+type rank struct {
+	conns       int
+	upBytes     int
+	downBytes   int
+	upPackets   int
+	downPackets int
+}
+
+func (s *Snapshot) networkRank(d *NetworkData) rank {
+	up, down := d.Bytes(s.Goodput)
+	return rank{conns: d.ConnCount, upBytes: up, downBytes: down, upPackets: d.UploadPackets, downPackets: d.DownloadPackets}
+}
+
+func (s *Snapshot) connectionRank(d *ConnectionData) rank {
+	up, down := d.Bytes(s.Goodput)
+	return rank{conns: 1, upBytes: up, downBytes: down, upPackets: d.UploadPackets, downPackets: d.DownloadPackets}
+}
+
+// before returns whether the rank comes before the other by the sort key, the upload
+// and the download going by the bytes or the packets depending on the view mode, and
+// the total traffic breaking the ties.
+func (r rank) before(other rank, mode ViewMode, key SortKey) bool {
+	up, down, otherUp, otherDown := r.upBytes, r.downBytes, other.upBytes, other.downBytes
+	if mode == ModeTablePackets {
+		up, down, otherUp, otherDown = r.upPackets, r.downPackets, other.upPackets, other.downPackets
+	}
+	packets, otherPackets := r.upPackets+r.downPackets, other.upPackets+other.downPackets
+
+	switch {
+	case key == SortUpload && up != otherUp:
+		return up > otherUp
+	case key == SortDownload && down != otherDown:
+		return down > otherDown
+	case key == SortPackets && packets != otherPackets:
+		return packets > otherPackets
+	case key == SortConnections && r.conns != other.conns:
+		return r.conns > other.conns
 	}
 
 	switch mode {
-	case ModeTableBytes:
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].Data.DownloadBytes+items[i].Data.UploadBytes > items[j].Data.DownloadBytes+items[j].Data.UploadBytes
-		})
-	case ModeTablePackets:
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].Data.DownloadPackets+items[i].Data.UploadPackets > items[j].Data.DownloadPackets+items[j].Data.UploadPackets
-		})
+	case ModeTableBytes, ModeTablePackets:
+		return up+down > otherUp+otherDown
+	}
+	return false
+}
+
+// TopNApplications returns the application protocols with the most traffic, the
+// unclassified connections are accounted to their transport protocol.
+func (s *Snapshot) TopNApplications(n int, mode ViewMode) []ApplicationsResult {
+	return s.TopNApplicationsBy(n, mode, SortTotal)
+}
+
+// TopNApplicationsBy returns the application protocols ranking first by the sort key.
+func (s *Snapshot) TopNApplicationsBy(n int, mode ViewMode, key SortKey) []ApplicationsResult {
+	var items []ApplicationsResult
+	for k, v := range s.Applications {
+		items = append(items, ApplicationsResult{Application: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNInterfaces returns the devices with the most traffic.
+func (s *Snapshot) TopNInterfaces(n int, mode ViewMode) []InterfacesResult {
+	return s.TopNInterfacesBy(n, mode, SortTotal)
+}
+
+// TopNInterfacesBy returns the devices ranking first by the sort key.
+func (s *Snapshot) TopNInterfacesBy(n int, mode ViewMode, key SortKey) []InterfacesResult {
+	var items []InterfacesResult
+	for k, v := range s.Interfaces {
+		items = append(items, InterfacesResult{Interface: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNRemotePorts returns the remote ports with the most traffic.
+func (s *Snapshot) TopNRemotePorts(n int, mode ViewMode) []RemotePortsResult {
+	return s.TopNRemotePortsBy(n, mode, SortTotal)
+}
+
+// TopNRemotePortsBy returns the remote ports ranking first by the sort key.
+func (s *Snapshot) TopNRemotePortsBy(n int, mode ViewMode, key SortKey) []RemotePortsResult {
+	var items []RemotePortsResult
+	for k, v := range s.RemotePorts {
+		items = append(items, RemotePortsResult{Port: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNUsers returns the users with the most traffic.
+func (s *Snapshot) TopNUsers(n int, mode ViewMode) []UsersResult {
+	return s.TopNUsersBy(n, mode, SortTotal)
+}
+
+// TopNUsersBy returns the users ranking first by the sort key.
+func (s *Snapshot) TopNUsersBy(n int, mode ViewMode, key SortKey) []UsersResult {
+	var items []UsersResult
+	for k, v := range s.Users {
+		items = append(items, UsersResult{User: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNContainers returns the containers with the most traffic.
+func (s *Snapshot) TopNContainers(n int, mode ViewMode) []ContainersResult {
+	return s.TopNContainersBy(n, mode, SortTotal)
+}
+
+// TopNContainersBy returns the containers ranking first by the sort key.
+func (s *Snapshot) TopNContainersBy(n int, mode ViewMode, key SortKey) []ContainersResult {
+	var items []ContainersResult
+	for k, v := range s.Containers {
+		items = append(items, ContainersResult{Container: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNCategories returns the categories of the processes with the most traffic.
+func (s *Snapshot) TopNCategories(n int, mode ViewMode) []CategoriesResult {
+	return s.TopNCategoriesBy(n, mode, SortTotal)
+}
+
+// TopNCategoriesBy returns the categories of the processes ranking first by the sort
+// key.
+func (s *Snapshot) TopNCategoriesBy(n int, mode ViewMode, key SortKey) []CategoriesResult {
+	var items []CategoriesResult
+	for k, v := range s.Categories {
+		items = append(items, CategoriesResult{Category: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
 	}
+	return items[:n]
+}
+
+// TopNCountries returns the countries of the remote ends with the most traffic.
+func (s *Snapshot) TopNCountries(n int, mode ViewMode) []CountriesResult {
+	return s.TopNCountriesBy(n, mode, SortTotal)
+}
+
+// TopNCountriesBy returns the countries of the remote ends ranking first by the sort
+// key.
+func (s *Snapshot) TopNCountriesBy(n int, mode ViewMode, key SortKey) []CountriesResult {
+	var items []CountriesResult
+	for k, v := range s.Countries {
+		items = append(items, CountriesResult{Country: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNASNs returns the autonomous systems of the remote ends with the most traffic.
+func (s *Snapshot) TopNASNs(n int, mode ViewMode) []ASNsResult {
+	return s.TopNASNsBy(n, mode, SortTotal)
+}
+
+// TopNASNsBy returns the autonomous systems of the remote ends ranking first by the
+// sort key.
+func (s *Snapshot) TopNASNsBy(n int, mode ViewMode, key SortKey) []ASNsResult {
+	var items []ASNsResult
+	for k, v := range s.ASNs {
+		items = append(items, ASNsResult{AS: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNView returns the groups of the view of the name with the most traffic, none if
+// no aggregator names it.
+func (s *Snapshot) TopNView(name string, n int, mode ViewMode) []ViewResult {
+	return s.TopNViewBy(name, n, mode, SortTotal)
+}
+
+// TopNViewBy returns the groups of the view of the name ranking first by the sort key.
+func (s *Snapshot) TopNViewBy(name string, n int, mode ViewMode, key SortKey) []ViewResult {
+	var items []ViewResult
+	for k, v := range s.Views[name] {
+		items = append(items, ViewResult{Group: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return s.networkRank(items[i].Data).before(s.networkRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNConnectionsByRTT returns the connections with the longest round-trip times,
+// the connections without RTT samples are left out.
+func (s *Snapshot) TopNConnectionsByRTT(n int) []ConnectionsResult {
+	var items []ConnectionsResult
+	for k, v := range s.Connections {
+		if v.RTT > 0 {
+			items = append(items, ConnectionsResult{Conn: k, Data: v})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Data.RTT > items[j].Data.RTT
+	})
 
 	if len(items) < n {
 		n = len(items)
@@ -117,21 +651,59 @@ func (s *Snapshot) TopNRemoteAddrs(n int, mode ViewMode) []RemoteAddrsResult {
 }
 
 func (s *Snapshot) TopNConnections(n int, mode ViewMode) []ConnectionsResult {
+	return s.TopNConnectionsBy(n, mode, SortTotal)
+}
+
+// TopNConnectionsBy returns the connections ranking first by the sort key, by their
+// packets for SortConnections as they are a connection each.
+func (s *Snapshot) TopNConnectionsBy(n int, mode ViewMode, key SortKey) []ConnectionsResult {
+	// the connections being one each, they rank by their packets
+	if key == SortConnections {
+		key = SortPackets
+	}
+
 	var items []ConnectionsResult
 	for k, v := range s.Connections {
 		items = append(items, ConnectionsResult{Conn: k, Data: v})
 	}
 
-	switch mode {
-	case ModeTableBytes:
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].Data.DownloadBytes+items[i].Data.UploadBytes > items[j].Data.DownloadBytes+items[j].Data.UploadBytes
-		})
-	case ModeTablePackets:
-		sort.Slice(items, func(i, j int) bool {
-			return items[i].Data.DownloadPackets+items[i].Data.UploadPackets > items[j].Data.DownloadPackets+items[j].Data.UploadPackets
-		})
+	sort.Slice(items, func(i, j int) bool {
+		return s.connectionRank(items[i].Data).before(s.connectionRank(items[j].Data), mode, key)
+	})
+
+	if len(items) < n {
+		n = len(items)
+	}
+	return items[:n]
+}
+
+// TopNNeighbors returns the neighbors sending the most ARP/NDP packets.
+func (s *Snapshot) TopNNeighbors(n int) []NeighborsResult {
+	var items []NeighborsResult
+	for k, v := range s.Neighbors {
+		items = append(items, NeighborsResult{Neighbor: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Data.Requests+items[i].Data.Replies > items[j].Data.Requests+items[j].Data.Replies
+	})
+
+	if len(items) < n {
+		n = len(items)
 	}
+	return items[:n]
+}
+
+// TopNDiscoveries returns the devices that announced themselves most recently.
+func (s *Snapshot) TopNDiscoveries(n int) []DiscoveriesResult {
+	var items []DiscoveriesResult
+	for k, v := range s.Discoveries {
+		items = append(items, DiscoveriesResult{IP: k, Data: v})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Data.LastSeen.After(items[j].Data.LastSeen)
+	})
 
 	if len(items) < n {
 		n = len(items)
@@ -140,36 +712,131 @@ func (s *Snapshot) TopNConnections(n int, mode ViewMode) []ConnectionsResult {
 }
 
 type StatsManager struct {
-	ratio int
-	stat  Stat
-	mode  ViewMode
+	interval time.Duration // Interval the counts are averaged a second over, the window once summed up
+	stat     Stat
+	lastPut  time.Time     // When the latest stats were put, zero if none
+	elapsed  time.Duration // Time between the latest stats put or over the window, the interval at first
+	mode     ViewMode
+	goodput  bool
+	loopback bool
+	mirror   bool
+	scope    *Scope // Scope the stats are limited to, nil if none
+	history  *throughputHistory
+	rates    *bandwidthTracker // Peak and average rates of the connections and the processes
+	window   *statWindow       // Window the stats are summed up over, nil if none
+	idle     time.Duration     // Idle timeout of the connections, none if 0
+
+	totals     *cumulativeTotals // Totals of the processes and the remote addresses since started
+	cumulative bool              // Whether the snapshots rank by the totals since started
+
+	stateFile         string        // File the totals are saved to, none if empty
+	stateSaveInterval time.Duration // Interval the totals are saved at
+
+	recorders []IntervalRecorder // Recorders of the rows of each interval
+	session   *SessionRecorder   // Recorder of the stats of each interval, nil if none
+
+	categories *CategoryRules // Rules the processes are categorized by, nil if none
+	tags       *Tags          // Tags of the remote hosts and the connections, nil if none
+
+	aggregators []Aggregator // Aggregators of the views of the user
+
+	watch *processWatch // Process the stats are restricted to along with its children, nil if none
 }
 
 func NewStatsManager(opt Options) *StatsManager {
-	return &StatsManager{
-		ratio: opt.Interval,
-		mode:  opt.ViewMode,
+	s := &StatsManager{
+		interval: opt.interval(),
+		mode:     opt.ViewMode,
+		goodput:  opt.Goodput,
+		loopback: opt.IncludeLoopback,
+		mirror:   opt.Mirror,
+		history:  newThroughputHistory(opt.HistorySize),
+		rates:    newBandwidthTracker(opt.PercentileWindow, opt.RateHistorySize),
+		idle:     opt.IdleTimeout,
+
+		totals:     newCumulativeTotals(),
+		cumulative: opt.Cumulative,
+
+		stateFile:         opt.StateFile,
+		stateSaveInterval: opt.StateSaveInterval,
+	}
+	if opt.Window > 0 {
+		s.window = newStatWindow(opt.Window)
 	}
+	// the options are validated already
+	s.watch, _ = newProcessWatch(opt.WatchPID, opt.WatchProcessName)
+	return s
+}
+
+// evicted reports whether the connection is idle longer than the idle timeout as of
+// the latest stats put.
+func (s *StatsManager) evicted(info *ConnectionInfo) bool {
+	return s.idle > 0 && !info.LastSeen.IsZero() && s.lastPut.Sub(info.LastSeen) > s.idle
 }
 
 func (s *StatsManager) Put(stat Stat) {
-	s.stat = stat
+	s.put(stat, time.Now())
 }
 
-// getProcName is deprecated - process info now comes directly from Segment
-// Kept for backward compatibility with non-Linux systems
-func (s *StatsManager) getProcName(openSockets OpenSockets, localSocket LocalSocket) string {
-	ips := []string{localSocket.IP, "*"}
-	for _, ip := range ips {
-		cloned := localSocket
-		cloned.IP = ip
+// put puts the stats counted until now, since the previous ones were put.
+func (s *StatsManager) put(stat Stat, now time.Time) {
+	s.elapsed = s.interval
+	if !s.lastPut.IsZero() {
+		s.elapsed = now.Sub(s.lastPut)
+	}
+	s.lastPut = now
+	if s.watch != nil {
+		s.watch.refresh()
+	}
 
-		v, ok := openSockets[cloned]
-		if ok {
-			return v.String()
+	// the history, the rates and the totals track the intervals one by one
+	point := s.historyPoint(stat, now)
+	s.history.add(point)
+	s.trackBandwidth(stat, point)
+	s.trackTotals(stat, point)
+	s.saveStateIfDue(now)
+	if len(s.recorders) > 0 {
+		interval := s.storedInterval(stat, point)
+		for _, r := range s.recorders {
+			// a failed record is lost, the next ones going on
+			r.Record(interval)
 		}
 	}
-	return unknownProcessName
+	if s.session != nil {
+		s.session.Record(stat, now)
+	}
+
+	if s.window != nil {
+		stat, s.elapsed = s.window.put(stat, s.elapsed, now)
+		s.interval = s.elapsed
+	}
+	s.stat = stat
+}
+
+// ShiftScope limits the stats to the local traffic, then to the internet traffic and
+// then to none of them in turn.
+func (s *StatsManager) ShiftScope() {
+	switch {
+	case s.scope == nil:
+		local := ScopeLocal
+		s.scope = &local
+	case *s.scope == ScopeLocal:
+		internet := ScopeInternet
+		s.scope = &internet
+	default:
+		s.scope = nil
+	}
+}
+
+// SetViewMode sets the view mode the stats are got for, every view being counted from
+// the same stats so nothing counted so far is lost.
+func (s *StatsManager) SetViewMode(mode ViewMode) {
+	s.mode = mode
+}
+
+// SetLoopback sets whether the traffic captured on the loopback devices is counted.
+func (s *StatsManager) SetLoopback(loopback bool) {
+	s.loopback = loopback
 }
 
 func (s *StatsManager) GetStats() interface{} {
@@ -185,13 +852,18 @@ func (s *StatsManager) getNetworkData() *NetworkData {
 
 	stat := s.stat
 	for conn, info := range stat.Utilization {
-		// For Linux: skip if process info is not available
-		if info.Process == nil {
-			// For non-Linux: fallback to getProcName
-			procName := s.getProcName(stat.OpenSockets, conn.Local)
-			if procName == unknownProcessName {
-				continue // Skip unknown processes
-			}
+		if info.Loopback && !s.loopback {
+			continue
+		}
+		if s.scope != nil && info.Scope != *s.scope {
+			continue
+		}
+		// Skip unknown processes
+		if info.Process == nil && !s.mirror {
+			continue
+		}
+		if s.watch != nil && !s.watch.watches(info.Process) {
+			continue
 		}
 
 		if !visited[conn] {
@@ -206,57 +878,200 @@ func (s *StatsManager) getNetworkData() *NetworkData {
 	}
 
 	return &NetworkData{
-		UploadBytes:     uploadBytes / s.ratio,
-		DownloadBytes:   downloadBytes / s.ratio,
-		UploadPackets:   uploadPackets / s.ratio,
-		DownloadPackets: downloadPackets / s.ratio,
+		UploadBytes:     perSecond(uploadBytes, s.interval),
+		DownloadBytes:   perSecond(downloadBytes, s.interval),
+		UploadPackets:   perSecond(uploadPackets, s.interval),
+		DownloadPackets: perSecond(downloadPackets, s.interval),
 		ConnCount:       connections,
 	}
 }
 
+// processName returns the name the traffic of the connection is accounted to by the
+// processes, false if left out as of an unknown process, of a process not watched or
+// of a loopback device while not counted.
+func (s *StatsManager) processName(conn Connection, info *ConnectionInfo) (string, bool) {
+	if info.Loopback && !s.loopback {
+		return "", false
+	}
+	if s.watch != nil && !s.watch.watches(info.Process) {
+		return "", false
+	}
+	switch {
+	case conn.Overflow():
+		return OverflowIP, true
+	case s.mirror:
+		// the traffic on a mirror port is grouped by the local hosts
+		return conn.Local.IP, true
+	case info.Process != nil:
+		return info.Process.String(), true
+	}
+	return "", false
+}
+
+// remoteName returns the name the traffic of the connection is accounted to by the
+// remote addresses.
+func remoteName(conn Connection, info *ConnectionInfo) string {
+	if conn.Overflow() {
+		return OverflowIP
+	}
+	// multicast and broadcast traffic is tied to no remote host
+	if info.Cast != CastUnicast {
+		return "<" + info.Cast.String() + ">"
+	}
+	// the label of the user is preferred to any name, the server name learned from the
+	// payload to the reverse DNS
+	if info.ServerName != "" && !info.Labeled {
+		return info.ServerName
+	}
+	return conn.Remote.IP
+}
+
 func (s *StatsManager) getSnapshot() *Snapshot {
 	processes := map[string]*NetworkData{}
 	remoteAddr := map[string]*NetworkData{}
+	applications := map[ApplicationProtocol]*NetworkData{}
+	families := map[AddressFamily]*NetworkData{}
+	interfaces := map[string]*NetworkData{}
+	remotePorts := map[RemotePort]*NetworkData{}
+	users := map[string]*NetworkData{}
+	containers := map[string]*NetworkData{}
+	categories := map[string]*NetworkData{}
+	views := make(map[string]map[string]*NetworkData, len(s.aggregators))
+	for _, a := range s.aggregators {
+		views[a.Name()] = map[string]*NetworkData{}
+	}
+	countries := map[string]*NetworkData{}
+	asns := map[string]*NetworkData{}
+	remoteLocations := map[string]*Location{}
+	unattributed := map[UnattributedReason]*NetworkData{}
+	scopes := map[Scope]*NetworkData{}
 	connections := map[Connection]*ConnectionData{}
 	visited := map[Connection]bool{}
+	throughput := &NetworkData{}
 	var totalUploadBytes, totalDownloadBytes, totalUploadPackets, totalDownloadPackets, totalConnections int
+	var totalUploadPayloadBytes, totalDownloadPayloadBytes, evicted int
 
 	stat := s.stat
 	for conn, info := range stat.Utilization {
-		var procName string
-		// For Linux: use embedded process info
-		if info.Process != nil {
-			procName = info.Process.String()
-		} else {
-			// For non-Linux: fallback to getProcName
-			procName = s.getProcName(stat.OpenSockets, conn.Local)
-			if procName == unknownProcessName {
-				continue // Skip unknown processes
+		if s.loopback || !info.Loopback {
+			throughput.ConnCount++
+			throughput.add(info)
+		}
+
+		// the traffic of unknown processes is left out of the rest, but for why
+		if reason := info.Unattributed; reason != "" && !s.mirror && (s.loopback || !info.Loopback) &&
+			(s.scope == nil || info.Scope == *s.scope) {
+			if _, ok := unattributed[reason]; !ok {
+				unattributed[reason] = &NetworkData{}
+			}
+			unattributed[reason].ConnCount++
+			unattributed[reason].add(info)
+		}
+
+		procName, ok := s.processName(conn, info)
+		if !ok {
+			continue // Skip unknown processes
+		}
+
+		// the totals of the scopes ignore the scope the stats are limited to
+		if _, ok := scopes[info.Scope]; !ok {
+			scopes[info.Scope] = &NetworkData{}
+		}
+		scopes[info.Scope].ConnCount++
+		scopes[info.Scope].add(info)
+		if s.scope != nil && info.Scope != *s.scope {
+			continue
+		}
+
+		// the idle connections are left out of the tables alike, their traffic staying
+		// in the totals only
+		if s.evicted(info) {
+			if !visited[conn] {
+				evicted++
 			}
+			totalUploadPackets += info.UploadPackets
+			totalDownloadPackets += info.DownloadPackets
+			totalUploadBytes += info.UploadBytes
+			totalDownloadBytes += info.DownloadBytes
+			totalUploadPayloadBytes += info.UploadPayloadBytes
+			totalDownloadPayloadBytes += info.DownloadPayloadBytes
+			visited[conn] = true
+			continue
 		}
-		
+
 		if _, ok := connections[conn]; !ok {
 			connections[conn] = &ConnectionData{
 				InterfaceName: info.Interface,
 				ProcessName:   procName,
+				ServerName:    info.ServerName,
+				RemoteOS:      info.RemoteOS,
+				CommunityID:   conn.CommunityID(),
+				Labeled:       info.Labeled,
+				Application:   info.ApplicationProtocol,
+				RTT:           info.RTT,
+				KernelTCP:     info.KernelTCP,
+				FirstSeen:     info.FirstSeen,
+				LastSeen:      info.LastSeen,
+				LocalWindow:   info.LocalWindow,
+				RemoteWindow:  info.RemoteWindow,
+			}
+
+			// the RTT measured by the kernel stands in until the packets give a sample
+			if info.RTT == 0 && info.KernelTCP != nil {
+				connections[conn].RTT = info.KernelTCP.RTT
 			}
 		}
 		connections[conn].UploadBytes += info.UploadBytes
 		connections[conn].DownloadBytes += info.DownloadBytes
+		connections[conn].UploadPayloadBytes += info.UploadPayloadBytes
+		connections[conn].DownloadPayloadBytes += info.DownloadPayloadBytes
 		connections[conn].UploadPackets += info.UploadPackets
 		connections[conn].DownloadPackets += info.DownloadPackets
+		connections[conn].RetransmittedPackets += info.RetransmittedPackets
+		connections[conn].RetransmittedBytes += info.RetransmittedBytes
+		connections[conn].LocalZeroWindows += info.LocalZeroWindows
+		connections[conn].RemoteZeroWindows += info.RemoteZeroWindows
+		connections[conn].DupACKs += info.DupACKs
+		connections[conn].OutOfOrderPackets += info.OutOfOrderPackets
+		connections[conn].CorruptPackets += info.CorruptPackets
 
-		if _, ok := remoteAddr[conn.Remote.IP]; !ok {
-			remoteAddr[conn.Remote.IP] = &NetworkData{}
+		remote := remoteName(conn, info)
+		if _, ok := remoteAddr[remote]; !ok {
+			remoteAddr[remote] = &NetworkData{}
 		}
 		if !visited[conn] {
 			totalConnections++
-			remoteAddr[conn.Remote.IP].ConnCount++
+			remoteAddr[remote].ConnCount++
+		}
+		remoteAddr[remote].UploadBytes += info.UploadBytes
+		remoteAddr[remote].DownloadBytes += info.DownloadBytes
+		remoteAddr[remote].UploadPayloadBytes += info.UploadPayloadBytes
+		remoteAddr[remote].DownloadPayloadBytes += info.DownloadPayloadBytes
+		remoteAddr[remote].UploadPackets += info.UploadPackets
+		remoteAddr[remote].DownloadPackets += info.DownloadPackets
+		remoteAddr[remote].addProtocol(conn.Local.Protocol, info, visited[conn])
+
+		if info.Location != nil {
+			remoteLocations[remote] = info.Location
+		}
+		if country := info.Location.countryCode(); country != "" {
+			if _, ok := countries[country]; !ok {
+				countries[country] = &NetworkData{}
+			}
+			if !visited[conn] {
+				countries[country].ConnCount++
+			}
+			countries[country].add(info)
+		}
+		if as := info.Location.AS(); as != "" {
+			if _, ok := asns[as]; !ok {
+				asns[as] = &NetworkData{}
+			}
+			if !visited[conn] {
+				asns[as].ConnCount++
+			}
+			asns[as].add(info)
 		}
-		remoteAddr[conn.Remote.IP].UploadBytes += info.UploadBytes
-		remoteAddr[conn.Remote.IP].DownloadBytes += info.UploadBytes
-		remoteAddr[conn.Remote.IP].UploadPackets += info.UploadPackets
-		remoteAddr[conn.Remote.IP].DownloadPackets += info.DownloadPackets
 
 		if _, ok := processes[procName]; !ok {
 			processes[procName] = &NetworkData{}
@@ -264,36 +1079,252 @@ func (s *StatsManager) getSnapshot() *Snapshot {
 		if !visited[conn] {
 			processes[procName].ConnCount++
 		}
+		app := info.ApplicationProtocol
+		if app == "" {
+			app = ApplicationProtocol(conn.Local.Protocol)
+		}
+		if _, ok := applications[app]; !ok {
+			applications[app] = &NetworkData{}
+		}
+		if !visited[conn] {
+			applications[app].ConnCount++
+		}
+		applications[app].UploadBytes += info.UploadBytes
+		applications[app].DownloadBytes += info.DownloadBytes
+		applications[app].UploadPayloadBytes += info.UploadPayloadBytes
+		applications[app].DownloadPayloadBytes += info.DownloadPayloadBytes
+		applications[app].UploadPackets += info.UploadPackets
+		applications[app].DownloadPackets += info.DownloadPackets
+
+		if _, ok := families[info.Family]; !ok {
+			families[info.Family] = &NetworkData{}
+		}
+		if !visited[conn] {
+			families[info.Family].ConnCount++
+		}
+		families[info.Family].add(info)
+
+		// the connections polled in place of the capture were seen on no device
+		if info.Interface != "" {
+			if _, ok := interfaces[info.Interface]; !ok {
+				interfaces[info.Interface] = &NetworkData{}
+			}
+			if !visited[conn] {
+				interfaces[info.Interface].ConnCount++
+			}
+			interfaces[info.Interface].add(info)
+		}
+
+		// the ports of the other protocols stand for no service
+		if proto := conn.Local.Protocol; proto == ProtoTCP || proto == ProtoUDP {
+			port := RemotePort{Port: conn.Remote.Port, Protocol: proto}
+			if _, ok := remotePorts[port]; !ok {
+				remotePorts[port] = &NetworkData{}
+			}
+			if !visited[conn] {
+				remotePorts[port].ConnCount++
+			}
+			remotePorts[port].add(info)
+		}
+
 		processes[procName].UploadBytes += info.UploadBytes
 		processes[procName].DownloadBytes += info.DownloadBytes
+		processes[procName].UploadPayloadBytes += info.UploadPayloadBytes
+		processes[procName].DownloadPayloadBytes += info.DownloadPayloadBytes
 		processes[procName].UploadPackets += info.UploadPackets
 		processes[procName].DownloadPackets += info.DownloadPackets
+		processes[procName].addProtocol(conn.Local.Protocol, info, visited[conn])
+
+		if info.Process != nil && !s.mirror {
+			user := info.Process.User
+			if user == "" {
+				user = unknownUserName
+			}
+			if _, ok := users[user]; !ok {
+				users[user] = &NetworkData{}
+			}
+			if !visited[conn] {
+				users[user].ConnCount++
+			}
+			users[user].add(info)
+		}
+
+		if info.Process != nil && info.Process.Container != "" {
+			container := info.Process.Container
+			if _, ok := containers[container]; !ok {
+				containers[container] = &NetworkData{}
+			}
+			if !visited[conn] {
+				containers[container].ConnCount++
+			}
+			containers[container].add(info)
+		}
+
+		if info.Process != nil && !s.mirror && s.categories != nil {
+			category := s.categories.Categorize(info.Process)
+			if _, ok := categories[category]; !ok {
+				categories[category] = &NetworkData{}
+			}
+			if !visited[conn] {
+				categories[category].ConnCount++
+			}
+			categories[category].add(info)
+		}
+
+		for _, a := range s.aggregators {
+			group, ok := a.Group(conn, info)
+			if !ok {
+				continue
+			}
+			view := views[a.Name()]
+			if _, ok := view[group]; !ok {
+				view[group] = &NetworkData{}
+			}
+			if !visited[conn] {
+				view[group].ConnCount++
+			}
+			view[group].add(info)
+		}
 
 		totalUploadPackets += info.UploadPackets
 		totalDownloadPackets += info.DownloadPackets
 		totalUploadBytes += info.UploadBytes
 		totalDownloadBytes += info.DownloadBytes
+		totalUploadPayloadBytes += info.UploadPayloadBytes
+		totalDownloadPayloadBytes += info.DownloadPayloadBytes
 		visited[conn] = true
 	}
 
-	for _, v := range processes {
-		v.DivideBy(s.ratio)
+	// the rates go by the time actually elapsed, the rest by the interval
+	for k, v := range processes {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+		if b, ok := s.rates.processes[k]; ok {
+			v.Bandwidth = b.Bandwidth
+		}
 	}
 	for _, v := range remoteAddr {
-		v.DivideBy(s.ratio)
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range applications {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
 	}
-	for _, v := range connections {
-		v.DivideBy(s.ratio)
+	for _, v := range families {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range interfaces {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range remotePorts {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range users {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range containers {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range categories {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, view := range views {
+		for _, v := range view {
+			v.setRates(s.elapsed)
+			v.PerSecond(s.interval)
+		}
+	}
+	for _, v := range countries {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range asns {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range unattributed {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	for _, v := range scopes {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+	}
+	throughput.setRates(s.elapsed)
+	throughput.PerSecond(s.interval)
+	for k, v := range connections {
+		v.setRates(s.elapsed)
+		v.PerSecond(s.interval)
+		if b, ok := s.rates.connections[k]; ok {
+			v.Bandwidth = b.Bandwidth
+		}
+	}
+
+	var tags map[string][]string
+	if s.tags != nil {
+		tags = s.tags.All()
+	}
+
+	neighbors := make(Neighbors)
+	for k, v := range stat.Neighbors {
+		cloned := *v
+		cloned.PerSecond(s.interval)
+		neighbors[k] = &cloned
 	}
 
-	return &Snapshot{
+	snapshot := &Snapshot{
 		Processes:            processes,
 		RemoteAddrs:          remoteAddr,
+		Applications:         applications,
+		Families:             families,
+		Interfaces:           interfaces,
+		RemotePorts:          remotePorts,
+		Users:                users,
+		Containers:           containers,
+		Categories:           categories,
+		Countries:            countries,
+		ASNs:                 asns,
+		RemoteLocations:      remoteLocations,
+		Scopes:               scopes,
+		Scope:                s.scope,
 		Connections:          connections,
-		TotalUploadBytes:     totalUploadBytes / s.ratio,
-		TotalDownloadBytes:   totalDownloadBytes / s.ratio,
-		TotalUploadPackets:   totalUploadPackets / s.ratio,
-		TotalDownloadPackets: totalDownloadPackets / s.ratio,
+		EvictedConnections:   evicted,
+		Neighbors:            neighbors,
+		Discoveries:          stat.Discoveries,
+		DHCPEvents:           stat.DHCPEvents,
+		ConnectionEvents:     stat.ConnectionEvents,
+		ActiveConnections:    stat.ActiveConnections,
+		Elapsed:              s.elapsed,
+		Monitor:              stat.Monitor,
+		Degraded:             stat.Degraded,
+		TotalUploadBytes:     perSecond(totalUploadBytes, s.interval),
+		TotalDownloadBytes:   perSecond(totalDownloadBytes, s.interval),
+		TotalUploadPackets:   perSecond(totalUploadPackets, s.interval),
+		TotalDownloadPackets: perSecond(totalDownloadPackets, s.interval),
 		TotalConnections:     totalConnections,
+
+		TotalUploadPayloadBytes:   perSecond(totalUploadPayloadBytes, s.interval),
+		TotalDownloadPayloadBytes: perSecond(totalDownloadPayloadBytes, s.interval),
+		Goodput:                   s.goodput,
+
+		ProcessTotals:    sumTotals(s.totals.processes, s.scope),
+		RemoteAddrTotals: sumTotals(s.totals.remoteAddrs, s.scope),
+		Cumulative:       s.cumulative,
+
+		Unattributed: unattributed,
+		Tags:         tags,
+		Views:        views,
+		Throughput:   throughput,
+	}
+	if s.watch != nil {
+		snapshot.Watch, snapshot.Watched = s.watch.String(), s.watch.watched()
 	}
+	return snapshot
 }
@@ -0,0 +1,398 @@
+package sniffer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRates(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	stat := Stat{Utilization: Utilization{conn: {
+		Process:       &ProcessInfo{Pid: 1, Name: "curl"},
+		UploadBytes:   3000,
+		DownloadBytes: 6000,
+	}}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	now := time.Now()
+
+	// the first stats go by the interval
+	s.put(stat, now)
+	snapshot := s.getSnapshot()
+	assert.Equal(t, 2*time.Second, snapshot.Elapsed)
+	assert.Equal(t, 1500.0, snapshot.Connections[conn].UploadRate)
+
+	s.put(stat, now.Add(3*time.Second))
+	snapshot = s.getSnapshot()
+	assert.Equal(t, 3*time.Second, snapshot.Elapsed)
+	assert.Equal(t, 1000.0, snapshot.Connections[conn].UploadRate)
+	assert.Equal(t, 2000.0, snapshot.Connections[conn].DownloadRate)
+	assert.Equal(t, 1500, snapshot.Connections[conn].UploadBytes)
+
+	process := snapshot.Processes["<1>:curl"]
+	assert.Equal(t, 1000.0, process.UploadRate)
+	assert.Equal(t, 2000.0, process.DownloadRate)
+	remote := snapshot.RemoteAddrs["1.1.1.1"]
+	assert.Equal(t, 1000.0, remote.UploadRate)
+	assert.Equal(t, 2000.0, remote.DownloadRate)
+}
+
+func TestSnapshotSubSecondInterval(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: curl, UploadBytes: 1000, UploadPackets: 3},
+	}}
+
+	s := NewStatsManager(Options{RefreshInterval: 250 * time.Millisecond})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	// the counts of a quarter of a second make four times as much a second
+	assert.Equal(t, 4000, snapshot.Processes[curl.String()].UploadBytes)
+	assert.Equal(t, 12, snapshot.Processes[curl.String()].UploadPackets)
+	assert.Equal(t, 4000, snapshot.TotalUploadBytes)
+	assert.Equal(t, 4000.0, snapshot.Processes[curl.String()].UploadRate)
+}
+
+func TestTopNBySortKey(t *testing.T) {
+	snapshot := &Snapshot{
+		Processes: map[string]*NetworkData{
+			"<1>:curl":    {UploadBytes: 90000, UploadPackets: 60, ConnCount: 1},
+			"<2>:nmap":    {UploadBytes: 6000, DownloadBytes: 4000, UploadPackets: 100, DownloadPackets: 50, ConnCount: 100},
+			"<3>:healthd": {UploadBytes: 3000, UploadPackets: 300, ConnCount: 1},
+		},
+		Connections: map[Connection]*ConnectionData{
+			{Local: LocalSocket{Port: 1}}: {UploadBytes: 90000, UploadPackets: 60},
+			{Local: LocalSocket{Port: 2}}: {UploadBytes: 3000, UploadPackets: 300},
+		},
+	}
+
+	names := func(results []ProcessesResult) []string {
+		var names []string
+		for _, r := range results {
+			names = append(names, r.ProcessName)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"<1>:curl", "<2>:nmap", "<3>:healthd"}, names(snapshot.TopNProcessesBy(3, ModeTableBytes, SortTotal)))
+	// the ties of the connections go by the bytes of the bytes mode
+	assert.Equal(t, []string{"<2>:nmap", "<1>:curl", "<3>:healthd"}, names(snapshot.TopNProcessesBy(3, ModeTableBytes, SortConnections)))
+	assert.Equal(t, []string{"<3>:healthd", "<2>:nmap", "<1>:curl"}, names(snapshot.TopNProcessesBy(3, ModeTableBytes, SortPackets)))
+	assert.Equal(t, []string{"<2>:nmap", "<1>:curl"}, names(snapshot.TopNProcessesBy(2, ModeTableBytes, SortDownload)))
+	// the upload goes by the packets in the packets mode
+	assert.Equal(t, []string{"<3>:healthd", "<2>:nmap", "<1>:curl"}, names(snapshot.TopNProcessesBy(3, ModeTablePackets, SortUpload)))
+	assert.Equal(t, []string{"<1>:curl", "<2>:nmap", "<3>:healthd"}, names(snapshot.TopNProcessesBy(3, ModeTableBytes, SortUpload)))
+
+	// the connections rank by their packets for their count
+	assert.Equal(t, uint16(2), snapshot.TopNConnectionsBy(1, ModeTableBytes, SortConnections)[0].Conn.Local.Port)
+	assert.Equal(t, uint16(1), snapshot.TopNConnections(1, ModeTableBytes)[0].Conn.Local.Port)
+}
+
+func TestSortKeyNext(t *testing.T) {
+	assert.Equal(t, SortUpload, SortTotal.next())
+	assert.Equal(t, SortTotal, SortConnections.next())
+	assert.Equal(t, SortUpload, SortKey("").next())
+	assert.Error(t, SortKey("bytes").Validate())
+}
+
+func TestSnapshotInterfaces(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Interface: "eth0", Process: curl, UploadBytes: 4000, DownloadPackets: 2},
+		{Local: LocalSocket{Port: 2}}: {Interface: "eth0", Process: curl, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3}}: {Interface: "wlan0", Process: curl, UploadBytes: 8000},
+		{Local: LocalSocket{Port: 4}}: {Process: curl},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.Interfaces, 2)
+	eth0 := snapshot.Interfaces["eth0"]
+	assert.Equal(t, 2, eth0.ConnCount)
+	assert.Equal(t, 2000, eth0.UploadBytes)
+	assert.Equal(t, 1000, eth0.DownloadBytes)
+	assert.Equal(t, 1, eth0.DownloadPackets)
+
+	top := snapshot.TopNInterfaces(2, ModeTableBytes)
+	assert.Equal(t, "wlan0", top[0].Interface)
+	assert.Equal(t, "eth0", snapshot.TopNInterfacesBy(1, ModeTableBytes, SortConnections)[0].Interface)
+}
+
+func TestSnapshotRemotePorts(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}: {Process: curl, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "8.8.8.8", Port: 443}}: {Process: curl, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3, Protocol: ProtoUDP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}: {Process: curl, UploadBytes: 100},
+		{Local: LocalSocket{Port: 7, Protocol: ProtoICMP}, Remote: RemoteSocket{IP: "1.1.1.1"}}:           {Process: curl, UploadBytes: 64},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.RemotePorts, 2)
+	https := snapshot.RemotePorts[RemotePort{Port: 443, Protocol: ProtoTCP}]
+	assert.Equal(t, 2, https.ConnCount)
+	assert.Equal(t, 2000, https.UploadBytes)
+	assert.Equal(t, 1000, https.DownloadBytes)
+	assert.Equal(t, RemotePort{Port: 443, Protocol: ProtoTCP}, snapshot.TopNRemotePorts(1, ModeTableBytes)[0].Port)
+}
+
+func TestSnapshotProtocolSubtotals(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1, Protocol: ProtoTCP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}: {Process: curl, UploadBytes: 4000, UploadPackets: 4},
+		{Local: LocalSocket{Port: 2, Protocol: ProtoUDP}, Remote: RemoteSocket{IP: "1.1.1.1", Port: 443}}: {Process: curl, DownloadBytes: 6000, DownloadPackets: 6},
+		{Local: LocalSocket{Port: 3, Protocol: ProtoUDP}, Remote: RemoteSocket{IP: "8.8.8.8", Port: 53}}:  {Process: curl, UploadBytes: 200},
+		{Local: LocalSocket{Port: 7, Protocol: ProtoICMP}, Remote: RemoteSocket{IP: "8.8.8.8"}}:           {Process: curl, UploadBytes: 64},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	process := snapshot.Processes["<1>:curl"]
+	assert.Equal(t, 1, process.TCP.ConnCount)
+	assert.Equal(t, 2000, process.TCP.UploadBytes)
+	assert.Equal(t, 2, process.TCP.UploadPackets)
+	assert.Equal(t, 2, process.UDP.ConnCount)
+	assert.Equal(t, 100, process.UDP.UploadBytes)
+	assert.Equal(t, 3000, process.UDP.DownloadBytes)
+	assert.Equal(t, 3000.0, process.UDP.DownloadRate)
+
+	remote := snapshot.RemoteAddrs["8.8.8.8"]
+	assert.Nil(t, remote.TCP)
+	assert.Equal(t, 100, remote.UDP.UploadBytes)
+	assert.Nil(t, snapshot.Interfaces["eth0"])
+}
+
+func TestSnapshotUsers(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl", User: "alice"}
+	wget := &ProcessInfo{Pid: 2, Name: "wget", User: "alice"}
+	sshd := &ProcessInfo{Pid: 3, Name: "sshd", User: "root"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: curl, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2}}: {Process: wget, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3}}: {Process: sshd, UploadBytes: 200},
+		{Local: LocalSocket{Port: 4}}: {Process: &ProcessInfo{Pid: 4, Name: "nginx"}, UploadBytes: 100},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableUsers})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.Users, 3)
+	alice := snapshot.Users["alice"]
+	assert.Equal(t, 2, alice.ConnCount)
+	assert.Equal(t, 2000, alice.UploadBytes)
+	assert.Equal(t, 1000, alice.DownloadBytes)
+	assert.Equal(t, 50, snapshot.Users[unknownUserName].UploadBytes)
+	assert.Equal(t, "alice", snapshot.TopNUsers(1, ModeTableBytes)[0].User)
+}
+
+func TestSnapshotContainers(t *testing.T) {
+	nginx := &ProcessInfo{Pid: 1, Name: "nginx", Container: "0123456789ab"}
+	redis := &ProcessInfo{Pid: 2, Name: "redis", Container: "ba9876543210"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: nginx, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2}}: {Process: nginx, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3}}: {Process: redis, UploadBytes: 200},
+		{Local: LocalSocket{Port: 4}}: {Process: &ProcessInfo{Pid: 3, Name: "sshd"}, UploadBytes: 100},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableContainers})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.Containers, 2)
+	assert.Equal(t, 2, snapshot.Containers["0123456789ab"].ConnCount)
+	assert.Equal(t, 2000, snapshot.Containers["0123456789ab"].UploadBytes)
+	assert.Equal(t, "0123456789ab", snapshot.TopNContainers(1, ModeTableBytes)[0].Container)
+	assert.Equal(t, "ba9876543210", snapshot.TopNContainersBy(2, ModeTableBytes, SortConnections)[1].Container)
+}
+
+func TestSnapshotCategories(t *testing.T) {
+	rules, err := parseCategoryRules(strings.NewReader("browser name ^(chrome|firefox)"))
+	assert.NoError(t, err)
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: &ProcessInfo{Pid: 1, Name: "chrome"}, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2}}: {Process: &ProcessInfo{Pid: 2, Name: "firefox"}, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3}}: {Process: &ProcessInfo{Pid: 3, Name: "sshd"}, UploadBytes: 200},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableCategories})
+	s.SetCategories(rules)
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.Categories, 2)
+	assert.Equal(t, 2, snapshot.Categories["browser"].ConnCount)
+	assert.Equal(t, 2000, snapshot.Categories["browser"].UploadBytes)
+	assert.Equal(t, 1000, snapshot.Categories["browser"].DownloadBytes)
+	assert.Equal(t, 100, snapshot.Categories[uncategorizedName].UploadBytes)
+	assert.Equal(t, "browser", snapshot.TopNCategories(1, ModeTableBytes)[0].Category)
+
+}
+
+func TestSnapshotApplicationsMode(t *testing.T) {
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1, Protocol: ProtoTCP}}: {Process: &ProcessInfo{Pid: 1, Name: "ssh"}, FlowInfo: FlowInfo{ApplicationProtocol: "ssh"}, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2, Protocol: ProtoTCP}}: {Process: &ProcessInfo{Pid: 2, Name: "curl"}, FlowInfo: FlowInfo{ApplicationProtocol: "tls"}, DownloadBytes: 6000},
+		{Local: LocalSocket{Port: 3, Protocol: ProtoUDP}}: {Process: &ProcessInfo{Pid: 3, Name: "app"}, UploadBytes: 200},
+	}}
+
+	assert.NoError(t, ModeTableApplications.Validate())
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableApplications})
+	s.put(stat, time.Now())
+	snapshot := s.GetStats().(*Snapshot)
+
+	// the unclassified connections count toward their transport protocol
+	top := snapshot.TopNApplicationsBy(3, ModeTableBytes, SortUpload)
+	assert.Len(t, top, 3)
+	assert.Equal(t, ApplicationProtocol("ssh"), top[0].Application)
+	assert.Equal(t, 2000, top[0].Data.UploadBytes)
+	assert.Equal(t, ApplicationProtocol(ProtoUDP), top[1].Application)
+	assert.Equal(t, ApplicationProtocol("tls"), snapshot.TopNApplications(1, ModeTableBytes)[0].Application)
+}
+
+func TestSetViewMode(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}, Remote: RemoteSocket{IP: "1.1.1.1"}}:  {Process: curl, Scope: ScopeInternet, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2}, Remote: RemoteSocket{IP: "10.0.0.2"}}: {Process: curl, Scope: ScopeLocal, DownloadBytes: 2000},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes, HistorySize: 4})
+	s.put(stat, time.Now())
+	s.ShiftScope()
+
+	// the plot goes by the stats already counted, limited to the same scope
+	s.SetViewMode(ModePlotProcesses)
+	data := s.GetStats().(*NetworkData)
+	assert.Equal(t, 1, data.ConnCount)
+	assert.Equal(t, 1000, data.DownloadBytes)
+
+	s.SetViewMode(ModeTableUsers)
+	snapshot := s.GetStats().(*Snapshot)
+	assert.Equal(t, 1, snapshot.Processes[curl.String()].ConnCount)
+	assert.Len(t, s.History(), 1)
+}
+
+func TestSnapshotUnattributed(t *testing.T) {
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Unattributed: UnattributedNoSocket, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2}}: {Unattributed: UnattributedNoSocket, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3}}: {Process: &ProcessInfo{Name: "uid 1000"}, Unattributed: UnattributedDenied, UploadBytes: 200},
+		{Local: LocalSocket{Port: 4}}: {Process: &ProcessInfo{Pid: 4, Name: "nginx"}, UploadBytes: 100},
+		{Local: LocalSocket{Port: 5}}: {Unattributed: UnattributedNamespace, Loopback: true, UploadBytes: 100},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	// the loopback traffic is left out unless shown
+	assert.Len(t, snapshot.Unattributed, 2)
+	assert.Equal(t, 2, snapshot.Unattributed[UnattributedNoSocket].ConnCount)
+	assert.Equal(t, 2000, snapshot.Unattributed[UnattributedNoSocket].UploadBytes)
+	assert.Equal(t, 1000, snapshot.Unattributed[UnattributedNoSocket].DownloadBytes)
+	assert.Equal(t, 1, snapshot.Unattributed[UnattributedDenied].ConnCount)
+
+	// the users named after their uid still show up as processes
+	assert.Len(t, snapshot.Processes, 2)
+}
+
+func TestSnapshotCountries(t *testing.T) {
+	london := &Location{Country: "GB", CountryName: "United Kingdom", City: "London", ASN: 20712}
+	sydney := &Location{Country: "AU", CountryName: "Australia", City: "Sydney", ASN: 13335, ASOrg: "CLOUDFLARENET"}
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}, Remote: RemoteSocket{IP: "81.2.69.142"}}: {Process: curl, Location: london, UploadBytes: 4000},
+		{Local: LocalSocket{Port: 2}, Remote: RemoteSocket{IP: "81.2.69.143"}}: {Process: curl, Location: london, DownloadBytes: 2000},
+		{Local: LocalSocket{Port: 3}, Remote: RemoteSocket{IP: "1.1.1.1"}}:     {Process: curl, Location: sydney, UploadBytes: 200},
+		{Local: LocalSocket{Port: 4}, Remote: RemoteSocket{IP: "10.0.0.2"}}:    {Process: curl, UploadBytes: 100},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.Countries, 2)
+	assert.Equal(t, 2, snapshot.Countries["GB"].ConnCount)
+	assert.Equal(t, 2000, snapshot.Countries["GB"].UploadBytes)
+	assert.Equal(t, "GB", snapshot.TopNCountries(1, ModeTableBytes)[0].Country)
+
+	assert.Len(t, snapshot.ASNs, 2)
+	assert.Equal(t, 100, snapshot.ASNs["AS13335 CLOUDFLARENET"].UploadBytes)
+	assert.Equal(t, "AS20712", snapshot.TopNASNs(1, ModeTableBytes)[0].AS)
+
+	top := snapshot.TopNRemoteAddrs(4, ModeTableBytes)
+	assert.Equal(t, "81.2.69.142", top[0].Addr)
+	assert.Equal(t, london, top[0].Location)
+	assert.Nil(t, top[3].Location)
+}
+
+func TestSnapshotHostLabels(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}, Remote: RemoteSocket{IP: "staging-k8s"}}: {Process: curl, Labeled: true, FlowInfo: FlowInfo{ServerName: "api.staging.internal"}, UploadBytes: 400},
+		{Local: LocalSocket{Port: 2}, Remote: RemoteSocket{IP: "10.3.0.1"}}:    {Process: curl, FlowInfo: FlowInfo{ServerName: "example.com"}, UploadBytes: 200},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	// the label of the user is preferred to the server name
+	top := snapshot.TopNRemoteAddrs(2, ModeTableBytes)
+	assert.Equal(t, "staging-k8s", top[0].Addr)
+	assert.Equal(t, "example.com", top[1].Addr)
+}
+
+func TestSnapshotThroughput(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: curl, UploadBytes: 400, UploadPackets: 4},
+		{Local: LocalSocket{Port: 2}}: {Unattributed: UnattributedNoSocket, DownloadBytes: 2000, DownloadPackets: 2},
+		{Local: LocalSocket{Port: 3}}: {Process: curl, Loopback: true, UploadBytes: 100},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2})
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	// the unattributed traffic counts, the loopback one does not
+	assert.Equal(t, 2, snapshot.Throughput.ConnCount)
+	assert.Equal(t, 200, snapshot.Throughput.UploadBytes)
+	assert.Equal(t, 1000, snapshot.Throughput.DownloadBytes)
+	assert.Equal(t, 2, snapshot.Throughput.UploadPackets)
+	assert.Equal(t, 200, snapshot.TotalUploadBytes)
+	assert.Equal(t, 0, snapshot.TotalDownloadBytes)
+}
+
+func TestStatsManagerSetLoopback(t *testing.T) {
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: curl, UploadBytes: 400},
+		{Local: LocalSocket{Port: 2}}: {Process: curl, Loopback: true, UploadBytes: 100},
+	}}
+
+	// the loopback traffic is captured while left out, so the toggle counts it right away
+	s := NewStatsManager(Options{Interval: 2})
+	s.put(stat, time.Now())
+	assert.Equal(t, 200, s.getSnapshot().TotalUploadBytes)
+
+	s.SetLoopback(true)
+	snapshot := s.getSnapshot()
+	assert.Equal(t, 250, snapshot.TotalUploadBytes)
+	assert.Equal(t, 2, snapshot.TotalConnections)
+}
@@ -0,0 +1,161 @@
+package sniffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateVersion is the version of the state file, the files of the other versions
+// being ignored.
+const stateVersion = 1
+
+// savedTotal is the totals of a process or a remote address in the state file.
+type savedTotal struct {
+	Name                 string `json:"name"`
+	Scope                string `json:"scope"`
+	UploadBytes          int    `json:"upload_bytes"`
+	DownloadBytes        int    `json:"download_bytes"`
+	UploadPayloadBytes   int    `json:"upload_payload_bytes"`
+	DownloadPayloadBytes int    `json:"download_payload_bytes"`
+	UploadPackets        int    `json:"upload_packets"`
+	DownloadPackets      int    `json:"download_packets"`
+	Connections          int    `json:"connections"`
+}
+
+// savedState is the state file, the cumulative totals as of when saved.
+type savedState struct {
+	Version     int          `json:"version"`
+	Saved       time.Time    `json:"saved"`
+	Processes   []savedTotal `json:"processes"`
+	RemoteAddrs []savedTotal `json:"remote_addrs"`
+}
+
+func saveTotals(totals map[totalsKey]*NetworkData) []savedTotal {
+	saved := make([]savedTotal, 0, len(totals))
+	for k, v := range totals {
+		saved = append(saved, savedTotal{
+			Name:                 k.name,
+			Scope:                k.scope.String(),
+			UploadBytes:          v.UploadBytes,
+			DownloadBytes:        v.DownloadBytes,
+			UploadPayloadBytes:   v.UploadPayloadBytes,
+			DownloadPayloadBytes: v.DownloadPayloadBytes,
+			UploadPackets:        v.UploadPackets,
+			DownloadPackets:      v.DownloadPackets,
+			Connections:          v.ConnCount,
+		})
+	}
+	return saved
+}
+
+func restoreTotals(totals map[totalsKey]*NetworkData, saved []savedTotal) {
+	for _, t := range saved {
+		scope := ScopeInternet
+		if t.Scope == ScopeLocal.String() {
+			scope = ScopeLocal
+		}
+		key := totalsKey{t.Name, scope}
+		data, ok := totals[key]
+		if !ok {
+			data = &NetworkData{}
+			totals[key] = data
+		}
+		data.UploadBytes += t.UploadBytes
+		data.DownloadBytes += t.DownloadBytes
+		data.UploadPayloadBytes += t.UploadPayloadBytes
+		data.DownloadPayloadBytes += t.DownloadPayloadBytes
+		data.UploadPackets += t.UploadPackets
+		data.DownloadPackets += t.DownloadPackets
+		data.ConnCount += t.Connections
+	}
+}
+
+// save writes the totals to the file, through a temporary file renamed over it not to
+// leave it half written.
+func (t *cumulativeTotals) save(path string, now time.Time) error {
+	b, err := json.Marshal(savedState{
+		Version:     stateVersion,
+		Saved:       now,
+		Processes:   saveTotals(t.processes),
+		RemoteAddrs: saveTotals(t.remoteAddrs),
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	t.saved = now
+	return nil
+}
+
+// load adds the totals saved in the file, if any.
+func (t *cumulativeTotals) load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state savedState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	if state.Version != stateVersion {
+		return nil
+	}
+	restoreTotals(t.processes, state.Processes)
+	restoreTotals(t.remoteAddrs, state.RemoteAddrs)
+	return nil
+}
+
+// LoadState restores the totals since started from Options.StateFile, as saved before
+// the sniffer restarted. Nothing is restored without a state file.
+func (s *StatsManager) LoadState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+	return s.totals.load(s.stateFile)
+}
+
+// SaveState saves the totals since started to Options.StateFile, if any.
+func (s *StatsManager) SaveState() error {
+	if s.stateFile == "" {
+		return nil
+	}
+	return s.totals.save(s.stateFile, time.Now())
+}
+
+// saveStateIfDue saves the totals once Options.StateSaveInterval has elapsed since
+// last saved, the failures being retried on the next interval.
+func (s *StatsManager) saveStateIfDue(now time.Time) {
+	if s.stateFile == "" {
+		return
+	}
+	if t := s.totals.saved; t.IsZero() || now.Sub(t) >= s.stateSaveInterval {
+		if err := s.totals.save(s.stateFile, now); err != nil {
+			s.totals.saved = now
+		}
+	}
+}
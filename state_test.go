@@ -0,0 +1,51 @@
+package sniffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	opt := Options{Interval: 2, ViewMode: ModeTableBytes, StateFile: path, StateSaveInterval: time.Minute}
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}, Remote: RemoteSocket{IP: "1.1.1.1"}}: {Process: curl, UploadBytes: 4000, Scope: ScopeLocal},
+	}}
+
+	now := time.Now()
+	s := NewStatsManager(opt)
+	assert.NoError(t, s.LoadState())
+	s.put(stat, now)
+	assert.FileExists(t, path)
+
+	// saved once the interval elapses only
+	s.put(stat, now.Add(30*time.Second))
+	restored := NewStatsManager(opt)
+	assert.NoError(t, restored.LoadState())
+	assert.Equal(t, 4000, restored.totals.processes[totalsKey{"<1>:curl", ScopeLocal}].UploadBytes)
+
+	assert.NoError(t, s.SaveState())
+	restored = NewStatsManager(opt)
+	assert.NoError(t, restored.LoadState())
+	assert.Equal(t, 8000, restored.totals.processes[totalsKey{"<1>:curl", ScopeLocal}].UploadBytes)
+	assert.Equal(t, 1, restored.totals.remoteAddrs[totalsKey{"1.1.1.1", ScopeLocal}].ConnCount)
+
+	// the totals go on from the restored ones
+	restored.put(stat, now.Add(time.Minute))
+	snapshot := restored.getSnapshot()
+	assert.Equal(t, 12000, snapshot.ProcessTotals["<1>:curl"].UploadBytes)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	assert.Error(t, NewStatsManager(opt).LoadState())
+	assert.NoError(t, NewStatsManager(Options{StateFile: filepath.Join(dir, "missing")}).LoadState())
+}
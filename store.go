@@ -0,0 +1,379 @@
+package sniffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// storeFileName is the file of the history store in its directory.
+const storeFileName = "sniffer.db"
+
+// storeTimeout is how long the history store waits for the database locked by another
+// sniffer.
+const storeTimeout = 10 * time.Second
+
+// storeBucket is the bucket of the intervals of the history store.
+var storeBucket = []byte("intervals")
+
+// StoredRow is the traffic of a process or a remote address over an interval, or over
+// a range of intervals as summed up by the queries.
+type StoredRow struct {
+	Name            string `json:"name"`
+	UploadBytes     int    `json:"upload_bytes"`
+	DownloadBytes   int    `json:"download_bytes"`
+	UploadPackets   int    `json:"upload_packets"`
+	DownloadPackets int    `json:"download_packets"`
+	Connections     int    `json:"connections"`
+}
+
+func (r *StoredRow) add(other StoredRow) {
+	r.UploadBytes += other.UploadBytes
+	r.DownloadBytes += other.DownloadBytes
+	r.UploadPackets += other.UploadPackets
+	r.DownloadPackets += other.DownloadPackets
+	r.Connections += other.Connections
+}
+
+// StoredInterval is the aggregated rows of an interval as recorded in the store.
+type StoredInterval struct {
+	Time        time.Time   `json:"time"` // When the interval ended
+	Elapsed     float64     `json:"elapsed_seconds"`
+	Processes   []StoredRow `json:"processes"`
+	RemoteAddrs []StoredRow `json:"remote_addrs"`
+}
+
+// IntervalRecorder records the rows of each interval, as the HistoryStore does.
+type IntervalRecorder interface {
+	Record(interval StoredInterval) error
+	Close() error
+}
+
+// HistoryStore records the rows of each interval to a bbolt database in a directory,
+// keyed by the time the interval ended, the intervals past the retention being
+// removed. The database is open for each record and query only, so that another
+// sniffer queries it while this one records.
+type HistoryStore struct {
+	path      string
+	retention time.Duration // How long the intervals are kept, forever if 0
+}
+
+// OpenHistoryStore opens the store of the directory, created if missing.
+func OpenHistoryStore(dir string, retention time.Duration) (*HistoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	st := &HistoryStore{path: filepath.Join(dir, storeFileName), retention: retention}
+	if err := st.update(func(*bolt.Bucket) error { return nil }); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// update runs fn over the intervals in a read-write transaction, waiting for the
+// other sniffers to be done with the database.
+func (st *HistoryStore) update(fn func(*bolt.Bucket) error) error {
+	db, err := bolt.Open(st.path, 0644, &bolt.Options{Timeout: storeTimeout})
+	if err != nil {
+		return fmt.Errorf("open %s: %v", st.path, err)
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(storeBucket)
+		if err != nil {
+			return err
+		}
+		return fn(bucket)
+	})
+}
+
+// view runs fn over the intervals in a read-only transaction.
+func (st *HistoryStore) view(fn func(*bolt.Bucket) error) error {
+	db, err := bolt.Open(st.path, 0644, &bolt.Options{Timeout: storeTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("open %s: %v", st.path, err)
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(storeBucket)
+		if bucket == nil {
+			return nil
+		}
+		return fn(bucket)
+	})
+}
+
+// storeKey returns the key of an interval ended at t, the sequence telling apart the
+// intervals ended at once.
+func storeKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// Record puts the interval to the store, removing the intervals past the retention.
+func (st *HistoryStore) Record(interval StoredInterval) error {
+	b, err := json.Marshal(interval)
+	if err != nil {
+		return err
+	}
+
+	return st.update(func(bucket *bolt.Bucket) error {
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(storeKey(interval.Time, seq), b); err != nil {
+			return err
+		}
+		if st.retention <= 0 {
+			return nil
+		}
+		return removeExpired(bucket, interval.Time.Add(-st.retention))
+	})
+}
+
+// removeExpired removes the intervals ended before the time.
+func removeExpired(bucket *bolt.Bucket, before time.Time) error {
+	end := storeKey(before, 0)
+	var keys [][]byte
+	c := bucket.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query returns the intervals ended within [from, to), from the oldest to the latest.
+func (st *HistoryStore) Query(from, to time.Time) ([]StoredInterval, error) {
+	var intervals []StoredInterval
+	err := st.view(func(bucket *bolt.Bucket) error {
+		end := storeKey(to, 0)
+		c := bucket.Cursor()
+		for k, v := c.Seek(storeKey(from, 0)); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var interval StoredInterval
+			if err := json.Unmarshal(v, &interval); err != nil {
+				return fmt.Errorf("read %s: %v", st.path, err)
+			}
+			intervals = append(intervals, interval)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return intervals, nil
+}
+
+// TopTalkers returns the n processes and the n remote addresses with the most bytes
+// over the intervals ended within [from, to).
+func (st *HistoryStore) TopTalkers(from, to time.Time, n int) ([]StoredRow, []StoredRow, error) {
+	processes, remoteAddrs, err := st.sum(from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	return topRows(processes, n), topRows(remoteAddrs, n), nil
+}
+
+// RowChange is the traffic of a process or a remote address over two ranges of
+// intervals, none over the range it was not seen in.
+type RowChange struct {
+	Name   string
+	Before StoredRow
+	After  StoredRow
+}
+
+// Change returns the change of the bytes from the earlier range to the later one.
+func (c RowChange) Change() int {
+	return c.After.UploadBytes + c.After.DownloadBytes - c.Before.UploadBytes - c.Before.DownloadBytes
+}
+
+// Compare returns the n processes and the n remote addresses whose bytes changed the
+// most from the intervals ended within [beforeFrom, beforeTo) to the ones ended within
+// [afterFrom, afterTo), e.g. over the last 5 minutes against the previous 5 minutes.
+func (st *HistoryStore) Compare(beforeFrom, beforeTo, afterFrom, afterTo time.Time, n int) ([]RowChange, []RowChange, error) {
+	beforeProcesses, beforeRemoteAddrs, err := st.sum(beforeFrom, beforeTo)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterProcesses, afterRemoteAddrs, err := st.sum(afterFrom, afterTo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return topChanges(beforeProcesses, afterProcesses, n), topChanges(beforeRemoteAddrs, afterRemoteAddrs, n), nil
+}
+
+// sum sums the rows of the processes and of the remote addresses of the intervals ended
+// within [from, to) up by their names.
+func (st *HistoryStore) sum(from, to time.Time) (map[string]*StoredRow, map[string]*StoredRow, error) {
+	intervals, err := st.Query(from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	processes := make(map[string]*StoredRow)
+	remoteAddrs := make(map[string]*StoredRow)
+	for _, interval := range intervals {
+		sumRows(processes, interval.Processes)
+		sumRows(remoteAddrs, interval.RemoteAddrs)
+	}
+	return processes, remoteAddrs, nil
+}
+
+func sumRows(sums map[string]*StoredRow, rows []StoredRow) {
+	for _, row := range rows {
+		sum, ok := sums[row.Name]
+		if !ok {
+			sum = &StoredRow{Name: row.Name}
+			sums[row.Name] = sum
+		}
+		sum.add(row)
+	}
+}
+
+func topRows(sums map[string]*StoredRow, n int) []StoredRow {
+	rows := make([]StoredRow, 0, len(sums))
+	for _, row := range sums {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i].UploadBytes+rows[i].DownloadBytes, rows[j].UploadBytes+rows[j].DownloadBytes
+		if a != b {
+			return a > b
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	if len(rows) < n {
+		n = len(rows)
+	}
+	return rows[:n]
+}
+
+// topChanges returns the n rows whose bytes changed the most from the earlier sums to
+// the later ones, either way.
+func topChanges(before, after map[string]*StoredRow, n int) []RowChange {
+	changes := make(map[string]*RowChange)
+	for name, row := range before {
+		changes[name] = &RowChange{Name: name, Before: *row, After: StoredRow{Name: name}}
+	}
+	for name, row := range after {
+		change, ok := changes[name]
+		if !ok {
+			change = &RowChange{Name: name, Before: StoredRow{Name: name}}
+			changes[name] = change
+		}
+		change.After = *row
+	}
+
+	rows := make([]RowChange, 0, len(changes))
+	for _, change := range changes {
+		rows = append(rows, *change)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i].Change(), rows[j].Change()
+		if a < 0 {
+			a = -a
+		}
+		if b < 0 {
+			b = -b
+		}
+		if a != b {
+			return a > b
+		}
+		return rows[i].Name < rows[j].Name
+	})
+	if len(rows) < n {
+		n = len(rows)
+	}
+	return rows[:n]
+}
+
+// Close closes the store, the database being open for each record and query only.
+func (st *HistoryStore) Close() error {
+	return nil
+}
+
+// parseQueryTime parses the bound of a query, a time in RFC 3339 or a duration before
+// now, e.g. 8h, now if empty.
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, neither RFC 3339 nor a duration", value)
+	}
+	return t, nil
+}
+
+// storedInterval sums the rows of the stats up as an interval of the store, leaving
+// out the same connections as the history.
+func (s *StatsManager) storedInterval(stat Stat, point HistoryPoint) StoredInterval {
+	processes := make(map[string]*StoredRow)
+	remoteAddrs := make(map[string]*StoredRow)
+	for conn, info := range stat.Utilization {
+		procName, ok := s.processName(conn, info)
+		if !ok {
+			continue
+		}
+		row := StoredRow{
+			UploadBytes:     info.UploadBytes,
+			DownloadBytes:   info.DownloadBytes,
+			UploadPackets:   info.UploadPackets,
+			DownloadPackets: info.DownloadPackets,
+			Connections:     1,
+		}
+		row.Name = procName
+		sumRows(processes, []StoredRow{row})
+		row.Name = remoteName(conn, info)
+		sumRows(remoteAddrs, []StoredRow{row})
+	}
+
+	return StoredInterval{
+		Time:        point.Time,
+		Elapsed:     point.Elapsed.Seconds(),
+		Processes:   topRows(processes, len(processes)),
+		RemoteAddrs: topRows(remoteAddrs, len(remoteAddrs)),
+	}
+}
+
+// AddRecorder records the rows of each interval put from now on to the recorder.
+func (s *StatsManager) AddRecorder(r IntervalRecorder) {
+	s.recorders = append(s.recorders, r)
+}
+
+// CloseRecorders closes the recorders and the session, returning the first error.
+func (s *StatsManager) CloseRecorders() error {
+	var first error
+	for _, r := range s.recorders {
+		if err := r.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.recorders = nil
+	if s.session != nil {
+		if err := s.session.Close(); err != nil && first == nil {
+			first = err
+		}
+		s.session = nil
+	}
+	return first
+}
@@ -0,0 +1,106 @@
+package sniffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenHistoryStore(dir, 48*time.Hour)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	night := time.Date(2022, 1, 1, 23, 0, 0, 0, time.UTC)
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.AddRecorder(store)
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	backup := &ProcessInfo{Pid: 2, Name: "backup"}
+	for i := 0; i < 4; i++ {
+		s.put(Stat{Utilization: Utilization{
+			{Local: LocalSocket{Port: 1}, Remote: RemoteSocket{IP: "1.1.1.1"}}: {Process: curl, UploadBytes: 100},
+			{Local: LocalSocket{Port: 2}, Remote: RemoteSocket{IP: "8.8.8.8"}}: {Process: backup, UploadBytes: 1000, DownloadPackets: 1},
+		}}, night.Add(time.Duration(i)*time.Hour))
+	}
+
+	assert.FileExists(t, filepath.Join(dir, "sniffer.db"))
+
+	intervals, err := store.Query(night, night.Add(3*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, intervals, 3)
+	assert.Equal(t, night.Add(time.Hour), intervals[1].Time)
+
+	processes, remoteAddrs, err := store.TopTalkers(night.Add(time.Hour), night.Add(4*time.Hour), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []StoredRow{{Name: "<2>:backup", UploadBytes: 3000, DownloadPackets: 3, Connections: 3}}, processes)
+	assert.Equal(t, "8.8.8.8", remoteAddrs[0].Name)
+
+	// the intervals past the retention are removed on each record
+	assert.NoError(t, store.Record(StoredInterval{Time: night.Add(50 * time.Hour)}))
+	intervals, err = store.Query(night, night.Add(51*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, intervals, 3)
+	assert.Equal(t, night.Add(2*time.Hour), intervals[0].Time)
+}
+
+func TestHistoryStoreCompare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenHistoryStore(dir, 0)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.Record(StoredInterval{
+		Time:        now.Add(-8 * time.Minute),
+		Processes:   []StoredRow{{Name: "curl", UploadBytes: 100}, {Name: "backup", UploadBytes: 5000}},
+		RemoteAddrs: []StoredRow{{Name: "8.8.8.8", UploadBytes: 5100}},
+	}))
+	assert.NoError(t, store.Record(StoredInterval{
+		Time:        now.Add(-2 * time.Minute),
+		Processes:   []StoredRow{{Name: "curl", UploadBytes: 300}, {Name: "sync", DownloadBytes: 2000}},
+		RemoteAddrs: []StoredRow{{Name: "8.8.8.8", UploadBytes: 2300}},
+	}))
+
+	processes, remoteAddrs, err := store.Compare(now.Add(-10*time.Minute), now.Add(-5*time.Minute), now.Add(-5*time.Minute), now, 2)
+	assert.NoError(t, err)
+
+	// the processes gone and new count as of no traffic in the other range
+	assert.Len(t, processes, 2)
+	assert.Equal(t, "backup", processes[0].Name)
+	assert.Equal(t, -5000, processes[0].Change())
+	assert.Equal(t, "sync", processes[1].Name)
+	assert.Equal(t, 2000, processes[1].Change())
+	assert.Equal(t, []RowChange{{
+		Name:   "8.8.8.8",
+		Before: StoredRow{Name: "8.8.8.8", UploadBytes: 5100},
+		After:  StoredRow{Name: "8.8.8.8", UploadBytes: 2300},
+	}}, remoteAddrs)
+}
+
+func TestParseQueryTime(t *testing.T) {
+	now := time.Date(2022, 1, 2, 6, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Time{
+		"":                     now,
+		"8h":                   now.Add(-8 * time.Hour),
+		"2022-01-01T22:00:00Z": time.Date(2022, 1, 1, 22, 0, 0, 0, time.UTC),
+	} {
+		parsed, err := parseQueryTime(value, now)
+		assert.NoError(t, err)
+		assert.True(t, expected.Equal(parsed), value)
+	}
+
+	_, err := parseQueryTime("last night", now)
+	assert.Error(t, err)
+}
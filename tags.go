@@ -0,0 +1,165 @@
+package sniffer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tags holds the tags of the remote hosts and of the connections to their ports, e.g.
+// known-good backup or investigate, saved to a file so they show up on the next runs.
+// The remote hosts go by their names in the remote addresses table, the connections to
+// a port by the host and the port, e.g. 10.2.0.5:22 or [2001:db8::1]:443.
+type Tags struct {
+	path string
+
+	mu   sync.Mutex
+	tags map[string][]string
+}
+
+// OpenTags reads the tags saved in the file, none if it is missing yet.
+func OpenTags(path string) (*Tags, error) {
+	t := &Tags{path: path, tags: make(map[string][]string)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &t.tags); err != nil {
+		return nil, fmt.Errorf("invalid tags file %s: %v", path, err)
+	}
+	return t, nil
+}
+
+// connectionTarget returns the target of the tags of the connections to the port of the
+// remote host.
+func connectionTarget(host string, port uint16) string {
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+// All returns a copy of the tags of every target.
+func (t *Tags) All() map[string][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	all := make(map[string][]string, len(t.tags))
+	for target, tags := range t.tags {
+		all[target] = append([]string(nil), tags...)
+	}
+	return all
+}
+
+// Tag adds the tag to the target and saves the tags.
+func (t *Tags) Tag(target, tag string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, existing := range t.tags[target] {
+		if existing == tag {
+			return nil
+		}
+	}
+	t.tags[target] = append(t.tags[target], tag)
+	sort.Strings(t.tags[target])
+	return t.save()
+}
+
+// Untag removes the tag from the target and saves the tags.
+func (t *Tags) Untag(target, tag string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tags := t.tags[target]
+	for i, existing := range tags {
+		if existing != tag {
+			continue
+		}
+		tags = append(tags[:i], tags[i+1:]...)
+		if len(tags) == 0 {
+			delete(t.tags, target)
+		} else {
+			t.tags[target] = tags
+		}
+		return t.save()
+	}
+	return nil
+}
+
+// Apply runs a tag command as typed in the UI, "<target> <tag>" tagging the target and
+// "<target> -<tag>" untagging it, the tag taking the rest of the line. It returns what
+// it did.
+func (t *Tags) Apply(cmd string) (string, error) {
+	fields := strings.Fields(cmd)
+	if len(fields) < 2 {
+		return "", errors.New("want <target> <tag> or <target> -<tag>")
+	}
+	target := fields[0]
+	tag := strings.Join(fields[1:], " ")
+	if strings.HasPrefix(tag, "-") {
+		tag = strings.TrimSpace(tag[1:])
+		if tag == "" {
+			return "", errors.New("empty tag")
+		}
+		return fmt.Sprintf("Untagged %s: %s", target, tag), t.Untag(target, tag)
+	}
+	return fmt.Sprintf("Tagged %s: %s", target, tag), t.Tag(target, tag)
+}
+
+// save writes the tags to the file, through a temporary file renamed over it not to
+// leave it half written.
+func (t *Tags) save() error {
+	b, err := json.MarshalIndent(t.tags, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(t.path), filepath.Base(t.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// TagsOf returns the tags of the targets as of the snapshot, in order and without
+// duplicates.
+func (s *Snapshot) TagsOf(targets ...string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		for _, tag := range s.Tags[target] {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// SetTags shows the tags in the snapshots from now on.
+func (s *StatsManager) SetTags(tags *Tags) {
+	s.tags = tags
+}
@@ -0,0 +1,72 @@
+package sniffer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer-tags")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tags.json")
+
+	tags, err := OpenTags(path)
+	assert.NoError(t, err)
+	msg, err := tags.Apply("203.0.113.7 investigate")
+	assert.NoError(t, err)
+	assert.Equal(t, "Tagged 203.0.113.7: investigate", msg)
+	_, err = tags.Apply("10.2.0.5:22 known-good backup")
+	assert.NoError(t, err)
+	_, err = tags.Apply("203.0.113.7 exfil?")
+	assert.NoError(t, err)
+	_, err = tags.Apply("203.0.113.7")
+	assert.Error(t, err)
+
+	// the tags show up on the next runs
+	reopened, err := OpenTags(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"203.0.113.7": {"exfil?", "investigate"},
+		"10.2.0.5:22": {"known-good backup"},
+	}, reopened.All())
+
+	_, err = reopened.Apply("203.0.113.7 -investigate")
+	assert.NoError(t, err)
+	_, err = reopened.Apply("10.2.0.5:22 -known-good backup")
+	assert.NoError(t, err)
+	reopened, err = OpenTags(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"203.0.113.7": {"exfil?"}}, reopened.All())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0644))
+	_, err = OpenTags(path)
+	assert.Error(t, err)
+}
+
+func TestSnapshotTags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sniffer-tags")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tags, err := OpenTags(filepath.Join(dir, "tags.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, tags.Tag("10.2.0.5", "backup"))
+	assert.NoError(t, tags.Tag(connectionTarget("10.2.0.5", 22), "investigate"))
+	assert.NoError(t, tags.Tag(connectionTarget("2001:db8::1", 443), "cdn"))
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.SetTags(tags)
+	s.put(Stat{}, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Equal(t, []string{"backup", "investigate"}, snapshot.TagsOf("10.2.0.5", connectionTarget("10.2.0.5", 22)))
+	assert.Equal(t, []string{"backup"}, snapshot.TagsOf("10.2.0.5", connectionTarget("10.2.0.5", 443)))
+	assert.Equal(t, []string{"cdn"}, snapshot.TagsOf("[2001:db8::1]:443"))
+	assert.Nil(t, snapshot.TagsOf("10.2.0.6"))
+}
@@ -0,0 +1,308 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// seqLess compares TCP sequence numbers modulo 2^32.
+func seqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// tcpSegmentEnd returns the sequence number following the segment, SYN and FIN occupy
+// a sequence number each.
+func tcpSegmentEnd(tcp *layers.TCP) uint32 {
+	end := tcp.Seq + uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN {
+		end++
+	}
+	return end
+}
+
+// tcpTimestamps returns the values of the timestamps option of the segment.
+func tcpTimestamps(tcp *layers.TCP) (tsVal, tsEcr uint32, ok bool) {
+	for _, opt := range tcp.Options {
+		if opt.OptionType == layers.TCPOptionKindTimestamps && len(opt.OptionData) == 8 {
+			return binary.BigEndian.Uint32(opt.OptionData), binary.BigEndian.Uint32(opt.OptionData[4:]), true
+		}
+	}
+	return 0, 0, false
+}
+
+// TCPState is the lifecycle state of a TCP connection as seen on the wire.
+type TCPState uint8
+
+const (
+	TCPStateNone        TCPState = iota // no segment seen yet
+	TCPStateOpening                     // SYN seen, handshake in progress
+	TCPStateEstablished                 // handshake completed or joined midstream
+	TCPStateClosing                     // FIN seen in one direction
+	TCPStateClosed                      // FIN seen in both directions or reset
+)
+
+func (s TCPState) String() string {
+	switch s {
+	case TCPStateOpening:
+		return "opening"
+	case TCPStateEstablished:
+		return "established"
+	case TCPStateClosing:
+		return "closing"
+	case TCPStateClosed:
+		return "closed"
+	}
+	return "none"
+}
+
+// ConnectionEventType is a change in the lifecycle of a TCP connection.
+type ConnectionEventType string
+
+const (
+	ConnectionOpen  ConnectionEventType = "open"
+	ConnectionClose ConnectionEventType = "close"
+	ConnectionReset ConnectionEventType = "reset"
+)
+
+// ConnectionEvent is a TCP connection opening or closing.
+type ConnectionEvent struct {
+	Time       time.Time
+	Interface  string
+	Connection Connection
+	Type       ConnectionEventType
+}
+
+// tcpWindowScale returns the shift count of the window scale option of the segment.
+func tcpWindowScale(tcp *layers.TCP) (uint8, bool) {
+	for _, opt := range tcp.Options {
+		if opt.OptionType == layers.TCPOptionKindWindowScale && len(opt.OptionData) == 1 {
+			return opt.OptionData[0], true
+		}
+	}
+	return 0, false
+}
+
+// tcpDirection is the state of one direction of a TCP connection.
+type tcpDirection struct {
+	started bool
+	nextSeq uint32 // sequence number following the highest one sent
+
+	windowScale uint8
+	scaling     bool   // whether the SYN offered window scaling
+	window      uint32 // latest receive window advertised, scaled
+	windowKnown bool
+
+	// the latest sequence numbers skipped, by loss or reordering
+	hole               bool
+	holeStart, holeEnd uint32
+	holeTime           time.Time
+
+	lastAck    uint32
+	lastWindow uint16 // unscaled window of the latest acknowledgement
+	ackKnown   bool
+}
+
+// tcpState is the state of a TCP connection learned from its headers.
+type tcpState struct {
+	upload, download tcpDirection
+
+	state                  TCPState
+	finUpload, finDownload bool
+
+	// the RTT is sampled from one uploaded segment at a time
+	srtt       time.Duration
+	timestamps bool      // whether the connection uses the timestamps option
+	tsVal      uint32    // TSval whose echo completes the pending sample
+	tsSent     time.Time // time the TSval was first sent, zero if no sample is pending
+	rttSeq     uint32    // acknowledgement number completing the pending sample
+	rttSent    time.Time // time the sampled segment was sent, zero if no sample is pending
+}
+
+func (t *tcpState) direction(d Direction) *tcpDirection {
+	if d == DirectionUpload {
+		return &t.upload
+	}
+	return &t.download
+}
+
+// inspect labels the segment with what its TCP header tells about the connection.
+func (t *tcpState) inspect(seg *Segment, tcp *layers.TCP) {
+	t.lifecycle(seg, tcp)
+	t.retransmission(seg, tcp)
+	t.sampleRTT(seg, tcp)
+	t.duplicateACK(seg, tcp)
+	t.receiveWindow(seg, tcp)
+	seg.TCPState = t.state
+}
+
+// receiveWindow follows the receive window advertised by the sender of the segment,
+// a window shrinking to zero means the receiving application can't keep up.
+func (t *tcpState) receiveWindow(seg *Segment, tcp *layers.TCP) {
+	dir := t.direction(seg.Direction)
+
+	// the window of a SYN is never scaled, the later ones are if both ends offered it
+	if tcp.SYN {
+		dir.windowScale, dir.scaling = tcpWindowScale(tcp)
+		dir.window, dir.windowKnown = uint32(tcp.Window), true
+		return
+	}
+	if tcp.RST {
+		return
+	}
+
+	window := uint32(tcp.Window)
+	if t.upload.scaling && t.download.scaling {
+		window <<= dir.windowScale
+	}
+	if window == 0 && (dir.window != 0 || !dir.windowKnown) {
+		seg.ZeroWindow = true
+	}
+	dir.window, dir.windowKnown = window, true
+}
+
+// lifecycle follows the connection through the handshake and teardown.
+func (t *tcpState) lifecycle(seg *Segment, tcp *layers.TCP) {
+	// a new connection reusing the tuple of a closed one
+	if tcp.SYN && !tcp.ACK && t.state == TCPStateClosed {
+		*t = tcpState{}
+	}
+
+	switch {
+	case t.state == TCPStateClosed:
+		return
+	case tcp.RST:
+		t.state, seg.TCPEvent = TCPStateClosed, ConnectionReset
+		return
+	case t.state == TCPStateNone && tcp.SYN:
+		t.state, seg.TCPEvent = TCPStateOpening, ConnectionOpen
+	case t.state == TCPStateNone:
+		t.state = TCPStateEstablished
+	case t.state == TCPStateOpening && tcp.ACK && !tcp.SYN:
+		t.state = TCPStateEstablished
+	}
+
+	if !tcp.FIN {
+		return
+	}
+	if seg.Direction == DirectionUpload {
+		t.finUpload = true
+	} else {
+		t.finDownload = true
+	}
+	t.state = TCPStateClosing
+	if t.finUpload && t.finDownload {
+		t.state, seg.TCPEvent = TCPStateClosed, ConnectionClose
+	}
+}
+
+func (t *tcpState) retransmission(seg *Segment, tcp *layers.TCP) {
+	dir := t.direction(seg.Direction)
+	length := uint32(len(tcp.Payload))
+	end := tcpSegmentEnd(tcp)
+	if end == tcp.Seq {
+		return
+	}
+
+	if !dir.started {
+		dir.started, dir.nextSeq = true, end
+		return
+	}
+
+	// keep-alive probes resend the last byte on purpose
+	keepAlive := length <= 1 && !tcp.SYN && !tcp.FIN && tcp.Seq == dir.nextSeq-1
+	switch {
+	case seqLess(dir.nextSeq, tcp.Seq):
+		// segments are missing, remember the latest hole
+		dir.hole, dir.holeStart, dir.holeEnd, dir.holeTime = true, dir.nextSeq, tcp.Seq, seg.Timestamp
+
+	case seqLess(tcp.Seq, dir.nextSeq) && !keepAlive:
+		// a segment filling the hole within a round trip was reordered rather than resent
+		if dir.hole && !seqLess(tcp.Seq, dir.holeStart) && seqLess(tcp.Seq, dir.holeEnd) &&
+			(t.srtt == 0 || seg.Timestamp.Sub(dir.holeTime) < t.srtt) {
+			seg.OutOfOrder = true
+			if tcp.Seq == dir.holeStart {
+				dir.holeStart = end
+			}
+			dir.hole = seqLess(dir.holeStart, dir.holeEnd)
+			break
+		}
+
+		seg.Retransmission = true
+		seg.RetransmittedBytes = int(length)
+		if resent := dir.nextSeq - tcp.Seq; resent < length {
+			seg.RetransmittedBytes = int(resent)
+		}
+	}
+	if seqLess(dir.nextSeq, end) {
+		dir.nextSeq = end
+	}
+}
+
+// duplicateACK spots the pure ACKs repeating the previous acknowledgement while data
+// is outstanding, which receivers send on every segment past a missing one.
+func (t *tcpState) duplicateACK(seg *Segment, tcp *layers.TCP) {
+	dir, peer := &t.upload, &t.download
+	if seg.Direction == DirectionDownload {
+		dir, peer = peer, dir
+	}
+	if !tcp.ACK {
+		return
+	}
+
+	pure := len(tcp.Payload) == 0 && !tcp.SYN && !tcp.FIN && !tcp.RST
+	if pure && dir.ackKnown && tcp.Ack == dir.lastAck && tcp.Window == dir.lastWindow &&
+		peer.started && seqLess(tcp.Ack, peer.nextSeq) {
+		seg.DupACK = true
+	}
+	dir.lastAck, dir.lastWindow, dir.ackKnown = tcp.Ack, tcp.Window, true
+}
+
+// sampleRTT times the round trip from an uploaded segment to the downloaded segment
+// acknowledging it, by the echo of the TCP timestamps if the connection uses them and
+// by the acknowledgement number otherwise.
+func (t *tcpState) sampleRTT(seg *Segment, tcp *layers.TCP) {
+	tsVal, tsEcr, hasTimestamps := tcpTimestamps(tcp)
+
+	if seg.Direction == DirectionUpload {
+		switch {
+		case hasTimestamps:
+			t.timestamps = true
+			if t.tsSent.IsZero() {
+				t.tsVal, t.tsSent = tsVal, seg.Timestamp
+			}
+
+		case !t.timestamps && tcpSegmentEnd(tcp) != tcp.Seq:
+			// the acknowledgement of a retransmitted segment is ambiguous (Karn's algorithm)
+			if seg.Retransmission {
+				t.rttSent = time.Time{}
+			} else if t.rttSent.IsZero() {
+				t.rttSeq, t.rttSent = tcpSegmentEnd(tcp), seg.Timestamp
+			}
+		}
+		return
+	}
+
+	switch {
+	case hasTimestamps && !t.tsSent.IsZero() && tsEcr == t.tsVal:
+		t.updateRTT(seg.Timestamp.Sub(t.tsSent))
+		t.tsSent = time.Time{}
+
+	case !t.timestamps && tcp.ACK && !t.rttSent.IsZero() && !seqLess(tcp.Ack, t.rttSeq):
+		t.updateRTT(seg.Timestamp.Sub(t.rttSent))
+		t.rttSent = time.Time{}
+	}
+}
+
+// updateRTT smooths the RTT samples as RFC 6298 does.
+func (t *tcpState) updateRTT(sample time.Duration) {
+	if sample <= 0 {
+		return
+	}
+	if t.srtt == 0 {
+		t.srtt = sample
+		return
+	}
+	t.srtt += (sample - t.srtt) / 8
+}
@@ -0,0 +1,156 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPRetransmission(t *testing.T) {
+	var state tcpState
+	send := func(seq uint32, n int, syn bool) *Segment {
+		seg := &Segment{Direction: DirectionUpload}
+		tcp := &layers.TCP{Seq: seq, SYN: syn}
+		tcp.Payload = make([]byte, n)
+		state.inspect(seg, tcp)
+		return seg
+	}
+
+	assert.False(t, send(1000, 0, true).Retransmission)
+	assert.True(t, send(1000, 0, true).Retransmission)
+	assert.False(t, send(1001, 100, false).Retransmission)
+	assert.False(t, send(1101, 100, false).Retransmission)
+
+	seg := send(1001, 100, false)
+	assert.True(t, seg.Retransmission)
+	assert.Equal(t, 100, seg.RetransmittedBytes)
+
+	// a segment overlapping the sent data only retransmits the overlap
+	seg = send(1151, 100, false)
+	assert.True(t, seg.Retransmission)
+	assert.Equal(t, 50, seg.RetransmittedBytes)
+
+	// keep-alive probe
+	assert.False(t, send(1250, 1, false).Retransmission)
+
+	// sequence numbers wrap around
+	state = tcpState{}
+	send(0xffffff00, 0x100, false)
+	assert.False(t, send(0, 10, false).Retransmission)
+	assert.True(t, send(0xffffff80, 10, false).Retransmission)
+}
+
+func TestTCPRTT(t *testing.T) {
+	var state tcpState
+	start := time.Now()
+	packet := func(d Direction, after time.Duration, tcp *layers.TCP) {
+		seg := &Segment{Direction: d, Timestamp: start.Add(after)}
+		state.inspect(seg, tcp)
+	}
+
+	// handshake
+	packet(DirectionUpload, 0, &layers.TCP{Seq: 100, SYN: true})
+	packet(DirectionDownload, 40*time.Millisecond, &layers.TCP{Seq: 500, Ack: 101, SYN: true, ACK: true})
+	assert.Equal(t, 40*time.Millisecond, state.srtt)
+
+	// data acknowledged 80ms later
+	packet(DirectionUpload, 50*time.Millisecond, &layers.TCP{Seq: 101, ACK: true, BaseLayer: layers.BaseLayer{Payload: make([]byte, 10)}})
+	packet(DirectionDownload, 130*time.Millisecond, &layers.TCP{Seq: 501, Ack: 111, ACK: true})
+	assert.Equal(t, 45*time.Millisecond, state.srtt)
+
+	// the acknowledgement of a retransmission is no sample
+	packet(DirectionUpload, 200*time.Millisecond, &layers.TCP{Seq: 111, ACK: true, BaseLayer: layers.BaseLayer{Payload: make([]byte, 10)}})
+	packet(DirectionUpload, 400*time.Millisecond, &layers.TCP{Seq: 111, ACK: true, BaseLayer: layers.BaseLayer{Payload: make([]byte, 10)}})
+	packet(DirectionDownload, 410*time.Millisecond, &layers.TCP{Seq: 501, Ack: 121, ACK: true})
+	assert.Equal(t, 45*time.Millisecond, state.srtt)
+}
+
+func TestTCPLifecycle(t *testing.T) {
+	var state tcpState
+	packet := func(d Direction, tcp *layers.TCP) *Segment {
+		seg := &Segment{Direction: d}
+		state.inspect(seg, tcp)
+		return seg
+	}
+
+	seg := packet(DirectionUpload, &layers.TCP{Seq: 1, SYN: true})
+	assert.Equal(t, ConnectionOpen, seg.TCPEvent)
+	assert.Equal(t, TCPStateOpening, seg.TCPState)
+	packet(DirectionDownload, &layers.TCP{Seq: 100, Ack: 2, SYN: true, ACK: true})
+	assert.Equal(t, TCPStateEstablished, packet(DirectionUpload, &layers.TCP{Seq: 2, Ack: 101, ACK: true}).TCPState)
+
+	assert.Equal(t, TCPStateClosing, packet(DirectionUpload, &layers.TCP{Seq: 2, Ack: 101, ACK: true, FIN: true}).TCPState)
+	seg = packet(DirectionDownload, &layers.TCP{Seq: 101, Ack: 3, ACK: true, FIN: true})
+	assert.Equal(t, ConnectionClose, seg.TCPEvent)
+	assert.Equal(t, TCPStateClosed, seg.TCPState)
+
+	// the last acknowledgement doesn't revive the connection
+	seg = packet(DirectionUpload, &layers.TCP{Seq: 3, Ack: 102, ACK: true})
+	assert.Equal(t, TCPStateClosed, seg.TCPState)
+	assert.Empty(t, seg.TCPEvent)
+
+	// the tuple is reused by a new connection which gets reset
+	assert.Equal(t, ConnectionOpen, packet(DirectionUpload, &layers.TCP{Seq: 5000, SYN: true}).TCPEvent)
+	assert.Equal(t, ConnectionReset, packet(DirectionDownload, &layers.TCP{Ack: 5001, RST: true, ACK: true}).TCPEvent)
+}
+
+func TestTCPReceiveWindow(t *testing.T) {
+	var state tcpState
+	packet := func(d Direction, tcp *layers.TCP) *Segment {
+		seg := &Segment{Direction: d}
+		state.inspect(seg, tcp)
+		return seg
+	}
+	wscale := func(shift byte) []layers.TCPOption {
+		return []layers.TCPOption{{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{shift}}}
+	}
+
+	packet(DirectionUpload, &layers.TCP{Seq: 1, SYN: true, Window: 64240, Options: wscale(7)})
+	packet(DirectionDownload, &layers.TCP{Seq: 100, Ack: 2, SYN: true, ACK: true, Window: 65160, Options: wscale(2)})
+	packet(DirectionUpload, &layers.TCP{Seq: 2, Ack: 101, ACK: true, Window: 502})
+	assert.Equal(t, uint32(502<<7), state.upload.window)
+
+	seg := packet(DirectionDownload, &layers.TCP{Seq: 101, Ack: 2, ACK: true, Window: 0})
+	assert.True(t, seg.ZeroWindow)
+	assert.False(t, packet(DirectionDownload, &layers.TCP{Seq: 101, Ack: 2, ACK: true, Window: 0}).ZeroWindow)
+	packet(DirectionDownload, &layers.TCP{Seq: 101, Ack: 2, ACK: true, Window: 100})
+	assert.Equal(t, uint32(400), state.download.window)
+}
+
+func TestTCPReordering(t *testing.T) {
+	var state tcpState
+	start := time.Now()
+	packet := func(d Direction, after time.Duration, tcp *layers.TCP) *Segment {
+		seg := &Segment{Direction: d, Timestamp: start.Add(after)}
+		state.inspect(seg, tcp)
+		return seg
+	}
+	data := func(seq uint32) *layers.TCP {
+		return &layers.TCP{Seq: seq, ACK: true, BaseLayer: layers.BaseLayer{Payload: make([]byte, 100)}}
+	}
+
+	packet(DirectionUpload, 0, &layers.TCP{Seq: 100, SYN: true})
+	packet(DirectionDownload, 40*time.Millisecond, &layers.TCP{Seq: 500, Ack: 101, SYN: true, ACK: true})
+	packet(DirectionUpload, 50*time.Millisecond, data(101))
+
+	// 201 is overtaken by 301, the receiver asks for it twice
+	packet(DirectionUpload, 50*time.Millisecond, data(301))
+	assert.False(t, packet(DirectionDownload, 60*time.Millisecond, &layers.TCP{Seq: 501, Ack: 201, ACK: true}).DupACK)
+	assert.True(t, packet(DirectionDownload, 61*time.Millisecond, &layers.TCP{Seq: 501, Ack: 201, ACK: true}).DupACK)
+
+	seg := packet(DirectionUpload, 52*time.Millisecond, data(201))
+	assert.True(t, seg.OutOfOrder)
+	assert.False(t, seg.Retransmission)
+
+	// a window update is no duplicate
+	assert.False(t, packet(DirectionDownload, 62*time.Millisecond, &layers.TCP{Seq: 501, Ack: 401, ACK: true, Window: 10}).DupACK)
+	assert.False(t, packet(DirectionDownload, 63*time.Millisecond, &layers.TCP{Seq: 501, Ack: 401, ACK: true, Window: 20}).DupACK)
+
+	// the missing segment resent after a round trip is a retransmission
+	packet(DirectionUpload, 100*time.Millisecond, data(501))
+	seg = packet(DirectionUpload, 500*time.Millisecond, data(401))
+	assert.False(t, seg.OutOfOrder)
+	assert.True(t, seg.Retransmission)
+}
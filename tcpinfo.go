@@ -0,0 +1,53 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// TCPInfo is the quality of a TCP connection as measured by the kernel, from the
+// tcp_info of the socket along with the depths of its queues.
+type TCPInfo struct {
+	RTT          time.Duration // Smoothed round-trip time
+	RTTVar       time.Duration // Variation of the round-trip time
+	Cwnd         uint32        // Congestion window in segments
+	Retransmits  uint8         // Retransmissions of the unacknowledged segment
+	TotalRetrans uint32        // Segments retransmitted over the life of the connection
+	PacingRate   uint64        // Pacing rate in bytes per second, 0 if unpaced
+	RecvQueue    uint32        // Bytes received the process didn't read yet
+	SendQueue    uint32        // Bytes written the peer didn't acknowledge yet
+}
+
+// The offsets of the fields in the tcp_info of linux/tcp.h, the struct only ever grew
+// at its end.
+const (
+	tcpInfoRetransmits  = 2
+	tcpInfoRTT          = 68
+	tcpInfoRTTVar       = 72
+	tcpInfoSndCwnd      = 80
+	tcpInfoTotalRetrans = 100
+	tcpInfoPacingRate   = 104
+)
+
+// parseTCPInfo parses the tcp_info in the byte order of the host, false if it is too
+// short to hold the retransmissions, older kernels lack the pacing rate.
+func parseTCPInfo(b []byte, order binary.ByteOrder) (TCPInfo, bool) {
+	if len(b) < tcpInfoTotalRetrans+4 {
+		return TCPInfo{}, false
+	}
+	info := TCPInfo{
+		RTT:          time.Duration(order.Uint32(b[tcpInfoRTT:])) * time.Microsecond,
+		RTTVar:       time.Duration(order.Uint32(b[tcpInfoRTTVar:])) * time.Microsecond,
+		Cwnd:         order.Uint32(b[tcpInfoSndCwnd:]),
+		Retransmits:  b[tcpInfoRetransmits],
+		TotalRetrans: order.Uint32(b[tcpInfoTotalRetrans:]),
+	}
+
+	// ~0 stands for no pacing
+	if len(b) >= tcpInfoPacingRate+8 {
+		if rate := order.Uint64(b[tcpInfoPacingRate:]); rate != ^uint64(0) {
+			info.PacingRate = rate
+		}
+	}
+	return info, true
+}
@@ -0,0 +1,43 @@
+package sniffer
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTCPInfo(t *testing.T) {
+	b := make([]byte, 232)
+	b[tcpInfoRetransmits] = 2
+	binary.LittleEndian.PutUint32(b[tcpInfoRTT:], 12500)
+	binary.LittleEndian.PutUint32(b[tcpInfoRTTVar:], 3000)
+	binary.LittleEndian.PutUint32(b[tcpInfoSndCwnd:], 10)
+	binary.LittleEndian.PutUint32(b[tcpInfoTotalRetrans:], 7)
+	binary.LittleEndian.PutUint64(b[tcpInfoPacingRate:], 1250000)
+
+	info, ok := parseTCPInfo(b, binary.LittleEndian)
+	assert.True(t, ok)
+	assert.Equal(t, TCPInfo{
+		RTT:          12500 * time.Microsecond,
+		RTTVar:       3 * time.Millisecond,
+		Cwnd:         10,
+		Retransmits:  2,
+		TotalRetrans: 7,
+		PacingRate:   1250000,
+	}, info)
+
+	// unpaced
+	binary.LittleEndian.PutUint64(b[tcpInfoPacingRate:], ^uint64(0))
+	info, _ = parseTCPInfo(b, binary.LittleEndian)
+	assert.Equal(t, uint64(0), info.PacingRate)
+
+	// the kernels before the pacing rate
+	info, ok = parseTCPInfo(b[:104], binary.LittleEndian)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), info.PacingRate)
+
+	_, ok = parseTCPInfo(b[:100], binary.LittleEndian)
+	assert.False(t, ok)
+}
@@ -0,0 +1,146 @@
+package sniffer
+
+import (
+	"encoding/binary"
+)
+
+const (
+	tlsRecordHandshake      = 0x16
+	tlsHandshakeClientHello = 0x01
+
+	tlsExtServerName          = 0x0000
+	tlsExtSupportedGroups     = 0x000a
+	tlsExtECPointFormats      = 0x000b
+	tlsExtSignatureAlgorithms = 0x000d
+	tlsExtALPN                = 0x0010
+	tlsExtSupportedVersions   = 0x002b
+)
+
+// clientHello holds the fields of a TLS ClientHello the sniffer is interested in.
+type clientHello struct {
+	Version             uint16
+	ServerName          string
+	CipherSuites        []uint16
+	Extensions          []uint16
+	SupportedGroups     []uint16
+	ECPointFormats      []uint8
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+	ALPN                []string
+}
+
+// tlsReader reads big-endian fields from a handshake message, reading past the end of
+// a truncated message yields short slices and zero values.
+type tlsReader []byte
+
+func (r *tlsReader) next(n int) []byte {
+	if n > len(*r) {
+		n = len(*r)
+	}
+	b := (*r)[:n]
+	*r = (*r)[n:]
+	return b
+}
+
+func (r *tlsReader) uint8() uint8 {
+	b := r.next(1)
+	if len(b) < 1 {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *tlsReader) uint16() uint16 {
+	b := r.next(2)
+	if len(b) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+// clientHelloRecordLength returns the length of the TLS handshake record starting the
+// data, its header included, as given in the header, 0 if no ClientHello starts it.
+func clientHelloRecordLength(data []byte) int {
+	if len(data) < 6 || data[0] != tlsRecordHandshake || data[1] != 0x03 || data[5] != tlsHandshakeClientHello {
+		return 0
+	}
+	return 5 + int(binary.BigEndian.Uint16(data[3:5]))
+}
+
+// parseClientHello parses the TLS ClientHello record at the beginning of a TCP
+// payload. A ClientHello spanning several segments is parsed as far as the payload goes.
+func parseClientHello(data []byte) *clientHello {
+	// record header: content type(1) version(2) length(2)
+	if len(data) < 5 || data[0] != tlsRecordHandshake || data[1] != 0x03 {
+		return nil
+	}
+	return parseHandshakeClientHello(data[5:])
+}
+
+// parseHandshakeClientHello parses a ClientHello handshake message.
+func parseHandshakeClientHello(data []byte) *clientHello {
+	// handshake header: type(1) length(3)
+	if len(data) < 6 || data[0] != tlsHandshakeClientHello {
+		return nil
+	}
+
+	r := tlsReader(data[4:])
+	hello := &clientHello{Version: r.uint16()}
+	r.next(32)             // random
+	r.next(int(r.uint8())) // session id
+	hello.CipherSuites = tlsReader(r.next(int(r.uint16()))).uint16s()
+	r.next(int(r.uint8())) // compression methods
+	r.next(2)              // extensions length
+
+	for len(r) >= 4 {
+		typ, length := r.uint16(), int(r.uint16())
+		ext := tlsReader(r.next(length))
+		if len(ext) < length {
+			break
+		}
+		hello.Extensions = append(hello.Extensions, typ)
+
+		switch typ {
+		case tlsExtServerName:
+			hello.ServerName = parseServerName(ext)
+		case tlsExtSupportedGroups:
+			hello.SupportedGroups = tlsReader(ext.next(int(ext.uint16()))).uint16s()
+		case tlsExtECPointFormats:
+			hello.ECPointFormats = ext.next(int(ext.uint8()))
+		case tlsExtSignatureAlgorithms:
+			hello.SignatureAlgorithms = tlsReader(ext.next(int(ext.uint16()))).uint16s()
+		case tlsExtSupportedVersions:
+			hello.SupportedVersions = tlsReader(ext.next(int(ext.uint8()))).uint16s()
+		case tlsExtALPN:
+			protos := tlsReader(ext.next(int(ext.uint16())))
+			for len(protos) > 0 {
+				hello.ALPN = append(hello.ALPN, string(protos.next(int(protos.uint8()))))
+			}
+		}
+	}
+	return hello
+}
+
+func (r tlsReader) uint16s() []uint16 {
+	var values []uint16
+	for len(r) >= 2 {
+		values = append(values, r.uint16())
+	}
+	return values
+}
+
+// parseServerName returns the host_name entry of the server_name extension.
+func parseServerName(r tlsReader) string {
+	r.next(2) // list length
+	for len(r) >= 3 {
+		typ, length := r.uint8(), int(r.uint16())
+		name := r.next(length)
+		if len(name) < length {
+			return ""
+		}
+		if typ == 0 {
+			return string(name)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package sniffer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureClientHello returns the first flight sent by a TLS client.
+func captureClientHello(t *testing.T, config *tls.Config) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		_ = tls.Client(client, config).Handshake()
+		client.Close()
+	}()
+
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	assert.NoError(t, err)
+	return buf[:n]
+}
+
+func TestParseClientHello(t *testing.T) {
+	record := captureClientHello(t, &tls.Config{ServerName: "example.com"})
+
+	hello := parseClientHello(record)
+	assert.NotNil(t, hello)
+	assert.Equal(t, "example.com", hello.ServerName)
+
+	// the server name survives a ClientHello truncated after its extension
+	end := bytes.Index(record, []byte("example.com")) + len("example.com")
+	hello = parseClientHello(record[:end+3])
+	assert.NotNil(t, hello)
+	assert.Equal(t, "example.com", hello.ServerName)
+
+	assert.Nil(t, parseClientHello(record[1:]))
+	assert.Nil(t, parseClientHello(nil))
+}
+
+func TestClientHelloFingerprints(t *testing.T) {
+	hello := &clientHello{
+		Version:           0x0303,
+		ServerName:        "example.com",
+		CipherSuites:      []uint16{0x0a0a, 4865, 4866},
+		Extensions:        []uint16{0x1a1a, 0, 10, 11, 16, 43},
+		SupportedGroups:   []uint16{0x2a2a, 29, 23},
+		ECPointFormats:    []uint8{0},
+		SupportedVersions: []uint16{0x3a3a, 0x0304, 0x0303},
+		ALPN:              []string{"h2", "http/1.1"},
+	}
+
+	sum := md5.Sum([]byte("771,4865-4866,0-10-11-16-43,29-23,0"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), hello.JA3())
+	assert.True(t, strings.HasPrefix(hello.JA4(false), "t13d0205h2_"))
+	assert.True(t, strings.HasPrefix(hello.JA4(true), "q13d0205h2_"))
+}
+
+func TestClientHelloAcrossSegments(t *testing.T) {
+	record := captureClientHello(t, &tls.Config{ServerName: "example.com", NextProtos: []string{"h2", "http/1.1"}})
+	whole := parseClientHello(record)
+	assert.NotNil(t, whole)
+
+	// the fingerprints wait for the rest of the record
+	split := bytes.Index(record, []byte("example.com")) + len("example.com") + 8
+	flow := &flowState{}
+	assert.True(t, inspectClientHello(flow, record[:split]))
+	assert.Equal(t, "example.com", flow.ServerName)
+	assert.Empty(t, flow.JA3)
+
+	assert.True(t, inspectClientHello(flow, record[split:]))
+	assert.Equal(t, whole.JA3(), flow.JA3)
+	assert.Equal(t, whole.JA4(false), flow.JA4)
+	assert.Nil(t, flow.tlsHello)
+
+	// the fingerprints of the first segment alone would have missed extensions
+	assert.NotEqual(t, whole.JA3(), parseClientHello(record[:split]).JA3())
+
+	assert.False(t, inspectClientHello(&flowState{}, []byte("GET / HTTP/1.1\r\n\r\n")))
+}
@@ -0,0 +1,92 @@
+package sniffer
+
+import "time"
+
+// totalsKey keys the totals by the scope of the traffic along with the name of the
+// process or the remote address, for the snapshots limited to a scope.
+type totalsKey struct {
+	name  string
+	scope Scope
+}
+
+// cumulativeTotals sums the traffic of the processes and the remote addresses up since
+// the sniffer started.
+type cumulativeTotals struct {
+	started     bool
+	processes   map[totalsKey]*NetworkData
+	remoteAddrs map[totalsKey]*NetworkData
+	saved       time.Time // When last saved to the state file, zero if never
+}
+
+func newCumulativeTotals() *cumulativeTotals {
+	return &cumulativeTotals{
+		processes:   make(map[totalsKey]*NetworkData),
+		remoteAddrs: make(map[totalsKey]*NetworkData),
+	}
+}
+
+// add counts the traffic of the connection over the interval started at start in, the
+// connection being counted as a new one if first seen within it.
+func (t *cumulativeTotals) add(procName, remote string, info *ConnectionInfo, start time.Time) {
+	for _, totals := range []struct {
+		m   map[totalsKey]*NetworkData
+		key totalsKey
+	}{
+		{t.processes, totalsKey{procName, info.Scope}},
+		{t.remoteAddrs, totalsKey{remote, info.Scope}},
+	} {
+		data, ok := totals.m[totals.key]
+		if !ok {
+			data = &NetworkData{}
+			totals.m[totals.key] = data
+		}
+		data.add(info)
+		if !t.started || info.FirstSeen.After(start) {
+			data.ConnCount++
+		}
+	}
+}
+
+// trackTotals counts the traffic of the interval in the totals since started, leaving
+// out the same connections as the history.
+func (s *StatsManager) trackTotals(stat Stat, point HistoryPoint) {
+	start := point.Time.Add(-point.Elapsed)
+	for conn, info := range stat.Utilization {
+		procName, ok := s.processName(conn, info)
+		if !ok {
+			continue
+		}
+		s.totals.add(procName, remoteName(conn, info), info, start)
+	}
+	s.totals.started = true
+}
+
+// SetCumulative sets whether the snapshots rank the processes and the remote addresses
+// by their totals since the sniffer started instead of their current rates.
+func (s *StatsManager) SetCumulative(cumulative bool) {
+	s.cumulative = cumulative
+}
+
+// sumTotals returns the totals of each name for a snapshot, of the traffic of the scope
+// if any.
+func sumTotals(totals map[totalsKey]*NetworkData, scope *Scope) map[string]*NetworkData {
+	sums := make(map[string]*NetworkData)
+	for k, v := range totals {
+		if scope != nil && k.scope != *scope {
+			continue
+		}
+		sum, ok := sums[k.name]
+		if !ok {
+			sum = &NetworkData{}
+			sums[k.name] = sum
+		}
+		sum.UploadBytes += v.UploadBytes
+		sum.DownloadBytes += v.DownloadBytes
+		sum.UploadPayloadBytes += v.UploadPayloadBytes
+		sum.DownloadPayloadBytes += v.DownloadPayloadBytes
+		sum.UploadPackets += v.UploadPackets
+		sum.DownloadPackets += v.DownloadPackets
+		sum.ConnCount += v.ConnCount
+	}
+	return sums
+}
@@ -0,0 +1,57 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotTotals(t *testing.T) {
+	now := time.Now()
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	local := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50001, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "10.0.0.2", Port: 22},
+	}
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	stat := func(upload int) Stat {
+		return Stat{Utilization: Utilization{
+			conn: {
+				FlowInfo:    FlowInfo{FirstSeen: now.Add(-time.Second), ServerName: "one.one.one.one"},
+				Process:     curl,
+				UploadBytes: upload,
+				Scope:       ScopeInternet,
+			},
+			local: {
+				FlowInfo:    FlowInfo{FirstSeen: now.Add(-time.Second)},
+				Process:     curl,
+				UploadBytes: 100,
+				Scope:       ScopeLocal,
+			},
+		}}
+	}
+
+	s := NewStatsManager(Options{Interval: 2, ViewMode: ModeTableBytes})
+	s.put(stat(4000), now)
+	s.put(stat(2000), now.Add(2*time.Second))
+
+	snapshot := s.getSnapshot()
+	assert.False(t, snapshot.Cumulative)
+	assert.Equal(t, 1050, snapshot.Processes["<1>:curl"].UploadBytes)
+	// the connections seen before the latest interval are counted once
+	assert.Equal(t, 6200, snapshot.ProcessTotals["<1>:curl"].UploadBytes)
+	assert.Equal(t, 2, snapshot.ProcessTotals["<1>:curl"].ConnCount)
+	assert.Equal(t, 6000, snapshot.RemoteAddrTotals["one.one.one.one"].UploadBytes)
+
+	s.SetCumulative(true)
+	s.ShiftScope()
+	snapshot = s.getSnapshot()
+	assert.True(t, snapshot.Cumulative)
+	top := snapshot.TopNProcesses(1, ModeTableBytes)
+	assert.Equal(t, 200, top[0].Data.UploadBytes)
+	assert.Equal(t, "10.0.0.2", snapshot.TopNRemoteAddrs(1, ModeTableBytes)[0].Addr)
+}
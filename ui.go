@@ -2,7 +2,9 @@ package sniffer
 
 import (
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chenjiandongx/termui/v3"
@@ -12,9 +14,12 @@ import (
 )
 
 const (
-	maxRows    = 64
 	timeFormat = "15:04:05"
 	padding    = 6
+
+	// bloatedQueue is the depth from which the queues of a TCP socket are shown, a
+	// send queue that deep hinting at a stuck peer
+	bloatedQueue = 64 << 10
 )
 
 type UIComponent struct {
@@ -25,7 +30,7 @@ type ViewMode uint8
 
 func (vm ViewMode) Validate() error {
 	switch vm {
-	case ModeTableBytes, ModeTablePackets, ModePlotProcesses:
+	case ModeTableBytes, ModeTablePackets, ModePlotProcesses, ModeTableUsers, ModeTableContainers, ModeTableCategories, ModeTableApplications:
 		return nil
 	}
 	return fmt.Errorf("invalid view mode %d", vm)
@@ -35,23 +40,36 @@ const (
 	ModeTableBytes ViewMode = iota
 	ModeTablePackets
 	ModePlotProcesses
+	ModeTableUsers        // Bytes of each user owning the sockets, for the shared hosts
+	ModeTableContainers   // Bytes of each container, for the docker hosts
+	ModeTableCategories   // Bytes of each category of the processes, as the rules of the user put them
+	ModeTableApplications // Bytes of each application protocol, as the classifier labels the connections
 )
 
 type Unit string
 
 const (
-	UnitB  Unit = "B"
-	UnitKB Unit = "KB"
-	UnitKb Unit = "Kb"
-	UnitMB Unit = "MB"
-	UnitMb Unit = "Mb"
-	UnitGB Unit = "GB"
-	UnitGb Unit = "Gb"
+	UnitB    Unit = "B"
+	UnitBit  Unit = "b"
+	UnitKB   Unit = "KB"
+	UnitKb   Unit = "Kb"
+	UnitMB   Unit = "MB"
+	UnitMb   Unit = "Mb"
+	UnitGB   Unit = "GB"
+	UnitGb   Unit = "Gb"
+	UnitAuto Unit = "auto" // B, KB, MB or GB, or their bits, whichever fits each value
 )
 
+// autoUnits are the units the auto unit picks from, the largest first, in bytes or in
+// bits.
+var autoUnits = map[bool][]Unit{
+	false: {UnitGB, UnitMB, UnitKB, UnitB},
+	true:  {UnitGb, UnitMb, UnitKb, UnitBit},
+}
+
 func (u Unit) Validate() error {
 	switch u {
-	case UnitB, UnitKB, UnitKb, UnitMB, UnitMb, UnitGB, UnitGb:
+	case UnitB, UnitBit, UnitKB, UnitKb, UnitMB, UnitMb, UnitGB, UnitGb, UnitAuto:
 		return nil
 	}
 	return fmt.Errorf("invalid unit %s", u)
@@ -66,6 +84,8 @@ func (u Unit) Ratio() float64 {
 	switch u {
 	case UnitB:
 		ratio = 1
+	case UnitBit:
+		ratio = 1.0 / 8
 	case UnitKB:
 		ratio = 1024
 	case UnitKb:
@@ -82,8 +102,68 @@ func (u Unit) Ratio() float64 {
 	return ratio
 }
 
+// scale returns the unit the bytes are shown in, under the auto unit the largest one
+// they make at least one of.
+func (u Unit) scale(bytes float64, bits bool) Unit {
+	if u != UnitAuto {
+		return u
+	}
+	units := autoUnits[bits]
+	for _, unit := range units[:len(units)-1] {
+		if bytes >= unit.Ratio() {
+			return unit
+		}
+	}
+	return units[len(units)-1]
+}
+
+// format formats the bytes in the unit, scaled to them if the unit is auto.
+func (u Unit) format(bytes float64, bits bool) string {
+	unit := u.scale(bytes, bits)
+	return fmt.Sprintf("%.1f%s", bytes/unit.Ratio(), unit)
+}
+
+// SortKey is what the tables rank by, the traffic of the view mode breaking the ties.
+type SortKey string
+
+const (
+	SortTotal       SortKey = "total"       // Bytes or packets depending on the view mode
+	SortUpload      SortKey = "upload"      // Upload bytes or packets depending on the view mode
+	SortDownload    SortKey = "download"    // Download bytes or packets depending on the view mode
+	SortPackets     SortKey = "packets"     // Packets per second
+	SortConnections SortKey = "connections" // Connections, to tell the chatty low bandwidth ones
+)
+
+// sortKeys are the sort keys in the order the o hotkey shifts them.
+var sortKeys = []SortKey{SortTotal, SortUpload, SortDownload, SortPackets, SortConnections}
+
+func (k SortKey) Validate() error {
+	for _, key := range sortKeys {
+		if k == key {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sort key %s", k)
+}
+
+func (k SortKey) String() string {
+	return string(k)
+}
+
+// next returns the sort key following this one, the unset one being SortTotal.
+func (k SortKey) next() SortKey {
+	for i, key := range sortKeys {
+		if k == key {
+			return sortKeys[(i+1)%len(sortKeys)]
+		}
+	}
+	return sortKeys[1]
+}
+
+const footerText = "<space> Pause. <q> Exit. <s> Switch mode. <tab> Rearrange tables. <r> Sort connections by RTT. <o> Sort order. <i> Interfaces/Ports. <l> Toggle loopback. <t> Totals. <w> Local/Internet. <e> Export CSV. <g> Tag"
+
 func newFooter() *widgets.Paragraph {
-	return newParagraph("<space> Pause. <q> Exit. <s> Switch mode. <tab> Rearrange tables")
+	return newParagraph(footerText)
 }
 
 func newParagraph(text string) *widgets.Paragraph {
@@ -122,22 +202,47 @@ func newPlot(title string, num int) *widgets.Plot {
 func NewUIComponent(opt Options) *UIComponent {
 	ui := &UIComponent{}
 	switch opt.ViewMode {
-	case ModeTableBytes, ModeTablePackets:
+	case ModeTableBytes, ModeTablePackets, ModeTableUsers, ModeTableContainers, ModeTableCategories, ModeTableApplications:
+		// the users, the containers, the categories and the applications go by their bytes
+		mode := opt.ViewMode
+		if mode == ModeTableUsers || mode == ModeTableContainers || mode == ModeTableCategories || mode == ModeTableApplications {
+			mode = ModeTableBytes
+		}
 		ui.viewer = &TableViewer{
 			footer:      newFooter(),
 			processes:   newTable("Process Name"),
+			users:       newTable("User"),
+			containers:  newTable("Container"),
+			categories:  newTable("Category"),
+			apps:        newTable("Application"),
 			remoteAddrs: newTable("Remote Address"),
+			interfaces:  newTable("Interface"),
+			remotePorts: newTable("Remote Port"),
+			countries:   newTable("Country"),
+			asns:        newTable("Autonomous System"),
 			connections: newTable("Connections"),
-			mode:        opt.ViewMode,
+			mode:        mode,
+			byUser:      opt.ViewMode == ModeTableUsers,
+			byContainer: opt.ViewMode == ModeTableContainers,
+			byCategory:  opt.ViewMode == ModeTableCategories,
+			byApp:       opt.ViewMode == ModeTableApplications,
 			unit:        opt.Unit,
+			bits:        opt.Bits,
+			goodput:     opt.Goodput,
+			mirror:      opt.Mirror,
+			geoip:       opt.GeoIPDB != "",
+			asn:         opt.ASNDB != "",
+			sortKey:     opt.SortKey,
+			rows:        opt.Rows,
 		}
 	default:
 		ui.viewer = &PlotViewer{
 			footer:      newFooter(),
 			packetsPlot: newPlot("Packets: Blue Up / Green Down", 2),
-			bytesPlot:   newPlot(fmt.Sprintf("Bytes: <Unit %sps> Blue Up / Green Down", opt.Unit.String()), 2),
+			bytesPlot:   newPlot(bytesPlotTitle(opt.Unit.scale(0, opt.Bits)), 2),
 			connsPlot:   newPlot("Connections", 1),
 			unit:        opt.Unit,
+			bits:        opt.Bits,
 		}
 	}
 
@@ -207,6 +312,7 @@ type PlotViewer struct {
 	shiftIdx int
 	count    int
 	unit     Unit
+	bits     bool // Whether the auto unit picks the units of bits
 }
 
 func (pv *PlotViewer) Setup() {
@@ -240,11 +346,24 @@ func (pv *PlotViewer) updatePackets(data *NetworkData) {
 	pv.packetsPlot.Data[1] = pv.packetsDownList.Get(1)
 }
 
+// bytesPlotTitle returns the title of the bytes plot in the unit.
+func bytesPlotTitle(unit Unit) string {
+	return fmt.Sprintf("Bytes: <Unit %sps> Blue Up / Green Down", unit.String())
+}
+
 func (pv *PlotViewer) updateBytes(data *NetworkData) {
 	pv.bytesUpList.Put(float64(data.UploadBytes))
 	pv.bytesDownList.Put(float64(data.DownloadBytes))
-	pv.bytesPlot.Data[0] = pv.bytesUpList.Get(pv.unit.Ratio())
-	pv.bytesPlot.Data[1] = pv.bytesDownList.Get(pv.unit.Ratio())
+
+	// the auto unit fits the peak of the plot
+	var peak float64
+	for _, v := range append(pv.bytesUpList.Get(1), pv.bytesDownList.Get(1)...) {
+		peak = math.Max(peak, v)
+	}
+	unit := pv.unit.scale(peak, pv.bits)
+	pv.bytesPlot.Title = bytesPlotTitle(unit)
+	pv.bytesPlot.Data[0] = pv.bytesUpList.Get(unit.Ratio())
+	pv.bytesPlot.Data[1] = pv.bytesDownList.Get(unit.Ratio())
 }
 
 func (pv *PlotViewer) updateConnections(data *NetworkData) {
@@ -291,6 +410,21 @@ func (pv *PlotViewer) Resize(width, height int) {
 	pv.render()
 }
 
+// backfill puts the throughput of the intervals of the history in the plots, averaged
+// a second over the refresh interval as the stats rendered are.
+func (pv *PlotViewer) backfill(points []HistoryPoint, interval time.Duration) {
+	for _, point := range points {
+		data := point.Total
+		data.PerSecond(interval)
+		pv.bytesUpList.Put(float64(data.UploadBytes))
+		pv.bytesDownList.Put(float64(data.DownloadBytes))
+		pv.packetsUpList.Put(float64(data.UploadPackets))
+		pv.packetsDownList.Put(float64(data.DownloadPackets))
+		pv.connsList.Put(float64(data.ConnCount))
+		pv.count++
+	}
+}
+
 func (pv *PlotViewer) Render(stats interface{}) {
 	if stats == nil {
 		return
@@ -315,20 +449,52 @@ func (pv *PlotViewer) render() {
 
 type TableViewer struct {
 	header      *widgets.Paragraph
+	throughput  *widgets.Paragraph // Throughput of all the devices, under the header
 	footer      *widgets.Paragraph
 	processes   *widgets.Table
+	users       *widgets.Table // Shown in place of the processes in the users mode
+	containers  *widgets.Table // Shown in place of the processes in the containers mode
+	categories  *widgets.Table // Shown in place of the processes in the categories mode
+	apps        *widgets.Table // Shown in place of the processes in the applications mode
 	remoteAddrs *widgets.Table
+	interfaces  *widgets.Table // Shown in place of the remote addresses on demand
+	remotePorts *widgets.Table // Shown in place of the remote addresses on demand
+	countries   *widgets.Table // Shown in place of the remote addresses on demand once located
+	asns        *widgets.Table // Shown in place of the remote addresses on demand with an ASN database
 	connections *widgets.Table
 	tableRef    []*widgets.Table
 	grid        *termui.Grid
 	shiftIdx    int
+	sortByRTT   bool
+	sortKey     SortKey
+	rows        int // Rows of each table
 	mode        ViewMode
+	byUser      bool // Whether in the users mode, counting the bytes of each user
+	byContainer bool // Whether in the containers mode, counting the bytes of each container
+	byCategory  bool // Whether in the categories mode, counting the bytes of each category
+	byApp       bool // Whether in the applications mode, counting the bytes of each application protocol
 	unit        Unit
+	bits        bool // Whether the auto unit picks the units of bits
+	goodput     bool
+	mirror      bool
+	geoip       bool // Whether the countries of the remote addresses are looked up
+	asn         bool // Whether the autonomous systems of the remote addresses are looked up
 }
 
 func (tv *TableViewer) Setup() {
 	tv.header = newParagraph(tv.getHeaderText(0, "", ""))
+	tv.throughput = newParagraph(tv.getThroughputText(nil))
 	tv.tableRef = []*widgets.Table{tv.processes, tv.remoteAddrs, tv.connections}
+	switch {
+	case tv.byUser:
+		tv.tableRef[0] = tv.users
+	case tv.byContainer:
+		tv.tableRef[0] = tv.containers
+	case tv.byCategory:
+		tv.tableRef[0] = tv.categories
+	case tv.byApp:
+		tv.tableRef[0] = tv.apps
+	}
 	width, height := termui.TerminalDimensions()
 	tv.grid = tv.newGrid(width, height)
 }
@@ -336,24 +502,62 @@ func (tv *TableViewer) Setup() {
 func (tv *TableViewer) getHeaderText(conn int, up, down string) string {
 	now := time.Now().Format(timeFormat)
 	var text string
-	switch tv.mode {
-	case ModeTableBytes:
+	switch {
+	case tv.byUser:
+		text = fmt.Sprintf("[Users Mode] Time: %s  [Total] Conn:%d Up:%s Down:%s", now, conn, up, down)
+	case tv.byContainer:
+		text = fmt.Sprintf("[Containers Mode] Time: %s  [Total] Conn:%d Up:%s Down:%s", now, conn, up, down)
+	case tv.byCategory:
+		text = fmt.Sprintf("[Categories Mode] Time: %s  [Total] Conn:%d Up:%s Down:%s", now, conn, up, down)
+	case tv.byApp:
+		text = fmt.Sprintf("[Applications Mode] Time: %s  [Total] Conn:%d Up:%s Down:%s", now, conn, up, down)
+	case tv.mode == ModeTableBytes:
+		if tv.goodput {
+			text = fmt.Sprintf("[Goodput Mode] Time: %s  [Total] Conn:%d Up:%s Down:%s", now, conn, up, down)
+			break
+		}
 		text = fmt.Sprintf("[Bytes Mode] Time: %s  [Total] Conn:%d Up:%s Down:%s", now, conn, up, down)
-	case ModeTablePackets:
+	case tv.mode == ModeTablePackets:
 		text = fmt.Sprintf("[Packets Mode] Time: %s  [Total] Conn:%d Up:%s Down:%s", now, conn, up, down)
 	}
 	return text
 }
 
+// getThroughputText returns the line of the throughput of all the devices, whatever
+// the mode, the filters and the scope.
+func (tv *TableViewer) getThroughputText(data *NetworkData) string {
+	if data == nil {
+		data = &NetworkData{}
+	}
+	return fmt.Sprintf("[Throughput] Conn:%d Up:%sps Down:%sps Packets Up:%sps Down:%sps",
+		data.ConnCount,
+		tv.unit.format(data.UploadRate, tv.bits), tv.unit.format(data.DownloadRate, tv.bits),
+		humanize.Comma(int64(data.UploadPackets)), humanize.Comma(int64(data.DownloadPackets)))
+}
+
 func (tv *TableViewer) humanizeNum(n int) string {
+	return tv.humanizeTotal(n) + "ps"
+}
+
+// humanizeTotal returns the bytes or the packets counted in all.
+func (tv *TableViewer) humanizeTotal(n int) string {
 	var s string
 	switch tv.mode {
 	case ModeTableBytes:
-		s = fmt.Sprintf("%.1f%s", float64(n)/tv.unit.Ratio(), tv.unit.String())
+		s = tv.unit.format(float64(n), tv.bits)
 	case ModeTablePackets:
 		s = humanize.Comma(int64(n))
 	}
-	return s + "ps"
+	return s
+}
+
+// trafficColumn returns the header of the traffic column of the processes and the
+// remote addresses along with how their traffic is shown, in all if cumulative.
+func (tv *TableViewer) trafficColumn(snapshot *Snapshot) (string, func(int) string) {
+	if snapshot.Cumulative {
+		return "Total Up / Down", tv.humanizeTotal
+	}
+	return "Up / Down", tv.humanizeNum
 }
 
 func (tv *TableViewer) updateHeader(snapshot *Snapshot) {
@@ -362,78 +566,385 @@ func (tv *TableViewer) updateHeader(snapshot *Snapshot) {
 	case ModeTableBytes:
 		up = tv.humanizeNum(snapshot.TotalUploadBytes)
 		down = tv.humanizeNum(snapshot.TotalDownloadBytes)
+		if tv.goodput {
+			up = tv.humanizeNum(snapshot.TotalUploadPayloadBytes)
+			down = tv.humanizeNum(snapshot.TotalDownloadPayloadBytes)
+		}
 	case ModeTablePackets:
 		up = tv.humanizeNum(snapshot.TotalUploadPackets)
 		down = tv.humanizeNum(snapshot.TotalDownloadPackets)
 	}
 	tv.header.Text = tv.getHeaderText(snapshot.TotalConnections, up, down)
+	if tv.mode == ModeTableBytes {
+		// the other one of goodput and wire bytes for comparison
+		otherUp, otherDown := snapshot.TotalUploadPayloadBytes, snapshot.TotalDownloadPayloadBytes
+		label := "Goodput"
+		if tv.goodput {
+			otherUp, otherDown, label = snapshot.TotalUploadBytes, snapshot.TotalDownloadBytes, "Wire"
+		}
+		tv.header.Text += fmt.Sprintf(" %s Up:%s Down:%s", label, tv.humanizeNum(otherUp), tv.humanizeNum(otherDown))
+	}
+	if data := snapshot.Families[FamilyIPv6]; data != nil {
+		tv.header.Text += fmt.Sprintf(" IPv6:%.0f%%", tv.share(data, snapshot.Families[FamilyIPv4]))
+	}
+	if data := snapshot.Scopes[ScopeInternet]; data != nil {
+		tv.header.Text += fmt.Sprintf(" Internet:%.0f%%", tv.share(data, snapshot.Scopes[ScopeLocal]))
+	}
+	for _, reason := range UnattributedReasons {
+		if data := snapshot.Unattributed[reason]; data != nil {
+			tv.header.Text += fmt.Sprintf(" Unattributed(%s):%d", reason, data.ConnCount)
+		}
+	}
+	if snapshot.Scope != nil {
+		tv.header.Text = fmt.Sprintf("[%s traffic] ", snapshot.Scope) + tv.header.Text
+	}
+	if snapshot.Watch != "" {
+		tv.header.Text = fmt.Sprintf("[Watching %s: %d processes] ", snapshot.Watch, len(snapshot.Watched)) + tv.header.Text
+	}
+	if snapshot.Cumulative {
+		tv.header.Text = "[Totals since started] " + tv.header.Text
+	}
+	if tv.sortKey != SortTotal && tv.sortKey != "" {
+		tv.header.Text = fmt.Sprintf("[Sorted by %s] ", tv.sortKey) + tv.header.Text
+	}
+	if snapshot.Degraded {
+		tv.header.Text = "[Degraded: no capture privileges, connections and queues only] " + tv.header.Text
+	}
+}
+
+// processColumn returns the header of the process column, which holds the local hosts
+// on a mirror port.
+func (tv *TableViewer) processColumn() string {
+	if tv.mirror {
+		return "Local Host"
+	}
+	return "<Pid>:Process"
+}
+
+// traffic returns the bytes or the packets of the data depending on the mode.
+func (tv *TableViewer) traffic(data *NetworkData) int {
+	if data == nil {
+		return 0
+	}
+	if tv.mode == ModeTableBytes {
+		up, down := data.Bytes(tv.goodput)
+		return up + down
+	}
+	return data.UploadPackets + data.DownloadPackets
+}
+
+// connCount returns the connections of the data along with the share of the UDP
+// traffic if any, which tells the QUIC, the VPNs or the media apart.
+func (tv *TableViewer) connCount(data *NetworkData) string {
+	count := strconv.Itoa(data.ConnCount)
+	if total := tv.traffic(data); data.UDP != nil && total > 0 {
+		count += fmt.Sprintf(" (%.0f%% udp)", float64(tv.traffic(data.UDP))*100/float64(total))
+	}
+	return count
+}
+
+// share returns the percentage of the traffic of the data out of it and the rest.
+func (tv *TableViewer) share(data, rest *NetworkData) float64 {
+	n, total := tv.traffic(data), tv.traffic(data)+tv.traffic(rest)
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
 }
 
 func (tv *TableViewer) updateProcesses(snapshot *Snapshot) {
+	column, humanizeNum := tv.trafficColumn(snapshot)
 	rows := make([][]string, 0)
-	for _, r := range snapshot.TopNProcesses(maxRows, tv.mode) {
+	for _, r := range snapshot.TopNProcessesBy(tv.rows, tv.mode, tv.sortKey) {
 		var up, down string
 		switch tv.mode {
 		case ModeTableBytes:
-			up = tv.humanizeNum(r.Data.UploadBytes)
-			down = tv.humanizeNum(r.Data.DownloadBytes)
+			upBytes, downBytes := r.Data.Bytes(tv.goodput)
+			up = humanizeNum(upBytes)
+			down = humanizeNum(downBytes)
 		case ModeTablePackets:
-			up = tv.humanizeNum(r.Data.UploadPackets)
-			down = tv.humanizeNum(r.Data.DownloadPackets)
+			up = humanizeNum(r.Data.UploadPackets)
+			down = humanizeNum(r.Data.DownloadPackets)
 		}
-		rows = append(rows, []string{r.ProcessName, strconv.Itoa(r.Data.ConnCount), up + " / " + down})
+		rows = append(rows, []string{r.ProcessName, tv.connCount(r.Data), up + " / " + down})
 	}
 
-	header := []string{"<Pid>:Process", "Connections", "Up / Down"}
+	header := []string{tv.processColumn(), "Connections", column}
 	tv.processes.Rows = [][]string{header, make([]string, 3)}
 	tv.processes.Rows = append(tv.processes.Rows, rows...)
 }
 
 func (tv *TableViewer) updateRemoteAddrs(snapshot *Snapshot) {
+	column, humanizeNum := tv.trafficColumn(snapshot)
 	rows := make([][]string, 0)
-	for _, r := range snapshot.TopNRemoteAddrs(maxRows, tv.mode) {
+	for _, r := range snapshot.TopNRemoteAddrsBy(tv.rows, tv.mode, tv.sortKey) {
 		var up, down string
 		switch tv.mode {
 		case ModeTableBytes:
-			up = tv.humanizeNum(r.Data.UploadBytes)
-			down = tv.humanizeNum(r.Data.DownloadBytes)
+			upBytes, downBytes := r.Data.Bytes(tv.goodput)
+			up = humanizeNum(upBytes)
+			down = humanizeNum(downBytes)
+		case ModeTablePackets:
+			up = humanizeNum(r.Data.UploadPackets)
+			down = humanizeNum(r.Data.DownloadPackets)
+		}
+		addr := r.Addr
+		if tags := snapshot.TagsOf(r.Addr); len(tags) > 0 {
+			addr += " [" + strings.Join(tags, ", ") + "]"
+		}
+		row := []string{addr, tv.connCount(r.Data), up + " / " + down}
+		if tv.geoip || tv.asn {
+			location := strings.TrimSpace(r.Location.String() + " " + r.Location.AS())
+			row = []string{addr, location, tv.connCount(r.Data), up + " / " + down}
+		}
+		rows = append(rows, row)
+	}
+
+	header := []string{"Remote Address", "Connections", column}
+	if tv.geoip || tv.asn {
+		header = []string{"Remote Address", "Location", "Connections", column}
+	}
+	tv.remoteAddrs.Rows = [][]string{header, make([]string, len(header))}
+	tv.remoteAddrs.Rows = append(tv.remoteAddrs.Rows, rows...)
+}
+
+// updateUsers shows the traffic of each user owning the sockets, which tells the users
+// of the shared hosts apart.
+func (tv *TableViewer) updateUsers(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNUsersBy(tv.rows, tv.mode, tv.sortKey) {
+		upBytes, downBytes := r.Data.Bytes(tv.goodput)
+		up, down := tv.humanizeNum(upBytes), tv.humanizeNum(downBytes)
+		rows = append(rows, []string{r.User, tv.connCount(r.Data), up + " / " + down})
+	}
+
+	header := []string{"User", "Connections", "Up / Down"}
+	tv.users.Rows = [][]string{header, make([]string, 3)}
+	tv.users.Rows = append(tv.users.Rows, rows...)
+}
+
+// Notify tells the message in the footer, along with the hotkeys.
+func (tv *TableViewer) Notify(msg string) {
+	tv.footer.Text = footerText + "  [" + msg + "]"
+	termui.Render(tv.grid)
+}
+
+// updateContainers shows the traffic of each container, as docker stats does.
+func (tv *TableViewer) updateContainers(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNContainersBy(tv.rows, tv.mode, tv.sortKey) {
+		upBytes, downBytes := r.Data.Bytes(tv.goodput)
+		up, down := tv.humanizeNum(upBytes), tv.humanizeNum(downBytes)
+		rows = append(rows, []string{r.Container, tv.connCount(r.Data), up + " / " + down})
+	}
+
+	header := []string{"Container", "Connections", "Up / Down"}
+	tv.containers.Rows = [][]string{header, make([]string, 3)}
+	tv.containers.Rows = append(tv.containers.Rows, rows...)
+}
+
+// updateCategories shows the traffic of each category of the processes, which the many
+// helpers of an application count toward as one.
+func (tv *TableViewer) updateCategories(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNCategoriesBy(tv.rows, tv.mode, tv.sortKey) {
+		upBytes, downBytes := r.Data.Bytes(tv.goodput)
+		up, down := tv.humanizeNum(upBytes), tv.humanizeNum(downBytes)
+		rows = append(rows, []string{r.Category, tv.connCount(r.Data), up + " / " + down})
+	}
+
+	header := []string{"Category", "Connections", "Up / Down"}
+	tv.categories.Rows = [][]string{header, make([]string, 3)}
+	tv.categories.Rows = append(tv.categories.Rows, rows...)
+}
+
+// updateApplications shows the traffic of each application protocol, the connections
+// left unclassified counting toward their transport protocol.
+func (tv *TableViewer) updateApplications(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNApplicationsBy(tv.rows, tv.mode, tv.sortKey) {
+		upBytes, downBytes := r.Data.Bytes(tv.goodput)
+		up, down := tv.humanizeNum(upBytes), tv.humanizeNum(downBytes)
+		rows = append(rows, []string{string(r.Application), tv.connCount(r.Data), up + " / " + down})
+	}
+
+	header := []string{"Application", "Connections", "Up / Down"}
+	tv.apps.Rows = [][]string{header, make([]string, 3)}
+	tv.apps.Rows = append(tv.apps.Rows, rows...)
+}
+
+// updateInterfaces shows the traffic of each device, which tells the NIC carrying it
+// on the multi-homed hosts.
+func (tv *TableViewer) updateInterfaces(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNInterfacesBy(tv.rows, tv.mode, tv.sortKey) {
+		var up, down string
+		switch tv.mode {
+		case ModeTableBytes:
+			upBytes, downBytes := r.Data.Bytes(tv.goodput)
+			up = tv.humanizeNum(upBytes)
+			down = tv.humanizeNum(downBytes)
 		case ModeTablePackets:
 			up = tv.humanizeNum(r.Data.UploadPackets)
 			down = tv.humanizeNum(r.Data.DownloadPackets)
 		}
-		rows = append(rows, []string{r.Addr, strconv.Itoa(r.Data.ConnCount), up + " / " + down})
+		rows = append(rows, []string{r.Interface, strconv.Itoa(r.Data.ConnCount), up + " / " + down})
 	}
 
-	header := []string{"Remote Address", "Connections", "Up / Down"}
-	tv.remoteAddrs.Rows = [][]string{header, make([]string, 3)}
-	tv.remoteAddrs.Rows = append(tv.remoteAddrs.Rows, rows...)
+	header := []string{"Interface", "Connections", "Up / Down"}
+	tv.interfaces.Rows = [][]string{header, make([]string, 3)}
+	tv.interfaces.Rows = append(tv.interfaces.Rows, rows...)
+}
+
+// updateRemotePorts shows the traffic of each remote port, which tells the services
+// it goes to.
+func (tv *TableViewer) updateRemotePorts(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNRemotePortsBy(tv.rows, tv.mode, tv.sortKey) {
+		var up, down string
+		switch tv.mode {
+		case ModeTableBytes:
+			upBytes, downBytes := r.Data.Bytes(tv.goodput)
+			up = tv.humanizeNum(upBytes)
+			down = tv.humanizeNum(downBytes)
+		case ModeTablePackets:
+			up = tv.humanizeNum(r.Data.UploadPackets)
+			down = tv.humanizeNum(r.Data.DownloadPackets)
+		}
+		rows = append(rows, []string{r.Port.String(), strconv.Itoa(r.Data.ConnCount), up + " / " + down})
+	}
+
+	header := []string{"Remote Port", "Connections", "Up / Down"}
+	tv.remotePorts.Rows = [][]string{header, make([]string, 3)}
+	tv.remotePorts.Rows = append(tv.remotePorts.Rows, rows...)
+}
+
+// updateCountries shows the traffic of each country of the remote ends, which tells
+// where it goes to.
+func (tv *TableViewer) updateCountries(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNCountriesBy(tv.rows, tv.mode, tv.sortKey) {
+		var up, down string
+		switch tv.mode {
+		case ModeTableBytes:
+			upBytes, downBytes := r.Data.Bytes(tv.goodput)
+			up = tv.humanizeNum(upBytes)
+			down = tv.humanizeNum(downBytes)
+		case ModeTablePackets:
+			up = tv.humanizeNum(r.Data.UploadPackets)
+			down = tv.humanizeNum(r.Data.DownloadPackets)
+		}
+		rows = append(rows, []string{r.Country, strconv.Itoa(r.Data.ConnCount), up + " / " + down})
+	}
+
+	header := []string{"Country", "Connections", "Up / Down"}
+	tv.countries.Rows = [][]string{header, make([]string, 3)}
+	tv.countries.Rows = append(tv.countries.Rows, rows...)
+}
+
+// updateASNs shows the traffic of each autonomous system of the remote ends, which
+// tells the clouds and the networks it goes to.
+func (tv *TableViewer) updateASNs(snapshot *Snapshot) {
+	rows := make([][]string, 0)
+	for _, r := range snapshot.TopNASNsBy(tv.rows, tv.mode, tv.sortKey) {
+		var up, down string
+		switch tv.mode {
+		case ModeTableBytes:
+			upBytes, downBytes := r.Data.Bytes(tv.goodput)
+			up = tv.humanizeNum(upBytes)
+			down = tv.humanizeNum(downBytes)
+		case ModeTablePackets:
+			up = tv.humanizeNum(r.Data.UploadPackets)
+			down = tv.humanizeNum(r.Data.DownloadPackets)
+		}
+		rows = append(rows, []string{r.AS, strconv.Itoa(r.Data.ConnCount), up + " / " + down})
+	}
+
+	header := []string{"Autonomous System", "Connections", "Up / Down"}
+	tv.asns.Rows = [][]string{header, make([]string, 3)}
+	tv.asns.Rows = append(tv.asns.Rows, rows...)
 }
 
 func (tv *TableViewer) updateConnections(snapshot *Snapshot) {
+	results := snapshot.TopNConnectionsBy(tv.rows, tv.mode, tv.sortKey)
+	if tv.sortByRTT {
+		results = snapshot.TopNConnectionsByRTT(tv.rows)
+	}
+
 	rows := make([][]string, 0)
-	for _, r := range snapshot.TopNConnections(maxRows, tv.mode) {
+	for _, r := range results {
 		var up, down string
 		switch tv.mode {
 		case ModeTableBytes:
-			up = tv.humanizeNum(r.Data.UploadBytes)
-			down = tv.humanizeNum(r.Data.DownloadBytes)
+			upBytes, downBytes := r.Data.Bytes(tv.goodput)
+			up = tv.humanizeNum(upBytes)
+			down = tv.humanizeNum(downBytes)
 		case ModeTablePackets:
 			up = tv.humanizeNum(r.Data.UploadPackets)
 			down = tv.humanizeNum(r.Data.DownloadPackets)
 		}
 
-		conn := fmt.Sprintf("<%s>:%d => %s:%d (%s)",
+		remote := r.Conn.Remote.IP
+		if r.Data.ServerName != "" && !r.Data.Labeled {
+			remote = r.Data.ServerName
+		}
+		proto := string(r.Conn.Local.Protocol)
+		if r.Data.Application != "" {
+			proto += "/" + string(r.Data.Application)
+		}
+		// the remote port goes along with the name of its service if known
+		port := strconv.Itoa(int(r.Conn.Remote.Port))
+		if service := r.Conn.RemoteService(); service != "" {
+			port += "(" + service + ")"
+		}
+		conn := fmt.Sprintf("<%s>:%d => %s:%s (%s)",
 			r.Data.InterfaceName,
 			r.Conn.Local.Port,
-			r.Conn.Remote.IP,
-			r.Conn.Remote.Port,
-			r.Conn.Local.Protocol,
+			remote,
+			port,
+			proto,
 		)
-		rows = append(rows, []string{conn, r.Data.ProcessName, up + " / " + down})
+		if r.Conn.VNI != 0 {
+			conn += fmt.Sprintf(" [VNI %d]", r.Conn.VNI)
+		}
+		if tags := snapshot.TagsOf(remote, connectionTarget(remote, r.Conn.Remote.Port)); len(tags) > 0 {
+			conn += " [" + strings.Join(tags, ", ") + "]"
+		}
+		if r.Data.RemoteOS != "" {
+			conn += fmt.Sprintf(" [%s]", r.Data.RemoteOS)
+		}
+		if packets := r.Data.UploadPackets + r.Data.DownloadPackets; r.Data.RetransmittedPackets > 0 && packets > 0 {
+			conn += fmt.Sprintf(" [%.1f%% retrans]", float64(r.Data.RetransmittedPackets)*100/float64(packets))
+		}
+		if n := r.Data.LocalZeroWindows + r.Data.RemoteZeroWindows; n > 0 {
+			conn += fmt.Sprintf(" [%d zero window]", n)
+		}
+		if r.Data.DupACKs > 0 {
+			conn += fmt.Sprintf(" [%d dup ack]", r.Data.DupACKs)
+		}
+		if r.Data.OutOfOrderPackets > 0 {
+			conn += fmt.Sprintf(" [%d out of order]", r.Data.OutOfOrderPackets)
+		}
+		if r.Data.CorruptPackets > 0 {
+			conn += fmt.Sprintf(" [%d bad checksum]", r.Data.CorruptPackets)
+		}
+		// the queues are all there is to tell of the traffic when degraded
+		if k := r.Data.KernelTCP; k != nil && (snapshot.Degraded || k.SendQueue >= bloatedQueue || k.RecvQueue >= bloatedQueue) {
+			conn += fmt.Sprintf(" [queues %s recv / %s send]", humanize.IBytes(uint64(k.RecvQueue)), humanize.IBytes(uint64(k.SendQueue)))
+		}
+		rtt := "-"
+		if r.Data.RTT > 0 {
+			rtt = r.Data.RTT.Round(100 * time.Microsecond).String()
+		}
+		if snapshot.Degraded {
+			up, down = "-", "-"
+		}
+		age := r.Data.Duration().Round(time.Second).String()
+		rows = append(rows, []string{conn, r.Data.ProcessName, up + " / " + down, age + " / " + rtt})
 	}
 
-	header := []string{"Connections", "<Pid>:Process", "Up / Down"}
-	tv.connections.Rows = [][]string{header, make([]string, 3)}
+	header := []string{"Connections", tv.processColumn(), "Up / Down", "Age / RTT"}
+	tv.connections.Rows = [][]string{header, make([]string, 4)}
 	tv.connections.Rows = append(tv.connections.Rows, rows...)
 }
 
@@ -447,18 +958,69 @@ func (tv *TableViewer) newGrid(width, height int) *termui.Grid {
 	tv.tableRef[(tv.shiftIdx+2)%num].ColumnWidths = []int{w * 2, w * 2, (w * 2) - 1}
 	tv.tableRef[(tv.shiftIdx+3)%num].ColumnWidths = []int{w * 6, w * 3, (w * 3) - 1}
 
+	// the connections table has an extra age and RTT column
+	if tv.connections == tv.tableRef[(tv.shiftIdx+3)%num] {
+		tv.connections.ColumnWidths = []int{w * 5, w * 2, w * 3, (w * 2) - 1}
+	} else {
+		tv.connections.ColumnWidths = []int{w * 2, w, w * 2, w - 1}
+	}
+
+	// the remote addresses have an extra location column once located
+	if tv.geoip || tv.asn {
+		if tv.remoteAddrs == tv.tableRef[(tv.shiftIdx+3)%num] {
+			tv.remoteAddrs.ColumnWidths = []int{w * 4, w * 3, w * 2, (w * 3) - 1}
+		} else {
+			tv.remoteAddrs.ColumnWidths = []int{w * 2, w * 2, w, w - 1}
+		}
+	}
+
 	grid.Set(
 		termui.NewRow(0.03, termui.NewCol(1.0, tv.header)),
-		termui.NewRow(0.47,
+		termui.NewRow(0.03, termui.NewCol(1.0, tv.throughput)),
+		termui.NewRow(0.455,
 			termui.NewCol(1.0/2, tv.tableRef[(tv.shiftIdx+1)%num]),
 			termui.NewCol(1.0/2, tv.tableRef[(tv.shiftIdx+2)%num]),
 		),
-		termui.NewRow(0.47, termui.NewCol(1.0, tv.tableRef[(tv.shiftIdx+3)%num])),
+		termui.NewRow(0.455, termui.NewCol(1.0, tv.tableRef[(tv.shiftIdx+3)%num])),
 		termui.NewRow(0.03, termui.NewCol(1.0, tv.footer)),
 	)
 	return grid
 }
 
+// ShiftAggregate shows the interfaces in place of the remote addresses, then the remote
+// ports, the countries and the autonomous systems if looked up and then the remote
+// addresses again in turn.
+func (tv *TableViewer) ShiftAggregate() {
+	cycle := []*widgets.Table{tv.remoteAddrs, tv.interfaces, tv.remotePorts}
+	if tv.geoip {
+		cycle = append(cycle, tv.countries)
+	}
+	if tv.asn {
+		cycle = append(cycle, tv.asns)
+	}
+	for i, table := range tv.tableRef {
+		for j, t := range cycle {
+			if table == t {
+				tv.tableRef[i] = cycle[(j+1)%len(cycle)]
+				break
+			}
+		}
+	}
+	width, height := termui.TerminalDimensions()
+	tv.grid = tv.newGrid(width, height)
+	termui.Render(tv.grid)
+}
+
+// ShiftSort ranks the tables by the next sort key.
+func (tv *TableViewer) ShiftSort() {
+	tv.sortKey = tv.sortKey.next()
+}
+
+// SortByRTT toggles sorting the connections by their round-trip times.
+func (tv *TableViewer) SortByRTT() {
+	tv.sortByRTT = !tv.sortByRTT
+}
+
 func (tv *TableViewer) Shift() {
 	tv.shiftIdx++
 	width, height := termui.TerminalDimensions()
@@ -477,8 +1039,17 @@ func (tv *TableViewer) Render(stats interface{}) {
 		return
 	}
 	tv.updateHeader(snapshot)
+	tv.throughput.Text = tv.getThroughputText(snapshot.Throughput)
 	tv.updateProcesses(snapshot)
+	tv.updateUsers(snapshot)
+	tv.updateContainers(snapshot)
+	tv.updateCategories(snapshot)
+	tv.updateApplications(snapshot)
 	tv.updateRemoteAddrs(snapshot)
+	tv.updateInterfaces(snapshot)
+	tv.updateRemotePorts(snapshot)
+	tv.updateCountries(snapshot)
+	tv.updateASNs(snapshot)
 	tv.updateConnections(snapshot)
 	termui.Render(tv.grid)
 }
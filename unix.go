@@ -0,0 +1,74 @@
+package sniffer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// UnixSocket is an endpoint of a UNIX domain socket.
+type UnixSocket struct {
+	Inode       uint32
+	Type        string      // stream, dgram or seqpacket
+	Path        string      // Bound path, @ prefixed if abstract, empty if unnamed
+	Listening   bool        // Whether the socket accepts connections
+	Peer        uint32      // Inode of the connected peer, 0 if none
+	Process     ProcessInfo // Process holding the socket, zero if unknown
+	PeerProcess ProcessInfo // Process holding the peer, zero if unknown
+	RecvQueue   uint32      // Bytes queued for reading, pending connections if listening
+	SendQueue   uint32      // Bytes queued for writing, the backlog if listening
+}
+
+func (u UnixSocket) String() string {
+	path := u.Path
+	if path == "" {
+		path = "*"
+	}
+
+	peer := ""
+	switch {
+	case u.Listening:
+		peer = " (listening)"
+	case u.PeerProcess.Name != "":
+		peer = " <-> " + u.PeerProcess.String()
+	case u.Peer != 0:
+		peer = fmt.Sprintf(" <-> inode %d", u.Peer)
+	}
+	return fmt.Sprintf("%s %s%s", u.Type, path, peer)
+}
+
+// ProcessUnixSockets are the UNIX domain socket endpoints held by a process.
+type ProcessUnixSockets struct {
+	Process ProcessInfo
+	Sockets []UnixSocket
+}
+
+// groupUnixSockets groups the sockets by the process holding them, the processes
+// with the most endpoints first, then by pid. The sockets of unknown processes are
+// left out.
+func groupUnixSockets(sockets []UnixSocket) []ProcessUnixSockets {
+	byProcess := make(map[ProcessInfo][]UnixSocket)
+	for _, sock := range sockets {
+		if sock.Process.Name == "" {
+			continue
+		}
+		byProcess[sock.Process] = append(byProcess[sock.Process], sock)
+	}
+
+	groups := make([]ProcessUnixSockets, 0, len(byProcess))
+	for proc, socks := range byProcess {
+		sort.Slice(socks, func(i, j int) bool {
+			if socks[i].Path != socks[j].Path {
+				return socks[i].Path < socks[j].Path
+			}
+			return socks[i].Inode < socks[j].Inode
+		})
+		groups = append(groups, ProcessUnixSockets{Process: proc, Sockets: socks})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Sockets) != len(groups[j].Sockets) {
+			return len(groups[i].Sockets) > len(groups[j].Sockets)
+		}
+		return groups[i].Process.Pid < groups[j].Process.Pid
+	})
+	return groups
+}
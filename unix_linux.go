@@ -0,0 +1,167 @@
+//go:build linux
+// +build linux
+
+package sniffer
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sizeOfUnixDiagRequest = 40
+	sizeOfUnixDiagMsg     = 16
+
+	// the attributes of the unix_diag_msg, see linux/unix_diag.h
+	unixDiagName  = 0
+	unixDiagPeer  = 2
+	unixDiagRQLen = 4
+
+	// the attributes requested along with the unix_diag_msg
+	unixDiagShowName  = 0x01
+	unixDiagShowPeer  = 0x04
+	unixDiagShowRQLen = 0x10
+
+	unixStateListen = 10
+)
+
+// unixDiagReq sock_diag
+/* unix_diag.h
+struct unix_diag_req {
+	__u8	sdiag_family;
+	__u8	sdiag_protocol;
+	__u16	pad;
+	__u32	udiag_states;
+	__u32	udiag_ino;
+	__u32	udiag_show;
+	__u32	udiag_cookie[2];
+};
+*/
+type unixDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	Pad      uint16
+	States   uint32
+	Ino      uint32
+	Show     uint32
+	Cookie   [2]uint32
+}
+
+type unixDiagRequest struct {
+	Nlh     syscall.NlMsghdr
+	ReqDiag unixDiagReq
+}
+
+// unixDiagMsg receive msg
+/* unix_diag.h
+struct unix_diag_msg {
+	__u8	udiag_family;
+	__u8	udiag_type;
+	__u8	udiag_state;
+	__u8	pad;
+
+	__u32	udiag_ino;
+	__u32	udiag_cookie[2];
+};
+*/
+type unixDiagMsg struct {
+	Family uint8
+	Type   uint8
+	State  uint8
+	Pad    uint8
+	Ino    uint32
+	Cookie [2]uint32
+}
+
+// unixSocketType names the type of a UNIX domain socket.
+func unixSocketType(t uint8) string {
+	switch t {
+	case syscall.SOCK_STREAM:
+		return "stream"
+	case syscall.SOCK_DGRAM:
+		return "dgram"
+	case syscall.SOCK_SEQPACKET:
+		return "seqpacket"
+	}
+	return "unknown"
+}
+
+// getUnixSockets dumps the UNIX domain sockets through UNIX_DIAG, the processes
+// holding them looked up in inodeMap.
+func (nl *netlinkConn) getUnixSockets(inodeMap map[uint32]ProcessInfo) ([]UnixSocket, error) {
+	var diagReq unixDiagRequest
+	diagReq.Nlh.Type = sockDiagByFamily
+	diagReq.Nlh.Flags = unix.NLM_F_DUMP | unix.NLM_F_REQUEST
+	diagReq.ReqDiag.Family = unix.AF_UNIX
+	diagReq.ReqDiag.States = ^uint32(0)
+	diagReq.ReqDiag.Show = unixDiagShowName | unixDiagShowPeer | unixDiagShowRQLen
+	diagReq.Nlh.Len = uint32(unsafe.Sizeof(diagReq))
+
+	buffer := make([]byte, sizeOfUnixDiagRequest)
+	*(*unixDiagRequest)(unsafe.Pointer(&buffer[0])) = diagReq
+
+	fd, err := nl.sockdiagDial(buffer)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	var sockets []UnixSocket
+	err = nl.sockdiagDump(fd, func(data []byte) {
+		if len(data) < sizeOfUnixDiagMsg {
+			return
+		}
+		m := (*unixDiagMsg)(unsafe.Pointer(&data[0]))
+		attrs := data[sizeOfUnixDiagMsg:]
+
+		sock := UnixSocket{
+			Inode:     m.Ino,
+			Type:      unixSocketType(m.Type),
+			Listening: m.State == unixStateListen,
+			Process:   inodeMap[m.Ino],
+		}
+
+		// the abstract names start with a NUL, the paths may end with one
+		if name := nl.diagAttr(attrs, unixDiagName); len(name) > 0 {
+			if name[0] == 0 {
+				sock.Path = "@" + string(name[1:])
+			} else {
+				sock.Path = strings.TrimRight(string(name), "\x00")
+			}
+		}
+		if peer := nl.diagAttr(attrs, unixDiagPeer); len(peer) >= 4 {
+			sock.Peer = getNativeEndian().Uint32(peer)
+			sock.PeerProcess = inodeMap[sock.Peer]
+		}
+		if rqlen := nl.diagAttr(attrs, unixDiagRQLen); len(rqlen) >= 8 {
+			sock.RecvQueue = getNativeEndian().Uint32(rqlen[0:4])
+			sock.SendQueue = getNativeEndian().Uint32(rqlen[4:8])
+		}
+		sockets = append(sockets, sock)
+	})
+	return sockets, err
+}
+
+// ListUnixSockets returns the UNIX domain socket endpoints of the processes, grouped
+// by process.
+func ListUnixSockets() ([]ProcessUnixSockets, error) {
+	nl := &netlinkConn{}
+	pids, err := nl.listPids()
+	if err != nil {
+		return nil, err
+	}
+
+	inodeMap, err := nl.getAllProcsInodes(context.Background(), pids...)
+	if err != nil {
+		return nil, err
+	}
+	sockets, err := nl.getUnixSockets(inodeMap)
+	if err != nil {
+		return nil, err
+	}
+	return groupUnixSockets(sockets), nil
+}
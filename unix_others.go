@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package sniffer
+
+import "errors"
+
+// ListUnixSockets is only supported on Linux, through the sock_diag netlink family.
+func ListUnixSockets() ([]ProcessUnixSockets, error) {
+	return nil, errors.New("unix socket diagnostics are only supported on Linux")
+}
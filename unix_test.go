@@ -0,0 +1,30 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupUnixSockets(t *testing.T) {
+	docker := ProcessInfo{Pid: 900, Name: "dockerd"}
+	client := ProcessInfo{Pid: 1200, Name: "docker"}
+
+	sockets := []UnixSocket{
+		{Inode: 11, Type: "stream", Path: "/run/docker.sock", Listening: true, Process: docker},
+		{Inode: 12, Type: "stream", Path: "/run/docker.sock", Peer: 21, Process: docker, PeerProcess: client},
+		{Inode: 21, Type: "stream", Peer: 12, Process: client, PeerProcess: docker},
+		{Inode: 30, Type: "dgram", Path: "@journal"},
+	}
+
+	groups := groupUnixSockets(sockets)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, docker, groups[0].Process)
+	assert.Len(t, groups[0].Sockets, 2)
+	assert.Equal(t, client, groups[1].Process)
+
+	assert.Equal(t, "stream /run/docker.sock (listening)", groups[0].Sockets[0].String())
+	assert.Equal(t, "stream /run/docker.sock <-> <1200>:docker", groups[0].Sockets[1].String())
+	assert.Equal(t, "stream * <-> <900>:dockerd", groups[1].Sockets[0].String())
+	assert.Equal(t, "dgram @journal <-> inode 7", UnixSocket{Type: "dgram", Path: "@journal", Peer: 7}.String())
+}
@@ -0,0 +1,130 @@
+package sniffer
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/shirou/gopsutil/process"
+)
+
+// watchedProc is a process of the process tree.
+type watchedProc struct {
+	pid  int
+	ppid int
+	name string
+}
+
+// processWatch restricts the stats to the process watched, by its pid or by a pattern
+// of its name, and to its children, as the process tree tells them on each interval.
+type processWatch struct {
+	pid  int    // Pid of the process watched, none if 0
+	name string // Pattern of filepath.Match of the names of the processes watched, none if empty
+
+	list func() ([]watchedProc, error) // Lists the processes of the tree
+	pids map[int]bool                  // Pids watched as of the latest refresh
+}
+
+// newProcessWatch returns the watch of the pid and of the name pattern, or nil if both
+// are empty.
+func newProcessWatch(pid int, name string) (*processWatch, error) {
+	if pid == 0 && name == "" {
+		return nil, nil
+	}
+	if pid < 0 {
+		return nil, fmt.Errorf("invalid pid %d to watch", pid)
+	}
+	if _, err := filepath.Match(name, ""); err != nil {
+		return nil, fmt.Errorf("invalid process name pattern %q to watch", name)
+	}
+	return &processWatch{pid: pid, name: name, list: listProcesses, pids: make(map[int]bool)}, nil
+}
+
+// listProcesses lists the processes of the host along with their parents.
+func listProcesses() ([]watchedProc, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]watchedProc, 0, len(procs))
+	for _, p := range procs {
+		ppid, err := p.Ppid()
+		if err != nil {
+			continue
+		}
+		name, _ := p.Name()
+		list = append(list, watchedProc{pid: int(p.Pid), ppid: int(ppid), name: name})
+	}
+	return list, nil
+}
+
+// isRoot reports whether the process is watched by its pid or its name, its children
+// being watched along with it.
+func (w *processWatch) isRoot(pid int, name string) bool {
+	if w.pid != 0 && pid == w.pid {
+		return true
+	}
+	if w.name == "" {
+		return false
+	}
+	ok, _ := filepath.Match(w.name, name)
+	return ok
+}
+
+// refresh walks the process tree down from the processes watched, keeping the pids
+// watched so far if the processes can't be listed.
+func (w *processWatch) refresh() {
+	procs, err := w.list()
+	if err != nil {
+		return
+	}
+
+	children := make(map[int][]int)
+	var pending []int
+	for _, p := range procs {
+		children[p.ppid] = append(children[p.ppid], p.pid)
+		if w.isRoot(p.pid, p.name) {
+			pending = append(pending, p.pid)
+		}
+	}
+	pids := make(map[int]bool)
+	for len(pending) > 0 {
+		pid := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if pids[pid] {
+			continue
+		}
+		pids[pid] = true
+		pending = append(pending, children[pid]...)
+	}
+	w.pids = pids
+}
+
+// watches reports whether the process is watched, the one of the pid or the name or
+// one of its children.
+func (w *processWatch) watches(p *ProcessInfo) bool {
+	if p == nil {
+		return false
+	}
+	return w.pids[p.Pid] || w.isRoot(p.Pid, p.Name)
+}
+
+// watched returns the sorted pids watched as of the latest refresh.
+func (w *processWatch) watched() []int {
+	pids := make([]int, 0, len(w.pids))
+	for pid := range w.pids {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+func (w *processWatch) String() string {
+	switch {
+	case w.name == "":
+		return fmt.Sprintf("pid %d", w.pid)
+	case w.pid == 0:
+		return w.name
+	}
+	return fmt.Sprintf("pid %d and %s", w.pid, w.name)
+}
@@ -0,0 +1,67 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessWatch(t *testing.T) {
+	w, err := newProcessWatch(0, "")
+	assert.NoError(t, err)
+	assert.Nil(t, w)
+	_, err = newProcessWatch(0, "[")
+	assert.Error(t, err)
+
+	w, err = newProcessWatch(10, "")
+	assert.NoError(t, err)
+	w.list = func() ([]watchedProc, error) {
+		return []watchedProc{
+			{pid: 1, ppid: 0, name: "init"},
+			{pid: 10, ppid: 1, name: "make"},
+			{pid: 11, ppid: 10, name: "cc"},
+			{pid: 12, ppid: 11, name: "ld"},
+			{pid: 20, ppid: 1, name: "curl"},
+		}, nil
+	}
+	w.refresh()
+
+	// the children of the children are watched too
+	assert.Equal(t, []int{10, 11, 12}, w.watched())
+	assert.True(t, w.watches(&ProcessInfo{Pid: 12, Name: "ld"}))
+	assert.False(t, w.watches(&ProcessInfo{Pid: 20, Name: "curl"}))
+	assert.False(t, w.watches(nil))
+	assert.Equal(t, "pid 10", w.String())
+}
+
+func TestSnapshotWatch(t *testing.T) {
+	makeProc := &ProcessInfo{Pid: 10, Name: "make"}
+	cc := &ProcessInfo{Pid: 11, Name: "cc"}
+	curl := &ProcessInfo{Pid: 20, Name: "curl"}
+	stat := Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}, Remote: RemoteSocket{IP: "1.1.1.1"}}: {Process: makeProc, UploadBytes: 400},
+		{Local: LocalSocket{Port: 2}, Remote: RemoteSocket{IP: "2.2.2.2"}}: {Process: cc, UploadBytes: 200},
+		{Local: LocalSocket{Port: 3}, Remote: RemoteSocket{IP: "3.3.3.3"}}: {Process: curl, UploadBytes: 800},
+	}}
+
+	s := NewStatsManager(Options{Interval: 2, WatchProcessName: "mak*"})
+	s.watch.list = func() ([]watchedProc, error) {
+		return []watchedProc{{pid: 10, ppid: 1, name: "make"}, {pid: 11, ppid: 10, name: "cc"}, {pid: 20, ppid: 1, name: "curl"}}, nil
+	}
+	s.put(stat, time.Now())
+	snapshot := s.getSnapshot()
+
+	assert.Len(t, snapshot.Processes, 2)
+	assert.Len(t, snapshot.Connections, 2)
+	assert.Len(t, snapshot.RemoteAddrs, 2)
+	assert.Equal(t, 300, snapshot.TotalUploadBytes)
+	assert.Equal(t, "mak*", snapshot.Watch)
+	assert.Equal(t, []int{10, 11}, snapshot.Watched)
+
+	s.SetViewMode(ModePlotProcesses)
+	assert.Equal(t, 2, s.GetStats().(*NetworkData).ConnCount)
+
+	opt := Options{Interval: 1, Rows: 1, Unit: UnitKB, SortKey: SortTotal, WatchPID: 10, Mirror: true}
+	assert.Error(t, opt.Validate())
+}
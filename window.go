@@ -0,0 +1,107 @@
+package sniffer
+
+import "time"
+
+// windowedStat is the stats of an interval within the window.
+type windowedStat struct {
+	end     time.Time // When the interval ended
+	elapsed time.Duration
+	stat    Stat
+}
+
+// statWindow sums the stats of the intervals ended within a sliding window up, apart
+// from the refresh interval.
+type statWindow struct {
+	length time.Duration
+	stats  []windowedStat // Stats of the intervals within the window, the oldest first
+}
+
+func newStatWindow(length time.Duration) *statWindow {
+	return &statWindow{length: length}
+}
+
+// put adds the stats of the interval elapsed until now, dropping the intervals ended
+// out of the window, and returns the stats of the window along with the time they
+// were counted over. The latest interval is always kept.
+func (w *statWindow) put(stat Stat, elapsed time.Duration, now time.Time) (Stat, time.Duration) {
+	w.stats = append(w.stats, windowedStat{end: now, elapsed: elapsed, stat: stat})
+	expired := 0
+	for expired < len(w.stats)-1 && now.Sub(w.stats[expired].end) >= w.length {
+		expired++
+	}
+	w.stats = append(w.stats[:0], w.stats[expired:]...)
+
+	return w.sum()
+}
+
+// sum sums the traffic of the connections and the packets of the neighbors up over the
+// window, the rest being of the latest interval.
+func (w *statWindow) sum() (Stat, time.Duration) {
+	sum := w.stats[len(w.stats)-1].stat
+	sum.Utilization = make(Utilization)
+	sum.Neighbors = make(Neighbors)
+
+	var elapsed time.Duration
+	for _, ws := range w.stats {
+		elapsed += ws.elapsed
+		for conn, info := range ws.stat.Utilization {
+			if total, ok := sum.Utilization[conn]; ok {
+				total.merge(info)
+				continue
+			}
+			cloned := *info
+			sum.Utilization[conn] = &cloned
+		}
+		for neighbor, info := range ws.stat.Neighbors {
+			if total, ok := sum.Neighbors[neighbor]; ok {
+				total.Interface = info.Interface
+				total.Requests += info.Requests
+				total.Replies += info.Replies
+				continue
+			}
+			cloned := *info
+			sum.Neighbors[neighbor] = &cloned
+		}
+	}
+	return sum, elapsed
+}
+
+// merge counts the traffic of the connection over a later interval in, taking its
+// latest state.
+func (c *ConnectionInfo) merge(later *ConnectionInfo) {
+	firstSeen := c.FirstSeen
+	c.FlowInfo = later.FlowInfo
+	if !firstSeen.IsZero() {
+		c.FirstSeen = firstSeen
+	}
+	if later.Process != nil {
+		c.Process = later.Process
+	}
+	if later.KernelTCP != nil {
+		c.KernelTCP = later.KernelTCP
+	}
+	if later.Location != nil {
+		c.Location = later.Location
+	}
+	c.Interface = later.Interface
+	c.TCPState = later.TCPState
+	if c.Process != nil && c.Process.Pid != 0 {
+		c.Unattributed = ""
+	} else {
+		c.Unattributed = later.Unattributed
+	}
+
+	c.UploadPackets += later.UploadPackets
+	c.DownloadPackets += later.DownloadPackets
+	c.UploadBytes += later.UploadBytes
+	c.DownloadBytes += later.DownloadBytes
+	c.UploadPayloadBytes += later.UploadPayloadBytes
+	c.DownloadPayloadBytes += later.DownloadPayloadBytes
+	c.RetransmittedPackets += later.RetransmittedPackets
+	c.RetransmittedBytes += later.RetransmittedBytes
+	c.LocalZeroWindows += later.LocalZeroWindows
+	c.RemoteZeroWindows += later.RemoteZeroWindows
+	c.DupACKs += later.DupACKs
+	c.OutOfOrderPackets += later.OutOfOrderPackets
+	c.CorruptPackets += later.CorruptPackets
+}
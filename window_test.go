@@ -0,0 +1,99 @@
+package sniffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatWindow(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	neighbor := Neighbor{MAC: "00:11:22:33:44:55", IP: "10.0.0.2"}
+	stat := func(upload int, state TCPState) Stat {
+		return Stat{
+			Utilization: Utilization{conn: {UploadBytes: upload, TCPState: state}},
+			Neighbors:   Neighbors{neighbor: {Requests: 1}},
+		}
+	}
+
+	w := newStatWindow(3 * time.Second)
+	now := time.Now()
+	w.put(stat(1000, TCPStateEstablished), time.Second, now)
+	w.put(stat(2000, TCPStateEstablished), time.Second, now.Add(time.Second))
+	sum, elapsed := w.put(stat(3000, TCPStateClosed), time.Second, now.Add(2*time.Second))
+	assert.Equal(t, 3*time.Second, elapsed)
+	assert.Equal(t, 6000, sum.Utilization[conn].UploadBytes)
+	assert.Equal(t, TCPStateClosed, sum.Utilization[conn].TCPState)
+	assert.Equal(t, 3, sum.Neighbors[neighbor].Requests)
+
+	// the first interval ended out of the window, the stats put are left as they are
+	sum, elapsed = w.put(Stat{}, time.Second, now.Add(3*time.Second))
+	assert.Equal(t, 3*time.Second, elapsed)
+	assert.Equal(t, 5000, sum.Utilization[conn].UploadBytes)
+	assert.Equal(t, 2000, w.stats[0].stat.Utilization[conn].UploadBytes)
+
+	// the latest interval is kept however long
+	sum, elapsed = w.put(stat(500, TCPStateEstablished), time.Minute, now.Add(time.Hour))
+	assert.Equal(t, time.Minute, elapsed)
+	assert.Equal(t, 500, sum.Utilization[conn].UploadBytes)
+}
+
+func TestSnapshotWindow(t *testing.T) {
+	conn := Connection{
+		Local:  LocalSocket{IP: "10.0.0.1", Port: 50000, Protocol: ProtoTCP},
+		Remote: RemoteSocket{IP: "1.1.1.1", Port: 443},
+	}
+	stat := func(upload int) Stat {
+		return Stat{Utilization: Utilization{conn: {
+			Process:     &ProcessInfo{Pid: 1, Name: "curl"},
+			UploadBytes: upload,
+		}}}
+	}
+
+	s := NewStatsManager(Options{Interval: 1, ViewMode: ModeTableBytes, Window: 4 * time.Second})
+	now := time.Now()
+	for i, upload := range []int{4000, 0, 4000, 0} {
+		s.put(stat(upload), now.Add(time.Duration(i)*time.Second))
+	}
+
+	snapshot := s.getSnapshot()
+	assert.Equal(t, 4*time.Second, snapshot.Elapsed)
+	assert.Equal(t, 2000, snapshot.Connections[conn].UploadBytes)
+	assert.Equal(t, 2000.0, snapshot.Connections[conn].UploadRate)
+	assert.Equal(t, 2000, snapshot.TotalUploadBytes)
+	// the peaks go by the intervals one by one
+	assert.Equal(t, 4000.0, snapshot.Connections[conn].PeakUploadRate)
+}
+
+func TestSnapshotEvictIdle(t *testing.T) {
+	now := time.Now()
+	curl := &ProcessInfo{Pid: 1, Name: "curl"}
+	s := NewStatsManager(Options{Interval: 1, ViewMode: ModeTableBytes, Window: time.Minute, IdleTimeout: 10 * time.Second})
+
+	s.put(Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 1}}: {Process: curl, UploadBytes: 100, FlowInfo: FlowInfo{LastSeen: now}},
+	}}, now)
+	s.put(Stat{Utilization: Utilization{
+		{Local: LocalSocket{Port: 2}}: {Process: curl, UploadBytes: 100, FlowInfo: FlowInfo{LastSeen: now.Add(20 * time.Second)}},
+	}}, now.Add(20*time.Second))
+	snapshot := s.getSnapshot()
+
+	// the idle connection is gone from every table, its traffic staying in the totals
+	assert.Len(t, snapshot.Connections, 1)
+	assert.Equal(t, 1, snapshot.EvictedConnections)
+	assert.NotNil(t, snapshot.Connections[Connection{Local: LocalSocket{Port: 2}}])
+	assert.Equal(t, 1, snapshot.Processes["<1>:curl"].ConnCount)
+	assert.Equal(t, 1, snapshot.TotalConnections)
+	assert.Equal(t, 9, snapshot.TotalUploadBytes)
+	assert.Equal(t, 4, snapshot.Processes["<1>:curl"].UploadBytes)
+
+	// the stats of an interval are all recent without a window
+	opt := Options{Interval: 1, Rows: 1, Unit: UnitKB, SortKey: SortTotal, IdleTimeout: 10 * time.Second}
+	assert.Error(t, opt.Validate())
+	opt.Window = time.Minute
+	assert.NoError(t, opt.Validate())
+}